@@ -0,0 +1,97 @@
+package fakepinger
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+
+	pb "github.com/umenosuke/ping-grpc-client/proto/pingGrpc"
+	"github.com/umenosuke/pinger4"
+)
+
+// Behavior is how a simulated target answers.
+type Behavior struct {
+	//応答が無い(Timeout)割合(%)
+	LossPercent float64
+	//RTTの平均
+	RTTMean time.Duration
+	//RTTの標準偏差(正規分布)
+	RTTJitter time.Duration
+	//TTL Exceeded が返ってくる割合(%)
+	TTLExceededPercent float64
+	//TTL Exceeded を返すルーター
+	TTLExceededFrom string
+	//タイムアウト後に応答が返ってくる割合(%)
+	LatePercent float64
+}
+
+// DefaultBehavior is a stable target with about 10ms RTT.
+func DefaultBehavior() Behavior {
+	return Behavior{
+		RTTMean:   10 * time.Millisecond,
+		RTTJitter: 2 * time.Millisecond,
+	}
+}
+
+// outcome is the simulated answer of a single probe.
+type outcome struct {
+	resultType pb.IcmpResult_ResultType
+	rtt        time.Duration
+	peerIP     net.IP
+}
+
+func (b Behavior) roll(r *rand.Rand, timeout time.Duration) outcome {
+	p := r.Float64() * 100
+
+	if p < b.LossPercent {
+		return outcome{resultType: pb.IcmpResult_IcmpResultTypeTimeout, rtt: timeout}
+	}
+	p -= b.LossPercent
+
+	if p < b.TTLExceededPercent {
+		return outcome{
+			resultType: pb.IcmpResult_IcmpResultTypeTTLExceeded,
+			rtt:        b.rtt(r) / 2,
+			peerIP:     net.ParseIP(b.TTLExceededFrom),
+		}
+	}
+	p -= b.TTLExceededPercent
+
+	if p < b.LatePercent {
+		late := timeout + time.Duration(r.Int63n(int64(timeout)/2+1))
+		return outcome{resultType: pb.IcmpResult_IcmpResultTypeReceiveAfterTimeout, rtt: late}
+	}
+
+	rtt := b.rtt(r)
+	if rtt > timeout {
+		return outcome{resultType: pb.IcmpResult_IcmpResultTypeReceiveAfterTimeout, rtt: rtt}
+	}
+	return outcome{resultType: pb.IcmpResult_IcmpResultTypeReceive, rtt: rtt}
+}
+
+func (b Behavior) rtt(r *rand.Rand) time.Duration {
+	rtt := float64(b.RTTMean) + r.NormFloat64()*float64(b.RTTJitter)
+	return time.Duration(math.Max(rtt, float64(100*time.Microsecond)))
+}
+
+// resolve returns the address of the target.
+// Names are resolved to a stable address in 198.18.0.0/15 without DNS.
+func resolve(targetIP string) net.IP {
+	if ip := net.ParseIP(targetIP).To4(); ip != nil {
+		return ip
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(targetIP))
+	sum := h.Sum32()
+	return net.IPv4(198, 18+byte(sum>>16)&0x01, byte(sum>>8), byte(sum)).To4()
+}
+
+func binIP(ip net.IP) uint32 {
+	if ip.To4() == nil {
+		return 0
+	}
+	return uint32(pinger4.NetIP2BinIPv4Address(ip.To4()))
+}
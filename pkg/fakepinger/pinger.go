@@ -0,0 +1,171 @@
+package fakepinger
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/umenosuke/ping-grpc-client/proto/pingGrpc"
+)
+
+const subscriberBufferSize = 1000
+
+type pinger struct {
+	info      *pb.PingerInfo
+	behaviors map[uint32]Behavior
+	roll      func(Behavior, time.Duration) outcome
+
+	stopOnce sync.Once
+	chStop   chan struct{}
+	done     chan struct{}
+
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[chan *pb.IcmpResult]struct{}
+	//対象ごとの直近StatisticsCountsNum回の成否
+	history map[uint32][]bool
+}
+
+func newPinger(info *pb.PingerInfo, behaviors map[uint32]Behavior, roll func(Behavior, time.Duration) outcome) *pinger {
+	return &pinger{
+		info:        info,
+		behaviors:   behaviors,
+		roll:        roll,
+		chStop:      make(chan struct{}),
+		done:        make(chan struct{}),
+		subscribers: make(map[chan *pb.IcmpResult]struct{}),
+		history:     make(map[uint32][]bool),
+	}
+}
+
+func (thisPinger *pinger) stop() {
+	thisPinger.stopOnce.Do(func() { close(thisPinger.chStop) })
+}
+
+// run sends probes until stop or expire.
+func (thisPinger *pinger) run() {
+	defer close(thisPinger.done)
+	defer (func() {
+		thisPinger.mu.Lock()
+		thisPinger.closed = true
+		thisPinger.mu.Unlock()
+	})()
+
+	interval := time.Duration(thisPinger.info.GetIntervalMillisec()) * time.Millisecond
+	timeout := time.Duration(thisPinger.info.GetTimeoutMillisec()) * time.Millisecond
+	expire := time.Unix(0, int64(thisPinger.info.GetExpireUnixNanosec()))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	expireTimer := time.NewTimer(time.Until(expire))
+	defer expireTimer.Stop()
+
+	var sequence int64
+	for {
+		for _, t := range thisPinger.info.GetTargets() {
+			thisPinger.probe(t.GetTargetID(), sequence, timeout)
+		}
+		sequence++
+
+		select {
+		case <-thisPinger.chStop:
+			return
+		case <-expireTimer.C:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (thisPinger *pinger) probe(targetID uint32, sequence int64, timeout time.Duration) {
+	out := thisPinger.roll(thisPinger.behaviors[targetID], timeout)
+	send := time.Now()
+
+	newResult := func(resultType pb.IcmpResult_ResultType, after time.Duration) *pb.IcmpResult {
+		return &pb.IcmpResult{
+			Type:                   resultType,
+			TargetID:               targetID,
+			BinPeerIP:              binIP(out.peerIP),
+			Sequence:               sequence,
+			SendTimeUnixNanosec:    send.UnixNano(),
+			ReceiveTimeUnixNanosec: send.Add(after).UnixNano(),
+		}
+	}
+
+	switch out.resultType {
+	case pb.IcmpResult_IcmpResultTypeReceiveAfterTimeout:
+		// 実際のpingerと同様、まずTimeoutが出てから遅れて応答が届く
+		time.AfterFunc(timeout, func() {
+			thisPinger.publish(newResult(pb.IcmpResult_IcmpResultTypeTimeout, timeout))
+		})
+		time.AfterFunc(out.rtt, func() {
+			thisPinger.publish(newResult(pb.IcmpResult_IcmpResultTypeReceiveAfterTimeout, out.rtt))
+		})
+	default:
+		time.AfterFunc(out.rtt, func() {
+			thisPinger.publish(newResult(out.resultType, out.rtt))
+		})
+	}
+}
+
+func (thisPinger *pinger) publish(res *pb.IcmpResult) {
+	thisPinger.mu.Lock()
+	defer thisPinger.mu.Unlock()
+
+	if thisPinger.closed {
+		return
+	}
+
+	if res.GetType() != pb.IcmpResult_IcmpResultTypeReceiveAfterTimeout {
+		num := int(thisPinger.info.GetStatisticsCountsNum())
+		h := append(thisPinger.history[res.GetTargetID()], res.GetType() == pb.IcmpResult_IcmpResultTypeReceive)
+		if len(h) > num {
+			h = h[len(h)-num:]
+		}
+		thisPinger.history[res.GetTargetID()] = h
+	}
+
+	for ch := range thisPinger.subscribers {
+		select {
+		case ch <- res:
+		default:
+			// 読み出しの遅い購読者の分は捨てる
+		}
+	}
+}
+
+func (thisPinger *pinger) subscribe() chan *pb.IcmpResult {
+	thisPinger.mu.Lock()
+	defer thisPinger.mu.Unlock()
+
+	ch := make(chan *pb.IcmpResult, subscriberBufferSize)
+	thisPinger.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (thisPinger *pinger) unsubscribe(ch chan *pb.IcmpResult) {
+	thisPinger.mu.Lock()
+	defer thisPinger.mu.Unlock()
+
+	delete(thisPinger.subscribers, ch)
+}
+
+func (thisPinger *pinger) statistics() *pb.Statistics {
+	thisPinger.mu.Lock()
+	defer thisPinger.mu.Unlock()
+
+	res := &pb.Statistics{}
+	for _, t := range thisPinger.info.GetTargets() {
+		var count int64
+		for _, ok := range thisPinger.history[t.GetTargetID()] {
+			if ok {
+				count++
+			}
+		}
+		res.Targets = append(res.Targets, &pb.Statistics_SuccessCount{
+			TargetID: t.GetTargetID(),
+			Count:    count,
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,274 @@
+// Package fakepinger is an in-process ping-grpc-server with simulated targets.
+//
+// It sends no ICMP; every result is rolled from the Behavior of the target,
+// so the client can be exercised offline and in tests.
+package fakepinger
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/umenosuke/ping-grpc-client/proto/pingGrpc"
+)
+
+const bufconnSize = 1024 * 1024
+
+// Options is the setting of a Server.
+type Options struct {
+	//乱数のシード、同じ値なら同じ結果列になる(タイミングを除く)
+	Seed int64
+	//SetBehaviorで指定されていない対象の振る舞い
+	DefaultBehavior Behavior
+}
+
+// Server is a fake pb.PingerServer.
+type Server struct {
+	pb.UnimplementedPingerServer
+
+	options Options
+
+	mu        sync.Mutex
+	rnd       *rand.Rand
+	behaviors map[string]Behavior
+	pingers   map[uint32]*pinger
+	nextID    uint32
+
+	serveOnce  sync.Once
+	listener   *bufconn.Listener
+	grpcServer *grpc.Server
+}
+
+// New returns a Server with no pingers.
+func New(options Options) *Server {
+	return &Server{
+		options:   options,
+		rnd:       rand.New(rand.NewSource(options.Seed)),
+		behaviors: make(map[string]Behavior),
+		pingers:   make(map[uint32]*pinger),
+		nextID:    1,
+	}
+}
+
+// SetBehavior sets how the target answers in pingers started after the call.
+// targetIP is matched against StartRequest_IcmpTarget.TargetIP as is.
+func (thisServer *Server) SetBehavior(targetIP string, behavior Behavior) {
+	thisServer.mu.Lock()
+	defer thisServer.mu.Unlock()
+
+	thisServer.behaviors[targetIP] = behavior
+}
+
+// Dial serves the Server on an in-memory listener and returns a connection to it.
+func (thisServer *Server) Dial(ctx context.Context, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	thisServer.serveOnce.Do(func() {
+		thisServer.listener = bufconn.Listen(bufconnSize)
+		thisServer.grpcServer = grpc.NewServer()
+		pb.RegisterPingerServer(thisServer.grpcServer, thisServer)
+		go thisServer.grpcServer.Serve(thisServer.listener)
+	})
+
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return thisServer.listener.DialContext(ctx)
+		}),
+		grpc.WithInsecure(),
+	}, opts...)
+
+	return grpc.DialContext(ctx, "bufconn", opts...)
+}
+
+// Close stops all pingers and the in-memory listener.
+func (thisServer *Server) Close() {
+	thisServer.mu.Lock()
+	pingers := make([]*pinger, 0, len(thisServer.pingers))
+	for id, p := range thisServer.pingers {
+		pingers = append(pingers, p)
+		delete(thisServer.pingers, id)
+	}
+	thisServer.mu.Unlock()
+
+	for _, p := range pingers {
+		p.stop()
+	}
+
+	if thisServer.grpcServer != nil {
+		thisServer.grpcServer.Stop()
+	}
+}
+
+// Start implements pb.PingerServer.
+func (thisServer *Server) Start(ctx context.Context, req *pb.StartRequest) (*pb.PingerID, error) {
+	if len(req.GetTargets()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no targets")
+	}
+	if req.GetIntervalMillisec() == 0 || req.GetTimeoutMillisec() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "IntervalMillisec and TimeoutMillisec must be greater than 0")
+	}
+
+	thisServer.mu.Lock()
+	id := thisServer.nextID
+	thisServer.nextID++
+
+	now := time.Now()
+	info := &pb.PingerInfo{
+		Description:           req.GetDescription(),
+		Targets:               make([]*pb.PingerInfo_IcmpTarget, 0, len(req.GetTargets())),
+		IntervalMillisec:      req.GetIntervalMillisec(),
+		TimeoutMillisec:       req.GetTimeoutMillisec(),
+		StatisticsCountsNum:   req.GetStatisticsCountsNum(),
+		StatisticsIntervalSec: req.GetStatisticsIntervalSec(),
+		StartUnixNanosec:      uint64(now.UnixNano()),
+		ExpireUnixNanosec:     uint64(now.Add(time.Duration(req.GetStopPingerSec()) * time.Second).UnixNano()),
+	}
+	behaviors := make(map[uint32]Behavior, len(req.GetTargets()))
+	for i, t := range req.GetTargets() {
+		targetID := uint32(i + 1)
+		info.Targets = append(info.Targets, &pb.PingerInfo_IcmpTarget{
+			TargetIP:    t.GetTargetIP(),
+			TargetBinIP: resolve(t.GetTargetIP()).String(),
+			Comment:     t.GetComment(),
+			TargetID:    targetID,
+		})
+		if b, ok := thisServer.behaviors[t.GetTargetIP()]; ok {
+			behaviors[targetID] = b
+		} else {
+			behaviors[targetID] = thisServer.options.DefaultBehavior
+		}
+	}
+
+	p := newPinger(info, behaviors, thisServer.roll)
+	thisServer.pingers[id] = p
+	thisServer.mu.Unlock()
+
+	go (func() {
+		p.run()
+		thisServer.mu.Lock()
+		if thisServer.pingers[id] == p {
+			delete(thisServer.pingers, id)
+		}
+		thisServer.mu.Unlock()
+	})()
+
+	return &pb.PingerID{PingerID: id}, nil
+}
+
+// Stop implements pb.PingerServer.
+func (thisServer *Server) Stop(ctx context.Context, req *pb.PingerID) (*pb.Null, error) {
+	thisServer.mu.Lock()
+	p, ok := thisServer.pingers[req.GetPingerID()]
+	delete(thisServer.pingers, req.GetPingerID())
+	thisServer.mu.Unlock()
+
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "pinger %d not found", req.GetPingerID())
+	}
+	p.stop()
+
+	return &pb.Null{}, nil
+}
+
+// GetPingerList implements pb.PingerServer.
+func (thisServer *Server) GetPingerList(ctx context.Context, req *pb.Null) (*pb.PingerList, error) {
+	thisServer.mu.Lock()
+	defer thisServer.mu.Unlock()
+
+	list := &pb.PingerList{}
+	for id, p := range thisServer.pingers {
+		list.Pingers = append(list.Pingers, &pb.PingerList_PingerSumally{
+			PingerID:          id,
+			Description:       p.info.GetDescription(),
+			StartUnixNanosec:  p.info.GetStartUnixNanosec(),
+			ExpireUnixNanosec: p.info.GetExpireUnixNanosec(),
+		})
+	}
+
+	return list, nil
+}
+
+// GetPingerInfo implements pb.PingerServer.
+func (thisServer *Server) GetPingerInfo(ctx context.Context, req *pb.PingerID) (*pb.PingerInfo, error) {
+	p, err := thisServer.lookup(req.GetPingerID())
+	if err != nil {
+		return nil, err
+	}
+
+	return p.info, nil
+}
+
+// GetsIcmpResult implements pb.PingerServer.
+func (thisServer *Server) GetsIcmpResult(req *pb.PingerID, stream pb.Pinger_GetsIcmpResultServer) error {
+	p, err := thisServer.lookup(req.GetPingerID())
+	if err != nil {
+		return err
+	}
+
+	ch := p.subscribe()
+	defer p.unsubscribe(ch)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-p.done:
+			return nil
+		case res := <-ch:
+			if err := stream.Send(res); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GetsStatistics implements pb.PingerServer.
+func (thisServer *Server) GetsStatistics(req *pb.PingerID, stream pb.Pinger_GetsStatisticsServer) error {
+	p, err := thisServer.lookup(req.GetPingerID())
+	if err != nil {
+		return err
+	}
+
+	interval := time.Duration(p.info.GetStatisticsIntervalSec()) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-p.done:
+			return nil
+		case <-ticker.C:
+			if err := stream.Send(p.statistics()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (thisServer *Server) lookup(pingerID uint32) (*pinger, error) {
+	thisServer.mu.Lock()
+	defer thisServer.mu.Unlock()
+
+	p, ok := thisServer.pingers[pingerID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "pinger %d not found", pingerID)
+	}
+	return p, nil
+}
+
+func (thisServer *Server) roll(b Behavior, timeout time.Duration) outcome {
+	thisServer.mu.Lock()
+	defer thisServer.mu.Unlock()
+
+	return b.roll(thisServer.rnd, timeout)
+}
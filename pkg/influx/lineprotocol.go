@@ -0,0 +1,99 @@
+// Package influx converts pinger results and statistics into InfluxDB
+// line protocol and writes them to an io.Writer or an /api/v2/write endpoint.
+package influx
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// Default measurement names.
+const (
+	DefaultResultMeasurement     = "ping_result"
+	DefaultStatisticsMeasurement = "ping_statistics"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+	stringFieldEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+type field struct {
+	key   string
+	value string
+}
+
+func line(measurement string, pingerID uint32, t pingclient.Target, fields []field, unixNanosec int64) string {
+	b := &strings.Builder{}
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	// タグはキーの順に並べる、空の値は書けない
+	tags := []field{
+		{key: "comment", value: t.Comment},
+		{key: "fqdn", value: t.FQDN()},
+		{key: "pinger_id", value: strconv.FormatUint(uint64(pingerID), 10)},
+		{key: "target_id", value: strconv.FormatUint(uint64(t.TargetID), 10)},
+		{key: "target_ip", value: t.TargetBinIP},
+	}
+	for _, tag := range tags {
+		if tag.value == "" {
+			continue
+		}
+		b.WriteString("," + tag.key + "=" + tagEscaper.Replace(tag.value))
+	}
+
+	for i, f := range fields {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(f.key + "=" + f.value)
+	}
+
+	b.WriteString(" " + strconv.FormatInt(unixNanosec, 10))
+	return b.String()
+}
+
+func stringField(str string) string {
+	return "\"" + stringFieldEscaper.Replace(str) + "\""
+}
+
+// ResultLine returns the line of a result, timestamped with ReceiveTimeUnixNanosec.
+// rtt_ms is written only for replies and peer_ip only for TTL exceeded.
+func ResultLine(measurement string, r pingclient.Result) string {
+	fields := []field{
+		{key: "type", value: stringField(r.Type.String())},
+		{key: "sequence", value: strconv.FormatInt(r.Sequence, 10) + "i"},
+		{key: "success", value: strconv.FormatBool(r.Type == pingclient.ResultTypeReceive)},
+	}
+	if r.IsReply() {
+		fields = append(fields, field{key: "rtt_ms", value: strconv.FormatFloat(float64(r.RTT())/1000/1000, 'f', 6, 64)})
+	}
+	if r.Type == pingclient.ResultTypeTTLExceeded {
+		fields = append(fields, field{key: "peer_ip", value: stringField(r.PeerIP)})
+	}
+
+	ts := r.ReceiveTimeUnixNanosec
+	if ts == 0 {
+		ts = r.SendTimeUnixNanosec
+	}
+
+	return line(measurement, r.PingerID, r.Target, fields, ts)
+}
+
+// StatisticsLines returns a line per target of a statistics tick.
+func StatisticsLines(measurement string, s pingclient.Statistics) []string {
+	lines := make([]string, 0, len(s.Targets))
+	for _, c := range s.Targets {
+		lines = append(lines, line(measurement, s.PingerID, c.Target, []field{
+			{key: "count", value: strconv.FormatInt(c.Count, 10) + "i"},
+			{key: "counts_num", value: strconv.FormatUint(s.CountsNum, 10) + "i"},
+			{key: "rate", value: strconv.FormatInt(c.Rate, 10) + "i"},
+		}, s.Time.UnixNano()))
+	}
+	return lines
+}
@@ -0,0 +1,199 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPWriterOptions is the setting of an HTTPWriter.
+type HTTPWriterOptions struct {
+	//書き込み先、例 http://127.0.0.1:8086/api/v2/write?org=myorg&bucket=ping
+	URL string
+	//空白文字列なら Authorization を付けない
+	Token string
+
+	//1回のPOSTの最大行数
+	BatchSize int
+	//BatchSize に満たなくても送る間隔
+	FlushInterval time.Duration
+	//1回のPOSTのタイムアウト
+	Timeout time.Duration
+	//失敗した時に再送するまでの時間
+	RetryInterval time.Duration
+	//送れていない行をいくつまで保持するか、超えたら古いものから捨てる
+	BufferSize int
+
+	//nilなら http.DefaultClient
+	HTTPClient *http.Client
+	//送信の失敗を知らせる、nilなら何もしない
+	OnError func(err error)
+}
+
+// HTTPWriter batches lines and POSTs them to an InfluxDB v2 write endpoint.
+// Write never blocks; lines are kept while the endpoint is unreachable.
+type HTTPWriter struct {
+	options HTTPWriterOptions
+
+	mu      sync.Mutex
+	buffer  []string
+	dropped uint64
+	chKick  chan struct{}
+}
+
+// NewHTTPWriter returns an HTTPWriter; call Run to send.
+func NewHTTPWriter(options HTTPWriterOptions) *HTTPWriter {
+	if options.BatchSize <= 0 {
+		options.BatchSize = 5000
+	}
+	if options.BufferSize < options.BatchSize {
+		options.BufferSize = options.BatchSize
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+
+	return &HTTPWriter{
+		options: options,
+		buffer:  make([]string, 0, options.BatchSize),
+		chKick:  make(chan struct{}, 1),
+	}
+}
+
+// Write queues lines.
+func (thisWriter *HTTPWriter) Write(lines ...string) {
+	thisWriter.mu.Lock()
+	thisWriter.buffer = append(thisWriter.buffer, lines...)
+	if over := len(thisWriter.buffer) - thisWriter.options.BufferSize; over > 0 {
+		thisWriter.buffer = append(thisWriter.buffer[:0], thisWriter.buffer[over:]...)
+		thisWriter.dropped += uint64(over)
+	}
+	full := len(thisWriter.buffer) >= thisWriter.options.BatchSize
+	thisWriter.mu.Unlock()
+
+	if full {
+		select {
+		case thisWriter.chKick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Dropped returns the number of lines discarded because the buffer was full.
+func (thisWriter *HTTPWriter) Dropped() uint64 {
+	thisWriter.mu.Lock()
+	defer thisWriter.mu.Unlock()
+	return thisWriter.dropped
+}
+
+// Run sends the queued lines until ctx is done, then tries once more to send the rest.
+func (thisWriter *HTTPWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(thisWriter.options.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, finalCtxCancel := context.WithTimeout(context.Background(), thisWriter.options.Timeout+time.Second)
+			defer finalCtxCancel()
+			for thisWriter.flush(finalCtx) {
+			}
+			return
+		case <-ticker.C:
+		case <-thisWriter.chKick:
+		}
+
+		for thisWriter.flush(ctx) {
+		}
+		if thisWriter.pending() > 0 {
+			// 送れなかった
+			select {
+			case <-ctx.Done():
+			case <-time.After(thisWriter.options.RetryInterval):
+			}
+		}
+	}
+}
+
+func (thisWriter *HTTPWriter) pending() int {
+	thisWriter.mu.Lock()
+	defer thisWriter.mu.Unlock()
+	return len(thisWriter.buffer)
+}
+
+// flush sends a batch and reports whether another batch may be sent now.
+func (thisWriter *HTTPWriter) flush(ctx context.Context) bool {
+	thisWriter.mu.Lock()
+	n := len(thisWriter.buffer)
+	if n > thisWriter.options.BatchSize {
+		n = thisWriter.options.BatchSize
+	}
+	batch := append([]string(nil), thisWriter.buffer[:n]...)
+	droppedBefore := thisWriter.dropped
+	thisWriter.mu.Unlock()
+	if len(batch) == 0 {
+		return false
+	}
+
+	retry, err := thisWriter.post(ctx, batch)
+	if err != nil {
+		if thisWriter.options.OnError != nil {
+			thisWriter.options.OnError(err)
+		}
+		if retry {
+			return false
+		}
+	}
+
+	// 送れた(または送っても無駄な)分を捨てる、送信中に先頭から捨てられた分は除く
+	thisWriter.mu.Lock()
+	defer thisWriter.mu.Unlock()
+	sent := len(batch) - int(thisWriter.dropped-droppedBefore)
+	if sent > 0 {
+		thisWriter.buffer = append(thisWriter.buffer[:0], thisWriter.buffer[sent:]...)
+	}
+	return err == nil
+}
+
+// post returns whether the failure is worth retrying.
+func (thisWriter *HTTPWriter) post(ctx context.Context, batch []string) (bool, error) {
+	reqCtx := ctx
+	if thisWriter.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, thisWriter.options.Timeout)
+		defer cancel()
+	}
+
+	body := strings.Join(batch, "\n") + "\n"
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, thisWriter.options.URL, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if thisWriter.options.Token != "" {
+		req.Header.Set("Authorization", "Token "+thisWriter.options.Token)
+	}
+
+	res, err := thisWriter.options.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	resBody, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("influx write: unexpected status %s %s", res.Status, strings.TrimSpace(string(resBody)))
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, err
+}
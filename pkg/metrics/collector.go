@@ -0,0 +1,204 @@
+// Package metrics keeps per-target metrics of pingers and exposes them
+// in the Prometheus text format.
+//
+// A Collector is fed with the Results and Statistics of pingclient
+// watches; exporters read it with Snapshot or WritePrometheus.
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// DefaultBuckets are the upper bounds (seconds) of the RTT histogram.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// TargetMetrics is the metrics of a target.
+type TargetMetrics struct {
+	Target pingclient.Target
+
+	Replies     uint64
+	Timeouts    uint64
+	TTLExceeded uint64
+	//タイムアウト後の応答
+	Late uint64
+
+	//タイムアウト前の応答のRTT(秒)
+	RTTCount uint64
+	RTTSum   float64
+	//Bucketsの各区間の数(累積ではない)、最後は上限なし
+	RTTBucketCounts []uint64
+	LastRTT         float64
+	HasLastRTT      bool
+
+	//直近 StatisticsCountsNum 回の成功率(0-1)
+	SuccessRatio    float64
+	HasSuccessRatio bool
+}
+
+// PingerMetrics is the metrics of the targets of a pinger.
+type PingerMetrics struct {
+	Info pingclient.PingerInfo
+	//AddPingerした時刻、累積値の起点
+	StartTime time.Time
+	Targets   []TargetMetrics
+}
+
+type pingerState struct {
+	info      pingclient.PingerInfo
+	startTime time.Time
+	order     []uint32
+	targets   map[uint32]*TargetMetrics
+}
+
+// Collector is the metrics of pingers.
+// It is safe for concurrent use.
+type Collector struct {
+	buckets []float64
+
+	mu      sync.Mutex
+	pingers map[uint32]*pingerState
+}
+
+// NewCollector returns a Collector; nil buckets means DefaultBuckets.
+func NewCollector(buckets []float64) *Collector {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Collector{
+		buckets: buckets,
+		pingers: make(map[uint32]*pingerState),
+	}
+}
+
+// Buckets returns the upper bounds of the RTT histogram.
+func (thisCollector *Collector) Buckets() []float64 {
+	return append([]float64(nil), thisCollector.buckets...)
+}
+
+// AddPinger starts collecting the pinger; metrics of a pinger already added are reset.
+func (thisCollector *Collector) AddPinger(info pingclient.PingerInfo) {
+	p := &pingerState{
+		info:      info,
+		startTime: time.Now(),
+		order:     make([]uint32, 0, len(info.Targets)),
+		targets:   make(map[uint32]*TargetMetrics, len(info.Targets)),
+	}
+	for _, t := range info.Targets {
+		p.order = append(p.order, t.TargetID)
+		p.targets[t.TargetID] = &TargetMetrics{
+			Target:          t,
+			RTTBucketCounts: make([]uint64, len(thisCollector.buckets)+1),
+		}
+	}
+
+	thisCollector.mu.Lock()
+	defer thisCollector.mu.Unlock()
+	thisCollector.pingers[info.PingerID] = p
+}
+
+// RemovePinger drops the metrics of the pinger.
+func (thisCollector *Collector) RemovePinger(pingerID uint32) {
+	thisCollector.mu.Lock()
+	defer thisCollector.mu.Unlock()
+	delete(thisCollector.pingers, pingerID)
+}
+
+func (thisCollector *Collector) target(pingerID uint32, target pingclient.Target) *TargetMetrics {
+	p, ok := thisCollector.pingers[pingerID]
+	if !ok {
+		return nil
+	}
+	t, ok := p.targets[target.TargetID]
+	if !ok {
+		t = &TargetMetrics{
+			Target:          target,
+			RTTBucketCounts: make([]uint64, len(thisCollector.buckets)+1),
+		}
+		p.order = append(p.order, target.TargetID)
+		p.targets[target.TargetID] = t
+	}
+	return t
+}
+
+// AddResult adds a result of an added pinger.
+func (thisCollector *Collector) AddResult(r pingclient.Result) {
+	thisCollector.mu.Lock()
+	defer thisCollector.mu.Unlock()
+
+	t := thisCollector.target(r.PingerID, r.Target)
+	if t == nil {
+		return
+	}
+
+	switch r.Type {
+	case pingclient.ResultTypeReceive:
+		t.Replies++
+		rtt := r.RTT().Seconds()
+		t.RTTCount++
+		t.RTTSum += rtt
+		t.LastRTT = rtt
+		t.HasLastRTT = true
+		i := sort.SearchFloat64s(thisCollector.buckets, rtt)
+		t.RTTBucketCounts[i]++
+	case pingclient.ResultTypeReceiveAfterTimeout:
+		t.Late++
+	case pingclient.ResultTypeTimeout:
+		t.Timeouts++
+	case pingclient.ResultTypeTTLExceeded:
+		t.TTLExceeded++
+	}
+}
+
+// AddStatistics updates the success ratio of the targets of an added pinger.
+func (thisCollector *Collector) AddStatistics(s pingclient.Statistics) {
+	thisCollector.mu.Lock()
+	defer thisCollector.mu.Unlock()
+
+	for _, c := range s.Targets {
+		t := thisCollector.target(s.PingerID, c.Target)
+		if t == nil {
+			continue
+		}
+		if s.CountsNum > 0 {
+			t.SuccessRatio = float64(c.Count) / float64(s.CountsNum)
+			t.HasSuccessRatio = true
+		}
+	}
+}
+
+// Snapshot returns a copy of the metrics in PingerID order.
+func (thisCollector *Collector) Snapshot() []PingerMetrics {
+	thisCollector.mu.Lock()
+	defer thisCollector.mu.Unlock()
+
+	ids := make([]uint32, 0, len(thisCollector.pingers))
+	for id := range thisCollector.pingers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	res := make([]PingerMetrics, 0, len(ids))
+	for _, id := range ids {
+		p := thisCollector.pingers[id]
+		m := PingerMetrics{
+			Info:      p.info,
+			StartTime: p.startTime,
+			Targets:   make([]TargetMetrics, 0, len(p.order)),
+		}
+		for _, targetID := range p.order {
+			t := *p.targets[targetID]
+			t.RTTBucketCounts = append([]uint64(nil), t.RTTBucketCounts...)
+			m.Targets = append(m.Targets, t)
+		}
+		res = append(res, m)
+	}
+
+	return res
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+func TestAddStatistics(t *testing.T) {
+	first := pingclient.Target{TargetID: 1, TargetIP: "192.0.2.1"}
+	second := pingclient.Target{TargetID: 2, TargetIP: "192.0.2.2"}
+	unknown := pingclient.Target{TargetID: 9, TargetIP: "192.0.2.9"}
+
+	tests := []struct {
+		name     string
+		counts   []pingclient.SuccessCount
+		want     []float64
+		wantHave []bool
+	}{
+		{
+			name:     "every target, pinger not added is ignored",
+			counts:   []pingclient.SuccessCount{{Target: first, Count: 5}, {Target: second, Count: 2}},
+			want:     []float64{1, 0.4},
+			wantHave: []bool{true, true},
+		},
+		{
+			name:     "target not in the info is added",
+			counts:   []pingclient.SuccessCount{{Target: unknown, Count: 5}, {Target: second, Count: 3}},
+			want:     []float64{0, 0.6, 1},
+			wantHave: []bool{false, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCollector(nil)
+			c.AddPinger(pingclient.PingerInfo{PingerID: 1, Targets: []pingclient.Target{first, second}})
+			c.AddStatistics(pingclient.Statistics{PingerID: 1, CountsNum: 5, Targets: tt.counts})
+			c.AddStatistics(pingclient.Statistics{PingerID: 2, CountsNum: 5, Targets: tt.counts})
+
+			pingers := c.Snapshot()
+			if len(pingers) != 1 || len(pingers[0].Targets) != len(tt.want) {
+				t.Fatalf("snapshot = %+v", pingers)
+			}
+			for i, m := range pingers[0].Targets {
+				if m.SuccessRatio != tt.want[i] || m.HasSuccessRatio != tt.wantHave[i] {
+					t.Errorf("target %d ratio = %v/%v, want %v/%v", m.Target.TargetID, m.SuccessRatio, m.HasSuccessRatio, tt.want[i], tt.wantHave[i])
+				}
+			}
+		})
+	}
+}
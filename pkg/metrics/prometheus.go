@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType is the Content-Type of WritePrometheus.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type promLabel struct {
+	name  string
+	value string
+}
+
+type promFamily struct {
+	name string
+	help string
+	kind string
+	//値が無い対象は書かない
+	write func(w *bufio.Writer, labels []promLabel, t TargetMetrics)
+}
+
+var promFamilies = []promFamily{
+	{
+		name:  "ping_rtt_seconds",
+		help:  "Round trip time of replies received before the timeout.",
+		kind:  "histogram",
+		write: nil, // バケットの上限が必要なので WritePrometheus で書く
+	},
+	{
+		name: "ping_last_rtt_seconds",
+		help: "Round trip time of the last reply received before the timeout.",
+		kind: "gauge",
+		write: func(w *bufio.Writer, labels []promLabel, t TargetMetrics) {
+			if t.HasLastRTT {
+				writePromSample(w, "ping_last_rtt_seconds", labels, t.LastRTT)
+			}
+		},
+	},
+	{
+		name: "ping_success_ratio",
+		help: "Ratio of successes within the last StatisticsCountsNum results, reported by the server.",
+		kind: "gauge",
+		write: func(w *bufio.Writer, labels []promLabel, t TargetMetrics) {
+			if t.HasSuccessRatio {
+				writePromSample(w, "ping_success_ratio", labels, t.SuccessRatio)
+			}
+		},
+	},
+	{
+		name: "ping_replies_total",
+		help: "Number of replies received before the timeout.",
+		kind: "counter",
+		write: func(w *bufio.Writer, labels []promLabel, t TargetMetrics) {
+			writePromSample(w, "ping_replies_total", labels, float64(t.Replies))
+		},
+	},
+	{
+		name: "ping_timeouts_total",
+		help: "Number of probes without a reply before the timeout.",
+		kind: "counter",
+		write: func(w *bufio.Writer, labels []promLabel, t TargetMetrics) {
+			writePromSample(w, "ping_timeouts_total", labels, float64(t.Timeouts))
+		},
+	},
+	{
+		name: "ping_ttl_exceeded_total",
+		help: "Number of TTL exceeded answers.",
+		kind: "counter",
+		write: func(w *bufio.Writer, labels []promLabel, t TargetMetrics) {
+			writePromSample(w, "ping_ttl_exceeded_total", labels, float64(t.TTLExceeded))
+		},
+	},
+	{
+		name: "ping_late_replies_total",
+		help: "Number of replies received after the timeout.",
+		kind: "counter",
+		write: func(w *bufio.Writer, labels []promLabel, t TargetMetrics) {
+			writePromSample(w, "ping_late_replies_total", labels, float64(t.Late))
+		},
+	},
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format.
+func (thisCollector *Collector) WritePrometheus(out io.Writer) error {
+	snapshot := thisCollector.Snapshot()
+	w := bufio.NewWriter(out)
+
+	for _, family := range promFamilies {
+		w.WriteString("# HELP " + family.name + " " + family.help + "\n")
+		w.WriteString("# TYPE " + family.name + " " + family.kind + "\n")
+
+		for _, p := range snapshot {
+			for _, t := range p.Targets {
+				labels := targetLabels(p, t)
+				if family.write != nil {
+					family.write(w, labels, t)
+					continue
+				}
+
+				var cumulative uint64
+				for i, le := range thisCollector.buckets {
+					cumulative += t.RTTBucketCounts[i]
+					writePromSample(w, family.name+"_bucket", append(labels, promLabel{name: "le", value: formatPromFloat(le)}), float64(cumulative))
+				}
+				writePromSample(w, family.name+"_bucket", append(labels, promLabel{name: "le", value: "+Inf"}), float64(t.RTTCount))
+				writePromSample(w, family.name+"_sum", labels, t.RTTSum)
+				writePromSample(w, family.name+"_count", labels, float64(t.RTTCount))
+			}
+		}
+	}
+
+	return w.Flush()
+}
+
+func targetLabels(p PingerMetrics, t TargetMetrics) []promLabel {
+	return []promLabel{
+		{name: "pinger_id", value: strconv.FormatUint(uint64(p.Info.PingerID), 10)},
+		{name: "description", value: p.Info.Description},
+		{name: "target_ip", value: t.Target.TargetBinIP},
+		{name: "fqdn", value: t.Target.FQDN()},
+		{name: "comment", value: t.Target.Comment},
+	}
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writePromSample(w *bufio.Writer, name string, labels []promLabel, value float64) {
+	w.WriteString(name)
+	w.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(l.name + "=\"" + promLabelEscaper.Replace(l.value) + "\"")
+	}
+	w.WriteString("} " + formatPromFloat(value) + "\n")
+}
+
+func formatPromFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,196 @@
+// Package notify posts target state changes to webhooks.
+//
+// Events come from pingclient.EventDetector; each Webhook receives them
+// as a generic, Slack-compatible or Microsoft Teams-compatible JSON body.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// Webhook is a destination of notifications.
+type Webhook struct {
+	URL string `json:"URL"`
+	//generic, slack, teams のいずれか、空白文字列は generic
+	Template Template `json:"Template"`
+	//エラーに出す名前、空白文字列なら URL のホスト
+	//URL はトークンを含むことが多いので、エラーには URL を出さない
+	Name string `json:"Name"`
+}
+
+// Options is the setting of a Notifier.
+type Options struct {
+	Webhooks []Webhook
+
+	//1回のPOSTのタイムアウト
+	Timeout time.Duration
+	//失敗時に再送する回数
+	RetryNum int
+	//再送までの待ち時間
+	RetryInterval time.Duration
+	//同じ対象への通知を抑止する時間
+	Cooldown time.Duration
+
+	//nilなら http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type cooldownState struct {
+	lastSent time.Time
+	lastType pingclient.EventType
+}
+
+// Notifier posts Events to the webhooks of its Options.
+// It is safe for concurrent use.
+type Notifier struct {
+	options Options
+
+	mu       sync.Mutex
+	cooldown map[string]cooldownState
+}
+
+// New returns a Notifier.
+func New(options Options) (*Notifier, error) {
+	options.Webhooks = append([]Webhook(nil), options.Webhooks...)
+	for i, w := range options.Webhooks {
+		if w.URL == "" {
+			return nil, fmt.Errorf("webhook %d: empty URL", i)
+		}
+		u, err := url.Parse(w.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("webhook %d: invalid URL", i)
+		}
+		if w.Name == "" {
+			options.Webhooks[i].Name = u.Host
+		}
+		template, err := ParseTemplate(string(w.Template))
+		if err != nil {
+			return nil, fmt.Errorf("webhook %d: %w", i, err)
+		}
+		options.Webhooks[i].Template = template
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+
+	return &Notifier{
+		options:  options,
+		cooldown: make(map[string]cooldownState),
+	}, nil
+}
+
+// allow reports whether the event passes the cooldown of its target and records it if so.
+// An UP following a notified DOWN always passes, so a recovery is never swallowed;
+// an UP following a suppressed DOWN is suppressed as well.
+func (thisNotifier *Notifier) allow(e pingclient.Event) bool {
+	thisNotifier.mu.Lock()
+	defer thisNotifier.mu.Unlock()
+
+	key := fmt.Sprintf("%d/%d", e.PingerID, e.Target.TargetID)
+	if e.Type.IsMass() {
+		key = fmt.Sprintf("%d/mass", e.PingerID)
+	}
+	now := time.Now()
+
+	last, ok := thisNotifier.cooldown[key]
+	if ok && now.Sub(last.lastSent) < thisNotifier.options.Cooldown {
+		if !(!e.Type.IsDown() && last.lastType.IsDown()) {
+			return false
+		}
+	}
+
+	thisNotifier.cooldown[key] = cooldownState{lastSent: now, lastType: e.Type}
+	return true
+}
+
+// Notify posts the event to every webhook.
+// It returns false without posting when the target is in cooldown.
+func (thisNotifier *Notifier) Notify(ctx context.Context, e pingclient.Event) (bool, error) {
+	if !thisNotifier.allow(e) {
+		return false, nil
+	}
+
+	var errs []error
+	for _, w := range thisNotifier.options.Webhooks {
+		if err := thisNotifier.post(ctx, w, e); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", w.Name, err))
+		}
+	}
+
+	return true, errors.Join(errs...)
+}
+
+func (thisNotifier *Notifier) post(ctx context.Context, w Webhook, e pingclient.Event) error {
+	body, err := Payload(w.Template, e)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for i := 0; i <= thisNotifier.options.RetryNum; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(thisNotifier.options.RetryInterval):
+			}
+		}
+
+		retry, err := thisNotifier.postOnce(ctx, w.URL, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+
+	return lastErr
+}
+
+// postOnce returns whether the failure is worth retrying.
+func (thisNotifier *Notifier) postOnce(ctx context.Context, webhookURL string, body []byte) (bool, error) {
+	reqCtx := ctx
+	if thisNotifier.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, thisNotifier.options.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.New("invalid URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := thisNotifier.options.HTTPClient.Do(req)
+	if err != nil {
+		// url.Error は URL を含むので中身だけ返す
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("unexpected status %s", res.Status)
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, err
+}
@@ -0,0 +1,391 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+var testSince = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func testEvent(typ pingclient.EventType, targetID uint32) pingclient.Event {
+	e := pingclient.Event{
+		Type:     typ,
+		PingerID: 7,
+		Time:     testSince.Add(3 * time.Second),
+		Since:    testSince,
+	}
+	if typ.IsMass() {
+		e.Affected, e.TargetCount = 9, 10
+	} else {
+		e.Target = pingclient.Target{TargetID: targetID, TargetIP: "core.example.com", TargetBinIP: "192.0.2.1", Comment: "router"}
+		e.LostCount, e.FirstLostSequence, e.LastLostSequence = 3, 10, 12
+	}
+	if !typ.IsDown() {
+		e.OutageDuration = 2500 * time.Millisecond
+	}
+	return e
+}
+
+// tHook is a webhook receiver answering the statuses in order, then 200.
+type tHook struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	delay    time.Duration
+	bodies   []map[string]interface{}
+}
+
+func newHook(t *testing.T, statuses ...int) *tHook {
+	h := &tHook{statuses: statuses}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		decoded := make(map[string]interface{})
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(body, &decoded) != nil {
+			t.Errorf("bad request %s %q %s", r.Method, r.Header.Get("Content-Type"), body)
+		}
+
+		h.mu.Lock()
+		h.bodies = append(h.bodies, decoded)
+		status := http.StatusOK
+		if len(h.statuses) > 0 {
+			status, h.statuses = h.statuses[0], h.statuses[1:]
+		}
+		delay := h.delay
+		h.mu.Unlock()
+
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+			}
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(h.Close)
+	return h
+}
+
+func (thisHook *tHook) received() []map[string]interface{} {
+	thisHook.mu.Lock()
+	defer thisHook.mu.Unlock()
+	return append([]map[string]interface{}(nil), thisHook.bodies...)
+}
+
+func TestPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		template Template
+		event    pingclient.Event
+		want     map[string]interface{}
+	}{
+		{
+			name:     "generic down",
+			template: TemplateGeneric,
+			event:    testEvent(pingclient.EventDown, 1),
+			want: map[string]interface{}{
+				"Event":             "DOWN",
+				"Text":              "[DOWN] core.example.com (192.0.2.1) router - 3 lost since 2026/01/02 03:04:05 (pinger 7)",
+				"PingerID":          float64(7),
+				"TargetID":          float64(1),
+				"TargetIP":          "192.0.2.1",
+				"FQDN":              "core.example.com",
+				"Comment":           "router",
+				"LostCount":         float64(3),
+				"FirstLostSequence": float64(10),
+				"LastLostSequence":  float64(12),
+				"SinceUnixNanosec":  float64(testSince.UnixNano()),
+			},
+		},
+		{
+			name:     "generic up",
+			template: TemplateGeneric,
+			event:    testEvent(pingclient.EventUp, 1),
+			want: map[string]interface{}{
+				"Event":                  "UP",
+				"Text":                   "[UP] core.example.com (192.0.2.1) router - recovered after 2.5s, 3 lost (pinger 7)",
+				"OutageDurationMillisec": float64(2500),
+			},
+		},
+		{
+			name:     "slack",
+			template: TemplateSlack,
+			event:    testEvent(pingclient.EventMassDown, 0),
+			want: map[string]interface{}{
+				"text": "[MASS-DOWN] 9/10 targets down since 2026/01/02 03:04:05, likely vantage point or server side outage (pinger 7)",
+			},
+		},
+		{
+			name:     "teams down",
+			template: TemplateTeams,
+			event:    testEvent(pingclient.EventDown, 1),
+			want: map[string]interface{}{
+				"@type":      "MessageCard",
+				"@context":   "http://schema.org/extensions",
+				"themeColor": "E01E5A",
+				"title":      "DOWN 192.0.2.1",
+				"summary":    "[DOWN] core.example.com (192.0.2.1) router - 3 lost since 2026/01/02 03:04:05 (pinger 7)",
+			},
+		},
+		{
+			name:     "teams mass up",
+			template: TemplateTeams,
+			event:    testEvent(pingclient.EventMassUp, 0),
+			want: map[string]interface{}{
+				"themeColor": "2EB67D",
+				"title":      "MASS-UP pinger 7",
+				"text":       "[MASS-UP] recovered after 2.5s, 9/10 targets affected (pinger 7)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := Payload(tt.template, tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]interface{})
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s = %v, want %v", key, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		webhooks []Webhook
+		wantErr  bool
+		wantName string
+	}{
+		{name: "name from host", webhooks: []Webhook{{URL: "https://hooks.example.com/services/SECRET"}}, wantName: "hooks.example.com"},
+		{name: "name given", webhooks: []Webhook{{URL: "https://hooks.example.com/services/SECRET", Name: "ops"}}, wantName: "ops"},
+		{name: "empty URL", webhooks: []Webhook{{}}, wantErr: true},
+		{name: "no host", webhooks: []Webhook{{URL: "/services/SECRET"}}, wantErr: true},
+		{name: "unknown template", webhooks: []Webhook{{URL: "https://hooks.example.com/", Template: "mail"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier, err := New(Options{Webhooks: tt.webhooks})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				if strings.Contains(err.Error(), "SECRET") {
+					t.Errorf("error leaks the URL : %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w := notifier.options.Webhooks[0]; w.Name != tt.wantName || w.Template != TemplateGeneric {
+				t.Errorf("webhook = %+v", w)
+			}
+		})
+	}
+}
+
+func TestNotifyTemplates(t *testing.T) {
+	generic, slack, teams := newHook(t), newHook(t), newHook(t)
+	notifier, err := New(Options{Webhooks: []Webhook{
+		{URL: generic.URL + "/hook"},
+		{URL: slack.URL + "/services/XXX", Template: TemplateSlack},
+		{URL: teams.URL + "/webhookb2/XXX", Template: TemplateTeams},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := notifier.Notify(context.Background(), testEvent(pingclient.EventDown, 1))
+	if !sent || err != nil {
+		t.Fatalf("Notify = %v, %v", sent, err)
+	}
+	if got := generic.received(); len(got) != 1 || got[0]["Event"] != "DOWN" {
+		t.Errorf("generic received %v", got)
+	}
+	if got := slack.received(); len(got) != 1 || !strings.HasPrefix(got[0]["text"].(string), "[DOWN] ") {
+		t.Errorf("slack received %v", got)
+	}
+	if got := teams.received(); len(got) != 1 || got[0]["@type"] != "MessageCard" {
+		t.Errorf("teams received %v", got)
+	}
+}
+
+func TestNotifyRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		retryNum  int
+		wantPosts int
+		wantErr   string
+	}{
+		{name: "ok", wantPosts: 1},
+		{name: "retried 5xx", statuses: []int{500, 503}, retryNum: 3, wantPosts: 3},
+		{name: "retried 429", statuses: []int{429}, retryNum: 1, wantPosts: 2},
+		{name: "retries exhausted", statuses: []int{500, 500, 500}, retryNum: 2, wantPosts: 3, wantErr: "500"},
+		{name: "4xx is not retried", statuses: []int{400}, retryNum: 3, wantPosts: 1, wantErr: "400"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := newHook(t, tt.statuses...)
+			notifier, err := New(Options{
+				Webhooks:      []Webhook{{URL: hook.URL + "/services/SECRET", Name: "ops"}},
+				RetryNum:      tt.retryNum,
+				RetryInterval: 10 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = notifier.Notify(context.Background(), testEvent(pingclient.EventDown, 1))
+			if got := len(hook.received()); got != tt.wantPosts {
+				t.Errorf("posted %d times, want %d", got, tt.wantPosts)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "webhook ops") {
+				t.Errorf("err = %v, want %s from webhook ops", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), "SECRET") {
+				t.Errorf("error leaks the URL : %v", err)
+			}
+		})
+	}
+}
+
+func TestNotifyTimeout(t *testing.T) {
+	hook := newHook(t)
+	hook.delay = time.Second
+	notifier, err := New(Options{
+		Webhooks: []Webhook{{URL: hook.URL + "/services/SECRET"}},
+		Timeout:  50 * time.Millisecond,
+		RetryNum: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = notifier.Notify(context.Background(), testEvent(pingclient.EventDown, 1))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("took %s, want the timeout twice", d)
+	}
+	if got := len(hook.received()); got != 2 {
+		t.Errorf("posted %d times, want 2", got)
+	}
+	if strings.Contains(err.Error(), "SECRET") || !strings.Contains(err.Error(), strings.TrimPrefix(hook.URL, "http://")) {
+		t.Errorf("err = %v, want the host without the path", err)
+	}
+}
+
+func TestNotifyUnreachable(t *testing.T) {
+	hook := newHook(t)
+	hook.Close()
+	notifier, err := New(Options{Webhooks: []Webhook{{URL: hook.URL + "/services/SECRET"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = notifier.Notify(context.Background(), testEvent(pingclient.EventDown, 1))
+	if err == nil || strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("err = %v, want an error without the URL", err)
+	}
+}
+
+func TestNotifyCooldown(t *testing.T) {
+	type step struct {
+		typ      pingclient.EventType
+		targetID uint32
+		wantSent bool
+	}
+
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		steps    []step
+	}{
+		{
+			name: "no cooldown",
+			steps: []step{
+				{typ: pingclient.EventDown, targetID: 1, wantSent: true},
+				{typ: pingclient.EventDown, targetID: 1, wantSent: true},
+			},
+		},
+		{
+			name:     "flapping",
+			cooldown: time.Hour,
+			steps: []step{
+				{typ: pingclient.EventDown, targetID: 1, wantSent: true},
+				//DOWN の後の UP は抑止しない
+				{typ: pingclient.EventUp, targetID: 1, wantSent: true},
+				{typ: pingclient.EventDown, targetID: 1},
+				//抑止した DOWN の後の UP も抑止する
+				{typ: pingclient.EventUp, targetID: 1},
+				{typ: pingclient.EventDown, targetID: 2, wantSent: true},
+			},
+		},
+		{
+			name:     "mass is separate from targets",
+			cooldown: time.Hour,
+			steps: []step{
+				{typ: pingclient.EventDown, targetID: 1, wantSent: true},
+				{typ: pingclient.EventMassDown, wantSent: true},
+				{typ: pingclient.EventMassUp, wantSent: true},
+				{typ: pingclient.EventMassDown},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := newHook(t)
+			notifier, err := New(Options{Webhooks: []Webhook{{URL: hook.URL}}, Cooldown: tt.cooldown})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			posts := 0
+			for i, st := range tt.steps {
+				sent, err := notifier.Notify(context.Background(), testEvent(st.typ, st.targetID))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if sent != st.wantSent {
+					t.Errorf("step %d %s sent = %v, want %v", i, st.typ, sent, st.wantSent)
+				}
+				if sent {
+					posts++
+				}
+			}
+			if got := len(hook.received()); got != posts {
+				t.Errorf("posted %d times, want %d", got, posts)
+			}
+		})
+	}
+}
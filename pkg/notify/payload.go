@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// Template is the shape of the JSON body posted to a webhook.
+type Template string
+
+// Template values.
+const (
+	//イベントの内容をそのままJSONにしたもの
+	TemplateGeneric = Template("generic")
+	//Slack の Incoming Webhook 互換
+	TemplateSlack = Template("slack")
+	//Microsoft Teams の Incoming Webhook(MessageCard)互換
+	TemplateTeams = Template("teams")
+)
+
+// ParseTemplate returns the Template of the name; empty means generic.
+func ParseTemplate(str string) (Template, error) {
+	switch Template(str) {
+	case "", TemplateGeneric:
+		return TemplateGeneric, nil
+	case TemplateSlack:
+		return TemplateSlack, nil
+	case TemplateTeams:
+		return TemplateTeams, nil
+	default:
+		return "", fmt.Errorf("unknown webhook template %q", str)
+	}
+}
+
+type genericPayload struct {
+	Event                  string  `json:"Event"`
+	Text                   string  `json:"Text"`
+	PingerID               uint32  `json:"PingerID"`
+	TargetID               uint32  `json:"TargetID"`
+	TargetIP               string  `json:"TargetIP"`
+	FQDN                   string  `json:"FQDN"`
+	Comment                string  `json:"Comment"`
+	ExpectUnreachable      bool    `json:"ExpectUnreachable"`
+	TimeUnixNanosec        int64   `json:"TimeUnixNanosec"`
+	SinceUnixNanosec       int64   `json:"SinceUnixNanosec"`
+	OutageDurationMillisec float64 `json:"OutageDurationMillisec"`
+	LostCount              int64   `json:"LostCount"`
+	FirstLostSequence      int64   `json:"FirstLostSequence"`
+	LastLostSequence       int64   `json:"LastLostSequence"`
+	Affected               int     `json:"Affected"`
+	TargetCount            int     `json:"TargetCount"`
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+type teamsPayload struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	ThemeColor string `json:"themeColor"`
+	Summary    string `json:"summary"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+}
+
+// Text returns a one-line human readable description of the event.
+func Text(e pingclient.Event) string {
+	name := e.Target.TargetBinIP
+	if fqdn := e.Target.FQDN(); fqdn != "" {
+		name = fqdn + " (" + e.Target.TargetBinIP + ")"
+	}
+	if e.Target.Comment != "" {
+		name += " " + e.Target.Comment
+	}
+
+	switch {
+	case e.Type == pingclient.EventMassDown:
+		return fmt.Sprintf("[MASS-DOWN] %d/%d targets down since %s, likely vantage point or server side outage (pinger %d)",
+			e.Affected,
+			e.TargetCount,
+			e.Since.Format("2006/01/02 15:04:05"),
+			e.PingerID,
+		)
+	case e.Type == pingclient.EventMassUp:
+		return fmt.Sprintf("[MASS-UP] recovered after %s, %d/%d targets affected (pinger %d)",
+			e.OutageDuration.Round(time.Millisecond),
+			e.Affected,
+			e.TargetCount,
+			e.PingerID,
+		)
+	case e.Type == pingclient.EventDown && e.Target.ExpectUnreachable:
+		return fmt.Sprintf("[DOWN] %s - expected unreachable but answering, %d replies since %s (pinger %d)",
+			name,
+			e.LostCount,
+			e.Since.Format("2006/01/02 15:04:05"),
+			e.PingerID,
+		)
+	case e.Type == pingclient.EventDown:
+		return fmt.Sprintf("[DOWN] %s - %d lost since %s (pinger %d)",
+			name,
+			e.LostCount,
+			e.Since.Format("2006/01/02 15:04:05"),
+			e.PingerID,
+		)
+	case e.Target.ExpectUnreachable:
+		return fmt.Sprintf("[UP] %s - unreachable again after %s, %d replies (pinger %d)",
+			name,
+			e.OutageDuration.Round(time.Millisecond),
+			e.LostCount,
+			e.PingerID,
+		)
+	default:
+		return fmt.Sprintf("[UP] %s - recovered after %s, %d lost (pinger %d)",
+			name,
+			e.OutageDuration.Round(time.Millisecond),
+			e.LostCount,
+			e.PingerID,
+		)
+	}
+}
+
+// Payload returns the JSON body of the event in the template.
+func Payload(template Template, e pingclient.Event) ([]byte, error) {
+	text := Text(e)
+
+	switch template {
+	case TemplateSlack:
+		return json.Marshal(slackPayload{Text: text})
+	case TemplateTeams:
+		color := "2EB67D"
+		if e.Type.IsDown() {
+			color = "E01E5A"
+		}
+		title := e.Type.String() + " " + e.Target.TargetBinIP
+		if e.Type.IsMass() {
+			title = fmt.Sprintf("%s pinger %d", e.Type, e.PingerID)
+		}
+		return json.Marshal(teamsPayload{
+			Type:       "MessageCard",
+			Context:    "http://schema.org/extensions",
+			ThemeColor: color,
+			Summary:    text,
+			Title:      title,
+			Text:       text,
+		})
+	default:
+		return json.Marshal(genericPayload{
+			Event:                  e.Type.String(),
+			Text:                   text,
+			PingerID:               e.PingerID,
+			TargetID:               e.Target.TargetID,
+			TargetIP:               e.Target.TargetBinIP,
+			FQDN:                   e.Target.FQDN(),
+			Comment:                e.Target.Comment,
+			ExpectUnreachable:      e.Target.ExpectUnreachable,
+			TimeUnixNanosec:        e.Time.UnixNano(),
+			SinceUnixNanosec:       e.Since.UnixNano(),
+			OutageDurationMillisec: float64(e.OutageDuration) / 1000 / 1000,
+			LostCount:              e.LostCount,
+			FirstLostSequence:      e.FirstLostSequence,
+			LastLostSequence:       e.LastLostSequence,
+			Affected:               e.Affected,
+			TargetCount:            e.TargetCount,
+		})
+	}
+}
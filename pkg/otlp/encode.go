@@ -0,0 +1,189 @@
+// Package otlp exports pkg/metrics snapshots to an OpenTelemetry Collector
+// over OTLP/gRPC or OTLP/HTTP.
+//
+// The ExportMetricsServiceRequest is encoded by hand with protowire,
+// so no OpenTelemetry module is needed.
+package otlp
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/metrics"
+)
+
+// ScopeName is the instrumentation scope of the metrics.
+const ScopeName = "github.com/umenosuke/ping-grpc-client/pkg/otlp"
+
+// Attribute is a string resource or data point attribute.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+const (
+	aggregationTemporalityCumulative = 2
+)
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, str string) []byte {
+	if str == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, str)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	return appendFixed64(b, num, math.Float64bits(v))
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// KeyValue{key = 1, value = 2 AnyValue{string_value = 1}}
+func appendAttributes(b []byte, num protowire.Number, attributes []Attribute) []byte {
+	for _, a := range attributes {
+		var anyValue []byte
+		anyValue = protowire.AppendTag(anyValue, 1, protowire.BytesType)
+		anyValue = protowire.AppendString(anyValue, a.Value)
+
+		var kv []byte
+		kv = appendString(kv, 1, a.Key)
+		kv = appendMessage(kv, 2, anyValue)
+		b = appendMessage(b, num, kv)
+	}
+	return b
+}
+
+// NumberDataPoint{attributes = 7, start_time_unix_nano = 2, time_unix_nano = 3, as_double = 4, as_int = 6}
+func numberDataPoint(attributes []Attribute, start time.Time, now time.Time, asInt bool, v float64) []byte {
+	var b []byte
+	b = appendAttributes(b, 7, attributes)
+	b = appendFixed64(b, 2, uint64(start.UnixNano()))
+	b = appendFixed64(b, 3, uint64(now.UnixNano()))
+	if asInt {
+		b = appendFixed64(b, 6, uint64(int64(v)))
+	} else {
+		b = appendDouble(b, 4, v)
+	}
+	return b
+}
+
+// HistogramDataPoint{attributes = 9, start = 2, time = 3, count = 4, sum = 5, bucket_counts = 6, explicit_bounds = 7}
+func histogramDataPoint(attributes []Attribute, start time.Time, now time.Time, t metrics.TargetMetrics, bounds []float64) []byte {
+	var b []byte
+	b = appendAttributes(b, 9, attributes)
+	b = appendFixed64(b, 2, uint64(start.UnixNano()))
+	b = appendFixed64(b, 3, uint64(now.UnixNano()))
+	b = appendFixed64(b, 4, t.RTTCount)
+	b = appendDouble(b, 5, t.RTTSum)
+
+	var counts []byte
+	for _, c := range t.RTTBucketCounts {
+		counts = protowire.AppendFixed64(counts, c)
+	}
+	b = appendMessage(b, 6, counts)
+
+	var explicitBounds []byte
+	for _, bound := range bounds {
+		explicitBounds = protowire.AppendFixed64(explicitBounds, math.Float64bits(bound))
+	}
+	b = appendMessage(b, 7, explicitBounds)
+
+	return b
+}
+
+// Metric{name = 1, description = 2, unit = 3, gauge = 5, sum = 7, histogram = 9}
+func metric(name string, description string, unit string, dataNum protowire.Number, data []byte) []byte {
+	var b []byte
+	b = appendString(b, 1, name)
+	b = appendString(b, 2, description)
+	b = appendString(b, 3, unit)
+	return appendMessage(b, dataNum, data)
+}
+
+func targetAttributes(t metrics.TargetMetrics) []Attribute {
+	attributes := []Attribute{
+		{Key: "ping.target.id", Value: strconv.FormatUint(uint64(t.Target.TargetID), 10)},
+		{Key: "ping.target.ip", Value: t.Target.TargetBinIP},
+	}
+	if fqdn := t.Target.FQDN(); fqdn != "" {
+		attributes = append(attributes, Attribute{Key: "ping.target.fqdn", Value: fqdn})
+	}
+	if t.Target.Comment != "" {
+		attributes = append(attributes, Attribute{Key: "ping.target.comment", Value: t.Target.Comment})
+	}
+	return attributes
+}
+
+// EncodeMetrics returns an ExportMetricsServiceRequest with a ResourceMetrics per pinger.
+// The resource of a pinger is the given attributes plus its ID and description.
+func EncodeMetrics(resource []Attribute, snapshot []metrics.PingerMetrics, bounds []float64, now time.Time) []byte {
+	var request []byte
+
+	for _, p := range snapshot {
+		attributes := append(append([]Attribute(nil), resource...),
+			Attribute{Key: "ping.pinger.id", Value: strconv.FormatUint(uint64(p.Info.PingerID), 10)},
+			Attribute{Key: "ping.pinger.description", Value: p.Info.Description},
+		)
+
+		var rtt, availability, replies, timeouts, ttlExceeded, late []byte
+		for _, t := range p.Targets {
+			a := targetAttributes(t)
+			rtt = appendMessage(rtt, 1, histogramDataPoint(a, p.StartTime, now, t, bounds))
+			if t.HasSuccessRatio {
+				availability = appendMessage(availability, 1, numberDataPoint(a, p.StartTime, now, false, t.SuccessRatio))
+			}
+			replies = appendMessage(replies, 1, numberDataPoint(a, p.StartTime, now, true, float64(t.Replies)))
+			timeouts = appendMessage(timeouts, 1, numberDataPoint(a, p.StartTime, now, true, float64(t.Timeouts)))
+			ttlExceeded = appendMessage(ttlExceeded, 1, numberDataPoint(a, p.StartTime, now, true, float64(t.TTLExceeded)))
+			late = appendMessage(late, 1, numberDataPoint(a, p.StartTime, now, true, float64(t.Late)))
+		}
+
+		// Histogram, Sum{data_points = 1, aggregation_temporality = 2, is_monotonic = 3}
+		rtt = appendVarint(rtt, 2, aggregationTemporalityCumulative)
+		counter := func(points []byte) []byte {
+			points = appendVarint(points, 2, aggregationTemporalityCumulative)
+			return appendVarint(points, 3, 1)
+		}
+
+		var scopeMetrics []byte
+		var scope []byte
+		scope = appendString(scope, 1, ScopeName)
+		scopeMetrics = appendMessage(scopeMetrics, 1, scope)
+		scopeMetrics = appendMessage(scopeMetrics, 2, metric("ping.rtt", "Round trip time of replies received before the timeout.", "s", 9, rtt))
+		if len(availability) > 0 {
+			scopeMetrics = appendMessage(scopeMetrics, 2, metric("ping.availability", "Ratio of successes within the last StatisticsCountsNum results.", "1", 5, availability))
+		}
+		scopeMetrics = appendMessage(scopeMetrics, 2, metric("ping.replies", "Number of replies received before the timeout.", "{reply}", 7, counter(replies)))
+		scopeMetrics = appendMessage(scopeMetrics, 2, metric("ping.timeouts", "Number of probes without a reply before the timeout.", "{probe}", 7, counter(timeouts)))
+		scopeMetrics = appendMessage(scopeMetrics, 2, metric("ping.ttl_exceeded", "Number of TTL exceeded answers.", "{answer}", 7, counter(ttlExceeded)))
+		scopeMetrics = appendMessage(scopeMetrics, 2, metric("ping.late_replies", "Number of replies received after the timeout.", "{reply}", 7, counter(late)))
+
+		// ResourceMetrics{resource = 1 Resource{attributes = 1}, scope_metrics = 2}
+		var resourceMessage []byte
+		resourceMessage = appendAttributes(resourceMessage, 1, attributes)
+		var resourceMetrics []byte
+		resourceMetrics = appendMessage(resourceMetrics, 1, resourceMessage)
+		resourceMetrics = appendMessage(resourceMetrics, 2, scopeMetrics)
+
+		request = appendMessage(request, 1, resourceMetrics)
+	}
+
+	return request
+}
@@ -0,0 +1,406 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/metrics"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// otlpMetricsProto is the part of opentelemetry-proto v1 (collector/metrics/v1, metrics/v1,
+// resource/v1 and common/v1) that EncodeMetrics writes, with the same names and field numbers.
+const otlpMetricsProto = `
+name: "otlp_metrics_test.proto"
+package: "opentelemetry.proto.test.v1"
+syntax: "proto3"
+message_type: {
+  name: "ExportMetricsServiceRequest"
+  field: {name: "resource_metrics" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.ResourceMetrics"}
+}
+message_type: {
+  name: "ResourceMetrics"
+  field: {name: "resource" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.Resource"}
+  field: {name: "scope_metrics" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.ScopeMetrics"}
+  field: {name: "schema_url" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING}
+}
+message_type: {
+  name: "Resource"
+  field: {name: "attributes" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.KeyValue"}
+  field: {name: "dropped_attributes_count" number: 2 label: LABEL_OPTIONAL type: TYPE_UINT32}
+}
+message_type: {
+  name: "ScopeMetrics"
+  field: {name: "scope" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.InstrumentationScope"}
+  field: {name: "metrics" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.Metric"}
+  field: {name: "schema_url" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING}
+}
+message_type: {
+  name: "InstrumentationScope"
+  field: {name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING}
+  field: {name: "version" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING}
+  field: {name: "attributes" number: 3 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.KeyValue"}
+  field: {name: "dropped_attributes_count" number: 4 label: LABEL_OPTIONAL type: TYPE_UINT32}
+}
+message_type: {
+  name: "Metric"
+  field: {name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING}
+  field: {name: "description" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING}
+  field: {name: "unit" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING}
+  field: {name: "gauge" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.Gauge" oneof_index: 0}
+  field: {name: "sum" number: 7 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.Sum" oneof_index: 0}
+  field: {name: "histogram" number: 9 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.Histogram" oneof_index: 0}
+  oneof_decl: {name: "data"}
+}
+message_type: {
+  name: "Gauge"
+  field: {name: "data_points" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.NumberDataPoint"}
+}
+message_type: {
+  name: "Sum"
+  field: {name: "data_points" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.NumberDataPoint"}
+  field: {name: "aggregation_temporality" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".opentelemetry.proto.test.v1.AggregationTemporality"}
+  field: {name: "is_monotonic" number: 3 label: LABEL_OPTIONAL type: TYPE_BOOL}
+}
+message_type: {
+  name: "Histogram"
+  field: {name: "data_points" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.HistogramDataPoint"}
+  field: {name: "aggregation_temporality" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".opentelemetry.proto.test.v1.AggregationTemporality"}
+}
+message_type: {
+  name: "NumberDataPoint"
+  field: {name: "attributes" number: 7 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.KeyValue"}
+  field: {name: "start_time_unix_nano" number: 2 label: LABEL_OPTIONAL type: TYPE_FIXED64}
+  field: {name: "time_unix_nano" number: 3 label: LABEL_OPTIONAL type: TYPE_FIXED64}
+  field: {name: "as_double" number: 4 label: LABEL_OPTIONAL type: TYPE_DOUBLE oneof_index: 0}
+  field: {name: "as_int" number: 6 label: LABEL_OPTIONAL type: TYPE_SFIXED64 oneof_index: 0}
+  field: {name: "flags" number: 8 label: LABEL_OPTIONAL type: TYPE_UINT32}
+  oneof_decl: {name: "value"}
+}
+message_type: {
+  name: "HistogramDataPoint"
+  field: {name: "attributes" number: 9 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.KeyValue"}
+  field: {name: "start_time_unix_nano" number: 2 label: LABEL_OPTIONAL type: TYPE_FIXED64}
+  field: {name: "time_unix_nano" number: 3 label: LABEL_OPTIONAL type: TYPE_FIXED64}
+  field: {name: "count" number: 4 label: LABEL_OPTIONAL type: TYPE_FIXED64}
+  field: {name: "sum" number: 5 label: LABEL_OPTIONAL type: TYPE_DOUBLE proto3_optional: true oneof_index: 0}
+  field: {name: "bucket_counts" number: 6 label: LABEL_REPEATED type: TYPE_FIXED64}
+  field: {name: "explicit_bounds" number: 7 label: LABEL_REPEATED type: TYPE_DOUBLE}
+  field: {name: "flags" number: 10 label: LABEL_OPTIONAL type: TYPE_UINT32}
+  field: {name: "min" number: 11 label: LABEL_OPTIONAL type: TYPE_DOUBLE proto3_optional: true oneof_index: 1}
+  field: {name: "max" number: 12 label: LABEL_OPTIONAL type: TYPE_DOUBLE proto3_optional: true oneof_index: 2}
+  oneof_decl: {name: "_sum"}
+  oneof_decl: {name: "_min"}
+  oneof_decl: {name: "_max"}
+}
+message_type: {
+  name: "KeyValue"
+  field: {name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING}
+  field: {name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".opentelemetry.proto.test.v1.AnyValue"}
+}
+message_type: {
+  name: "AnyValue"
+  field: {name: "string_value" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0}
+  field: {name: "bool_value" number: 2 label: LABEL_OPTIONAL type: TYPE_BOOL oneof_index: 0}
+  field: {name: "int_value" number: 3 label: LABEL_OPTIONAL type: TYPE_INT64 oneof_index: 0}
+  field: {name: "double_value" number: 4 label: LABEL_OPTIONAL type: TYPE_DOUBLE oneof_index: 0}
+  field: {name: "bytes_value" number: 7 label: LABEL_OPTIONAL type: TYPE_BYTES oneof_index: 0}
+  oneof_decl: {name: "value"}
+}
+enum_type: {
+  name: "AggregationTemporality"
+  value: {name: "AGGREGATION_TEMPORALITY_UNSPECIFIED" number: 0}
+  value: {name: "AGGREGATION_TEMPORALITY_DELTA" number: 1}
+  value: {name: "AGGREGATION_TEMPORALITY_CUMULATIVE" number: 2}
+}
+`
+
+// decodeRequest decodes an ExportMetricsServiceRequest with the OTLP schema and returns it
+// in the OTLP/JSON form. Fields the schema does not know are errors.
+func decodeRequest(t *testing.T, request []byte) map[string]interface{} {
+	t.Helper()
+
+	fdp := &descriptorpb.FileDescriptorProto{}
+	if err := prototext.Unmarshal([]byte(otlpMetricsProto), fdp); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protodesc.NewFile(fdp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := dynamicpb.NewMessage(fd.Messages().ByName("ExportMetricsServiceRequest"))
+	if err := proto.Unmarshal(request, msg); err != nil {
+		t.Fatal(err)
+	}
+	checkNoUnknown(t, msg, "ExportMetricsServiceRequest")
+
+	str, err := protojson.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := make(map[string]interface{})
+	if err := json.Unmarshal(str, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func checkNoUnknown(t *testing.T, msg protoreflect.Message, path string) {
+	t.Helper()
+
+	if unknown := msg.GetUnknown(); len(unknown) > 0 {
+		t.Errorf("%s has unknown fields %x", path, unknown)
+	}
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind {
+			return true
+		}
+		if fd.IsList() {
+			for i := 0; i < v.List().Len(); i++ {
+				checkNoUnknown(t, v.List().Get(i).Message(), path+"."+string(fd.Name()))
+			}
+		} else {
+			checkNoUnknown(t, v.Message(), path+"."+string(fd.Name()))
+		}
+		return true
+	})
+}
+
+// jsonPath follows keys and list indexes in a decoded JSON value.
+func jsonPath(t *testing.T, v interface{}, path ...interface{}) interface{} {
+	t.Helper()
+
+	for _, p := range path {
+		switch p := p.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("%v is not an object at %q", v, p)
+			}
+			v = m[p]
+		case int:
+			l, ok := v.([]interface{})
+			if !ok || p >= len(l) {
+				t.Fatalf("%v has no index %d", v, p)
+			}
+			v = l[p]
+		}
+	}
+	return v
+}
+
+func attributeMap(t *testing.T, attributes interface{}) map[string]string {
+	t.Helper()
+
+	res := make(map[string]string)
+	list, _ := attributes.([]interface{})
+	for i := range list {
+		key, _ := jsonPath(t, list, i, "key").(string)
+		value, _ := jsonPath(t, list, i, "value", "stringValue").(string)
+		res[key] = value
+	}
+	return res
+}
+
+func testSnapshot() ([]metrics.PingerMetrics, time.Time) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []metrics.PingerMetrics{{
+		Info:      pingclient.PingerInfo{PingerID: 3, Description: "core"},
+		StartTime: start,
+		Targets: []metrics.TargetMetrics{
+			{
+				Target:          pingclient.Target{TargetID: 1, TargetIP: "core.example.com", TargetBinIP: "192.0.2.1", Comment: "router"},
+				Replies:         8,
+				Timeouts:        2,
+				TTLExceeded:     1,
+				Late:            1,
+				RTTCount:        8,
+				RTTSum:          0.04,
+				RTTBucketCounts: []uint64{5, 3, 0},
+				SuccessRatio:    0.8,
+				HasSuccessRatio: true,
+			},
+			{
+				Target:          pingclient.Target{TargetID: 2, TargetIP: "192.0.2.2", TargetBinIP: "192.0.2.2"},
+				Timeouts:        10,
+				RTTBucketCounts: []uint64{0, 0, 0},
+			},
+		},
+	}}, start.Add(10 * time.Second)
+}
+
+func TestEncodeMetrics(t *testing.T) {
+	snapshot, now := testSnapshot()
+	request := EncodeMetrics([]Attribute{{Key: "service.name", Value: "ping"}}, snapshot, []float64{0.005, 0.01}, now)
+	decoded := decodeRequest(t, request)
+
+	resourceMetrics := jsonPath(t, decoded, "resourceMetrics").([]interface{})
+	if len(resourceMetrics) != 1 {
+		t.Fatalf("resourceMetrics = %v", resourceMetrics)
+	}
+	resource := attributeMap(t, jsonPath(t, resourceMetrics, 0, "resource", "attributes"))
+	if resource["service.name"] != "ping" || resource["ping.pinger.id"] != "3" || resource["ping.pinger.description"] != "core" {
+		t.Errorf("resource = %v", resource)
+	}
+	if name := jsonPath(t, resourceMetrics, 0, "scopeMetrics", 0, "scope", "name"); name != ScopeName {
+		t.Errorf("scope = %v", name)
+	}
+
+	metricsByName := make(map[string]map[string]interface{})
+	for _, m := range jsonPath(t, resourceMetrics, 0, "scopeMetrics", 0, "metrics").([]interface{}) {
+		metric := m.(map[string]interface{})
+		metricsByName[metric["name"].(string)] = metric
+	}
+	if len(metricsByName) != 6 {
+		t.Errorf("metrics = %v", metricsByName)
+	}
+
+	startNano, nowNano := "1767323045000000000", "1767323055000000000"
+
+	rtt := metricsByName["ping.rtt"]
+	if rtt["unit"] != "s" || jsonPath(t, rtt, "histogram", "aggregationTemporality") != "AGGREGATION_TEMPORALITY_CUMULATIVE" {
+		t.Errorf("ping.rtt = %v", rtt)
+	}
+	point := jsonPath(t, rtt, "histogram", "dataPoints", 0).(map[string]interface{})
+	if point["count"] != "8" || point["sum"] != 0.04 || point["startTimeUnixNano"] != startNano || point["timeUnixNano"] != nowNano {
+		t.Errorf("ping.rtt point = %v", point)
+	}
+	counts, bounds := point["bucketCounts"].([]interface{}), point["explicitBounds"].([]interface{})
+	if len(counts) != len(bounds)+1 || counts[0] != "5" || counts[1] != "3" || bounds[0] != 0.005 || bounds[1] != 0.01 {
+		t.Errorf("ping.rtt buckets = %v %v", counts, bounds)
+	}
+	target := attributeMap(t, point["attributes"])
+	if target["ping.target.id"] != "1" || target["ping.target.ip"] != "192.0.2.1" || target["ping.target.fqdn"] != "core.example.com" || target["ping.target.comment"] != "router" {
+		t.Errorf("ping.rtt attributes = %v", target)
+	}
+
+	availability := jsonPath(t, metricsByName["ping.availability"], "gauge", "dataPoints").([]interface{})
+	if len(availability) != 1 || jsonPath(t, availability, 0, "asDouble") != 0.8 {
+		t.Errorf("ping.availability = %v", availability)
+	}
+
+	counters := []struct {
+		name string
+		want []string
+	}{
+		{name: "ping.replies", want: []string{"8", "0"}},
+		{name: "ping.timeouts", want: []string{"2", "10"}},
+		{name: "ping.ttl_exceeded", want: []string{"1", "0"}},
+		{name: "ping.late_replies", want: []string{"1", "0"}},
+	}
+	for _, c := range counters {
+		sum := jsonPath(t, metricsByName[c.name], "sum").(map[string]interface{})
+		if sum["isMonotonic"] != true || sum["aggregationTemporality"] != "AGGREGATION_TEMPORALITY_CUMULATIVE" {
+			t.Errorf("%s = %v", c.name, sum)
+		}
+		points := sum["dataPoints"].([]interface{})
+		if len(points) != len(c.want) {
+			t.Fatalf("%s points = %v", c.name, points)
+		}
+		for i, want := range c.want {
+			if got := jsonPath(t, points, i, "asInt"); got != want {
+				t.Errorf("%s point %d = %v, want %s", c.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodeMetricsEmpty(t *testing.T) {
+	if request := EncodeMetrics(nil, nil, nil, time.Now()); len(request) != 0 {
+		t.Errorf("request = %x", request)
+	}
+}
+
+// TestExportHTTP sends to a stand-in OTLP/HTTP receiver.
+func TestExportHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Authorization") != "Bearer x" {
+			t.Errorf("bad request %s %v", r.URL.Path, r.Header)
+		}
+		mu.Lock()
+		received = body
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	exporter, err := New(Options{Protocol: ProtocolHTTP, Endpoint: server.URL + "/v1/metrics", Headers: map[string]string{"Authorization": "Bearer x"}, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	snapshot, now := testSnapshot()
+	if err := exporter.Export(context.Background(), EncodeMetrics(nil, snapshot, []float64{0.005, 0.01}, now)); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if n := len(jsonPath(t, decodeRequest(t, received), "resourceMetrics").([]interface{})); n != 1 {
+		t.Errorf("received %d resourceMetrics", n)
+	}
+}
+
+// TestExportGRPC sends to a stand-in OTLP/gRPC receiver.
+func TestExportGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var received []byte
+	var method string
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		var request []byte
+		if err := stream.RecvMsg(&request); err != nil {
+			return err
+		}
+		mu.Lock()
+		received = request
+		method, _ = grpc.MethodFromServerStream(stream)
+		mu.Unlock()
+		response := []byte{}
+		return stream.SendMsg(&response)
+	}))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	exporter, err := New(Options{Protocol: ProtocolGRPC, Endpoint: listener.Addr().String(), Insecure: true, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	snapshot, now := testSnapshot()
+	if err := exporter.Export(context.Background(), EncodeMetrics(nil, snapshot, []float64{0.005, 0.01}, now)); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if method != "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export" {
+		t.Errorf("method = %q", method)
+	}
+	if n := len(jsonPath(t, decodeRequest(t, received), "resourceMetrics").([]interface{})); n != 1 {
+		t.Errorf("received %d resourceMetrics", n)
+	}
+}
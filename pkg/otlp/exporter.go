@@ -0,0 +1,145 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Protocol values.
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+)
+
+const grpcExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// Options is the setting of an Exporter.
+type Options struct {
+	//grpc か http
+	Protocol string
+	//grpc は host:port (例 127.0.0.1:4317)、http はURL (例 http://127.0.0.1:4318/v1/metrics)
+	Endpoint string
+	//grpc で TLS を使わない
+	Insecure bool
+	//送信時に付けるヘッダ(grpc ではメタデータ)
+	Headers map[string]string
+	//1回の送信のタイムアウト
+	Timeout time.Duration
+
+	//nilなら http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Exporter sends encoded ExportMetricsServiceRequests.
+type Exporter struct {
+	options Options
+	conn    *grpc.ClientConn
+}
+
+// rawCodec passes already encoded protobuf messages through gRPC
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("otlp: unexpected message %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("otlp: unexpected message %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// New returns an Exporter; a gRPC connection is established lazily.
+func New(options Options) (*Exporter, error) {
+	e := &Exporter{options: options}
+	if e.options.HTTPClient == nil {
+		e.options.HTTPClient = http.DefaultClient
+	}
+
+	switch options.Protocol {
+	case ProtocolGRPC:
+		creds := credentials.NewTLS(&tls.Config{})
+		if options.Insecure {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.Dial(options.Endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, err
+		}
+		e.conn = conn
+	case ProtocolHTTP:
+	default:
+		return nil, fmt.Errorf("otlp: unknown protocol %q", options.Protocol)
+	}
+
+	return e, nil
+}
+
+// Close releases the gRPC connection.
+func (thisExporter *Exporter) Close() error {
+	if thisExporter.conn == nil {
+		return nil
+	}
+	return thisExporter.conn.Close()
+}
+
+// Export sends a request made by EncodeMetrics.
+func (thisExporter *Exporter) Export(ctx context.Context, request []byte) error {
+	if thisExporter.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, thisExporter.options.Timeout)
+		defer cancel()
+	}
+
+	if thisExporter.conn != nil {
+		for k, v := range thisExporter.options.Headers {
+			ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(k), v)
+		}
+		var response []byte
+		return thisExporter.conn.Invoke(ctx, grpcExportMethod, &request, &response, grpc.ForceCodec(rawCodec{}))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, thisExporter.options.Endpoint, bytes.NewReader(request))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range thisExporter.options.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := thisExporter.options.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("otlp: unexpected status %s", res.Status)
+	}
+	return nil
+}
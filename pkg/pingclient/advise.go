@@ -0,0 +1,208 @@
+package pingclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TimeoutAdvisorOptions is the setting of a TimeoutAdvisor.
+type TimeoutAdvisorOptions struct {
+	//推奨値の元にする応答のRTTのパーセンタイル、0なら99
+	Percentile float64
+	//パーセンタイルに掛ける余裕、0なら1.5
+	Margin float64
+	//推奨値を切り上げる単位(ミリ秒)、0なら100
+	RoundMillisec uint64
+	//応答(タイムアウト後を含む)がこれより少ない対象は推奨値の元にしない、0なら20
+	MinSamples int
+	//今のタイムアウトより小さい値を勧めてよいか
+	AllowDecrease bool
+}
+
+// TargetTimeoutAdvice is the RTT distribution of a target and the timeout it needs.
+type TargetTimeoutAdvice struct {
+	Target Target
+
+	//タイムアウト前の応答
+	Replies int64
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+
+	//タイムアウト後の応答
+	Late    int64
+	LateMin time.Duration
+	LateMax time.Duration
+
+	//タイムアウト前後の応答を合わせた Percentile のRTT
+	ReplyPercentile time.Duration
+	//この対象に必要なタイムアウト、応答が無ければ0
+	TimeoutMillisec uint64
+	//応答が MinSamples より少なく、推奨値の元にしていない
+	InsufficientData bool
+}
+
+// TimeoutAdvice is the recommended TimeoutMillisec and IntervalMillisec of a pinger.
+type TimeoutAdvice struct {
+	CurrentTimeoutMillisec  uint64
+	CurrentIntervalMillisec uint64
+
+	//十分な応答があった対象に必要なタイムアウトの最大、そのような対象が無ければ現在の値
+	//AllowDecrease でなければ現在の値より小さくしない
+	TimeoutMillisec uint64
+	//前のpingのタイムアウト前に次を撃たないよう TimeoutMillisec 以上にする
+	IntervalMillisec uint64
+
+	Targets []TargetTimeoutAdvice
+}
+
+type targetRTTSamples struct {
+	target TargetTimeoutAdvice
+	rtts   []time.Duration
+	late   []time.Duration
+}
+
+// TimeoutAdvisor collects the RTTs of replies received before and after
+// the timeout and recommends a TimeoutMillisec that would catch them.
+// It is safe for concurrent use.
+type TimeoutAdvisor struct {
+	mu      sync.Mutex
+	info    PingerInfo
+	options TimeoutAdvisorOptions
+	order   []uint32
+	targets map[uint32]*targetRTTSamples
+}
+
+// NewTimeoutAdvisor returns a TimeoutAdvisor for the targets of the pinger.
+func NewTimeoutAdvisor(info PingerInfo, options TimeoutAdvisorOptions) *TimeoutAdvisor {
+	if options.Percentile <= 0 || options.Percentile > 100 {
+		options.Percentile = 99
+	}
+	if options.Margin <= 0 {
+		options.Margin = 1.5
+	}
+	if options.RoundMillisec == 0 {
+		options.RoundMillisec = 100
+	}
+	if options.MinSamples <= 0 {
+		options.MinSamples = 20
+	}
+
+	a := &TimeoutAdvisor{
+		info:    info,
+		options: options,
+		order:   make([]uint32, 0, len(info.Targets)),
+		targets: make(map[uint32]*targetRTTSamples, len(info.Targets)),
+	}
+	for _, t := range info.Targets {
+		a.order = append(a.order, t.TargetID)
+		a.targets[t.TargetID] = &targetRTTSamples{target: TargetTimeoutAdvice{Target: t}}
+	}
+
+	return a
+}
+
+func appendSample(samples []time.Duration, rtt time.Duration) []time.Duration {
+	samples = append(samples, rtt)
+	if len(samples) > maxRTTSamples {
+		samples = samples[len(samples)-maxRTTSamples:]
+	}
+	return samples
+}
+
+// Add adds a result.
+func (thisAdvisor *TimeoutAdvisor) Add(r Result) {
+	if !r.IsReply() {
+		return
+	}
+
+	thisAdvisor.mu.Lock()
+	defer thisAdvisor.mu.Unlock()
+
+	t, ok := thisAdvisor.targets[r.Target.TargetID]
+	if !ok {
+		thisAdvisor.order = append(thisAdvisor.order, r.Target.TargetID)
+		t = &targetRTTSamples{target: TargetTimeoutAdvice{Target: r.Target}}
+		thisAdvisor.targets[r.Target.TargetID] = t
+	}
+
+	rtt := r.RTT()
+	if r.Type == ResultTypeReceive {
+		t.target.Replies++
+		t.rtts = appendSample(t.rtts, rtt)
+		return
+	}
+
+	t.target.Late++
+	if t.target.Late == 1 || rtt < t.target.LateMin {
+		t.target.LateMin = rtt
+	}
+	if rtt > t.target.LateMax {
+		t.target.LateMax = rtt
+	}
+	t.late = appendSample(t.late, rtt)
+}
+
+// Advice returns the recommendation from the results added so far.
+func (thisAdvisor *TimeoutAdvisor) Advice() TimeoutAdvice {
+	thisAdvisor.mu.Lock()
+	defer thisAdvisor.mu.Unlock()
+
+	advice := TimeoutAdvice{
+		CurrentTimeoutMillisec:  thisAdvisor.info.TimeoutMillisec,
+		CurrentIntervalMillisec: thisAdvisor.info.IntervalMillisec,
+		Targets:                 make([]TargetTimeoutAdvice, 0, len(thisAdvisor.order)),
+	}
+
+	for _, id := range thisAdvisor.order {
+		t := thisAdvisor.targets[id]
+		target := t.target
+
+		sorted := make([]time.Duration, len(t.rtts))
+		copy(sorted, t.rtts)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		target.P50 = percentile(sorted, 50)
+		target.P90 = percentile(sorted, 90)
+		target.P99 = percentile(sorted, 99)
+
+		all := make([]time.Duration, 0, len(sorted)+len(t.late))
+		all = append(append(all, sorted...), t.late...)
+		sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+		target.ReplyPercentile = percentile(all, thisAdvisor.options.Percentile)
+		if len(all) > 0 {
+			target.TimeoutMillisec = thisAdvisor.roundUp(time.Duration(float64(target.ReplyPercentile) * thisAdvisor.options.Margin))
+		}
+		// 数十回分のパーセンタイルはほぼ最大値なので、少ない応答では決めない
+		target.InsufficientData = len(all) > 0 && len(all) < thisAdvisor.options.MinSamples
+		if !target.InsufficientData && target.TimeoutMillisec > advice.TimeoutMillisec {
+			advice.TimeoutMillisec = target.TimeoutMillisec
+		}
+
+		advice.Targets = append(advice.Targets, target)
+	}
+
+	if advice.TimeoutMillisec == 0 {
+		advice.TimeoutMillisec = advice.CurrentTimeoutMillisec
+	}
+	if !thisAdvisor.options.AllowDecrease && advice.TimeoutMillisec < advice.CurrentTimeoutMillisec {
+		advice.TimeoutMillisec = advice.CurrentTimeoutMillisec
+	}
+	advice.IntervalMillisec = advice.CurrentIntervalMillisec
+	if advice.IntervalMillisec < advice.TimeoutMillisec {
+		advice.IntervalMillisec = advice.TimeoutMillisec
+	}
+
+	return advice
+}
+
+// roundUp returns d in milliseconds rounded up to RoundMillisec, at least RoundMillisec.
+func (thisAdvisor *TimeoutAdvisor) roundUp(d time.Duration) uint64 {
+	unit := thisAdvisor.options.RoundMillisec
+	ms := uint64((d + time.Millisecond - 1) / time.Millisecond)
+	ms = (ms + unit - 1) / unit * unit
+	if ms < unit {
+		ms = unit
+	}
+	return ms
+}
@@ -0,0 +1,159 @@
+package pingclient
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testRTTResults returns n results of the target of type typ, the i-th with RTT rtt(i).
+func testRTTResults(target Target, typ ResultType, n int, rtt func(i int) time.Duration) []Result {
+	results := make([]Result, 0, n)
+	for i := 0; i < n; i++ {
+		send := testBase.Add(time.Duration(i) * time.Second)
+		r := Result{PingerID: 1, Target: target, Sequence: int64(i), Type: typ, SendTimeUnixNanosec: send.UnixNano()}
+		if r.IsReply() {
+			r.ReceiveTimeUnixNanosec = send.Add(rtt(i)).UnixNano()
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestTimeoutAdvisor(t *testing.T) {
+	lan := Target{TargetID: 1, TargetIP: "192.0.2.1"}
+	far := Target{TargetID: 2, TargetIP: "192.0.2.2"}
+	constant := func(d time.Duration) func(int) time.Duration {
+		return func(int) time.Duration { return d }
+	}
+
+	type wantTarget struct {
+		timeout      uint64
+		insufficient bool
+	}
+	tests := []struct {
+		name         string
+		options      TimeoutAdvisorOptions
+		current      uint64
+		results      []Result
+		wantTimeout  uint64
+		wantInterval uint64
+		wantTargets  []wantTarget
+	}{
+		{
+			name:         "fast replies do not cut the timeout",
+			current:      1000,
+			results:      testRTTResults(lan, ResultTypeReceive, 30, constant(5*time.Millisecond)),
+			wantTimeout:  1000,
+			wantInterval: 1000,
+			wantTargets:  []wantTarget{{timeout: 100}, {}},
+		},
+		{
+			name:         "fast replies with allow decrease",
+			options:      TimeoutAdvisorOptions{AllowDecrease: true},
+			current:      1000,
+			results:      testRTTResults(lan, ResultTypeReceive, 30, constant(5*time.Millisecond)),
+			wantTimeout:  100,
+			wantInterval: 1000,
+			wantTargets:  []wantTarget{{timeout: 100}, {}},
+		},
+		{
+			name:    "slow replies raise the timeout",
+			current: 500,
+			results: testRTTResults(lan, ResultTypeReceive, 100, func(i int) time.Duration {
+				return time.Duration(100+i*4) * time.Millisecond
+			}),
+			// p99 は 99番目の 492ms、1.5倍の 738ms を切り上げ
+			wantTimeout:  800,
+			wantInterval: 1000,
+			wantTargets:  []wantTarget{{timeout: 800}, {}},
+		},
+		{
+			name:    "late only",
+			current: 1000,
+			results: testRTTResults(far, ResultTypeReceiveAfterTimeout, 25, func(i int) time.Duration {
+				return time.Duration(1200+i*10) * time.Millisecond
+			}),
+			// 最大の 1440ms の1.5倍
+			wantTimeout:  2200,
+			wantInterval: 2200,
+			wantTargets:  []wantTarget{{}, {timeout: 2200}},
+		},
+		{
+			name:         "no replies",
+			current:      1000,
+			results:      append(testRTTResults(lan, ResultTypeTimeout, 30, nil), testRTTResults(far, ResultTypeTTLExceeded, 30, nil)...),
+			wantTimeout:  1000,
+			wantInterval: 1000,
+			wantTargets:  []wantTarget{{}, {}},
+		},
+		{
+			name:    "few samples do not drive the advice",
+			current: 1000,
+			results: append(
+				testRTTResults(lan, ResultTypeReceive, 30, constant(5*time.Millisecond)),
+				testRTTResults(far, ResultTypeReceiveAfterTimeout, 3, constant(1500*time.Millisecond))...,
+			),
+			wantTimeout:  1000,
+			wantInterval: 1000,
+			wantTargets:  []wantTarget{{timeout: 100}, {timeout: 2300, insufficient: true}},
+		},
+		{
+			name:    "min samples option",
+			options: TimeoutAdvisorOptions{MinSamples: 3},
+			current: 1000,
+			results: append(
+				testRTTResults(lan, ResultTypeReceive, 30, constant(5*time.Millisecond)),
+				testRTTResults(far, ResultTypeReceiveAfterTimeout, 3, constant(1500*time.Millisecond))...,
+			),
+			wantTimeout:  2300,
+			wantInterval: 2300,
+			wantTargets:  []wantTarget{{timeout: 100}, {timeout: 2300}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := PingerInfo{PingerID: 1, Targets: []Target{lan, far}, TimeoutMillisec: tt.current, IntervalMillisec: 1000}
+			advisor := NewTimeoutAdvisor(info, tt.options)
+			for _, r := range tt.results {
+				advisor.Add(r)
+			}
+
+			advice := advisor.Advice()
+			if advice.CurrentTimeoutMillisec != tt.current || advice.TimeoutMillisec != tt.wantTimeout || advice.IntervalMillisec != tt.wantInterval {
+				t.Errorf("advice = %d -> %d, interval %d, want %d -> %d, interval %d",
+					advice.CurrentTimeoutMillisec, advice.TimeoutMillisec, advice.IntervalMillisec, tt.current, tt.wantTimeout, tt.wantInterval)
+			}
+			got := make([]wantTarget, 0, len(advice.Targets))
+			for _, target := range advice.Targets {
+				got = append(got, wantTarget{timeout: target.TimeoutMillisec, insufficient: target.InsufficientData})
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantTargets) {
+				t.Errorf("targets = %+v, want %+v", got, tt.wantTargets)
+			}
+		})
+	}
+}
+
+func TestTimeoutAdvisorLate(t *testing.T) {
+	target := Target{TargetID: 1, TargetIP: "192.0.2.1"}
+	advisor := NewTimeoutAdvisor(PingerInfo{PingerID: 1, Targets: []Target{target}, TimeoutMillisec: 1000}, TimeoutAdvisorOptions{})
+	for _, r := range testRTTResults(target, ResultTypeReceive, 10, func(i int) time.Duration { return time.Duration(i+1) * time.Millisecond }) {
+		advisor.Add(r)
+	}
+	for _, r := range testRTTResults(target, ResultTypeReceiveAfterTimeout, 3, func(i int) time.Duration { return time.Duration(1300-i*100) * time.Millisecond }) {
+		advisor.Add(r)
+	}
+
+	got := advisor.Advice().Targets[0]
+	if got.Replies != 10 || got.P50 != 5*time.Millisecond || got.P90 != 9*time.Millisecond || got.P99 != 10*time.Millisecond {
+		t.Errorf("replies = %d p50/p90/p99 %s/%s/%s", got.Replies, got.P50, got.P90, got.P99)
+	}
+	if got.Late != 3 || got.LateMin != 1100*time.Millisecond || got.LateMax != 1300*time.Millisecond || got.ReplyPercentile != 1300*time.Millisecond {
+		t.Errorf("late = %d %s-%s, percentile %s", got.Late, got.LateMin, got.LateMax, got.ReplyPercentile)
+	}
+	if !got.InsufficientData {
+		t.Error("13 samples are not insufficient with the default MinSamples 20")
+	}
+}
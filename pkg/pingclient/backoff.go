@@ -0,0 +1,61 @@
+package pingclient
+
+import (
+	"math/rand"
+	"time"
+)
+
+// BackoffOptions is the setting of a Backoff.
+type BackoffOptions struct {
+	//最初の待ち時間、0なら500ms
+	Min time.Duration
+	//待ち時間の上限、0なら30秒
+	Max time.Duration
+}
+
+// Backoff returns exponentially growing waits with jitter for retrying a connection.
+// It is not safe for concurrent use.
+type Backoff struct {
+	options BackoffOptions
+	rnd     *rand.Rand
+
+	//次の待ち時間の基準、jitter を加える前
+	next time.Duration
+}
+
+// NewBackoff returns a Backoff starting from options.Min.
+func NewBackoff(options BackoffOptions) *Backoff {
+	if options.Min <= 0 {
+		options.Min = 500 * time.Millisecond
+	}
+	if options.Max <= 0 {
+		options.Max = 30 * time.Second
+	}
+	if options.Max < options.Min {
+		options.Max = options.Min
+	}
+
+	return &Backoff{
+		options: options,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		next:    options.Min,
+	}
+}
+
+// Next returns the wait before the next attempt and doubles the following one up to Max.
+// The wait is randomized between half and the whole of it so that many clients do not retry together.
+func (thisBackoff *Backoff) Next() time.Duration {
+	base := thisBackoff.next
+	thisBackoff.next *= 2
+	if thisBackoff.next > thisBackoff.options.Max {
+		thisBackoff.next = thisBackoff.options.Max
+	}
+
+	half := base / 2
+	return half + time.Duration(thisBackoff.rnd.Int63n(int64(base-half)+1))
+}
+
+// Reset starts again from Min, call it after a successful attempt.
+func (thisBackoff *Backoff) Reset() {
+	thisBackoff.next = thisBackoff.options.Min
+}
@@ -0,0 +1,56 @@
+package pingclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		options BackoffOptions
+		//jitter を加える前の待ち時間の並び
+		want []time.Duration
+	}{
+		{
+			name: "defaults",
+			want: []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second},
+		},
+		{
+			name:    "doubles up to max",
+			options: BackoffOptions{Min: 100 * time.Millisecond, Max: 500 * time.Millisecond},
+			want:    []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond},
+		},
+		{
+			name:    "max below min",
+			options: BackoffOptions{Min: time.Second, Max: time.Millisecond},
+			want:    []time.Duration{time.Second, time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backoff := NewBackoff(tt.options)
+			for round := 0; round < 2; round++ {
+				for i, base := range tt.want {
+					got := backoff.Next()
+					if got < base/2 || got > base {
+						t.Errorf("round %d attempt %d = %s, want in [%s, %s]", round, i, got, base/2, base)
+					}
+				}
+				backoff.Reset()
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	backoff := NewBackoff(BackoffOptions{Min: time.Second, Max: time.Second})
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		seen[backoff.Next()] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("waits are not randomized : %v", seen)
+	}
+}
@@ -0,0 +1,113 @@
+// Package pingclient is a client library for ping-grpc-server.
+//
+// It wraps the generated gRPC client and returns plain Go values,
+// so that other tools can drive pingers without parsing CLI output.
+package pingclient
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/umenosuke/ping-grpc-client/proto/pingGrpc"
+)
+
+// Client is a ping-grpc-server client.
+type Client struct {
+	client pb.PingerClient
+}
+
+// New returns a Client using the connection.
+func New(cc grpc.ClientConnInterface) *Client {
+	return NewFromPingerClient(pb.NewPingerClient(cc))
+}
+
+// NewFromPingerClient returns a Client wrapping a generated gRPC client.
+func NewFromPingerClient(client pb.PingerClient) *Client {
+	return &Client{client: client}
+}
+
+// StartOptions is the content of a start request.
+type StartOptions struct {
+	Description string
+	Targets     []StartTarget
+
+	StopPingerSec         uint64
+	IntervalMillisec      uint64
+	TimeoutMillisec       uint64
+	StatisticsCountsNum   uint64
+	StatisticsIntervalSec uint64
+}
+
+// StartTarget is a target of a start request.
+type StartTarget struct {
+	TargetIP string
+	Comment  string
+	//応答が無いことを期待する対象、サーバーへは Comment の先頭の印として渡す
+	ExpectUnreachable bool
+}
+
+// Start starts a pinger and returns its PingerID.
+func (thisClient *Client) Start(ctx context.Context, opts StartOptions) (uint32, error) {
+	targets := make([]*pb.StartRequest_IcmpTarget, 0, len(opts.Targets))
+	for _, t := range opts.Targets {
+		targets = append(targets, &pb.StartRequest_IcmpTarget{
+			TargetIP: t.TargetIP,
+			Comment:  encodeExpectUnreachable(t.Comment, t.ExpectUnreachable),
+		})
+	}
+
+	res, err := thisClient.client.Start(ctx, &pb.StartRequest{
+		Description:           opts.Description,
+		Targets:               targets,
+		StopPingerSec:         opts.StopPingerSec,
+		IntervalMillisec:      opts.IntervalMillisec,
+		TimeoutMillisec:       opts.TimeoutMillisec,
+		StatisticsCountsNum:   opts.StatisticsCountsNum,
+		StatisticsIntervalSec: opts.StatisticsIntervalSec,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return res.GetPingerID(), nil
+}
+
+// Stop stops the pinger.
+func (thisClient *Client) Stop(ctx context.Context, pingerID uint32) error {
+	_, err := thisClient.client.Stop(ctx, &pb.PingerID{PingerID: pingerID})
+	return err
+}
+
+// List returns the running pingers in start order.
+func (thisClient *Client) List(ctx context.Context) ([]PingerSummary, error) {
+	list, err := thisClient.client.GetPingerList(ctx, &pb.Null{})
+	if err != nil {
+		return nil, err
+	}
+
+	pingers := make([]PingerSummary, 0, len(list.GetPingers()))
+	for _, p := range list.GetPingers() {
+		pingers = append(pingers, PingerSummary{
+			PingerID:    p.GetPingerID(),
+			Description: p.GetDescription(),
+			StartTime:   time.Unix(0, int64(p.GetStartUnixNanosec())),
+			ExpireTime:  time.Unix(0, int64(p.GetExpireUnixNanosec())),
+		})
+	}
+	sort.SliceStable(pingers, func(i, j int) bool { return pingers[i].StartTime.Before(pingers[j].StartTime) })
+
+	return pingers, nil
+}
+
+// Info returns the detail of the pinger.
+func (thisClient *Client) Info(ctx context.Context, pingerID uint32) (PingerInfo, error) {
+	info, err := thisClient.client.GetPingerInfo(ctx, &pb.PingerID{PingerID: pingerID})
+	if err != nil {
+		return PingerInfo{}, err
+	}
+
+	return newPingerInfo(pingerID, info), nil
+}
@@ -0,0 +1,269 @@
+package pingclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of a state change.
+type EventType int
+
+// EventType values.
+const (
+	EventDown = EventType(iota + 1)
+	EventUp
+	//多くの対象が同じ時間帯に DOWN になった、観測点やサーバー側の障害
+	EventMassDown
+	//EventMassDown からの復旧
+	EventMassUp
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventDown:
+		return "DOWN"
+	case EventUp:
+		return "UP"
+	case EventMassDown:
+		return "MASS-DOWN"
+	case EventMassUp:
+		return "MASS-UP"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// IsDown reports whether the event is a DOWN of a target or of the whole pinger.
+func (t EventType) IsDown() bool {
+	return t == EventDown || t == EventMassDown
+}
+
+// IsMass reports whether the event is about the whole pinger rather than a target.
+func (t EventType) IsMass() bool {
+	return t == EventMassDown || t == EventMassUp
+}
+
+// Event is a state change of a target.
+// For EventMassDown and EventMassUp Target is empty and
+// Affected and TargetCount are set instead.
+type Event struct {
+	Type     EventType
+	PingerID uint32
+	Target   Target
+	//状態変化を確定させた結果の時刻
+	Time time.Time
+	//最初に失敗したpingの送信時刻
+	Since time.Time
+	//UPのみ、最初の失敗から復旧後最初の成功までの時間
+	OutageDuration time.Duration
+	//失敗したpingの数、DOWNでは確定までの数(ExpectUnreachable の対象では応答の数)
+	LostCount         int64
+	FirstLostSequence int64
+	LastLostSequence  int64
+
+	//MASSのみ、障害に含まれた対象の数と、判定の対象になった(ExpectUnreachable 以外の)対象の数
+	Affected    int
+	TargetCount int
+}
+
+// Hysteresis is the number of consecutive results needed to change state.
+type Hysteresis struct {
+	//DOWNとみなす連続失敗回数
+	DownCount uint64 `json:"DownCount"`
+	//UPとみなす連続成功回数
+	UpCount uint64 `json:"UpCount"`
+}
+
+// EventDetectorOptions is the setting of an EventDetector.
+type EventDetectorOptions struct {
+	Default Hysteresis
+	//対象ごとの設定、キーは開始時の TargetIP
+	Targets map[string]Hysteresis
+}
+
+type targetState int
+
+const (
+	targetStateUnknown = targetState(iota)
+	targetStateUp
+	targetStateDown
+)
+
+type targetEventState struct {
+	target     Target
+	hysteresis Hysteresis
+	state      targetState
+
+	successRun int64
+	failRun    int64
+
+	//現在の失敗の連続(DOWN中は復旧まで)
+	since     time.Time
+	lostCount int64
+	firstLost int64
+	lastLost  int64
+	recoverAt time.Time
+}
+
+// EventDetector turns Results into DOWN/UP Events with hysteresis.
+// A target that is up from the beginning emits no UP event.
+// For ExpectUnreachable targets replies count as failures, so DOWN means
+// the target started answering and UP that it stopped again.
+// It is safe for concurrent use.
+type EventDetector struct {
+	mu       sync.Mutex
+	pingerID uint32
+	options  EventDetectorOptions
+	targets  map[uint32]*targetEventState
+}
+
+// NewEventDetector returns an EventDetector for the targets of the pinger.
+func NewEventDetector(info PingerInfo, options EventDetectorOptions) *EventDetector {
+	d := &EventDetector{
+		pingerID: info.PingerID,
+		options:  options,
+		targets:  make(map[uint32]*targetEventState, len(info.Targets)),
+	}
+	for _, t := range info.Targets {
+		d.targets[t.TargetID] = d.newTargetState(t)
+	}
+
+	return d
+}
+
+func (thisDetector *EventDetector) newTargetState(t Target) *targetEventState {
+	h := thisDetector.options.Default
+	if th, ok := thisDetector.options.Targets[t.TargetIP]; ok {
+		h = th
+	}
+	if h.DownCount == 0 {
+		h.DownCount = 1
+	}
+	if h.UpCount == 0 {
+		h.UpCount = 1
+	}
+
+	return &targetEventState{target: t, hysteresis: h}
+}
+
+// Rebind moves the state of the targets to the new pinger info, matching targets by TargetIP
+// in TargetID order for duplicates, so a target still DOWN when its pinger is recreated
+// gets no second DOWN and its outage is measured from the first loss.
+// FirstLostSequence of such an outage is then a sequence of the old pinger.
+// Targets not in the new info are dropped.
+// It returns the new Target of each old TargetID that was matched.
+func (thisDetector *EventDetector) Rebind(info PingerInfo) map[uint32]Target {
+	thisDetector.mu.Lock()
+	defer thisDetector.mu.Unlock()
+
+	olds := make([]*targetEventState, 0, len(thisDetector.targets))
+	for _, t := range thisDetector.targets {
+		olds = append(olds, t)
+	}
+	sort.Slice(olds, func(i, j int) bool { return olds[i].target.TargetID < olds[j].target.TargetID })
+	byIP := make(map[string][]*targetEventState, len(olds))
+	for _, t := range olds {
+		byIP[t.target.TargetIP] = append(byIP[t.target.TargetIP], t)
+	}
+
+	moved := make(map[uint32]Target, len(info.Targets))
+	targets := make(map[uint32]*targetEventState, len(info.Targets))
+	for _, t := range info.Targets {
+		state := thisDetector.newTargetState(t)
+		if matched := byIP[t.TargetIP]; len(matched) > 0 {
+			old := matched[0]
+			byIP[t.TargetIP] = matched[1:]
+			moved[old.target.TargetID] = t
+			hysteresis := state.hysteresis
+			*state = *old
+			state.target = t
+			state.hysteresis = hysteresis
+		}
+		targets[t.TargetID] = state
+	}
+	thisDetector.pingerID = info.PingerID
+	thisDetector.targets = targets
+
+	return moved
+}
+
+// Add adds a result and returns the state change it caused, if any.
+func (thisDetector *EventDetector) Add(r Result) (Event, bool) {
+	thisDetector.mu.Lock()
+	defer thisDetector.mu.Unlock()
+
+	t, ok := thisDetector.targets[r.Target.TargetID]
+	if !ok {
+		t = thisDetector.newTargetState(r.Target)
+		thisDetector.targets[r.Target.TargetID] = t
+	}
+
+	// ExpectUnreachable の対象は応答が失敗、応答が無いことが成功
+	var success bool
+	switch {
+	case r.AsExpected():
+		success = true
+	case r.Type == ResultTypeTimeout, r.Type == ResultTypeTTLExceeded, r.Target.ExpectUnreachable && r.IsReply():
+		success = false
+	default:
+		return Event{}, false
+	}
+
+	if success {
+		t.failRun = 0
+		t.successRun++
+		if t.state != targetStateDown {
+			t.state = targetStateUp
+			t.lostCount = 0
+			return Event{}, false
+		}
+		if t.successRun == 1 {
+			// 復旧までの時間は連続成功の最初のpingで測る
+			t.recoverAt = time.Unix(0, r.SendTimeUnixNanosec)
+		}
+		if uint64(t.successRun) < t.hysteresis.UpCount {
+			return Event{}, false
+		}
+
+		e := Event{
+			Type:              EventUp,
+			PingerID:          thisDetector.pingerID,
+			Target:            r.Target,
+			Time:              r.ReceiveTime(),
+			Since:             t.since,
+			OutageDuration:    t.recoverAt.Sub(t.since),
+			LostCount:         t.lostCount,
+			FirstLostSequence: t.firstLost,
+			LastLostSequence:  t.lastLost,
+		}
+		t.state = targetStateUp
+		t.lostCount = 0
+		return e, true
+	}
+
+	t.successRun = 0
+	t.failRun++
+	if t.lostCount == 0 {
+		t.since = time.Unix(0, r.SendTimeUnixNanosec)
+		t.firstLost = r.Sequence
+	}
+	t.lostCount++
+	t.lastLost = r.Sequence
+
+	if t.state == targetStateDown || uint64(t.failRun) < t.hysteresis.DownCount {
+		return Event{}, false
+	}
+
+	t.state = targetStateDown
+	return Event{
+		Type:              EventDown,
+		PingerID:          thisDetector.pingerID,
+		Target:            r.Target,
+		Time:              r.ReceiveTime(),
+		Since:             t.since,
+		LostCount:         t.lostCount,
+		FirstLostSequence: t.firstLost,
+		LastLostSequence:  t.lastLost,
+	}, true
+}
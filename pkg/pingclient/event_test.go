@@ -0,0 +1,215 @@
+package pingclient
+
+import (
+	"testing"
+	"time"
+)
+
+var testBase = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// testResults returns results of the target, one per second from sequence 0.
+// O is Receive, X Timeout, T TTL Exceeded and L ReceiveAfterTimeout.
+func testResults(target Target, types string) []Result {
+	results := make([]Result, 0, len(types))
+	for i, c := range types {
+		r := Result{
+			PingerID:            1,
+			Target:              target,
+			Sequence:            int64(i),
+			SendTimeUnixNanosec: testBase.Add(time.Duration(i) * time.Second).UnixNano(),
+		}
+		r.ReceiveTimeUnixNanosec = r.SendTimeUnixNanosec + int64(10*time.Millisecond)
+		switch c {
+		case 'O':
+			r.Type = ResultTypeReceive
+		case 'X':
+			r.Type = ResultTypeTimeout
+		case 'T':
+			r.Type = ResultTypeTTLExceeded
+		case 'L':
+			r.Type = ResultTypeReceiveAfterTimeout
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestEventDetector(t *testing.T) {
+	type wantEvent struct {
+		//イベントを起こした結果の番号
+		at        int
+		typ       EventType
+		lostCount int64
+		firstLost int64
+		lastLost  int64
+		outage    time.Duration
+	}
+
+	tests := []struct {
+		name       string
+		target     Target
+		hysteresis Hysteresis
+		results    string
+		want       []wantEvent
+	}{
+		{
+			name:    "up from the beginning",
+			results: "OOOO",
+		},
+		{
+			name:    "down and up",
+			results: "OOXXOO",
+			want: []wantEvent{
+				{at: 2, typ: EventDown, lostCount: 1, firstLost: 2, lastLost: 2},
+				{at: 4, typ: EventUp, lostCount: 2, firstLost: 2, lastLost: 3, outage: 2 * time.Second},
+			},
+		},
+		{
+			name:    "down from the beginning",
+			results: "XXO",
+			want: []wantEvent{
+				{at: 0, typ: EventDown, lostCount: 1},
+				{at: 2, typ: EventUp, lostCount: 2, firstLost: 0, lastLost: 1, outage: 2 * time.Second},
+			},
+		},
+		{
+			name:       "hysteresis",
+			hysteresis: Hysteresis{DownCount: 3, UpCount: 2},
+			results:    "OXXOXXXXOXOOO",
+			want: []wantEvent{
+				{at: 6, typ: EventDown, lostCount: 3, firstLost: 4, lastLost: 6},
+				{at: 11, typ: EventUp, lostCount: 5, firstLost: 4, lastLost: 9, outage: 6 * time.Second},
+			},
+		},
+		{
+			name:    "ttl exceeded is a failure, late reply is ignored",
+			results: "OTLLO",
+			want: []wantEvent{
+				{at: 1, typ: EventDown, lostCount: 1, firstLost: 1, lastLost: 1},
+				{at: 4, typ: EventUp, lostCount: 1, firstLost: 1, lastLost: 1, outage: 3 * time.Second},
+			},
+		},
+		{
+			name:    "expect unreachable",
+			target:  Target{TargetID: 1, TargetIP: "192.0.2.9", ExpectUnreachable: true},
+			results: "XXOLXT",
+			want: []wantEvent{
+				{at: 2, typ: EventDown, lostCount: 1, firstLost: 2, lastLost: 2},
+				{at: 4, typ: EventUp, lostCount: 2, firstLost: 2, lastLost: 3, outage: 2 * time.Second},
+			},
+		},
+		{
+			name:    "per target hysteresis",
+			target:  Target{TargetID: 1, TargetIP: "192.0.2.2"},
+			results: "OXXO",
+			want: []wantEvent{
+				{at: 2, typ: EventDown, lostCount: 2, firstLost: 1, lastLost: 2},
+				{at: 3, typ: EventUp, lostCount: 2, firstLost: 1, lastLost: 2, outage: 2 * time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target.TargetIP == "" {
+				target = Target{TargetID: 1, TargetIP: "192.0.2.1"}
+			}
+			detector := NewEventDetector(PingerInfo{PingerID: 1, Targets: []Target{target}}, EventDetectorOptions{
+				Default: tt.hysteresis,
+				Targets: map[string]Hysteresis{"192.0.2.2": {DownCount: 2}},
+			})
+
+			got := make(map[int]Event)
+			for i, r := range testResults(target, tt.results) {
+				if e, ok := detector.Add(r); ok {
+					got[i] = e
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events %v, want %d", len(got), got, len(tt.want))
+			}
+			for _, w := range tt.want {
+				e, ok := got[w.at]
+				if !ok {
+					t.Errorf("no event at %d, got %v", w.at, got)
+					continue
+				}
+				if e.Type != w.typ || e.LostCount != w.lostCount || e.FirstLostSequence != w.firstLost || e.LastLostSequence != w.lastLost || e.OutageDuration != w.outage {
+					t.Errorf("event at %d = %s lost %d (%d-%d) outage %s, want %s lost %d (%d-%d) outage %s",
+						w.at, e.Type, e.LostCount, e.FirstLostSequence, e.LastLostSequence, e.OutageDuration,
+						w.typ, w.lostCount, w.firstLost, w.lastLost, w.outage)
+				}
+				if e.PingerID != 1 || e.Target != target || !e.Since.Equal(testBase.Add(time.Duration(w.firstLost)*time.Second)) {
+					t.Errorf("event at %d = %+v", w.at, e)
+				}
+			}
+		})
+	}
+}
+
+func TestEventDetectorRebind(t *testing.T) {
+	oldA := Target{TargetID: 1, TargetIP: "192.0.2.1"}
+	oldB := Target{TargetID: 2, TargetIP: "192.0.2.2"}
+	oldDup := Target{TargetID: 3, TargetIP: "192.0.2.1"}
+	d := NewEventDetector(PingerInfo{PingerID: 1, Targets: []Target{oldA, oldB, oldDup}}, EventDetectorOptions{})
+
+	// 作り直す前に A だけ DOWN
+	for _, r := range append(testResults(oldA, "OXX"), append(testResults(oldB, "OOO"), testResults(oldDup, "OOO")...)...) {
+		d.Add(r)
+	}
+
+	newB := Target{TargetID: 1, TargetIP: "192.0.2.2"}
+	newA := Target{TargetID: 2, TargetIP: "192.0.2.1"}
+	newDup := Target{TargetID: 3, TargetIP: "192.0.2.1"}
+	newC := Target{TargetID: 4, TargetIP: "192.0.2.3"}
+	moved := d.Rebind(PingerInfo{PingerID: 2, Targets: []Target{newB, newA, newDup, newC}})
+	if len(moved) != 3 || moved[1] != newA || moved[2] != newB || moved[3] != newDup {
+		t.Fatalf("moved = %v", moved)
+	}
+
+	// 作り直した後の結果は続きの時刻で、Sequence は0から
+	later := func(target Target, types string) []Result {
+		results := testResults(target, types)
+		for i := range results {
+			results[i].PingerID = 2
+			results[i].SendTimeUnixNanosec += int64(10 * time.Second)
+			results[i].ReceiveTimeUnixNanosec += int64(10 * time.Second)
+		}
+		return results
+	}
+
+	events := make([]Event, 0)
+	for _, results := range [][]Result{later(newA, "XXO"), later(newB, "OXO"), later(newDup, "XO"), later(newC, "X")} {
+		for _, r := range results {
+			if e, ok := d.Add(r); ok {
+				events = append(events, e)
+			}
+		}
+	}
+
+	want := []struct {
+		typ    EventType
+		target Target
+		lost   int64
+		outage time.Duration
+	}{
+		// A は作り直す前の最初の損失から数える
+		{typ: EventUp, target: newA, lost: 4, outage: 11 * time.Second},
+		{typ: EventDown, target: newB, lost: 1},
+		{typ: EventUp, target: newB, lost: 1, outage: 1 * time.Second},
+		{typ: EventDown, target: newDup, lost: 1},
+		{typ: EventUp, target: newDup, lost: 1, outage: 1 * time.Second},
+		{typ: EventDown, target: newC, lost: 1},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %+v", events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Type != w.typ || e.Target != w.target || e.PingerID != 2 || e.LostCount != w.lost || e.OutageDuration != w.outage {
+			t.Errorf("event %d = %s %+v lost %d outage %s, want %s %+v lost %d outage %s", i, e.Type, e.Target, e.LostCount, e.OutageDuration, w.typ, w.target, w.lost, w.outage)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package pingclient
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MassFailureOptions is the setting of a MassFailureDetector.
+type MassFailureOptions struct {
+	//同じ時間帯に DOWN になった対象がこの割合(%)以上なら1つの障害(観測点やサーバー側の障害)とみなす、0なら検出しない
+	Percent float64
+	//DOWN になった対象がこの数より少なければ障害とみなさない、0なら3
+	MinTargets int
+	//同じ時間帯とみなす幅、DOWN はこの間保留される、0なら IntervalMillisec の2倍
+	Window time.Duration
+}
+
+// Threshold returns the number of failing targets out of total that makes a mass failure,
+// or 0 when it can not happen.
+// ExpectUnreachable targets should not be counted in total.
+func (options MassFailureOptions) Threshold(total int) int {
+	if options.Percent <= 0 || total == 0 {
+		return 0
+	}
+	minTargets := options.MinTargets
+	if minTargets <= 0 {
+		minTargets = 3
+	}
+
+	threshold := int(math.Ceil(float64(total) * options.Percent / 100))
+	if threshold < minTargets {
+		threshold = minTargets
+	}
+	if threshold > total {
+		return 0
+	}
+	return threshold
+}
+
+// MassFailureDetector turns Results into Events like EventDetector, but
+// reports many targets going DOWN within Window as a single EventMassDown
+// and suppresses their DOWN/UP events until the EventMassUp.
+// The mass failure ends when fewer than half of the threshold are DOWN;
+// targets of it still DOWN at that time get their DOWN event then.
+// ExpectUnreachable targets are neither counted nor suppressed.
+// It is safe for concurrent use.
+type MassFailureDetector struct {
+	mu        sync.Mutex
+	pingerID  uint32
+	events    *EventDetector
+	options   MassFailureOptions
+	window    time.Duration
+	total     int
+	threshold int
+
+	//ExpectUnreachable 以外で DOWN の対象
+	down map[uint32]bool
+	//Window の間保留している DOWN
+	pending []Event
+	//障害中の EventMassDown
+	incident *Event
+	//障害に含めた対象の DOWN
+	absorbed map[uint32]Event
+}
+
+// NewMassFailureDetector returns a MassFailureDetector for the targets of the pinger.
+func NewMassFailureDetector(info PingerInfo, eventOptions EventDetectorOptions, options MassFailureOptions) *MassFailureDetector {
+	total := 0
+	for _, t := range info.Targets {
+		if !t.ExpectUnreachable {
+			total++
+		}
+	}
+	if options.Window <= 0 {
+		options.Window = 2 * time.Duration(info.IntervalMillisec) * time.Millisecond
+		if options.Window <= 0 {
+			options.Window = 2 * time.Second
+		}
+	}
+
+	return &MassFailureDetector{
+		pingerID:  info.PingerID,
+		events:    NewEventDetector(info, eventOptions),
+		options:   options,
+		window:    options.Window,
+		total:     total,
+		threshold: options.Threshold(total),
+		down:      make(map[uint32]bool),
+		absorbed:  make(map[uint32]Event),
+	}
+}
+
+// Rebind moves the state to the new pinger info like EventDetector.Rebind,
+// a mass failure in progress continues with the matched targets.
+func (thisDetector *MassFailureDetector) Rebind(info PingerInfo) {
+	moved := thisDetector.events.Rebind(info)
+
+	thisDetector.mu.Lock()
+	defer thisDetector.mu.Unlock()
+
+	rebindEvent := func(e Event) (Event, bool) {
+		t, ok := moved[e.Target.TargetID]
+		e.PingerID = info.PingerID
+		e.Target = t
+		return e, ok
+	}
+
+	down := make(map[uint32]bool, len(thisDetector.down))
+	for id := range thisDetector.down {
+		if t, ok := moved[id]; ok {
+			down[t.TargetID] = true
+		}
+	}
+	pending := make([]Event, 0, len(thisDetector.pending))
+	for _, p := range thisDetector.pending {
+		if e, ok := rebindEvent(p); ok {
+			pending = append(pending, e)
+		}
+	}
+	absorbed := make(map[uint32]Event, len(thisDetector.absorbed))
+	for _, a := range thisDetector.absorbed {
+		if e, ok := rebindEvent(a); ok {
+			absorbed[e.Target.TargetID] = e
+		}
+	}
+
+	total := 0
+	for _, t := range info.Targets {
+		if !t.ExpectUnreachable {
+			total++
+		}
+	}
+	thisDetector.pingerID = info.PingerID
+	thisDetector.down = down
+	thisDetector.pending = pending
+	thisDetector.absorbed = absorbed
+	thisDetector.total = total
+	thisDetector.threshold = thisDetector.options.Threshold(total)
+	if thisDetector.incident != nil {
+		thisDetector.incident.PingerID = info.PingerID
+		thisDetector.incident.TargetCount = total
+	}
+}
+
+// Add adds a result and returns the events to report, possibly none or several.
+func (thisDetector *MassFailureDetector) Add(r Result) []Event {
+	e, ok := thisDetector.events.Add(r)
+	if thisDetector.threshold == 0 {
+		if ok {
+			return []Event{e}
+		}
+		return nil
+	}
+
+	now := r.ReceiveTime()
+	if r.ReceiveTimeUnixNanosec == 0 {
+		now = time.Unix(0, r.SendTimeUnixNanosec)
+	}
+
+	thisDetector.mu.Lock()
+	defer thisDetector.mu.Unlock()
+
+	var res []Event
+	if ok {
+		res = thisDetector.addEvent(res, e)
+	}
+	res = thisDetector.release(res, now)
+	switch {
+	case thisDetector.incident == nil && len(thisDetector.pending) >= thisDetector.threshold:
+		res = thisDetector.start(res, now)
+	case thisDetector.incident != nil && len(thisDetector.down)*2 < thisDetector.threshold:
+		res = thisDetector.end(res, now)
+	}
+
+	return res
+}
+
+// Flush returns the DOWN events still held for Window.
+func (thisDetector *MassFailureDetector) Flush() []Event {
+	thisDetector.mu.Lock()
+	defer thisDetector.mu.Unlock()
+
+	res := thisDetector.pending
+	thisDetector.pending = nil
+	return res
+}
+
+func (thisDetector *MassFailureDetector) addEvent(res []Event, e Event) []Event {
+	if e.Target.ExpectUnreachable {
+		return append(res, e)
+	}
+
+	id := e.Target.TargetID
+	if e.Type == EventDown {
+		thisDetector.down[id] = true
+		if thisDetector.incident != nil {
+			thisDetector.absorbed[id] = e
+			thisDetector.incident.Affected++
+			return res
+		}
+		thisDetector.pending = append(thisDetector.pending, e)
+		return res
+	}
+
+	delete(thisDetector.down, id)
+	if _, ok := thisDetector.absorbed[id]; ok {
+		delete(thisDetector.absorbed, id)
+		return res
+	}
+	for i, p := range thisDetector.pending {
+		if p.Target.TargetID == id {
+			// 保留中に復旧したものはそのまま出す
+			thisDetector.pending = append(thisDetector.pending[:i:i], thisDetector.pending[i+1:]...)
+			return append(res, p, e)
+		}
+	}
+	return append(res, e)
+}
+
+// release Window を過ぎた保留中の DOWN を出す
+func (thisDetector *MassFailureDetector) release(res []Event, now time.Time) []Event {
+	kept := thisDetector.pending[:0]
+	for _, p := range thisDetector.pending {
+		if now.Sub(p.Time) >= thisDetector.window {
+			res = append(res, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	thisDetector.pending = kept
+	return res
+}
+
+func (thisDetector *MassFailureDetector) start(res []Event, now time.Time) []Event {
+	incident := Event{
+		Type:        EventMassDown,
+		PingerID:    thisDetector.pingerID,
+		Time:        now,
+		Since:       now,
+		Affected:    len(thisDetector.pending),
+		TargetCount: thisDetector.total,
+	}
+	for _, p := range thisDetector.pending {
+		if p.Since.Before(incident.Since) {
+			incident.Since = p.Since
+		}
+		thisDetector.absorbed[p.Target.TargetID] = p
+	}
+	thisDetector.pending = nil
+	thisDetector.incident = &incident
+
+	return append(res, incident)
+}
+
+func (thisDetector *MassFailureDetector) end(res []Event, now time.Time) []Event {
+	incident := thisDetector.incident
+	res = append(res, Event{
+		Type:           EventMassUp,
+		PingerID:       thisDetector.pingerID,
+		Time:           now,
+		Since:          incident.Since,
+		OutageDuration: now.Sub(incident.Since),
+		Affected:       incident.Affected,
+		TargetCount:    thisDetector.total,
+	})
+
+	// まだ復旧していない対象は個別の障害として出す
+	stillDown := make([]Event, 0, len(thisDetector.absorbed))
+	for _, e := range thisDetector.absorbed {
+		stillDown = append(stillDown, e)
+	}
+	sort.Slice(stillDown, func(i, j int) bool { return stillDown[i].Target.TargetID < stillDown[j].Target.TargetID })
+	res = append(res, stillDown...)
+
+	thisDetector.absorbed = make(map[uint32]Event)
+	thisDetector.incident = nil
+	return res
+}
@@ -0,0 +1,200 @@
+package pingclient
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMassFailureThreshold(t *testing.T) {
+	tests := []struct {
+		options MassFailureOptions
+		total   int
+		want    int
+	}{
+		{options: MassFailureOptions{}, total: 10, want: 0},
+		{options: MassFailureOptions{Percent: 50}, total: 10, want: 5},
+		{options: MassFailureOptions{Percent: 50}, total: 5, want: 3},
+		{options: MassFailureOptions{Percent: 50}, total: 4, want: 3},
+		{options: MassFailureOptions{Percent: 50}, total: 2, want: 0},
+		{options: MassFailureOptions{Percent: 50, MinTargets: 1}, total: 2, want: 1},
+		{options: MassFailureOptions{Percent: 34, MinTargets: 1}, total: 10, want: 4},
+		{options: MassFailureOptions{Percent: 100}, total: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.options.Threshold(tt.total); got != tt.want {
+			t.Errorf("%+v Threshold(%d) = %d, want %d", tt.options, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestMassFailureDetector(t *testing.T) {
+	tests := []struct {
+		name string
+		//"!" の対象は ExpectUnreachable
+		targets string
+		options MassFailureOptions
+		//1秒ごとの対象ごとの結果、O は Receive で X は Timeout
+		steps []string
+		//step ごとの Event
+		want      [][]string
+		wantFlush []string
+	}{
+		{
+			name:    "mass down and up",
+			targets: ".....",
+			options: MassFailureOptions{Percent: 50},
+			steps:   []string{"OOOOO", "XXXOO", "XXXXO", "OOOXO", "OOOOO"},
+			want: [][]string{
+				nil,
+				{"MASS-DOWN 3/5"},
+				nil,
+				{"MASS-UP 4/5", "DOWN 192.0.2.4"},
+				{"UP 192.0.2.4"},
+			},
+		},
+		{
+			name:    "failures spread beyond the window",
+			targets: ".....",
+			options: MassFailureOptions{Percent: 50},
+			steps:   []string{"OOOOO", "XOOOO", "XOOOO", "XXOOO", "XXOOO", "XXXOO"},
+			want: [][]string{
+				nil,
+				nil,
+				nil,
+				{"DOWN 192.0.2.1"},
+				nil,
+				{"DOWN 192.0.2.2"},
+			},
+			wantFlush: []string{"DOWN 192.0.2.3"},
+		},
+		{
+			name:    "recovered while held",
+			targets: ".....",
+			options: MassFailureOptions{Percent: 50},
+			steps:   []string{"OOOOO", "XOOOO", "OOOOO"},
+			want: [][]string{
+				nil,
+				nil,
+				{"DOWN 192.0.2.1", "UP 192.0.2.1"},
+			},
+		},
+		{
+			name:    "disabled",
+			targets: ".....",
+			steps:   []string{"OOOOO", "XXXXX", "OOOOO"},
+			want: [][]string{
+				nil,
+				{"DOWN 192.0.2.1", "DOWN 192.0.2.2", "DOWN 192.0.2.3", "DOWN 192.0.2.4", "DOWN 192.0.2.5"},
+				{"UP 192.0.2.1", "UP 192.0.2.2", "UP 192.0.2.3", "UP 192.0.2.4", "UP 192.0.2.5"},
+			},
+		},
+		{
+			name:    "expect unreachable is neither counted nor held",
+			targets: "...!",
+			options: MassFailureOptions{Percent: 50, MinTargets: 2},
+			steps:   []string{"OOOX", "XOOO", "XXOO"},
+			want: [][]string{
+				nil,
+				{"DOWN 192.0.2.4"},
+				{"MASS-DOWN 2/3"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := make([]Target, 0, len(tt.targets))
+			for i, c := range tt.targets {
+				targets = append(targets, Target{TargetID: uint32(i + 1), TargetIP: fmt.Sprintf("192.0.2.%d", i+1), ExpectUnreachable: c == '!'})
+			}
+			info := PingerInfo{PingerID: 1, Targets: targets, IntervalMillisec: 1000}
+			detector := NewMassFailureDetector(info, EventDetectorOptions{}, tt.options)
+
+			format := func(events []Event) []string {
+				var res []string
+				for _, e := range events {
+					if e.Type.IsMass() {
+						res = append(res, fmt.Sprintf("%s %d/%d", e.Type, e.Affected, e.TargetCount))
+					} else {
+						res = append(res, e.Type.String()+" "+e.Target.TargetIP)
+					}
+				}
+				return res
+			}
+
+			for step, types := range tt.steps {
+				var got []Event
+				for i, c := range types {
+					r := Result{PingerID: 1, Target: targets[i], Sequence: int64(step), Type: ResultTypeReceive}
+					if c == 'X' {
+						r.Type = ResultTypeTimeout
+					}
+					r.SendTimeUnixNanosec = testBase.Add(time.Duration(step) * time.Second).UnixNano()
+					r.ReceiveTimeUnixNanosec = r.SendTimeUnixNanosec + int64(10*time.Millisecond)
+					got = append(got, detector.Add(r)...)
+				}
+				if gotStr := format(got); !reflect.DeepEqual(gotStr, tt.want[step]) {
+					t.Errorf("step %d events = %v, want %v", step, gotStr, tt.want[step])
+				}
+			}
+			if got := format(detector.Flush()); !reflect.DeepEqual(got, tt.wantFlush) {
+				t.Errorf("Flush = %v, want %v", got, tt.wantFlush)
+			}
+		})
+	}
+}
+
+func TestMassFailureDetectorRebind(t *testing.T) {
+	targets := func(pingerID uint32) []Target {
+		res := make([]Target, 0, 5)
+		for i := 0; i < 5; i++ {
+			// 作り直した pinger では TargetID の順番が逆
+			id := uint32(i + 1)
+			if pingerID == 2 {
+				id = uint32(5 - i)
+			}
+			res = append(res, Target{TargetID: id, TargetIP: fmt.Sprintf("192.0.2.%d", i+1)})
+		}
+		return res
+	}
+	detector := NewMassFailureDetector(PingerInfo{PingerID: 1, Targets: targets(1), IntervalMillisec: 1000}, EventDetectorOptions{}, MassFailureOptions{Percent: 50})
+
+	add := func(pingerID uint32, step int, types string) []string {
+		var res []string
+		for i, c := range types {
+			r := Result{PingerID: pingerID, Target: targets(pingerID)[i], Sequence: int64(step), Type: ResultTypeReceive}
+			if c == 'X' {
+				r.Type = ResultTypeTimeout
+			}
+			r.SendTimeUnixNanosec = testBase.Add(time.Duration(step) * time.Second).UnixNano()
+			r.ReceiveTimeUnixNanosec = r.SendTimeUnixNanosec + int64(10*time.Millisecond)
+			for _, e := range detector.Add(r) {
+				res = append(res, fmt.Sprintf("%s %d %s#%d", e.Type, e.PingerID, e.Target.TargetIP, e.Target.TargetID))
+			}
+		}
+		return res
+	}
+
+	steps := []struct {
+		pingerID uint32
+		types    string
+		want     []string
+	}{
+		{pingerID: 1, types: "OOOOO"},
+		{pingerID: 1, types: "XXXOO", want: []string{"MASS-DOWN 1 #0"}},
+		// 作り直した後も障害中のまま、DOWN は出ない
+		{pingerID: 2, types: "XXXOO"},
+		{pingerID: 2, types: "OOXOO", want: []string{"MASS-UP 2 #0", "DOWN 2 192.0.2.3#3"}},
+		{pingerID: 2, types: "OOOOO", want: []string{"UP 2 192.0.2.3#3"}},
+	}
+	for step, s := range steps {
+		if step == 2 {
+			detector.Rebind(PingerInfo{PingerID: 2, Targets: targets(2), IntervalMillisec: 1000})
+		}
+		if got := add(s.pingerID, step, s.types); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("step %d events = %v, want %v", step, got, s.want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package pingclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// sequenceWindow is the number of recent sequences kept per target
+// to tell duplicates from late deliveries.
+const sequenceWindow = 4096
+
+// SequenceAnomalyType is the kind of a sequence problem.
+type SequenceAnomalyType int
+
+// SequenceAnomalyType values.
+const (
+	SequenceMissing = SequenceAnomalyType(iota + 1)
+	SequenceDuplicate
+	SequenceReordered
+)
+
+func (t SequenceAnomalyType) String() string {
+	switch t {
+	case SequenceMissing:
+		return "MISSING"
+	case SequenceDuplicate:
+		return "DUPLICATE"
+	case SequenceReordered:
+		return "REORDERED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// SequenceAnomaly is a problem in the results delivered for a target,
+// as opposed to a lost ping which is delivered as a Timeout.
+type SequenceAnomaly struct {
+	Type     SequenceAnomalyType
+	PingerID uint32
+	Target   Target
+	//検出のきっかけになった結果の時刻
+	Time time.Time
+	//MISSING は届かなかった連続した範囲、それ以外は届いた結果のシーケンス
+	FirstSequence int64
+	LastSequence  int64
+	//届いた時点で最も新しいシーケンス
+	MaxSequence int64
+	//REORDERED のみ、MISSING として数えた後に届いた
+	WasMissing bool
+}
+
+// Count returns the number of sequences of the anomaly.
+func (a SequenceAnomaly) Count() int64 {
+	return a.LastSequence - a.FirstSequence + 1
+}
+
+// SequenceCounts is the number of sequence problems of a target.
+type SequenceCounts struct {
+	Target Target
+
+	//届いた結果の数(ReceiveAfterTimeout を除く)
+	Delivered int64
+	//届かなかったシーケンスの数(後から届いたものは除く)
+	Missing   int64
+	Duplicate int64
+	Reordered int64
+}
+
+type targetSequenceState struct {
+	counts  SequenceCounts
+	started bool
+	max     int64
+	//max から sequenceWindow 以内で届いたシーケンス
+	seen map[int64]struct{}
+	//まだ届いていないが、入れ替わりの範囲内なので MISSING と決めていないシーケンス
+	pending map[int64]struct{}
+	//MISSING と決めたシーケンス(max から sequenceWindow 以内)
+	missing map[int64]struct{}
+}
+
+// SequenceChecker tracks the sequences delivered per target and reports
+// missing, duplicated and out-of-order results.
+//
+// A pinger decides a Timeout only after TimeoutMillisec, so a result may
+// naturally arrive after the next ones by up to TimeoutMillisec/IntervalMillisec
+// sequences; within that tolerance it is neither missing nor reordered.
+// ReceiveAfterTimeout repeats the sequence of its Timeout and is not checked.
+// It is safe for concurrent use.
+type SequenceChecker struct {
+	mu        sync.Mutex
+	pingerID  uint32
+	tolerance int64
+	order     []uint32
+	targets   map[uint32]*targetSequenceState
+}
+
+// NewSequenceChecker returns a SequenceChecker for the targets of the pinger.
+func NewSequenceChecker(info PingerInfo) *SequenceChecker {
+	tolerance := int64(1)
+	if info.IntervalMillisec > 0 {
+		if t := int64((info.TimeoutMillisec + info.IntervalMillisec - 1) / info.IntervalMillisec); t > tolerance {
+			tolerance = t
+		}
+	}
+
+	c := &SequenceChecker{
+		pingerID:  info.PingerID,
+		tolerance: tolerance,
+		order:     make([]uint32, 0, len(info.Targets)),
+		targets:   make(map[uint32]*targetSequenceState, len(info.Targets)),
+	}
+	for _, t := range info.Targets {
+		c.order = append(c.order, t.TargetID)
+		c.targets[t.TargetID] = newTargetSequenceState(t)
+	}
+
+	return c
+}
+
+func newTargetSequenceState(t Target) *targetSequenceState {
+	return &targetSequenceState{
+		counts:  SequenceCounts{Target: t},
+		seen:    make(map[int64]struct{}),
+		pending: make(map[int64]struct{}),
+		missing: make(map[int64]struct{}),
+	}
+}
+
+// Add adds a result and returns the anomalies it revealed.
+// The first result of a target only sets the starting point.
+func (thisChecker *SequenceChecker) Add(r Result) []SequenceAnomaly {
+	switch r.Type {
+	case ResultTypeReceive, ResultTypeTimeout, ResultTypeTTLExceeded:
+	default:
+		return nil
+	}
+
+	thisChecker.mu.Lock()
+	defer thisChecker.mu.Unlock()
+
+	t, ok := thisChecker.targets[r.Target.TargetID]
+	if !ok {
+		thisChecker.order = append(thisChecker.order, r.Target.TargetID)
+		t = newTargetSequenceState(r.Target)
+		thisChecker.targets[r.Target.TargetID] = t
+	}
+	t.counts.Delivered++
+
+	seq := r.Sequence
+	anomaly := SequenceAnomaly{
+		PingerID:      thisChecker.pingerID,
+		Target:        r.Target,
+		Time:          r.ReceiveTime(),
+		FirstSequence: seq,
+		LastSequence:  seq,
+		MaxSequence:   t.max,
+	}
+
+	switch {
+	case !t.started:
+		t.started = true
+		t.max = seq
+		t.seen[seq] = struct{}{}
+		return nil
+	case seq > t.max:
+		return thisChecker.advance(t, r, seq)
+	case inSet(t.seen, seq) || t.max-seq > sequenceWindow:
+		// 窓より古いものは区別できないので重複として数える
+		t.counts.Duplicate++
+		anomaly.Type = SequenceDuplicate
+		return []SequenceAnomaly{anomaly}
+	case inSet(t.pending, seq) || (!inSet(t.missing, seq) && t.max-seq <= thisChecker.tolerance):
+		// 入れ替わりの範囲内
+		delete(t.pending, seq)
+		t.seen[seq] = struct{}{}
+		return nil
+	default:
+		t.seen[seq] = struct{}{}
+		t.counts.Reordered++
+		anomaly.Type = SequenceReordered
+		if inSet(t.missing, seq) {
+			delete(t.missing, seq)
+			t.counts.Missing--
+			anomaly.WasMissing = true
+		}
+		return []SequenceAnomaly{anomaly}
+	}
+}
+
+func inSet(set map[int64]struct{}, seq int64) bool {
+	_, ok := set[seq]
+	return ok
+}
+
+// advance moves max forward to seq and reports the sequences that became missing.
+func (thisChecker *SequenceChecker) advance(t *targetSequenceState, r Result, seq int64) []SequenceAnomaly {
+	prevMax := t.max
+	t.max = seq
+	t.seen[seq] = struct{}{}
+
+	// max - tolerance より古くてまだ届いていないものは MISSING
+	confirmBelow := seq - thisChecker.tolerance
+	confirmed := make([]int64, 0)
+	for q := range t.pending {
+		if q < confirmBelow {
+			confirmed = append(confirmed, q)
+			delete(t.pending, q)
+		}
+	}
+	sort.Slice(confirmed, func(i, j int) bool { return confirmed[i] < confirmed[j] })
+
+	ranges := make([][2]int64, 0)
+	for _, q := range confirmed {
+		if n := len(ranges); n > 0 && ranges[n-1][1]+1 == q {
+			ranges[n-1][1] = q
+		} else {
+			ranges = append(ranges, [2]int64{q, q})
+		}
+	}
+
+	// 飛ばされたシーケンス
+	if gapFirst, gapLast := prevMax+1, seq-1; gapFirst <= gapLast {
+		if gapFirst < confirmBelow {
+			last := gapLast
+			if last >= confirmBelow {
+				last = confirmBelow - 1
+			}
+			if n := len(ranges); n > 0 && ranges[n-1][1]+1 == gapFirst {
+				ranges[n-1][1] = last
+			} else {
+				ranges = append(ranges, [2]int64{gapFirst, last})
+			}
+			gapFirst = last + 1
+		}
+		for q := gapFirst; q <= gapLast; q++ {
+			t.pending[q] = struct{}{}
+		}
+	}
+
+	windowStart := seq - sequenceWindow
+	anomalies := make([]SequenceAnomaly, 0, len(ranges))
+	for _, rng := range ranges {
+		t.counts.Missing += rng[1] - rng[0] + 1
+		first := rng[0]
+		if first < windowStart {
+			first = windowStart
+		}
+		for q := first; q <= rng[1]; q++ {
+			t.missing[q] = struct{}{}
+		}
+		anomalies = append(anomalies, SequenceAnomaly{
+			Type:          SequenceMissing,
+			PingerID:      thisChecker.pingerID,
+			Target:        r.Target,
+			Time:          r.ReceiveTime(),
+			FirstSequence: rng[0],
+			LastSequence:  rng[1],
+			MaxSequence:   seq,
+		})
+	}
+
+	// 窓から外れたものを捨てる
+	if seq-prevMax > sequenceWindow {
+		for q := range t.seen {
+			if q < windowStart {
+				delete(t.seen, q)
+			}
+		}
+		for q := range t.missing {
+			if q < windowStart {
+				delete(t.missing, q)
+			}
+		}
+	} else {
+		for q := prevMax - sequenceWindow; q < windowStart; q++ {
+			delete(t.seen, q)
+			delete(t.missing, q)
+		}
+	}
+
+	return anomalies
+}
+
+// Snapshot returns the counts of all targets in the order of PingerInfo.Targets.
+func (thisChecker *SequenceChecker) Snapshot() []SequenceCounts {
+	thisChecker.mu.Lock()
+	defer thisChecker.mu.Unlock()
+
+	res := make([]SequenceCounts, 0, len(thisChecker.order))
+	for _, id := range thisChecker.order {
+		res = append(res, thisChecker.targets[id].counts)
+	}
+
+	return res
+}
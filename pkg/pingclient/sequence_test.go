@@ -0,0 +1,150 @@
+package pingclient
+
+import (
+	"testing"
+)
+
+func TestSequenceChecker(t *testing.T) {
+	type wantAnomaly struct {
+		//検出のきっかけになった結果の番号
+		at         int
+		typ        SequenceAnomalyType
+		first      int64
+		last       int64
+		wasMissing bool
+	}
+	type sequence struct {
+		seq int64
+		typ ResultType
+	}
+	receives := func(seqs ...int64) []sequence {
+		res := make([]sequence, 0, len(seqs))
+		for _, seq := range seqs {
+			res = append(res, sequence{seq: seq, typ: ResultTypeReceive})
+		}
+		return res
+	}
+
+	tests := []struct {
+		name      string
+		timeout   uint64
+		sequences []sequence
+		want      []wantAnomaly
+		wantCount SequenceCounts
+	}{
+		{
+			name:      "in order",
+			sequences: receives(0, 1, 2, 3),
+			wantCount: SequenceCounts{Delivered: 4},
+		},
+		{
+			name:      "missing",
+			sequences: receives(0, 1, 4, 5),
+			want: []wantAnomaly{
+				{at: 2, typ: SequenceMissing, first: 2, last: 2},
+				{at: 3, typ: SequenceMissing, first: 3, last: 3},
+			},
+			wantCount: SequenceCounts{Delivered: 4, Missing: 2},
+		},
+		{
+			name:      "missing range",
+			sequences: receives(0, 10),
+			want: []wantAnomaly{
+				{at: 1, typ: SequenceMissing, first: 1, last: 8},
+			},
+			wantCount: SequenceCounts{Delivered: 2, Missing: 8},
+		},
+		{
+			name:      "swapped within tolerance",
+			sequences: receives(0, 2, 1, 3),
+			wantCount: SequenceCounts{Delivered: 4},
+		},
+		{
+			name:      "wider tolerance with a longer timeout",
+			timeout:   3000,
+			sequences: receives(0, 4, 1, 2, 3, 5),
+			wantCount: SequenceCounts{Delivered: 6},
+		},
+		{
+			name:      "duplicate",
+			sequences: receives(0, 1, 1, 0),
+			want: []wantAnomaly{
+				{at: 2, typ: SequenceDuplicate, first: 1, last: 1},
+				{at: 3, typ: SequenceDuplicate, first: 0, last: 0},
+			},
+			wantCount: SequenceCounts{Delivered: 4, Duplicate: 2},
+		},
+		{
+			name:      "reordered after counted as missing",
+			sequences: receives(0, 1, 4, 2),
+			want: []wantAnomaly{
+				{at: 2, typ: SequenceMissing, first: 2, last: 2},
+				{at: 3, typ: SequenceReordered, first: 2, last: 2, wasMissing: true},
+			},
+			wantCount: SequenceCounts{Delivered: 4, Reordered: 1},
+		},
+		{
+			name:      "reordered before the start",
+			sequences: receives(5, 6, 3),
+			want: []wantAnomaly{
+				{at: 2, typ: SequenceReordered, first: 3, last: 3},
+			},
+			wantCount: SequenceCounts{Delivered: 3, Reordered: 1},
+		},
+		{
+			name: "timeouts count, late replies are not checked",
+			sequences: []sequence{
+				{seq: 0, typ: ResultTypeReceive},
+				{seq: 1, typ: ResultTypeTimeout},
+				{seq: 1, typ: ResultTypeReceiveAfterTimeout},
+				{seq: 2, typ: ResultTypeTTLExceeded},
+				{seq: 2, typ: ResultTypeUnknown},
+			},
+			wantCount: SequenceCounts{Delivered: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 1000
+			}
+			target := Target{TargetID: 1, TargetIP: "192.0.2.1"}
+			checker := NewSequenceChecker(PingerInfo{PingerID: 1, IntervalMillisec: 1000, TimeoutMillisec: timeout, Targets: []Target{target}})
+
+			got := make(map[int][]SequenceAnomaly)
+			for i, s := range tt.sequences {
+				r := Result{PingerID: 1, Target: target, Type: s.typ, Sequence: s.seq}
+				if anomalies := checker.Add(r); len(anomalies) > 0 {
+					got[i] = anomalies
+				}
+			}
+
+			n := 0
+			for _, anomalies := range got {
+				n += len(anomalies)
+			}
+			if n != len(tt.want) {
+				t.Fatalf("got %d anomalies %+v, want %d", n, got, len(tt.want))
+			}
+			for _, w := range tt.want {
+				anomalies := got[w.at]
+				if len(anomalies) != 1 {
+					t.Errorf("anomalies at %d = %+v", w.at, anomalies)
+					continue
+				}
+				a := anomalies[0]
+				if a.Type != w.typ || a.FirstSequence != w.first || a.LastSequence != w.last || a.WasMissing != w.wasMissing || a.Target != target {
+					t.Errorf("anomaly at %d = %+v, want %+v", w.at, a, w)
+				}
+			}
+
+			counts := checker.Snapshot()
+			tt.wantCount.Target = target
+			if len(counts) != 1 || counts[0] != tt.wantCount {
+				t.Errorf("counts = %+v, want %+v", counts, tt.wantCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package pingclient
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxRTTSamples is the number of recent RTTs kept per target for percentiles.
+const maxRTTSamples = 10000
+
+// TargetStats is the client-side statistics of a target.
+type TargetStats struct {
+	Target Target
+
+	//結果が確定した数(Receive + Timeout + TTLExceeded)
+	Sent        int64
+	Received    int64
+	Late        int64
+	TTLExceeded int64
+	//(Sent - Received) / Sent
+	LossPercent float64
+
+	LastType ResultType
+	LastRTT  time.Duration
+
+	//RTTはタイムアウト前に返ってきた応答のみで集計
+	Min  time.Duration
+	Avg  time.Duration
+	Max  time.Duration
+	MDev time.Duration
+	//直近 maxRTTSamples 件のパーセンタイル
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+}
+
+type targetAggregate struct {
+	target TargetStats
+	sum    float64
+	sumSq  float64
+	rtts   []time.Duration
+}
+
+// Aggregator computes TargetStats from Results.
+// It is safe for concurrent use.
+type Aggregator struct {
+	mu      sync.Mutex
+	order   []uint32
+	targets map[uint32]*targetAggregate
+}
+
+// NewAggregator returns an Aggregator for the targets of the pinger.
+func NewAggregator(info PingerInfo) *Aggregator {
+	a := &Aggregator{
+		order:   make([]uint32, 0, len(info.Targets)),
+		targets: make(map[uint32]*targetAggregate, len(info.Targets)),
+	}
+	for _, t := range info.Targets {
+		a.order = append(a.order, t.TargetID)
+		a.targets[t.TargetID] = &targetAggregate{target: TargetStats{Target: t}}
+	}
+
+	return a
+}
+
+// Add adds a result.
+func (thisAggregator *Aggregator) Add(r Result) {
+	thisAggregator.mu.Lock()
+	defer thisAggregator.mu.Unlock()
+
+	t, ok := thisAggregator.targets[r.Target.TargetID]
+	if !ok {
+		thisAggregator.order = append(thisAggregator.order, r.Target.TargetID)
+		t = &targetAggregate{target: TargetStats{Target: r.Target}}
+		thisAggregator.targets[r.Target.TargetID] = t
+	}
+
+	t.target.LastType = r.Type
+	t.target.LastRTT = 0
+	switch r.Type {
+	case ResultTypeReceive:
+		rtt := r.RTT()
+		t.target.LastRTT = rtt
+		t.target.Sent++
+		t.target.Received++
+		if t.target.Received == 1 || rtt < t.target.Min {
+			t.target.Min = rtt
+		}
+		if rtt > t.target.Max {
+			t.target.Max = rtt
+		}
+		t.sum += float64(rtt)
+		t.sumSq += float64(rtt) * float64(rtt)
+		t.rtts = append(t.rtts, rtt)
+		if len(t.rtts) > maxRTTSamples {
+			t.rtts = t.rtts[len(t.rtts)-maxRTTSamples:]
+		}
+	case ResultTypeReceiveAfterTimeout:
+		// 直前に Timeout として数えられている
+		t.target.LastRTT = r.RTT()
+		t.target.Late++
+	case ResultTypeTTLExceeded:
+		t.target.Sent++
+		t.target.TTLExceeded++
+	case ResultTypeTimeout:
+		t.target.Sent++
+	}
+}
+
+// Snapshot returns the statistics of all targets in the order of PingerInfo.Targets.
+func (thisAggregator *Aggregator) Snapshot() []TargetStats {
+	thisAggregator.mu.Lock()
+	defer thisAggregator.mu.Unlock()
+
+	res := make([]TargetStats, 0, len(thisAggregator.order))
+	for _, id := range thisAggregator.order {
+		res = append(res, thisAggregator.targets[id].snapshot())
+	}
+
+	return res
+}
+
+func (thisTarget *targetAggregate) snapshot() TargetStats {
+	s := thisTarget.target
+
+	if s.Sent > 0 {
+		s.LossPercent = float64(s.Sent-s.Received) * 100 / float64(s.Sent)
+	}
+
+	if s.Received > 0 {
+		avg := thisTarget.sum / float64(s.Received)
+		s.Avg = time.Duration(avg)
+		s.MDev = time.Duration(math.Sqrt(math.Max(thisTarget.sumSq/float64(s.Received)-avg*avg, 0)))
+
+		sorted := make([]time.Duration, len(thisTarget.rtts))
+		copy(sorted, thisTarget.rtts)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		s.P50 = percentile(sorted, 50)
+		s.P90 = percentile(sorted, 90)
+		s.P99 = percentile(sorted, 99)
+	}
+
+	return s
+}
+
+// percentile uses the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,161 @@
+package pingclient
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// testResult returns a result of the target, the reply arrives rtt after sending.
+func testResult(target Target, seq int64, typ ResultType, rtt time.Duration) Result {
+	send := testBase.Add(time.Duration(seq) * time.Second)
+	r := Result{PingerID: 1, Target: target, Sequence: seq, Type: typ, SendTimeUnixNanosec: send.UnixNano()}
+	if r.IsReply() {
+		r.ReceiveTimeUnixNanosec = send.Add(rtt).UnixNano()
+	}
+	return r
+}
+
+func TestAggregator(t *testing.T) {
+	target := Target{TargetID: 1, TargetIP: "192.0.2.1", TargetBinIP: "192.0.2.1"}
+	ms := time.Millisecond
+
+	//1ms から 10ms を1回ずつ
+	oneToTen := make([]Result, 0, 10)
+	for i := 1; i <= 10; i++ {
+		oneToTen = append(oneToTen, testResult(target, int64(i), ResultTypeReceive, time.Duration(i)*ms))
+	}
+
+	tests := []struct {
+		name    string
+		results []Result
+		want    TargetStats
+	}{
+		{
+			name: "no results",
+			want: TargetStats{Target: target},
+		},
+		{
+			name:    "receives",
+			results: oneToTen,
+			want: TargetStats{
+				Target: target, Sent: 10, Received: 10,
+				LastType: ResultTypeReceive, LastRTT: 10 * ms,
+				//mdev = sqrt(38.5 - 5.5^2) ms
+				Min: 1 * ms, Avg: 5500 * time.Microsecond, Max: 10 * ms, MDev: 2872281 * time.Nanosecond,
+				//nearest rank: ceil(p/100*10) 番目
+				P50: 5 * ms, P90: 9 * ms, P99: 10 * ms,
+			},
+		},
+		{
+			name: "timeout and late reply of the same sequence",
+			results: []Result{
+				testResult(target, 0, ResultTypeReceive, 10*ms),
+				testResult(target, 1, ResultTypeTimeout, 0),
+				testResult(target, 1, ResultTypeReceiveAfterTimeout, 1500*ms),
+				testResult(target, 2, ResultTypeReceive, 30*ms),
+				testResult(target, 3, ResultTypeTimeout, 0),
+				testResult(target, 3, ResultTypeReceiveAfterTimeout, 2500*ms),
+			},
+			want: TargetStats{
+				Target: target, Sent: 4, Received: 2, Late: 2, LossPercent: 50,
+				LastType: ResultTypeReceiveAfterTimeout, LastRTT: 2500 * ms,
+				Min: 10 * ms, Avg: 20 * ms, Max: 30 * ms, MDev: 10 * ms,
+				P50: 10 * ms, P90: 30 * ms, P99: 30 * ms,
+			},
+		},
+		{
+			name: "ttl exceeded and timeout",
+			results: []Result{
+				testResult(target, 0, ResultTypeTTLExceeded, 0),
+				testResult(target, 1, ResultTypeReceive, 20*ms),
+				testResult(target, 2, ResultTypeTimeout, 0),
+				testResult(target, 3, ResultTypeTimeout, 0),
+			},
+			want: TargetStats{
+				Target: target, Sent: 4, Received: 1, TTLExceeded: 1, LossPercent: 75,
+				LastType: ResultTypeTimeout, LastRTT: 0,
+				Min: 20 * ms, Avg: 20 * ms, Max: 20 * ms,
+				P50: 20 * ms, P90: 20 * ms, P99: 20 * ms,
+			},
+		},
+		{
+			name: "loss only",
+			results: []Result{
+				testResult(target, 0, ResultTypeTimeout, 0),
+				testResult(target, 0, ResultTypeReceiveAfterTimeout, 1200*ms),
+				testResult(target, 1, ResultTypeTimeout, 0),
+			},
+			want: TargetStats{
+				Target: target, Sent: 2, Late: 1, LossPercent: 100,
+				LastType: ResultTypeTimeout, LastRTT: 0,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAggregator(PingerInfo{Targets: []Target{target}})
+			for _, r := range tt.results {
+				a.Add(r)
+			}
+
+			stats := a.Snapshot()
+			if len(stats) != 1 {
+				t.Fatalf("got %d targets, want 1", len(stats))
+			}
+			got := stats[0]
+
+			if math.Abs(got.LossPercent-tt.want.LossPercent) > 1e-9 {
+				t.Errorf("LossPercent = %v, want %v", got.LossPercent, tt.want.LossPercent)
+			}
+			got.LossPercent = tt.want.LossPercent
+			if got != tt.want {
+				t.Errorf("got\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregatorPercentileWindow(t *testing.T) {
+	target := Target{TargetID: 1, TargetIP: "192.0.2.1", TargetBinIP: "192.0.2.1"}
+
+	a := NewAggregator(PingerInfo{Targets: []Target{target}})
+	//最初の1件だけ遅く、パーセンタイルの窓からは外れるが Max には残る
+	a.Add(testResult(target, 0, ResultTypeReceive, time.Second))
+	for i := 1; i <= maxRTTSamples; i++ {
+		a.Add(testResult(target, int64(i), ResultTypeReceive, time.Millisecond))
+	}
+
+	got := a.Snapshot()[0]
+	if got.Received != maxRTTSamples+1 || got.Max != time.Second || got.Min != time.Millisecond {
+		t.Errorf("Received, Min, Max = %d, %v, %v, want %d, 1ms, 1s", got.Received, got.Min, got.Max, maxRTTSamples+1)
+	}
+	if got.P50 != time.Millisecond || got.P99 != time.Millisecond {
+		t.Errorf("P50, P99 = %v, %v, want 1ms, 1ms", got.P50, got.P99)
+	}
+}
+
+func TestAggregatorOrder(t *testing.T) {
+	first := Target{TargetID: 1, TargetIP: "192.0.2.1"}
+	second := Target{TargetID: 2, TargetIP: "192.0.2.2"}
+	unknown := Target{TargetID: 9, TargetIP: "192.0.2.9"}
+
+	a := NewAggregator(PingerInfo{Targets: []Target{first, second}})
+	a.Add(testResult(unknown, 0, ResultTypeTimeout, 0))
+	a.Add(testResult(second, 0, ResultTypeReceive, time.Millisecond))
+
+	stats := a.Snapshot()
+	want := []uint32{1, 2, 9}
+	if len(stats) != len(want) {
+		t.Fatalf("got %d targets, want %d", len(stats), len(want))
+	}
+	for i, id := range want {
+		if stats[i].Target.TargetID != id {
+			t.Errorf("stats[%d].Target.TargetID = %d, want %d", i, stats[i].Target.TargetID, id)
+		}
+	}
+	if stats[0].Sent != 0 || stats[1].Received != 1 || stats[2].LossPercent != 100 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,99 @@
+package pingclient
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var targetLineReg = regexp.MustCompile(`^([^# \t]*)[# \t]*(.*)$`)
+
+// ExpectUnreachablePrefix marks a target that must not answer,
+// at the head of a target list line and of the Comment kept by the server.
+const ExpectUnreachablePrefix = "!"
+
+// commentEscape is put before a Comment that starts with "!" or itself by chance,
+// so that only the mark makes a Comment kept by the server start with "!".
+const commentEscape = `\`
+
+func encodeExpectUnreachable(comment string, expectUnreachable bool) string {
+	//サーバーが保持する Comment では印は "!" だけか "! " の後ろにコメントを続ける
+	if !expectUnreachable {
+		if strings.HasPrefix(comment, ExpectUnreachablePrefix) || strings.HasPrefix(comment, commentEscape) {
+			return commentEscape + comment
+		}
+		return comment
+	}
+	if comment == "" {
+		return ExpectUnreachablePrefix
+	}
+	return ExpectUnreachablePrefix + " " + comment
+}
+
+func decodeExpectUnreachable(comment string) (string, bool) {
+	//"!important" のように区切りの無いものは印ではなくコメントとして扱う
+	switch {
+	case comment == ExpectUnreachablePrefix:
+		return "", true
+	case strings.HasPrefix(comment, ExpectUnreachablePrefix+" "):
+		return strings.TrimPrefix(comment, ExpectUnreachablePrefix+" "), true
+	case strings.HasPrefix(comment, commentEscape):
+		return strings.TrimPrefix(comment, commentEscape), false
+	default:
+		return comment, false
+	}
+}
+
+// ParseTargetLine parses a "IP Comment" line of a target list.
+// A line starting with "!" is a target expected to be unreachable.
+// It returns false for empty and comment lines.
+func ParseTargetLine(line string) (StartTarget, bool) {
+	line = strings.Trim(line, " \t")
+	expectUnreachable := strings.HasPrefix(line, ExpectUnreachablePrefix)
+	if expectUnreachable {
+		line = strings.TrimLeft(strings.TrimPrefix(line, ExpectUnreachablePrefix), " \t")
+	}
+	if line == "" {
+		return StartTarget{}, false
+	}
+
+	result := targetLineReg.FindStringSubmatch(line)
+	if result == nil || result[1] == "" {
+		return StartTarget{}, false
+	}
+
+	return StartTarget{
+		TargetIP:          result[1],
+		Comment:           result[2],
+		ExpectUnreachable: expectUnreachable,
+	}, true
+}
+
+// SkippedLine is a line of a target list that was not a target.
+type SkippedLine struct {
+	LineNum int
+	Text    string
+}
+
+// ParseTargets reads a target list, one "IP Comment" per line.
+func ParseTargets(r io.Reader) ([]StartTarget, []SkippedLine, error) {
+	targets := make([]StartTarget, 0)
+	skipped := make([]SkippedLine, 0)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		if t, ok := ParseTargetLine(scanner.Text()); ok {
+			targets = append(targets, t)
+		} else {
+			skipped = append(skipped, SkippedLine{LineNum: lineNum, Text: scanner.Text()})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return targets, skipped, nil
+}
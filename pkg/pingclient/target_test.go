@@ -0,0 +1,80 @@
+package pingclient
+
+import "testing"
+
+func TestExpectUnreachableRoundTrip(t *testing.T) {
+	comments := []string{"", "router", "!important", "! important", "!", "\\", "\\!x", " leading space", "a ! b"}
+	for _, comment := range comments {
+		for _, expectUnreachable := range []bool{false, true} {
+			encoded := encodeExpectUnreachable(comment, expectUnreachable)
+			gotComment, gotExpect := decodeExpectUnreachable(encoded)
+			if gotComment != comment || gotExpect != expectUnreachable {
+				t.Errorf("(%q, %v) -> %q -> (%q, %v)", comment, expectUnreachable, encoded, gotComment, gotExpect)
+			}
+		}
+	}
+}
+
+func TestEncodeExpectUnreachable(t *testing.T) {
+	tests := []struct {
+		comment           string
+		expectUnreachable bool
+		want              string
+	}{
+		{comment: "router", want: "router"},
+		{comment: "!important", want: `\!important`},
+		{comment: `\x`, want: `\\x`},
+		{comment: "", expectUnreachable: true, want: "!"},
+		{comment: "acl", expectUnreachable: true, want: "! acl"},
+		{comment: "!important", expectUnreachable: true, want: "! !important"},
+	}
+	for _, tt := range tests {
+		if got := encodeExpectUnreachable(tt.comment, tt.expectUnreachable); got != tt.want {
+			t.Errorf("encode(%q, %v) = %q, want %q", tt.comment, tt.expectUnreachable, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeExpectUnreachable(t *testing.T) {
+	tests := []struct {
+		comment               string
+		wantComment           string
+		wantExpectUnreachable bool
+	}{
+		{comment: "router", wantComment: "router"},
+		{comment: "!", wantComment: "", wantExpectUnreachable: true},
+		{comment: "! acl", wantComment: "acl", wantExpectUnreachable: true},
+		//他のクライアントが書いた区切りの無い "!" は印ではない
+		{comment: "!important", wantComment: "!important"},
+		{comment: `\!important`, wantComment: "!important"},
+	}
+	for _, tt := range tests {
+		comment, expectUnreachable := decodeExpectUnreachable(tt.comment)
+		if comment != tt.wantComment || expectUnreachable != tt.wantExpectUnreachable {
+			t.Errorf("decode(%q) = (%q, %v), want (%q, %v)", tt.comment, comment, expectUnreachable, tt.wantComment, tt.wantExpectUnreachable)
+		}
+	}
+}
+
+func TestParseTargetLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   StartTarget
+		wantOK bool
+	}{
+		{line: "192.0.2.1 core router", want: StartTarget{TargetIP: "192.0.2.1", Comment: "core router"}, wantOK: true},
+		{line: "192.0.2.1\t# main", want: StartTarget{TargetIP: "192.0.2.1", Comment: "main"}, wantOK: true},
+		{line: "!192.0.2.10 isolated", want: StartTarget{TargetIP: "192.0.2.10", Comment: "isolated", ExpectUnreachable: true}, wantOK: true},
+		{line: "  ! 198.51.100.5", want: StartTarget{TargetIP: "198.51.100.5", ExpectUnreachable: true}, wantOK: true},
+		{line: "10.0.0.1 !important", want: StartTarget{TargetIP: "10.0.0.1", Comment: "!important"}, wantOK: true},
+		{line: "# comment"},
+		{line: "   "},
+		{line: "!"},
+	}
+	for _, tt := range tests {
+		got, ok := ParseTargetLine(tt.line)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("ParseTargetLine(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package pingclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TTLAnalyzerOptions is the setting of a TTLAnalyzer.
+type TTLAnalyzerOptions struct {
+	//続いているかを判定する直近の結果の数、0なら20
+	WindowCount int
+	//直近 WindowCount 件のうち TTL Exceeded がこの割合(%)以上なら続いているとみなす、0なら50
+	//この半分を下回ると解除する
+	PersistentPercent float64
+}
+
+// TTLPeerStats is the TTL exceeded answers of a target from a router.
+type TTLPeerStats struct {
+	PeerIP string
+	Count  int64
+	First  time.Time
+	Last   time.Time
+}
+
+// TargetTTLStats is the TTL exceeded answers of a target.
+type TargetTTLStats struct {
+	Target Target
+
+	//結果が確定した数(Receive + Timeout + TTLExceeded)
+	Decided     int64
+	TTLExceeded int64
+	//直近の結果の数(WindowCount まで)と、そのうちの TTL Exceeded の数
+	RecentCount       int
+	RecentTTLExceeded int
+	//連続した TTL Exceeded の数
+	Consecutive int64
+
+	//TTL Exceeded が続いている(ループやブラックホールの疑い)
+	Persistent bool
+	//Persistent になった結果の時刻
+	PersistentSince time.Time
+
+	//回答したルーターごと、多い順
+	Peers []TTLPeerStats
+}
+
+// TTLChange is a change of TargetTTLStats.Persistent.
+type TTLChange struct {
+	PingerID uint32
+	//変化を確定させた結果の時刻
+	Time  time.Time
+	Stats TargetTTLStats
+}
+
+type targetTTLState struct {
+	stats TargetTTLStats
+	//直近の結果が TTL Exceeded か、リングバッファ
+	recent     []bool
+	recentNext int
+	peers      map[string]*TTLPeerStats
+}
+
+// TTLAnalyzer aggregates TTL exceeded answers per target and per reporting
+// router and flags targets that persistently get them.
+// It is safe for concurrent use.
+type TTLAnalyzer struct {
+	mu       sync.Mutex
+	pingerID uint32
+	options  TTLAnalyzerOptions
+	order    []uint32
+	targets  map[uint32]*targetTTLState
+}
+
+// NewTTLAnalyzer returns a TTLAnalyzer for the targets of the pinger.
+func NewTTLAnalyzer(info PingerInfo, options TTLAnalyzerOptions) *TTLAnalyzer {
+	if options.WindowCount <= 0 {
+		options.WindowCount = 20
+	}
+	if options.PersistentPercent <= 0 {
+		options.PersistentPercent = 50
+	}
+
+	a := &TTLAnalyzer{
+		pingerID: info.PingerID,
+		options:  options,
+		order:    make([]uint32, 0, len(info.Targets)),
+		targets:  make(map[uint32]*targetTTLState, len(info.Targets)),
+	}
+	for _, t := range info.Targets {
+		a.order = append(a.order, t.TargetID)
+		a.targets[t.TargetID] = a.newTargetState(t)
+	}
+
+	return a
+}
+
+func (thisAnalyzer *TTLAnalyzer) newTargetState(t Target) *targetTTLState {
+	return &targetTTLState{
+		stats:  TargetTTLStats{Target: t},
+		recent: make([]bool, 0, thisAnalyzer.options.WindowCount),
+		peers:  make(map[string]*TTLPeerStats),
+	}
+}
+
+// Add adds a result and returns the change of Persistent it caused, if any.
+// Persistent is decided only once WindowCount results are known.
+func (thisAnalyzer *TTLAnalyzer) Add(r Result) (TTLChange, bool) {
+	switch r.Type {
+	case ResultTypeReceive, ResultTypeTimeout, ResultTypeTTLExceeded:
+	default:
+		return TTLChange{}, false
+	}
+
+	thisAnalyzer.mu.Lock()
+	defer thisAnalyzer.mu.Unlock()
+
+	t, ok := thisAnalyzer.targets[r.Target.TargetID]
+	if !ok {
+		thisAnalyzer.order = append(thisAnalyzer.order, r.Target.TargetID)
+		t = thisAnalyzer.newTargetState(r.Target)
+		thisAnalyzer.targets[r.Target.TargetID] = t
+	}
+
+	exceeded := r.Type == ResultTypeTTLExceeded
+	t.stats.Decided++
+	if exceeded {
+		t.stats.TTLExceeded++
+		t.stats.Consecutive++
+
+		peer, ok := t.peers[r.PeerIP]
+		if !ok {
+			peer = &TTLPeerStats{PeerIP: r.PeerIP, First: r.ReceiveTime()}
+			t.peers[r.PeerIP] = peer
+		}
+		peer.Count++
+		peer.Last = r.ReceiveTime()
+	} else {
+		t.stats.Consecutive = 0
+	}
+
+	if len(t.recent) < thisAnalyzer.options.WindowCount {
+		t.recent = append(t.recent, exceeded)
+	} else {
+		if t.recent[t.recentNext] {
+			t.stats.RecentTTLExceeded--
+		}
+		t.recent[t.recentNext] = exceeded
+		t.recentNext = (t.recentNext + 1) % thisAnalyzer.options.WindowCount
+	}
+	t.stats.RecentCount = len(t.recent)
+	if exceeded {
+		t.stats.RecentTTLExceeded++
+	}
+
+	if t.stats.RecentCount < thisAnalyzer.options.WindowCount {
+		return TTLChange{}, false
+	}
+	percent := float64(t.stats.RecentTTLExceeded) * 100 / float64(t.stats.RecentCount)
+	switch {
+	case !t.stats.Persistent && percent >= thisAnalyzer.options.PersistentPercent:
+		t.stats.Persistent = true
+		t.stats.PersistentSince = r.ReceiveTime()
+	case t.stats.Persistent && percent < thisAnalyzer.options.PersistentPercent/2:
+		t.stats.Persistent = false
+		t.stats.PersistentSince = time.Time{}
+	default:
+		return TTLChange{}, false
+	}
+
+	return TTLChange{
+		PingerID: thisAnalyzer.pingerID,
+		Time:     r.ReceiveTime(),
+		Stats:    t.snapshot(),
+	}, true
+}
+
+// Snapshot returns the stats of all targets in the order of PingerInfo.Targets.
+func (thisAnalyzer *TTLAnalyzer) Snapshot() []TargetTTLStats {
+	thisAnalyzer.mu.Lock()
+	defer thisAnalyzer.mu.Unlock()
+
+	res := make([]TargetTTLStats, 0, len(thisAnalyzer.order))
+	for _, id := range thisAnalyzer.order {
+		res = append(res, thisAnalyzer.targets[id].snapshot())
+	}
+
+	return res
+}
+
+func (thisTarget *targetTTLState) snapshot() TargetTTLStats {
+	s := thisTarget.stats
+
+	s.Peers = make([]TTLPeerStats, 0, len(thisTarget.peers))
+	for _, p := range thisTarget.peers {
+		s.Peers = append(s.Peers, *p)
+	}
+	sort.Slice(s.Peers, func(i, j int) bool {
+		if s.Peers[i].Count != s.Peers[j].Count {
+			return s.Peers[i].Count > s.Peers[j].Count
+		}
+		return s.Peers[i].PeerIP < s.Peers[j].PeerIP
+	})
+
+	return s
+}
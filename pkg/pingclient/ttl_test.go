@@ -0,0 +1,191 @@
+package pingclient
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPeerIPs = map[rune]string{'a': "198.51.100.1", 'b': "198.51.100.2", 'c': "198.51.100.3"}
+
+// testTTLResults is testResults, and a, b and c are TTL Exceeded from a router of testPeerIPs.
+func testTTLResults(target Target, types string) []Result {
+	results := testResults(target, strings.Map(func(c rune) rune {
+		if _, ok := testPeerIPs[c]; ok {
+			return 'T'
+		}
+		return c
+	}, types))
+	for i, c := range types {
+		results[i].PeerIP = testPeerIPs[c]
+	}
+	return results
+}
+
+func TestTTLAnalyzer(t *testing.T) {
+	target := Target{TargetID: 1, TargetIP: "192.0.2.1", TargetBinIP: "192.0.2.1"}
+
+	type wantChange struct {
+		//変化を起こした結果の番号
+		at         int
+		persistent bool
+	}
+	type wantPeer struct {
+		peer        rune
+		count       int64
+		first, last int
+	}
+	tests := []struct {
+		name    string
+		options TTLAnalyzerOptions
+		results string
+		want    []wantChange
+
+		wantDecided           int64
+		wantTTLExceeded       int64
+		wantRecentCount       int
+		wantRecentTTLExceeded int
+		wantConsecutive       int64
+		wantPeers             []wantPeer
+	}{
+		{
+			name:                  "not decided until the window is full",
+			results:               "aaa",
+			wantDecided:           3,
+			wantTTLExceeded:       3,
+			wantRecentCount:       3,
+			wantRecentTTLExceeded: 3,
+			wantConsecutive:       3,
+			wantPeers:             []wantPeer{{peer: 'a', count: 3, first: 0, last: 2}},
+		},
+		{
+			name:                  "set at the percent",
+			results:               "OOaOb",
+			want:                  []wantChange{{at: 4, persistent: true}},
+			wantDecided:           5,
+			wantTTLExceeded:       2,
+			wantRecentCount:       4,
+			wantRecentTTLExceeded: 2,
+			wantConsecutive:       1,
+			wantPeers: []wantPeer{
+				{peer: 'a', count: 1, first: 2, last: 2},
+				{peer: 'b', count: 1, first: 4, last: 4},
+			},
+		},
+		{
+			//25% は半分を下回っていないので続いたまま
+			name:                  "cleared below half the percent",
+			results:               "aaaaOOOO",
+			want:                  []wantChange{{at: 3, persistent: true}, {at: 7, persistent: false}},
+			wantDecided:           8,
+			wantTTLExceeded:       4,
+			wantRecentCount:       4,
+			wantRecentTTLExceeded: 0,
+			wantConsecutive:       0,
+			wantPeers:             []wantPeer{{peer: 'a', count: 4, first: 0, last: 3}},
+		},
+		{
+			name:    "peers across set and clear",
+			results: "abcaOOOObcbXb",
+			want: []wantChange{
+				{at: 3, persistent: true},
+				{at: 7, persistent: false},
+				{at: 9, persistent: true},
+			},
+			wantDecided:           13,
+			wantTTLExceeded:       8,
+			wantRecentCount:       4,
+			wantRecentTTLExceeded: 3,
+			wantConsecutive:       1,
+			wantPeers: []wantPeer{
+				{peer: 'b', count: 4, first: 1, last: 12},
+				//同数なら PeerIP 順
+				{peer: 'a', count: 2, first: 0, last: 3},
+				{peer: 'c', count: 2, first: 2, last: 9},
+			},
+		},
+		{
+			name:                  "late replies are not decided results",
+			results:               "aLaLOa",
+			want:                  []wantChange{{at: 5, persistent: true}},
+			wantDecided:           4,
+			wantTTLExceeded:       3,
+			wantRecentCount:       4,
+			wantRecentTTLExceeded: 3,
+			wantConsecutive:       1,
+			wantPeers:             []wantPeer{{peer: 'a', count: 3, first: 0, last: 5}},
+		},
+		{
+			name:                  "timeouts are not ttl exceeded",
+			options:               TTLAnalyzerOptions{WindowCount: 3, PersistentPercent: 60},
+			results:               "XaXaXa",
+			want:                  []wantChange{{at: 3, persistent: true}},
+			wantDecided:           6,
+			wantTTLExceeded:       3,
+			wantRecentCount:       3,
+			wantRecentTTLExceeded: 2,
+			wantConsecutive:       1,
+			wantPeers:             []wantPeer{{peer: 'a', count: 3, first: 1, last: 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			if options.WindowCount == 0 {
+				options = TTLAnalyzerOptions{WindowCount: 4, PersistentPercent: 50}
+			}
+			a := NewTTLAnalyzer(PingerInfo{PingerID: 1, Targets: []Target{target}}, options)
+			results := testTTLResults(target, tt.results)
+
+			var got []wantChange
+			for i, r := range results {
+				c, ok := a.Add(r)
+				if !ok {
+					continue
+				}
+				got = append(got, wantChange{at: i, persistent: c.Stats.Persistent})
+
+				if c.PingerID != 1 || !c.Time.Equal(r.ReceiveTime()) {
+					t.Errorf("change %d: PingerID, Time = %d, %v, want 1, %v", i, c.PingerID, c.Time, r.ReceiveTime())
+				}
+				wantSince := r.ReceiveTime()
+				if !c.Stats.Persistent {
+					wantSince = time.Time{}
+				}
+				if !c.Stats.PersistentSince.Equal(wantSince) {
+					t.Errorf("change %d: PersistentSince = %v, want %v", i, c.Stats.PersistentSince, wantSince)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("changes = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("change[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+
+			s := a.Snapshot()[0]
+			wantPersistent := len(tt.want) > 0 && tt.want[len(tt.want)-1].persistent
+			if s.Decided != tt.wantDecided || s.TTLExceeded != tt.wantTTLExceeded ||
+				s.RecentCount != tt.wantRecentCount || s.RecentTTLExceeded != tt.wantRecentTTLExceeded ||
+				s.Consecutive != tt.wantConsecutive || s.Persistent != wantPersistent {
+				t.Errorf("Decided, TTLExceeded, RecentCount, RecentTTLExceeded, Consecutive, Persistent = %d, %d, %d, %d, %d, %t, want %d, %d, %d, %d, %d, %t",
+					s.Decided, s.TTLExceeded, s.RecentCount, s.RecentTTLExceeded, s.Consecutive, s.Persistent,
+					tt.wantDecided, tt.wantTTLExceeded, tt.wantRecentCount, tt.wantRecentTTLExceeded, tt.wantConsecutive, wantPersistent)
+			}
+
+			if len(s.Peers) != len(tt.wantPeers) {
+				t.Fatalf("Peers = %+v, want %+v", s.Peers, tt.wantPeers)
+			}
+			for i, w := range tt.wantPeers {
+				p := s.Peers[i]
+				if p.PeerIP != testPeerIPs[w.peer] || p.Count != w.count ||
+					!p.First.Equal(results[w.first].ReceiveTime()) || !p.Last.Equal(results[w.last].ReceiveTime()) {
+					t.Errorf("Peers[%d] = %+v, want %s count %d first %d last %d", i, p, testPeerIPs[w.peer], w.count, w.first, w.last)
+				}
+			}
+		})
+	}
+}
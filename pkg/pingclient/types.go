@@ -0,0 +1,203 @@
+package pingclient
+
+import (
+	"time"
+
+	pb "github.com/umenosuke/ping-grpc-client/proto/pingGrpc"
+	"github.com/umenosuke/pinger4"
+)
+
+// PingerSummary is an entry of the pinger list.
+type PingerSummary struct {
+	PingerID    uint32    `json:"PingerID"`
+	Description string    `json:"Description"`
+	StartTime   time.Time `json:"StartTime"`
+	ExpireTime  time.Time `json:"ExpireTime"`
+}
+
+// PingerInfo is the detail of a pinger.
+type PingerInfo struct {
+	PingerID              uint32    `json:"PingerID"`
+	Description           string    `json:"Description"`
+	Targets               []Target  `json:"Targets"`
+	IntervalMillisec      uint64    `json:"IntervalMillisec"`
+	TimeoutMillisec       uint64    `json:"TimeoutMillisec"`
+	StatisticsCountsNum   uint64    `json:"StatisticsCountsNum"`
+	StatisticsIntervalSec uint64    `json:"StatisticsIntervalSec"`
+	StartTime             time.Time `json:"StartTime"`
+	ExpireTime            time.Time `json:"ExpireTime"`
+}
+
+// Target is a ping target of a running pinger.
+type Target struct {
+	TargetID uint32 `json:"TargetID"`
+	//開始時に指定されたアドレス(FQDNの場合あり)
+	TargetIP string `json:"TargetIP"`
+	//名前解決後のアドレス
+	TargetBinIP string `json:"TargetBinIP"`
+	Comment     string `json:"Comment"`
+	//応答が無いことを期待する対象
+	ExpectUnreachable bool `json:"ExpectUnreachable"`
+}
+
+// FQDN returns the name the target was started with, or "" when it was started by address.
+func (t Target) FQDN() string {
+	if t.TargetIP != t.TargetBinIP {
+		return t.TargetIP
+	}
+	return ""
+}
+
+// Target returns the target with the TargetID.
+// Unknown IDs return a Target holding only the ID.
+func (info PingerInfo) Target(targetID uint32) Target {
+	for _, t := range info.Targets {
+		if t.TargetID == targetID {
+			return t
+		}
+	}
+	return Target{TargetID: targetID}
+}
+
+func newPingerInfo(pingerID uint32, info *pb.PingerInfo) PingerInfo {
+	targets := make([]Target, 0, len(info.GetTargets()))
+	for _, t := range info.GetTargets() {
+		comment, expectUnreachable := decodeExpectUnreachable(t.GetComment())
+		targets = append(targets, Target{
+			TargetID:          t.GetTargetID(),
+			TargetIP:          t.GetTargetIP(),
+			TargetBinIP:       t.GetTargetBinIP(),
+			Comment:           comment,
+			ExpectUnreachable: expectUnreachable,
+		})
+	}
+
+	return PingerInfo{
+		PingerID:              pingerID,
+		Description:           info.GetDescription(),
+		Targets:               targets,
+		IntervalMillisec:      info.GetIntervalMillisec(),
+		TimeoutMillisec:       info.GetTimeoutMillisec(),
+		StatisticsCountsNum:   info.GetStatisticsCountsNum(),
+		StatisticsIntervalSec: info.GetStatisticsIntervalSec(),
+		StartTime:             time.Unix(0, int64(info.GetStartUnixNanosec())),
+		ExpireTime:            time.Unix(0, int64(info.GetExpireUnixNanosec())),
+	}
+}
+
+// ResultType is the kind of an ICMP result.
+type ResultType int
+
+// ResultType values, same as pb.IcmpResult_ResultType.
+const (
+	ResultTypeUnknown             = ResultType(pb.IcmpResult_IcmpResultTypeUnknown)
+	ResultTypeReceive             = ResultType(pb.IcmpResult_IcmpResultTypeReceive)
+	ResultTypeReceiveAfterTimeout = ResultType(pb.IcmpResult_IcmpResultTypeReceiveAfterTimeout)
+	ResultTypeTTLExceeded         = ResultType(pb.IcmpResult_IcmpResultTypeTTLExceeded)
+	ResultTypeTimeout             = ResultType(pb.IcmpResult_IcmpResultTypeTimeout)
+)
+
+func (t ResultType) String() string {
+	switch t {
+	case ResultTypeReceive:
+		return "Receive"
+	case ResultTypeReceiveAfterTimeout:
+		return "ReceiveAfterTimeout"
+	case ResultTypeTTLExceeded:
+		return "TTLExceeded"
+	case ResultTypeTimeout:
+		return "Timeout"
+	default:
+		return "Unknown"
+	}
+}
+
+// Result is an ICMP result of a target.
+type Result struct {
+	PingerID               uint32
+	Target                 Target
+	Type                   ResultType
+	Sequence               int64
+	PeerIP                 string
+	SendTimeUnixNanosec    int64
+	ReceiveTimeUnixNanosec int64
+}
+
+// ReceiveTime returns the time the result was decided.
+func (r Result) ReceiveTime() time.Time {
+	return time.Unix(0, r.ReceiveTimeUnixNanosec)
+}
+
+// RTT returns the round trip time.
+// It is meaningful only for Receive and ReceiveAfterTimeout.
+func (r Result) RTT() time.Duration {
+	return time.Duration(r.ReceiveTimeUnixNanosec - r.SendTimeUnixNanosec)
+}
+
+// IsReply reports whether an echo reply arrived, including late ones.
+func (r Result) IsReply() bool {
+	return r.Type == ResultTypeReceive || r.Type == ResultTypeReceiveAfterTimeout
+}
+
+// AsExpected reports whether the result is what the target expects:
+// a reply in time, or for ExpectUnreachable targets no reply at all.
+func (r Result) AsExpected() bool {
+	if r.Target.ExpectUnreachable {
+		return r.Type == ResultTypeTimeout || r.Type == ResultTypeTTLExceeded
+	}
+	return r.Type == ResultTypeReceive
+}
+
+func (info PingerInfo) newResult(res *pb.IcmpResult) Result {
+	return Result{
+		PingerID:               info.PingerID,
+		Target:                 info.Target(res.GetTargetID()),
+		Type:                   ResultType(res.GetType()),
+		Sequence:               res.GetSequence(),
+		PeerIP:                 pinger4.BinIPv4Address2String(pinger4.BinIPv4Address(res.GetBinPeerIP())),
+		SendTimeUnixNanosec:    res.GetSendTimeUnixNanosec(),
+		ReceiveTimeUnixNanosec: res.GetReceiveTimeUnixNanosec(),
+	}
+}
+
+// Statistics is a statistics tick of a pinger.
+type Statistics struct {
+	PingerID uint32
+	//クライアントが受信した時刻
+	Time time.Time
+	//何回分の結果を集計しているか
+	CountsNum uint64
+	Targets   []SuccessCount
+}
+
+// SuccessCount is the number of successes of a target within the last CountsNum results.
+type SuccessCount struct {
+	Target Target
+	Count  int64
+	//成功率(%)
+	Rate int64
+}
+
+func (info PingerInfo) newStatistics(res *pb.Statistics, now time.Time) Statistics {
+	countsNum := int64(info.StatisticsCountsNum)
+
+	targets := make([]SuccessCount, 0, len(res.GetTargets()))
+	for _, c := range res.GetTargets() {
+		var rate int64
+		if countsNum > 0 {
+			rate = c.GetCount() * 100 / countsNum
+		}
+		targets = append(targets, SuccessCount{
+			Target: info.Target(c.GetTargetID()),
+			Count:  c.GetCount(),
+			Rate:   rate,
+		})
+	}
+
+	return Statistics{
+		PingerID:  info.PingerID,
+		Time:      now,
+		CountsNum: info.StatisticsCountsNum,
+		Targets:   targets,
+	}
+}
@@ -0,0 +1,133 @@
+package pingclient
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/umenosuke/ping-grpc-client/proto/pingGrpc"
+)
+
+const watchBufferSize = 200
+
+type watchState struct {
+	done chan struct{}
+	err  error
+}
+
+// Err waits for the stream to end and returns the reason.
+// A normal end (server closed the stream or ctx canceled) returns nil.
+func (thisWatch *watchState) Err() error {
+	<-thisWatch.done
+	return thisWatch.err
+}
+
+func (thisWatch *watchState) finish(ctx context.Context, err error) {
+	if err == io.EOF || status.Code(err) == codes.Canceled || ctx.Err() != nil {
+		err = nil
+	}
+	thisWatch.err = err
+}
+
+// ResultWatch is a subscription to the ICMP results of a pinger.
+type ResultWatch struct {
+	watchState
+
+	//購読開始時のpingerの情報
+	Info PingerInfo
+	//購読終了時にcloseされる
+	C <-chan Result
+}
+
+// WatchResults subscribes to the ICMP results of the pinger until ctx is canceled or the stream ends.
+func (thisClient *Client) WatchResults(ctx context.Context, pingerID uint32) (*ResultWatch, error) {
+	info, err := thisClient.Info(ctx, pingerID)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := thisClient.client.GetsIcmpResult(ctx, &pb.PingerID{PingerID: pingerID})
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Result, watchBufferSize)
+	w := &ResultWatch{
+		watchState: watchState{done: make(chan struct{})},
+		Info:       info,
+		C:          ch,
+	}
+
+	go (func() {
+		defer close(w.done)
+		defer close(ch)
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				w.finish(ctx, err)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- info.newResult(res):
+			}
+		}
+	})()
+
+	return w, nil
+}
+
+// StatisticsWatch is a subscription to the statistics of a pinger.
+type StatisticsWatch struct {
+	watchState
+
+	//購読開始時のpingerの情報
+	Info PingerInfo
+	//購読終了時にcloseされる
+	C <-chan Statistics
+}
+
+// WatchStatistics subscribes to the statistics of the pinger until ctx is canceled or the stream ends.
+func (thisClient *Client) WatchStatistics(ctx context.Context, pingerID uint32) (*StatisticsWatch, error) {
+	info, err := thisClient.Info(ctx, pingerID)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := thisClient.client.GetsStatistics(ctx, &pb.PingerID{PingerID: pingerID})
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Statistics, watchBufferSize)
+	w := &StatisticsWatch{
+		watchState: watchState{done: make(chan struct{})},
+		Info:       info,
+		C:          ch,
+	}
+
+	go (func() {
+		defer close(w.done)
+		defer close(ch)
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				w.finish(ctx, err)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- info.newStatistics(res, time.Now()):
+			}
+		}
+	})()
+
+	return w, nil
+}
@@ -0,0 +1,136 @@
+package pingclient
+
+import (
+	"sync"
+	"time"
+)
+
+// WatchdogOptions is the setting of a Watchdog.
+type WatchdogOptions struct {
+	//期待する間隔の何回分届かなければ STALE とみなすか、0なら3
+	StaleCount int
+	//期待する間隔の何回分届かなければ購読し直すか、0なら購読し直さない
+	//購読し直した後も届かなければ、さらにこの回数分ごとに購読し直す
+	ResubscribeCount int
+}
+
+// ResultInterval returns the expected cadence of the result stream of the pinger.
+// Every target produces a result (a reply, a timeout or a TTL exceeded) per interval.
+func ResultInterval(info PingerInfo) time.Duration {
+	return time.Duration(info.IntervalMillisec) * time.Millisecond
+}
+
+// StatisticsInterval returns the expected cadence of the statistics stream of the pinger.
+func StatisticsInterval(info PingerInfo) time.Duration {
+	return time.Duration(info.StatisticsIntervalSec) * time.Second
+}
+
+// ExpectedResults returns how many results of all the targets the pinger produces in d.
+func ExpectedResults(info PingerInfo, d time.Duration) int {
+	interval := ResultInterval(info)
+	if interval <= 0 || d <= 0 {
+		return 0
+	}
+	return int(d/interval) * len(info.Targets)
+}
+
+// ExpectedStatistics returns how many statistics the pinger produces in d.
+func ExpectedStatistics(info PingerInfo, d time.Duration) int {
+	interval := StatisticsInterval(info)
+	if interval <= 0 || d <= 0 {
+		return 0
+	}
+	return int(d / interval)
+}
+
+// Watchdog notices a stream that silently stops delivering.
+// It is safe for concurrent use.
+type Watchdog struct {
+	mu       sync.Mutex
+	interval time.Duration
+	options  WatchdogOptions
+
+	//最後に届いた時刻、購読し直した時はその時刻
+	last time.Time
+	//届いていないと判定した時刻、届いていれば zero
+	staleSince time.Time
+	//最後に届いた時刻、購読し直しても変わらない
+	lastSeen time.Time
+}
+
+// NewWatchdog returns a Watchdog for a stream expected to deliver every interval, subscribed at now.
+// An interval of 0 disables it.
+func NewWatchdog(interval time.Duration, options WatchdogOptions, now time.Time) *Watchdog {
+	if options.StaleCount <= 0 {
+		options.StaleCount = 3
+	}
+
+	return &Watchdog{
+		interval: interval,
+		options:  options,
+		last:     now,
+		lastSeen: now,
+	}
+}
+
+// Interval returns the expected cadence; checking at this interval is enough.
+func (thisWatchdog *Watchdog) Interval() time.Duration {
+	return thisWatchdog.interval
+}
+
+// Seen records a delivery at now and returns how long the stream had been silent
+// if it was stale, or 0.
+func (thisWatchdog *Watchdog) Seen(now time.Time) time.Duration {
+	thisWatchdog.mu.Lock()
+	defer thisWatchdog.mu.Unlock()
+
+	var silent time.Duration
+	if !thisWatchdog.staleSince.IsZero() {
+		silent = now.Sub(thisWatchdog.lastSeen)
+		thisWatchdog.staleSince = time.Time{}
+	}
+	thisWatchdog.last = now
+	thisWatchdog.lastSeen = now
+
+	return silent
+}
+
+// Check reports whether the stream became stale at now (once per silence)
+// and whether it should be subscribed again. Call Resubscribed after doing so.
+func (thisWatchdog *Watchdog) Check(now time.Time) (becameStale bool, resubscribe bool) {
+	thisWatchdog.mu.Lock()
+	defer thisWatchdog.mu.Unlock()
+
+	if thisWatchdog.interval <= 0 {
+		return false, false
+	}
+
+	if thisWatchdog.staleSince.IsZero() && now.Sub(thisWatchdog.lastSeen) >= time.Duration(thisWatchdog.options.StaleCount)*thisWatchdog.interval {
+		thisWatchdog.staleSince = now
+		becameStale = true
+	}
+	if thisWatchdog.options.ResubscribeCount > 0 && now.Sub(thisWatchdog.last) >= time.Duration(thisWatchdog.options.ResubscribeCount)*thisWatchdog.interval {
+		resubscribe = true
+	}
+
+	return becameStale, resubscribe
+}
+
+// Resubscribed restarts the count for the next resubscription from now.
+func (thisWatchdog *Watchdog) Resubscribed(now time.Time) {
+	thisWatchdog.mu.Lock()
+	defer thisWatchdog.mu.Unlock()
+
+	thisWatchdog.last = now
+}
+
+// Silent returns how long nothing has been delivered if the stream is stale, or 0.
+func (thisWatchdog *Watchdog) Silent(now time.Time) time.Duration {
+	thisWatchdog.mu.Lock()
+	defer thisWatchdog.mu.Unlock()
+
+	if thisWatchdog.staleSince.IsZero() {
+		return 0
+	}
+	return now.Sub(thisWatchdog.lastSeen)
+}
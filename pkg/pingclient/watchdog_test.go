@@ -0,0 +1,142 @@
+package pingclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	const (
+		opSeen = iota
+		opCheck
+		opResubscribed
+	)
+	type step struct {
+		op int
+		//購読開始からの時間
+		at time.Duration
+
+		wantStale       bool
+		wantResubscribe bool
+		//Seen の戻り値か、Check の後の Silent
+		wantSilent time.Duration
+	}
+	s := time.Second
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		options  WatchdogOptions
+		steps    []step
+	}{
+		{
+			name:     "delivering",
+			interval: s,
+			steps: []step{
+				{op: opSeen, at: 1 * s},
+				{op: opCheck, at: 2 * s},
+				{op: opSeen, at: 2 * s},
+				{op: opCheck, at: 4 * s},
+			},
+		},
+		{
+			name:     "stale once per silence and recovered",
+			interval: s,
+			steps: []step{
+				{op: opSeen, at: 1 * s},
+				{op: opCheck, at: 3 * s},
+				{op: opCheck, at: 4 * s, wantStale: true, wantSilent: 3 * s},
+				{op: opCheck, at: 5 * s, wantSilent: 4 * s},
+				{op: opSeen, at: 6 * s, wantSilent: 5 * s},
+				{op: opCheck, at: 7 * s},
+				{op: opCheck, at: 9 * s, wantStale: true, wantSilent: 3 * s},
+			},
+		},
+		{
+			name:     "stale count",
+			interval: s,
+			options:  WatchdogOptions{StaleCount: 5},
+			steps: []step{
+				{op: opCheck, at: 4 * s},
+				{op: opCheck, at: 5 * s, wantStale: true, wantSilent: 5 * s},
+			},
+		},
+		{
+			name:     "resubscribe every count",
+			interval: s,
+			options:  WatchdogOptions{StaleCount: 2, ResubscribeCount: 4},
+			steps: []step{
+				{op: opCheck, at: 2 * s, wantStale: true, wantSilent: 2 * s},
+				{op: opCheck, at: 4 * s, wantResubscribe: true, wantSilent: 4 * s},
+				{op: opResubscribed, at: 4 * s},
+				{op: opCheck, at: 7 * s, wantSilent: 7 * s},
+				{op: opCheck, at: 8 * s, wantResubscribe: true, wantSilent: 8 * s},
+				{op: opResubscribed, at: 8 * s},
+				{op: opSeen, at: 9 * s, wantSilent: 9 * s},
+				{op: opCheck, at: 10 * s},
+				{op: opCheck, at: 11 * s, wantStale: true, wantSilent: 2 * s},
+				{op: opCheck, at: 13 * s, wantResubscribe: true, wantSilent: 4 * s},
+			},
+		},
+		{
+			name:     "disabled",
+			interval: 0,
+			options:  WatchdogOptions{ResubscribeCount: 1},
+			steps: []step{
+				{op: opCheck, at: time.Hour},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			watchdog := NewWatchdog(tt.interval, tt.options, start)
+			for i, st := range tt.steps {
+				now := start.Add(st.at)
+				switch st.op {
+				case opSeen:
+					if silent := watchdog.Seen(now); silent != st.wantSilent {
+						t.Errorf("step %d Seen = %s, want %s", i, silent, st.wantSilent)
+					}
+				case opCheck:
+					stale, resubscribe := watchdog.Check(now)
+					if stale != st.wantStale || resubscribe != st.wantResubscribe {
+						t.Errorf("step %d Check = %v, %v, want %v, %v", i, stale, resubscribe, st.wantStale, st.wantResubscribe)
+					}
+					if silent := watchdog.Silent(now); silent != st.wantSilent {
+						t.Errorf("step %d Silent = %s, want %s", i, silent, st.wantSilent)
+					}
+				case opResubscribed:
+					watchdog.Resubscribed(now)
+				}
+			}
+		})
+	}
+}
+
+func TestExpected(t *testing.T) {
+	info := PingerInfo{IntervalMillisec: 500, StatisticsIntervalSec: 2, Targets: make([]Target, 3)}
+	tests := []struct {
+		d              time.Duration
+		wantResults    int
+		wantStatistics int
+	}{
+		{d: 0},
+		{d: 400 * time.Millisecond},
+		{d: 1900 * time.Millisecond, wantResults: 9},
+		{d: 10 * time.Second, wantResults: 60, wantStatistics: 5},
+		{d: -time.Second},
+	}
+	for _, tt := range tests {
+		if got := ExpectedResults(info, tt.d); got != tt.wantResults {
+			t.Errorf("ExpectedResults(%s) = %d, want %d", tt.d, got, tt.wantResults)
+		}
+		if got := ExpectedStatistics(info, tt.d); got != tt.wantStatistics {
+			t.Errorf("ExpectedStatistics(%s) = %d, want %d", tt.d, got, tt.wantStatistics)
+		}
+	}
+	if got := ExpectedResults(PingerInfo{Targets: make([]Target, 3)}, time.Hour); got != 0 {
+		t.Errorf("ExpectedResults without interval = %d", got)
+	}
+}
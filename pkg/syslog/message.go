@@ -0,0 +1,297 @@
+// Package syslog formats pinger results and state changes as RFC 5424
+// messages and sends them over UDP, TCP or TLS.
+//
+// TCP and TLS use octet-counting framing (RFC 6587 / RFC 5425).
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// Severity is the RFC 5424 severity.
+type Severity int
+
+// Severity values.
+const (
+	SeverityEmergency Severity = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInformational
+	SeverityDebug
+)
+
+// Facility is the RFC 5424 facility.
+type Facility int
+
+// Facility values used by ParseFacility.
+const (
+	FacilityUser   Facility = 1
+	FacilityDaemon Facility = 3
+	FacilityLocal0 Facility = 16
+)
+
+// ParseFacility accepts "user", "daemon", "local0" .. "local7" or a number (0-23).
+func ParseFacility(str string) (Facility, error) {
+	switch str {
+	case "user":
+		return FacilityUser, nil
+	case "daemon":
+		return FacilityDaemon, nil
+	}
+	if strings.HasPrefix(str, "local") {
+		n, err := strconv.Atoi(strings.TrimPrefix(str, "local"))
+		if err == nil && n >= 0 && n <= 7 {
+			return FacilityLocal0 + Facility(n), nil
+		}
+	}
+	if n, err := strconv.Atoi(str); err == nil && n >= 0 && n <= 23 {
+		return Facility(n), nil
+	}
+	return 0, fmt.Errorf("syslog: unknown facility %q", str)
+}
+
+// DefaultSDID is the SD-ID of the structured data element.
+// 32473 is the enterprise number reserved for documentation (RFC 5612).
+const DefaultSDID = "ping@32473"
+
+// SDParam is a PARAM-NAME="PARAM-VALUE" of a structured data element.
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+// SDElement is a structured data element.
+type SDElement struct {
+	ID     string
+	Params []SDParam
+}
+
+// Message is an RFC 5424 message.
+type Message struct {
+	Facility Facility
+	Severity Severity
+	Time     time.Time
+	//空白文字列は "-"
+	Hostname string
+	AppName  string
+	ProcID   string
+	MsgID    string
+
+	StructuredData []SDElement
+	Msg            string
+}
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func header(str string, maxLen int) string {
+	// ヘッダは空白を含まない表示可能なASCIIのみ
+	str = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, str)
+	if len(str) > maxLen {
+		str = str[:maxLen]
+	}
+	if str == "" {
+		return "-"
+	}
+	return str
+}
+
+// String returns the message in RFC 5424 format, without framing.
+func (m Message) String() string {
+	b := &strings.Builder{}
+
+	b.WriteString("<" + strconv.Itoa(int(m.Facility)*8+int(m.Severity)) + ">1 ")
+	if m.Time.IsZero() {
+		b.WriteString("- ")
+	} else {
+		b.WriteString(m.Time.Format("2006-01-02T15:04:05.000000Z07:00") + " ")
+	}
+	b.WriteString(header(m.Hostname, 255) + " ")
+	b.WriteString(header(m.AppName, 48) + " ")
+	b.WriteString(header(m.ProcID, 128) + " ")
+	b.WriteString(header(m.MsgID, 32) + " ")
+
+	if len(m.StructuredData) == 0 {
+		b.WriteString("-")
+	}
+	for _, e := range m.StructuredData {
+		b.WriteString("[" + header(e.ID, 32))
+		for _, p := range e.Params {
+			if p.Value == "" {
+				continue
+			}
+			b.WriteString(" " + header(p.Name, 32) + "=\"" + sdValueEscaper.Replace(p.Value) + "\"")
+		}
+		b.WriteString("]")
+	}
+
+	if m.Msg != "" {
+		b.WriteString(" " + m.Msg)
+	}
+
+	return b.String()
+}
+
+// ResultSeverity maps a result type to a severity.
+func ResultSeverity(t pingclient.ResultType) Severity {
+	switch t {
+	case pingclient.ResultTypeReceive:
+		return SeverityInformational
+	case pingclient.ResultTypeReceiveAfterTimeout:
+		return SeverityWarning
+	case pingclient.ResultTypeTTLExceeded, pingclient.ResultTypeTimeout:
+		return SeverityError
+	default:
+		return SeverityNotice
+	}
+}
+
+// EventSeverity maps a state change to a severity.
+func EventSeverity(t pingclient.EventType) Severity {
+	if t.IsDown() {
+		return SeverityError
+	}
+	return SeverityNotice
+}
+
+func targetParams(pingerID uint32, t pingclient.Target) []SDParam {
+	params := []SDParam{
+		{Name: "pingerID", Value: strconv.FormatUint(uint64(pingerID), 10)},
+		{Name: "targetID", Value: strconv.FormatUint(uint64(t.TargetID), 10)},
+		{Name: "targetIP", Value: t.TargetBinIP},
+		{Name: "fqdn", Value: t.FQDN()},
+		{Name: "comment", Value: t.Comment},
+	}
+	if t.ExpectUnreachable {
+		params = append(params, SDParam{Name: "expect", Value: "unreachable"})
+	}
+	return params
+}
+
+// ResultMessage returns the message of a result; only the header fields
+// Facility, Hostname, AppName and ProcID are left to the caller.
+// MsgID is the result type and rtt is in milliseconds.
+func ResultMessage(sdID string, r pingclient.Result) Message {
+	params := append(targetParams(r.PingerID, r.Target),
+		SDParam{Name: "sequence", Value: strconv.FormatInt(r.Sequence, 10)},
+		SDParam{Name: "resultType", Value: r.Type.String()},
+	)
+	if r.IsReply() {
+		params = append(params, SDParam{Name: "rtt", Value: strconv.FormatFloat(float64(r.RTT())/1000/1000, 'f', 3, 64)})
+	}
+	if r.Type == pingclient.ResultTypeTTLExceeded {
+		params = append(params, SDParam{Name: "peerIP", Value: r.PeerIP})
+	}
+
+	var msg string
+	switch r.Type {
+	case pingclient.ResultTypeReceive:
+		msg = fmt.Sprintf("%s seq %d reply %.2fms", r.Target.TargetBinIP, r.Sequence, float64(r.RTT())/1000/1000)
+	case pingclient.ResultTypeReceiveAfterTimeout:
+		msg = fmt.Sprintf("%s seq %d reply %.2fms after timeout", r.Target.TargetBinIP, r.Sequence, float64(r.RTT())/1000/1000)
+	case pingclient.ResultTypeTTLExceeded:
+		msg = fmt.Sprintf("%s seq %d TTL exceeded from %s", r.Target.TargetBinIP, r.Sequence, r.PeerIP)
+	case pingclient.ResultTypeTimeout:
+		msg = fmt.Sprintf("%s seq %d timeout", r.Target.TargetBinIP, r.Sequence)
+	default:
+		msg = fmt.Sprintf("%s seq %d unknown result", r.Target.TargetBinIP, r.Sequence)
+	}
+
+	ts := r.ReceiveTime()
+	if r.ReceiveTimeUnixNanosec == 0 {
+		ts = time.Unix(0, r.SendTimeUnixNanosec)
+	}
+
+	severity := ResultSeverity(r.Type)
+	if r.Target.ExpectUnreachable {
+		// 応答が無いことを期待する対象は応答が異常
+		severity = SeverityInformational
+		if !r.AsExpected() {
+			severity = SeverityError
+		}
+	}
+
+	return Message{
+		Severity:       severity,
+		Time:           ts,
+		MsgID:          r.Type.String(),
+		StructuredData: []SDElement{{ID: sdID, Params: params}},
+		Msg:            msg,
+	}
+}
+
+// EventMessage returns the message of a state change, with MsgID DOWN or UP,
+// or MASS-DOWN or MASS-UP for a mass failure of the pinger.
+func EventMessage(sdID string, e pingclient.Event) Message {
+	if e.Type.IsMass() {
+		return massEventMessage(sdID, e)
+	}
+
+	params := append(targetParams(e.PingerID, e.Target),
+		SDParam{Name: "event", Value: e.Type.String()},
+		SDParam{Name: "lostCount", Value: strconv.FormatInt(e.LostCount, 10)},
+		SDParam{Name: "firstLostSequence", Value: strconv.FormatInt(e.FirstLostSequence, 10)},
+	)
+
+	var msg string
+	if e.Type == pingclient.EventDown {
+		msg = fmt.Sprintf("%s DOWN, %d lost since %s", e.Target.TargetBinIP, e.LostCount, e.Since.Format(time.RFC3339))
+		if e.Target.ExpectUnreachable {
+			msg = fmt.Sprintf("%s DOWN, expected unreachable but %d replies since %s", e.Target.TargetBinIP, e.LostCount, e.Since.Format(time.RFC3339))
+		}
+	} else {
+		params = append(params,
+			SDParam{Name: "lastLostSequence", Value: strconv.FormatInt(e.LastLostSequence, 10)},
+			SDParam{Name: "outage", Value: strconv.FormatFloat(e.OutageDuration.Seconds(), 'f', 3, 64)},
+		)
+		msg = fmt.Sprintf("%s UP, outage %.3fs, %d lost", e.Target.TargetBinIP, e.OutageDuration.Seconds(), e.LostCount)
+		if e.Target.ExpectUnreachable {
+			msg = fmt.Sprintf("%s UP, unreachable again after %.3fs, %d replies", e.Target.TargetBinIP, e.OutageDuration.Seconds(), e.LostCount)
+		}
+	}
+
+	return Message{
+		Severity:       EventSeverity(e.Type),
+		Time:           e.Time,
+		MsgID:          e.Type.String(),
+		StructuredData: []SDElement{{ID: sdID, Params: params}},
+		Msg:            msg,
+	}
+}
+
+func massEventMessage(sdID string, e pingclient.Event) Message {
+	params := []SDParam{
+		{Name: "pingerID", Value: strconv.FormatUint(uint64(e.PingerID), 10)},
+		{Name: "event", Value: e.Type.String()},
+		{Name: "affected", Value: strconv.Itoa(e.Affected)},
+		{Name: "targetCount", Value: strconv.Itoa(e.TargetCount)},
+	}
+
+	var msg string
+	if e.Type == pingclient.EventMassDown {
+		msg = fmt.Sprintf("MASS-DOWN, %d/%d targets down since %s, likely vantage point or server side outage", e.Affected, e.TargetCount, e.Since.Format(time.RFC3339))
+	} else {
+		params = append(params, SDParam{Name: "outage", Value: strconv.FormatFloat(e.OutageDuration.Seconds(), 'f', 3, 64)})
+		msg = fmt.Sprintf("MASS-UP, outage %.3fs, %d/%d targets affected", e.OutageDuration.Seconds(), e.Affected, e.TargetCount)
+	}
+
+	return Message{
+		Severity:       EventSeverity(e.Type),
+		Time:           e.Time,
+		MsgID:          e.Type.String(),
+		StructuredData: []SDElement{{ID: sdID, Params: params}},
+		Msg:            msg,
+	}
+}
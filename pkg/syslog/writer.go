@@ -0,0 +1,117 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Network values.
+const (
+	NetworkUDP = "udp"
+	NetworkTCP = "tcp"
+	NetworkTLS = "tls"
+)
+
+// WriterOptions is the setting of a Writer.
+type WriterOptions struct {
+	//udp, tcp, tls のいずれか
+	Network string
+	//host:port
+	Address string
+	//tls の時のみ、nilなら既定の設定
+	TLSConfig *tls.Config
+	//接続と1回の書き込みのタイムアウト
+	Timeout time.Duration
+}
+
+// Writer sends messages to a syslog receiver.
+// The connection is made on the first Write and remade after a failure.
+// It is safe for concurrent use.
+type Writer struct {
+	options WriterOptions
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewWriter returns a Writer.
+func NewWriter(options WriterOptions) (*Writer, error) {
+	switch options.Network {
+	case NetworkUDP, NetworkTCP, NetworkTLS:
+	default:
+		return nil, fmt.Errorf("syslog: unknown network %q", options.Network)
+	}
+	if _, _, err := net.SplitHostPort(options.Address); err != nil {
+		return nil, fmt.Errorf("syslog: %w", err)
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+
+	return &Writer{options: options}, nil
+}
+
+func (thisWriter *Writer) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: thisWriter.options.Timeout}
+	if thisWriter.options.Network != NetworkTLS {
+		return dialer.Dial(thisWriter.options.Network, thisWriter.options.Address)
+	}
+
+	config := thisWriter.options.TLSConfig
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(thisWriter.options.Address)
+	}
+	return tls.DialWithDialer(dialer, "tcp", thisWriter.options.Address, config)
+}
+
+// Write sends a message, reconnecting once if the connection was broken.
+func (thisWriter *Writer) Write(m Message) error {
+	msg := m.String()
+	if thisWriter.options.Network != NetworkUDP {
+		// octet-counting
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	thisWriter.mu.Lock()
+	defer thisWriter.mu.Unlock()
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if thisWriter.conn == nil {
+			thisWriter.conn, err = thisWriter.dial()
+			if err != nil {
+				thisWriter.conn = nil
+				return err
+			}
+		}
+
+		thisWriter.conn.SetWriteDeadline(time.Now().Add(thisWriter.options.Timeout))
+		if _, err = thisWriter.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		thisWriter.conn.Close()
+		thisWriter.conn = nil
+	}
+	return err
+}
+
+// Close closes the connection.
+func (thisWriter *Writer) Close() error {
+	thisWriter.mu.Lock()
+	defer thisWriter.mu.Unlock()
+
+	if thisWriter.conn == nil {
+		return nil
+	}
+	err := thisWriter.conn.Close()
+	thisWriter.conn = nil
+	return err
+}
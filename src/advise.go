@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+const defaultAdviseDuration = 60 * time.Second
+
+// tAdviseRecord is the output of "advise" in structured output
+type tAdviseRecord struct {
+	Kind                    string                `json:"Kind"`
+	PingerID                uint32                `json:"PingerID"`
+	DurationSec             float64               `json:"DurationSec"`
+	CurrentTimeoutMillisec  uint64                `json:"CurrentTimeoutMillisec"`
+	CurrentIntervalMillisec uint64                `json:"CurrentIntervalMillisec"`
+	TimeoutMillisec         uint64                `json:"TimeoutMillisec"`
+	IntervalMillisec        uint64                `json:"IntervalMillisec"`
+	Targets                 []tAdviseTargetRecord `json:"Targets"`
+}
+
+type tAdviseTargetRecord struct {
+	TargetID                uint32  `json:"TargetID"`
+	TargetIP                string  `json:"TargetIP"`
+	FQDN                    string  `json:"FQDN"`
+	Comment                 string  `json:"Comment"`
+	Replies                 int64   `json:"Replies"`
+	P50Millisec             float64 `json:"P50Millisec"`
+	P90Millisec             float64 `json:"P90Millisec"`
+	P99Millisec             float64 `json:"P99Millisec"`
+	Late                    int64   `json:"Late"`
+	LateMinMillisec         float64 `json:"LateMinMillisec"`
+	LateMaxMillisec         float64 `json:"LateMaxMillisec"`
+	ReplyPercentileMillisec float64 `json:"ReplyPercentileMillisec"`
+	TimeoutMillisec         uint64  `json:"TimeoutMillisec"`
+	InsufficientData        bool    `json:"InsufficientData"`
+}
+
+func newAdviseRecord(pingerID uint32, duration time.Duration, advice pingclient.TimeoutAdvice) tAdviseRecord {
+	record := tAdviseRecord{
+		Kind:                    "advise",
+		PingerID:                pingerID,
+		DurationSec:             duration.Seconds(),
+		CurrentTimeoutMillisec:  advice.CurrentTimeoutMillisec,
+		CurrentIntervalMillisec: advice.CurrentIntervalMillisec,
+		TimeoutMillisec:         advice.TimeoutMillisec,
+		IntervalMillisec:        advice.IntervalMillisec,
+		Targets:                 make([]tAdviseTargetRecord, 0, len(advice.Targets)),
+	}
+	for _, t := range advice.Targets {
+		record.Targets = append(record.Targets, tAdviseTargetRecord{
+			TargetID:                t.Target.TargetID,
+			TargetIP:                t.Target.TargetBinIP,
+			FQDN:                    t.Target.FQDN(),
+			Comment:                 t.Target.Comment,
+			Replies:                 t.Replies,
+			P50Millisec:             durationMillisec(t.P50),
+			P90Millisec:             durationMillisec(t.P90),
+			P99Millisec:             durationMillisec(t.P99),
+			Late:                    t.Late,
+			LateMinMillisec:         durationMillisec(t.LateMin),
+			LateMaxMillisec:         durationMillisec(t.LateMax),
+			ReplyPercentileMillisec: durationMillisec(t.ReplyPercentile),
+			TimeoutMillisec:         t.TimeoutMillisec,
+			InsufficientData:        t.InsufficientData,
+		})
+	}
+	return record
+}
+
+func adviseTargetMsg(t pingclient.TargetTimeoutAdvice, currentTimeoutMillisec uint64) tCliMsg {
+	strColor := cliColorDefault
+	if t.Late > 0 || t.TimeoutMillisec > currentTimeoutMillisec {
+		strColor = cliColorYellow
+	}
+
+	replies := "no replies"
+	if t.Replies > 0 {
+		replies = fmt.Sprintf("%d replies p50/p90/p99 %.2f/%.2f/%.2fms", t.Replies, durationMillisec(t.P50), durationMillisec(t.P90), durationMillisec(t.P99))
+	}
+	late := "no late"
+	if t.Late > 0 {
+		late = fmt.Sprintf("%d late %.2f-%.2fms", t.Late, durationMillisec(t.LateMin), durationMillisec(t.LateMax))
+	}
+	need := "-"
+	if t.TimeoutMillisec > 0 {
+		need = fmt.Sprintf("%dms", t.TimeoutMillisec)
+	}
+	if t.InsufficientData {
+		need += " (insufficient data, not used)"
+	}
+
+	return tCliMsg{
+		text: fmt.Sprintf("%15s - %s, %s - needs timeout %s - %s",
+			t.Target.TargetBinIP,
+			replies,
+			late,
+			need,
+			targetComment(t.Target),
+		),
+		color:   strColor,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+// adviseWriteConfig コンフィグの TimeoutMillisec と IntervalMillisec の値だけを書き換える、無ければ作る
+// 他のキーや順番、空白はそのまま残す
+func adviseWriteConfig(path string, advice pingclient.TimeoutAdvice) error {
+	values := []tAdviseConfigValue{
+		{key: "TimeoutMillisec", value: advice.TimeoutMillisec},
+		{key: "IntervalMillisec", value: advice.IntervalMillisec},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err != nil {
+		data = []byte("{}")
+	}
+
+	patched, err := adviseConfigPatch(data, values)
+	if err != nil {
+		return fmt.Errorf("[%s] %w", path, err)
+	}
+	return ioutil.WriteFile(path, patched, 0644)
+}
+
+type tAdviseConfigValue struct {
+	key   string
+	value uint64
+}
+
+// adviseConfigPatch JSONオブジェクトの一番上のキーの値を置き換える、無いキーは最後に足す
+func adviseConfigPatch(data []byte, values []tAdviseConfigValue) ([]byte, error) {
+	type tSpan struct {
+		start int
+		end   int
+		text  string
+	}
+	spans := make([]tSpan, 0, len(values))
+	found := make([]bool, len(values))
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if token, err := dec.Token(); err != nil {
+		return nil, err
+	} else if token != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+	//最後のメンバーの値の終わりと、そのキーの行の字下げ
+	lastEnd := -1
+	indent := "  "
+	for dec.More() {
+		keyFrom := int(dec.InputOffset())
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string)
+		keyStart := keyFrom + bytes.IndexByte(data[keyFrom:], '"')
+		lineStart := bytes.LastIndexByte(data[:keyStart], '\n') + 1
+		if ws := data[lineStart:keyStart]; len(bytes.TrimLeft(ws, " \t")) == 0 {
+			indent = string(ws)
+		}
+
+		valueFrom := int(dec.InputOffset())
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		lastEnd = int(dec.InputOffset())
+		for i, v := range values {
+			if v.key == key {
+				valueStart := valueFrom + bytes.Index(data[valueFrom:lastEnd], raw)
+				spans = append(spans, tSpan{start: valueStart, end: valueStart + len(raw), text: strconv.FormatUint(v.value, 10)})
+				found[i] = true
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	closeBrace := int(dec.InputOffset()) - 1
+
+	added := ""
+	for i, v := range values {
+		if found[i] {
+			continue
+		}
+		if lastEnd >= 0 || added != "" {
+			added += ","
+		}
+		added += "\n" + indent + strconv.Quote(v.key) + ": " + strconv.FormatUint(v.value, 10)
+	}
+	if added != "" {
+		if lastEnd >= 0 {
+			spans = append(spans, tSpan{start: lastEnd, end: lastEnd, text: added})
+		} else {
+			spans = append(spans, tSpan{start: closeBrace, end: closeBrace, text: added + "\n"})
+		}
+	}
+
+	//後ろから置き換えれば前の位置はずれない
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start > spans[j].start })
+	patched := append([]byte(nil), data...)
+	for _, span := range spans {
+		patched = append(patched[:span.start], append([]byte(span.text), patched[span.end:]...)...)
+	}
+	if !bytes.HasSuffix(patched, []byte("\n")) {
+		patched = append(patched, '\n')
+	}
+	return patched, nil
+}
+
+// advise 動いているpingerのタイムアウト前後の応答のRTTから TimeoutMillisec と IntervalMillisec を勧める
+func (thisClient *tClientWrap) advise(ctx context.Context, chOutPut chan<- tCliMsg, args []string) {
+	exitCode = 1
+
+	flagSet := flag.NewFlagSet("advise", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	var duration time.Duration
+	var writePath string
+	options := pingclient.TimeoutAdvisorOptions{}
+	flagSet.DurationVar(&duration, "duration", defaultAdviseDuration, "how long to watch")
+	flagSet.Float64Var(&options.Percentile, "percentile", 99, "percentile of reply rtt to cover")
+	flagSet.Float64Var(&options.Margin, "margin", 1.5, "multiplier of the percentile")
+	flagSet.IntVar(&options.MinSamples, "min-samples", 20, "replies a target needs to affect the advice")
+	flagSet.BoolVar(&options.AllowDecrease, "allow-decrease", false, "allow advising a timeout below the current one")
+	flagSet.StringVar(&writePath, "write", "", "config file path to write the values into")
+	positional, err := parseFlagsInterspersed(flagSet, args)
+	if err != nil || len(positional) != 1 || duration <= 0 || options.Percentile <= 0 || options.Percentile > 100 || options.Margin <= 0 || options.MinSamples <= 0 {
+		chOutPut <- tCliMsg{
+			text:    "Please enter \"advise {pingerID} [-duration 60s] [-percentile 99] [-margin 1.5] [-min-samples 20] [-allow-decrease] [-write {config path}]\"",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return
+	}
+	pingerID, ok := thisClient.parsePingerID(chOutPut, positional[0])
+	if !ok {
+		return
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	chOutPut <- tCliMsg{
+		text:    fmt.Sprintf("watching pinger %d for %s", pingerID, duration),
+		color:   cliColorDefault,
+		noBreak: false,
+	}
+	var advisor *pingclient.TimeoutAdvisor
+	_, err = thisClient.watchResultsFor(childCtx, pingerID, duration, func(info pingclient.PingerInfo) {
+		advisor = pingclient.NewTimeoutAdvisor(info, options)
+	}, func(result pingclient.Result) {
+		advisor.Add(result)
+	})
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
+	}
+	advice := advisor.Advice()
+
+	if thisClient.output.isMachine() {
+		record := newAdviseRecord(pingerID, duration, advice)
+		chOutPut <- dataMsg(thisClient.output, record, func(w io.Writer) {
+			fmt.Fprintln(w, "TargetIP\tReplies\tP50\tP90\tP99\tLate\tLateMax\tTimeout\tComment")
+			for _, t := range record.Targets {
+				fmt.Fprintf(w, "%s\t%d\t%.2f\t%.2f\t%.2f\t%d\t%.2f\t%d\t%s\n",
+					t.TargetIP,
+					t.Replies,
+					t.P50Millisec,
+					t.P90Millisec,
+					t.P99Millisec,
+					t.Late,
+					t.LateMaxMillisec,
+					t.TimeoutMillisec,
+					t.Comment,
+				)
+			}
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "TimeoutMillisec\t%d -> %d\n", record.CurrentTimeoutMillisec, record.TimeoutMillisec)
+			fmt.Fprintf(w, "IntervalMillisec\t%d -> %d\n", record.CurrentIntervalMillisec, record.IntervalMillisec)
+		})
+	} else {
+		for _, t := range advice.Targets {
+			chOutPut <- adviseTargetMsg(t, advice.CurrentTimeoutMillisec)
+		}
+		strColor := cliColorGreen
+		if advice.TimeoutMillisec != advice.CurrentTimeoutMillisec || advice.IntervalMillisec != advice.CurrentIntervalMillisec {
+			strColor = cliColorYellow
+		}
+		chOutPut <- tCliMsg{
+			text: fmt.Sprintf("advise: TimeoutMillisec %d -> %d, IntervalMillisec %d -> %d (p%g x %g)",
+				advice.CurrentTimeoutMillisec,
+				advice.TimeoutMillisec,
+				advice.CurrentIntervalMillisec,
+				advice.IntervalMillisec,
+				options.Percentile,
+				options.Margin,
+			),
+			color:   strColor,
+			noBreak: false,
+			data:    true,
+		}
+	}
+
+	if writePath != "" {
+		if err := adviseWriteConfig(writePath, advice); err != nil {
+			logger.Log(labelinglog.FlgError, "advise "+err.Error())
+			return
+		}
+		chOutPut <- tCliMsg{
+			text:    "advise: written to [" + writePath + "]",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+	}
+
+	exitCode = 0
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+func TestAdviseConfigPatch(t *testing.T) {
+	values := []tAdviseConfigValue{{key: "TimeoutMillisec", value: 800}, {key: "IntervalMillisec", value: 1000}}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "values replaced in place",
+			data: "{\n  \"StopPingerSec\": 3600,\n  \"TimeoutMillisec\": 500,\n  \"Description\": \"core\",\n  \"IntervalMillisec\":1000.0\n}\n",
+			want: "{\n  \"StopPingerSec\": 3600,\n  \"TimeoutMillisec\": 800,\n  \"Description\": \"core\",\n  \"IntervalMillisec\":1000\n}\n",
+		},
+		{
+			name: "missing key added last with the same indent",
+			data: "{\n    \"TimeoutMillisec\": 500,\n    \"Nested\": {\"IntervalMillisec\": 1}\n}",
+			want: "{\n    \"TimeoutMillisec\": 800,\n    \"Nested\": {\"IntervalMillisec\": 1},\n    \"IntervalMillisec\": 1000\n}\n",
+		},
+		{
+			name: "empty object",
+			data: "{}",
+			want: "{\n  \"TimeoutMillisec\": 800,\n  \"IntervalMillisec\": 1000\n}\n",
+		},
+		{
+			name: "one line",
+			data: "{\"A\": [1, 2], \"TimeoutMillisec\": \"500\"}\n",
+			want: "{\"A\": [1, 2], \"TimeoutMillisec\": 800,\n  \"IntervalMillisec\": 1000}\n",
+		},
+		{
+			name:    "not an object",
+			data:    "[1]",
+			wantErr: true,
+		},
+		{
+			name:    "broken",
+			data:    "{\"TimeoutMillisec\": }",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := adviseConfigPatch([]byte(tt.data), values)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("no error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdviseWriteConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	advice := pingclient.TimeoutAdvice{TimeoutMillisec: 800, IntervalMillisec: 1000}
+	if err := adviseWriteConfig(path, advice); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"TimeoutMillisec\": 800,\n  \"IntervalMillisec\": 1000\n}\n"; string(data) != want {
+		t.Errorf("new config =\n%s", data)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// applyMarkerRegexp apply が起動したpingerの Description は "[apply:{Name}] " で始まる
+var applyMarkerRegexp = regexp.MustCompile(`^\[apply:([^ \t\]]+)\] `)
+
+// exitCodeApplyPending --dry-run で変更が残っている時の終了コード
+const exitCodeApplyPending = 2
+
+type tApplyAction string
+
+const (
+	applyActionCreate  = tApplyAction("create")
+	applyActionReplace = tApplyAction("replace")
+	applyActionDelete  = tApplyAction("delete")
+	applyActionKeep    = tApplyAction("keep")
+)
+
+// tApplyRecord is a line of "apply" in structured output
+type tApplyRecord struct {
+	Kind        string   `json:"Kind"`
+	Action      string   `json:"Action"`
+	Name        string   `json:"Name"`
+	PingerID    uint32   `json:"PingerID"`
+	NewPingerID uint32   `json:"NewPingerID"`
+	Changes     []string `json:"Changes"`
+	DryRun      bool     `json:"DryRun"`
+	Error       string   `json:"Error"`
+}
+
+type tApplyPlan struct {
+	action  tApplyAction
+	name    string
+	spec    *tMonitorSpec
+	current *pingclient.PingerInfo
+	changes []string
+}
+
+func applyDescription(spec tMonitorSpec) string {
+	return "[apply:" + spec.name + "] " + spec.description
+}
+
+// apply 全ての変更ができた時だけ終了コード0、--dry-run で変更があれば exitCodeApplyPending
+func (thisClient *tClientWrap) apply(ctx context.Context, chOutPut chan<- tCliMsg, args []string) {
+	exitCode = 1
+
+	flagSet := flag.NewFlagSet("apply", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	var path string
+	var dryRun bool
+	flagSet.StringVar(&path, "f", "", "monitors file path")
+	flagSet.BoolVar(&dryRun, "dry-run", false, "show the changes without applying them")
+	if err := flagSet.Parse(args); err != nil || path == "" || flagSet.NArg() > 0 {
+		chOutPut <- tCliMsg{
+			text:    "Please enter \"apply -f {monitors file path} [--dry-run]\"",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return
+	}
+
+	_, specs, ok := thisClient.loadMonitors(chOutPut, path)
+	if !ok {
+		return
+	}
+
+	plans, err := thisClient.applyPlans(ctx, specs)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
+	}
+
+	failed := 0
+	pending := 0
+	for _, plan := range plans {
+		if dryRun || plan.action == applyActionKeep {
+			if plan.action != applyActionKeep {
+				pending++
+			}
+			thisClient.printApplyPlan(chOutPut, plan, 0, dryRun, nil)
+			continue
+		}
+
+		var newPingerID uint32
+		var err error
+		if plan.spec != nil {
+			newPingerID, err = thisClient.client.Start(ctx, plan.spec.config.startOptions(applyDescription(*plan.spec), plan.spec.targetList))
+		}
+		// 新しいpingerが動いてから古いものを止める
+		if err == nil && plan.current != nil {
+			err = thisClient.client.Stop(ctx, plan.current.PingerID)
+		}
+		if err != nil {
+			failed++
+		}
+		thisClient.printApplyPlan(chOutPut, plan, newPingerID, false, err)
+	}
+
+	if failed > 0 {
+		return
+	}
+	exitCode = 0
+	if pending > 0 {
+		exitCode = exitCodeApplyPending
+	}
+}
+
+// applyPlans 望む状態と動いているpingerを比べる、触るのは apply の印があるpingerのみ
+func (thisClient *tClientWrap) applyPlans(ctx context.Context, specs []tMonitorSpec) ([]tApplyPlan, error) {
+	pingers, err := thisClient.client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(map[string][]pingclient.PingerInfo)
+	ownedNames := make([]string, 0)
+	for _, p := range pingers {
+		match := applyMarkerRegexp.FindStringSubmatch(p.Description)
+		if match == nil {
+			continue
+		}
+		info, err := thisClient.client.Info(ctx, p.PingerID)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := owned[match[1]]; !ok {
+			ownedNames = append(ownedNames, match[1])
+		}
+		owned[match[1]] = append(owned[match[1]], info)
+	}
+
+	plans := make([]tApplyPlan, 0, len(specs)+len(owned))
+	desired := make(map[string]bool, len(specs))
+	for i := range specs {
+		spec := &specs[i]
+		desired[spec.name] = true
+
+		currents := owned[spec.name]
+		if len(currents) == 0 {
+			plans = append(plans, tApplyPlan{
+				action:  applyActionCreate,
+				name:    spec.name,
+				spec:    spec,
+				changes: []string{fmt.Sprintf("%d targets", len(spec.targetList))},
+			})
+			continue
+		}
+
+		// 同じ名前が複数あれば最新のものを残す
+		current := currents[len(currents)-1]
+		for j := range currents[:len(currents)-1] {
+			plans = append(plans, tApplyPlan{
+				action:  applyActionDelete,
+				name:    spec.name,
+				current: &currents[j],
+				changes: []string{"duplicate"},
+			})
+		}
+
+		changes := applyDiff(*spec, current)
+		action := applyActionKeep
+		if len(changes) > 0 {
+			action = applyActionReplace
+		}
+		plans = append(plans, tApplyPlan{
+			action:  action,
+			name:    spec.name,
+			spec:    spec,
+			current: &current,
+			changes: changes,
+		})
+	}
+
+	for _, name := range ownedNames {
+		if desired[name] {
+			continue
+		}
+		for j := range owned[name] {
+			plans = append(plans, tApplyPlan{
+				action:  applyActionDelete,
+				name:    name,
+				current: &owned[name][j],
+				changes: []string{"not in file"},
+			})
+		}
+	}
+
+	return plans, nil
+}
+
+func applyDiff(spec tMonitorSpec, current pingclient.PingerInfo) []string {
+	changes := make([]string, 0)
+
+	if d := applyDescription(spec); d != current.Description {
+		changes = append(changes, fmt.Sprintf("Description %q -> %q", current.Description, d))
+	}
+	uintChanges := []struct {
+		name    string
+		current uint64
+		desired uint64
+	}{
+		{name: "IntervalMillisec", current: current.IntervalMillisec, desired: spec.config.IntervalMillisec},
+		{name: "TimeoutMillisec", current: current.TimeoutMillisec, desired: spec.config.TimeoutMillisec},
+		{name: "StatisticsCountsNum", current: current.StatisticsCountsNum, desired: spec.config.StatisticsCountsNum},
+		{name: "StatisticsIntervalSec", current: current.StatisticsIntervalSec, desired: spec.config.StatisticsIntervalSec},
+	}
+	for _, c := range uintChanges {
+		if c.current != c.desired {
+			changes = append(changes, c.name+" "+strconv.FormatUint(c.current, 10)+" -> "+strconv.FormatUint(c.desired, 10))
+		}
+	}
+
+	// 応答が無いことを期待する印も比べる、コメントは引用して "!" で始まるコメントと区別する
+	markedComment := func(comment string, expectUnreachable bool) string {
+		if expectUnreachable {
+			return pingclient.ExpectUnreachablePrefix + strconv.Quote(comment)
+		}
+		return strconv.Quote(comment)
+	}
+	currentTargets := make(map[string][]string)
+	for _, t := range current.Targets {
+		currentTargets[t.TargetIP] = append(currentTargets[t.TargetIP], markedComment(t.Comment, t.ExpectUnreachable))
+	}
+	desiredTargets := make(map[string][]string)
+	for _, t := range spec.targetList {
+		desiredTargets[t.TargetIP] = append(desiredTargets[t.TargetIP], markedComment(t.Comment, t.ExpectUnreachable))
+	}
+
+	targetChanges := make([]string, 0)
+	for ip, comments := range desiredTargets {
+		currentComments, ok := currentTargets[ip]
+		if !ok {
+			targetChanges = append(targetChanges, "+ "+ip+" "+strings.Join(comments, ", "))
+			continue
+		}
+		if strings.Join(currentComments, "\n") != strings.Join(comments, "\n") {
+			targetChanges = append(targetChanges, "~ "+ip+" "+strings.Join(currentComments, ", ")+" -> "+strings.Join(comments, ", "))
+		}
+	}
+	for ip, comments := range currentTargets {
+		if _, ok := desiredTargets[ip]; !ok {
+			targetChanges = append(targetChanges, "- "+ip+" "+strings.Join(comments, ", "))
+		}
+	}
+	sort.Slice(targetChanges, func(i, j int) bool { return targetChanges[i][2:] < targetChanges[j][2:] })
+
+	return append(changes, targetChanges...)
+}
+
+func (thisClient *tClientWrap) printApplyPlan(chOutPut chan<- tCliMsg, plan tApplyPlan, newPingerID uint32, dryRun bool, err error) {
+	var pingerID uint32
+	if plan.current != nil {
+		pingerID = plan.current.PingerID
+	}
+
+	if thisClient.output.isStructured() {
+		record := tApplyRecord{
+			Kind:        "apply",
+			Action:      string(plan.action),
+			Name:        plan.name,
+			PingerID:    pingerID,
+			NewPingerID: newPingerID,
+			Changes:     plan.changes,
+			DryRun:      dryRun,
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		chOutPut <- recordMsg(thisClient.output, record)
+		return
+	}
+
+	var mark string
+	var strColor tCliColor
+	switch plan.action {
+	case applyActionCreate:
+		mark, strColor = "+", cliColorGreen
+	case applyActionReplace:
+		mark, strColor = "~", cliColorYellow
+	case applyActionDelete:
+		mark, strColor = "-", cliColorRed
+	default:
+		mark, strColor = "=", cliColorDefault
+	}
+
+	strID := "-"
+	if pingerID != 0 {
+		strID = "id " + strconv.FormatUint(uint64(pingerID), 10)
+	}
+	if newPingerID != 0 {
+		strID += " -> id " + strconv.FormatUint(uint64(newPingerID), 10)
+	}
+
+	str := fmt.Sprintf("%s %-20s %-16s %s", mark, plan.name, strID, plan.action)
+	if dryRun && plan.action != applyActionKeep {
+		str += " (dry-run)"
+	}
+	if err != nil {
+		str += " failed : " + err.Error()
+		strColor = cliColorRed
+	}
+	for _, change := range plan.changes {
+		str += "\n    " + change
+	}
+
+	chOutPut <- tCliMsg{
+		text:    str,
+		color:   strColor,
+		noBreak: false,
+		data:    true,
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// assert の期待
+const (
+	assertExpectReachable   = "reachable"
+	assertExpectUnreachable = "unreachable"
+)
+
+// tAssertConfig assert の期待ファイルの中身(JSON or YAML)
+type tAssertConfig struct {
+	//pingを撃つ時間(秒)、-duration があればそちらを使う
+	DurationSec uint64 `json:"DurationSec"`
+
+	//Expect, MaxLossPercent, MaxRTTMillisec を省略した対象の既定値
+	Expect         string   `json:"Expect"`
+	MaxLossPercent *float64 `json:"MaxLossPercent"`
+	MaxRTTMillisec *float64 `json:"MaxRTTMillisec"`
+
+	//対象リストのパス、相対パスは期待ファイルからの位置、全て既定値で判定する
+	TargetListPath string `json:"TargetListPath"`
+
+	Targets []tAssertTargetConfig `json:"Targets"`
+}
+
+// tAssertTargetConfig 1つの対象の期待
+type tAssertTargetConfig struct {
+	//対象リストと同じ形式の行
+	Target string `json:"Target"`
+
+	//reachable か unreachable
+	Expect string `json:"Expect"`
+
+	//損失率(%)の上限、reachable のみ
+	MaxLossPercent *float64 `json:"MaxLossPercent"`
+
+	//平均RTT(ミリ秒)の上限、reachable のみ
+	MaxRTTMillisec *float64 `json:"MaxRTTMillisec"`
+}
+
+type tAssertCase struct {
+	target         pingclient.StartTarget
+	expect         string
+	maxLossPercent *float64
+	maxRTTMillisec *float64
+}
+
+func (thisCase tAssertCase) String() string {
+	str := thisCase.expect
+	if thisCase.expect == assertExpectReachable {
+		if thisCase.maxLossPercent != nil {
+			str += fmt.Sprintf(", loss <= %g%%", *thisCase.maxLossPercent)
+		}
+		if thisCase.maxRTTMillisec != nil {
+			str += fmt.Sprintf(", rta <= %gms", *thisCase.maxRTTMillisec)
+		}
+	}
+	return str
+}
+
+// tAssertRecord is a line of "assert" in structured output
+type tAssertRecord struct {
+	Kind        string   `json:"Kind"`
+	PingerID    uint32   `json:"PingerID"`
+	TargetID    uint32   `json:"TargetID"`
+	TargetIP    string   `json:"TargetIP"`
+	FQDN        string   `json:"FQDN"`
+	Comment     string   `json:"Comment"`
+	Expect      string   `json:"Expect"`
+	Passed      bool     `json:"Passed"`
+	Failures    []string `json:"Failures"`
+	Sent        int64    `json:"Sent"`
+	Received    int64    `json:"Received"`
+	Late        int64    `json:"Late"`
+	LossPercent float64  `json:"LossPercent"`
+	AvgMillisec float64  `json:"AvgMillisec"`
+}
+
+// tAssertResult 1つの対象の判定
+type tAssertResult struct {
+	assertCase tAssertCase
+	stats      pingclient.TargetStats
+	//判定できなかった理由、JUnit の error の type
+	errorType string
+	failures  []string
+}
+
+func (r tAssertResult) passed() bool {
+	return r.errorType == "" && len(r.failures) == 0
+}
+
+// assertEmptyStats 結果の無い対象
+func assertEmptyStats(c tAssertCase) pingclient.TargetStats {
+	return pingclient.TargetStats{Target: pingclient.Target{TargetIP: c.target.TargetIP, TargetBinIP: c.target.TargetIP, Comment: c.target.Comment}}
+}
+
+// assertMatch 対象は TargetIP(開始時に指定したアドレス)で対応付ける、同じものが複数あれば順に対応付ける
+func assertMatch(cases []tAssertCase, stats []pingclient.TargetStats) []tAssertResult {
+	statsIndexes := make(map[string][]int)
+	for i, s := range stats {
+		statsIndexes[s.Target.TargetIP] = append(statsIndexes[s.Target.TargetIP], i)
+	}
+
+	results := make([]tAssertResult, 0, len(cases))
+	for _, c := range cases {
+		s := assertEmptyStats(c)
+		if indexes := statsIndexes[c.target.TargetIP]; len(indexes) > 0 {
+			s = stats[indexes[0]]
+			statsIndexes[c.target.TargetIP] = indexes[1:]
+		}
+		results = append(results, assertEvaluate(c, s))
+	}
+	return results
+}
+
+// assertErrors pingを撃てなかった時、全ての対象を判定できなかったことにする
+func assertErrors(cases []tAssertCase, err error) []tAssertResult {
+	results := make([]tAssertResult, 0, len(cases))
+	for _, c := range cases {
+		results = append(results, tAssertResult{
+			assertCase: c,
+			stats:      assertEmptyStats(c),
+			errorType:  "PingFailed",
+			failures:   []string{err.Error()},
+		})
+	}
+	return results
+}
+
+func assertEvaluate(c tAssertCase, s pingclient.TargetStats) tAssertResult {
+	result := tAssertResult{
+		assertCase: c,
+		stats:      s,
+		failures:   make([]string, 0),
+	}
+	if s.Sent == 0 {
+		result.errorType = "NoResults"
+		result.failures = append(result.failures, "no results")
+		return result
+	}
+
+	switch c.expect {
+	case assertExpectUnreachable:
+		if s.Received > 0 || s.Late > 0 {
+			result.failures = append(result.failures, fmt.Sprintf("expected unreachable, %d replies", s.Received+s.Late))
+		}
+	default:
+		if s.Received == 0 {
+			result.failures = append(result.failures, "expected reachable, no replies")
+			break
+		}
+		if c.maxLossPercent != nil && s.LossPercent > *c.maxLossPercent {
+			result.failures = append(result.failures, fmt.Sprintf("loss %.1f%% > %g%%", s.LossPercent, *c.maxLossPercent))
+		}
+		if c.maxRTTMillisec != nil && durationMillisec(s.Avg) > *c.maxRTTMillisec {
+			result.failures = append(result.failures, fmt.Sprintf("rta %.2fms > %gms", durationMillisec(s.Avg), *c.maxRTTMillisec))
+		}
+	}
+	return result
+}
+
+func (thisClient *tClientWrap) loadAssertCases(chOutPut chan<- tCliMsg, path string) (tAssertConfig, []tAssertCase, bool) {
+	assertConfig := tAssertConfig{
+		Expect:  assertExpectReachable,
+		Targets: []tAssertTargetConfig{},
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, err.Error())
+		chOutPut <- tCliMsg{
+			text:    "can not open [" + path + "]",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return assertConfig, nil, false
+	}
+	if err := yamlUnmarshal(data, &assertConfig); err != nil {
+		logger.Log(labelinglog.FlgError, "["+path+"] "+err.Error())
+		return assertConfig, nil, false
+	}
+
+	validExpect := func(expect string) bool {
+		return expect == assertExpectReachable || expect == assertExpectUnreachable
+	}
+	if !validExpect(assertConfig.Expect) {
+		logger.Log(labelinglog.FlgError, "["+path+"] invalid Expect \""+assertConfig.Expect+"\"")
+		return assertConfig, nil, false
+	}
+	defaultCase := func(target pingclient.StartTarget) tAssertCase {
+		c := tAssertCase{
+			target:         target,
+			expect:         assertConfig.Expect,
+			maxLossPercent: assertConfig.MaxLossPercent,
+			maxRTTMillisec: assertConfig.MaxRTTMillisec,
+		}
+		// 先頭に ! がある対象は unreachable
+		if target.ExpectUnreachable {
+			c.expect = assertExpectUnreachable
+		}
+		c.target.ExpectUnreachable = c.expect == assertExpectUnreachable
+		return c
+	}
+
+	cases := make([]tAssertCase, 0)
+	if assertConfig.TargetListPath != "" {
+		targetPath := assertConfig.TargetListPath
+		if !filepath.IsAbs(targetPath) {
+			targetPath = filepath.Join(filepath.Dir(path), targetPath)
+		}
+		targetList, ok := readTargetFile(chOutPut, targetPath)
+		if !ok {
+			return assertConfig, nil, false
+		}
+		for _, target := range targetList {
+			cases = append(cases, defaultCase(target))
+		}
+	}
+	for _, t := range assertConfig.Targets {
+		target, ok := pingclient.ParseTargetLine(t.Target)
+		if !ok {
+			logger.Log(labelinglog.FlgError, "["+path+"] invalid Target \""+t.Target+"\"")
+			return assertConfig, nil, false
+		}
+		c := defaultCase(target)
+		if t.Expect != "" {
+			if !validExpect(t.Expect) {
+				logger.Log(labelinglog.FlgError, "["+path+"] invalid Expect \""+t.Expect+"\"")
+				return assertConfig, nil, false
+			}
+			c.expect = t.Expect
+			c.target.ExpectUnreachable = t.Expect == assertExpectUnreachable
+		}
+		if t.MaxLossPercent != nil {
+			c.maxLossPercent = t.MaxLossPercent
+		}
+		if t.MaxRTTMillisec != nil {
+			c.maxRTTMillisec = t.MaxRTTMillisec
+		}
+		cases = append(cases, c)
+	}
+	if len(cases) == 0 {
+		logger.Log(labelinglog.FlgError, "["+path+"] no targets")
+		return assertConfig, nil, false
+	}
+
+	return assertConfig, cases, true
+}
+
+// assert 一時的なpingerで対象ごとの期待を確かめる、1つでも満たさなければ終了コード1
+func (thisClient *tClientWrap) assert(ctx context.Context, chOutPut chan<- tCliMsg, args []string) {
+	exitCode = 1
+
+	flagSet := flag.NewFlagSet("assert", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	var path string
+	var duration time.Duration
+	var junitPath string
+	flagSet.StringVar(&path, "f", "", "expectations file path")
+	flagSet.DurationVar(&duration, "duration", 0, "how long to ping")
+	flagSet.StringVar(&junitPath, "junit", "", "junit xml report path")
+	if err := flagSet.Parse(args); err != nil || path == "" || flagSet.NArg() > 0 || duration < 0 {
+		chOutPut <- tCliMsg{
+			text:    "Please enter \"assert -f {expectations file path} [-duration 30s] [-junit {report path}]\"",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return
+	}
+
+	assertConfig, cases, ok := thisClient.loadAssertCases(chOutPut, path)
+	if !ok {
+		return
+	}
+	if duration == 0 {
+		duration = time.Duration(assertConfig.DurationSec) * time.Second
+	}
+	if duration == 0 {
+		duration = 30 * time.Second
+	}
+
+	targetList := make([]pingclient.StartTarget, 0, len(cases))
+	for _, c := range cases {
+		targetList = append(targetList, c.target)
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	startTime := time.Now()
+	info, stats, err := thisClient.pingFor(childCtx, "assert "+path, targetList, duration)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		//CI が結果を拾えるよう、JUnit は全て error にして書く
+		thisClient.writeAssertJUnit(junitPath, path, info, startTime, duration, assertErrors(cases, err))
+		return
+	}
+	results := assertMatch(cases, stats)
+
+	passed := 0
+	for _, r := range results {
+		if r.passed() {
+			passed++
+		}
+		if thisClient.output.isStructured() {
+			chOutPut <- recordMsg(thisClient.output, newAssertRecord(info.PingerID, r))
+		} else {
+			chOutPut <- assertMsg(r)
+		}
+	}
+	if passed == len(results) {
+		exitCode = 0
+	}
+	if !thisClient.output.isMachine() {
+		strColor := cliColorGreen
+		if passed < len(results) {
+			strColor = cliColorRed
+		}
+		chOutPut <- tCliMsg{
+			text:    fmt.Sprintf("assert: %d targets, %d passed, %d failed", len(results), passed, len(results)-passed),
+			color:   strColor,
+			noBreak: false,
+		}
+	}
+
+	if !thisClient.writeAssertJUnit(junitPath, path, info, startTime, duration, results) {
+		exitCode = 1
+	}
+}
+
+// writeAssertJUnit junitPath が空なら何もしない、書けなければ false
+func (thisClient *tClientWrap) writeAssertJUnit(junitPath string, path string, info pingclient.PingerInfo, startTime time.Time, duration time.Duration, results []tAssertResult) bool {
+	if junitPath == "" {
+		return true
+	}
+	report, err := assertJUnitReport(path, info, startTime, duration, results)
+	if err == nil {
+		err = ioutil.WriteFile(junitPath, report, 0644)
+	}
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "junit "+err.Error())
+		return false
+	}
+	return true
+}
+
+func newAssertRecord(pingerID uint32, r tAssertResult) tAssertRecord {
+	return tAssertRecord{
+		Kind:        "assert",
+		PingerID:    pingerID,
+		TargetID:    r.stats.Target.TargetID,
+		TargetIP:    r.stats.Target.TargetBinIP,
+		FQDN:        r.stats.Target.FQDN(),
+		Comment:     r.stats.Target.Comment,
+		Expect:      r.assertCase.expect,
+		Passed:      r.passed(),
+		Failures:    r.failures,
+		Sent:        r.stats.Sent,
+		Received:    r.stats.Received,
+		Late:        r.stats.Late,
+		LossPercent: r.stats.LossPercent,
+		AvgMillisec: durationMillisec(r.stats.Avg),
+	}
+}
+
+func assertMsg(r tAssertResult) tCliMsg {
+	mark, strColor := "PASS", cliColorGreen
+	detail := ""
+	if !r.passed() {
+		mark, strColor = "FAIL", cliColorRed
+		detail = " - " + strings.Join(r.failures, ", ")
+	}
+
+	rta := "-"
+	if r.stats.Received > 0 {
+		rta = fmt.Sprintf("%.2fms", durationMillisec(r.stats.Avg))
+	}
+
+	return tCliMsg{
+		text: fmt.Sprintf("A %s - %15s - %s - loss %5.1f%% (%d/%d), rta %s%s - %s",
+			mark,
+			r.stats.Target.TargetBinIP,
+			r.assertCase,
+			r.stats.LossPercent,
+			r.stats.Sent-r.stats.Received,
+			r.stats.Sent,
+			rta,
+			detail,
+			targetComment(r.stats.Target),
+		),
+		color:   strColor,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+type tJUnitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []tJUnitTestSuite `xml:"testsuite"`
+}
+
+type tJUnitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr"`
+	Properties []tJUnitProperty `xml:"properties>property"`
+	Cases      []tJUnitTestCase `xml:"testcase"`
+}
+
+type tJUnitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type tJUnitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Time      string         `xml:"time,attr"`
+	Failure   *tJUnitFailure `xml:"failure,omitempty"`
+	Error     *tJUnitFailure `xml:"error,omitempty"`
+	SystemOut *tJUnitCData   `xml:"system-out,omitempty"`
+}
+
+type tJUnitCData struct {
+	Text string `xml:",cdata"`
+}
+
+type tJUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// assertJUnitReport 1対象1testcaseのJUnit XML
+func assertJUnitReport(path string, info pingclient.PingerInfo, startTime time.Time, duration time.Duration, results []tAssertResult) ([]byte, error) {
+	seconds := strconv.FormatFloat(duration.Seconds(), 'f', 3, 64)
+	suite := tJUnitTestSuite{
+		Name:      "ping " + path,
+		Tests:     len(results),
+		Time:      seconds,
+		Timestamp: startTime.Format("2006-01-02T15:04:05"),
+		Properties: []tJUnitProperty{
+			{Name: "server", Value: argServerAddress},
+			{Name: "pingerID", Value: strconv.FormatUint(uint64(info.PingerID), 10)},
+			{Name: "intervalMillisec", Value: strconv.FormatUint(info.IntervalMillisec, 10)},
+			{Name: "timeoutMillisec", Value: strconv.FormatUint(info.TimeoutMillisec, 10)},
+		},
+		Cases: make([]tJUnitTestCase, 0, len(results)),
+	}
+
+	for _, r := range results {
+		name := r.stats.Target.TargetBinIP + " " + r.assertCase.expect
+		if r.stats.Target.Comment != "" {
+			name = r.stats.Target.TargetBinIP + " (" + r.stats.Target.Comment + ") " + r.assertCase.expect
+		}
+		testCase := tJUnitTestCase{
+			Name:      name,
+			ClassName: "ping." + argServerAddress,
+			Time:      seconds,
+			SystemOut: &tJUnitCData{Text: fmt.Sprintf("expect %s\nsent %d, received %d, late %d, ttl exceeded %d, loss %.1f%%\nrtt min/avg/max/mdev %.2f/%.2f/%.2f/%.2fms",
+				r.assertCase,
+				r.stats.Sent,
+				r.stats.Received,
+				r.stats.Late,
+				r.stats.TTLExceeded,
+				r.stats.LossPercent,
+				durationMillisec(r.stats.Min),
+				durationMillisec(r.stats.Avg),
+				durationMillisec(r.stats.Max),
+				durationMillisec(r.stats.MDev),
+			)},
+		}
+		switch {
+		case r.errorType != "":
+			suite.Errors++
+			testCase.Error = &tJUnitFailure{Message: strings.Join(r.failures, ", "), Type: r.errorType, Text: targetComment(r.stats.Target)}
+		case !r.passed():
+			suite.Failures++
+			testCase.Failure = &tJUnitFailure{Message: strings.Join(r.failures, ", "), Type: "AssertionFailed", Text: strings.Join(r.failures, "\n")}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	report := tJUnitTestSuites{
+		Name:     "ping-grpc-client assert",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     seconds,
+		Suites:   []tJUnitTestSuite{suite},
+	}
+
+	body, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
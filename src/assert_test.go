@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+func TestAssertMatch(t *testing.T) {
+	assertCase := func(ip string, comment string) tAssertCase {
+		return tAssertCase{target: pingclient.StartTarget{TargetIP: ip, Comment: comment}, expect: assertExpectReachable}
+	}
+	targetStats := func(id uint32, ip string, received int64) pingclient.TargetStats {
+		return pingclient.TargetStats{Target: pingclient.Target{TargetID: id, TargetIP: ip, TargetBinIP: ip}, Sent: 5, Received: received}
+	}
+
+	tests := []struct {
+		name   string
+		cases  []tAssertCase
+		stats  []pingclient.TargetStats
+		wantID []uint32
+		passed []bool
+	}{
+		{
+			name:   "in order",
+			cases:  []tAssertCase{assertCase("192.0.2.1", ""), assertCase("192.0.2.2", "")},
+			stats:  []pingclient.TargetStats{targetStats(1, "192.0.2.1", 5), targetStats(2, "192.0.2.2", 0)},
+			wantID: []uint32{1, 2},
+			passed: []bool{true, false},
+		},
+		{
+			name:   "out of order",
+			cases:  []tAssertCase{assertCase("192.0.2.1", ""), assertCase("192.0.2.2", "")},
+			stats:  []pingclient.TargetStats{targetStats(2, "192.0.2.2", 0), targetStats(1, "192.0.2.1", 5)},
+			wantID: []uint32{1, 2},
+			passed: []bool{true, false},
+		},
+		{
+			name:   "duplicates in order",
+			cases:  []tAssertCase{assertCase("192.0.2.1", "a"), assertCase("192.0.2.1", "b")},
+			stats:  []pingclient.TargetStats{targetStats(1, "192.0.2.1", 5), targetStats(2, "192.0.2.1", 0)},
+			wantID: []uint32{1, 2},
+			passed: []bool{true, false},
+		},
+		{
+			name:   "missing target has no results",
+			cases:  []tAssertCase{assertCase("192.0.2.1", ""), assertCase("192.0.2.9", "gone")},
+			stats:  []pingclient.TargetStats{targetStats(1, "192.0.2.1", 5)},
+			wantID: []uint32{1, 0},
+			passed: []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := assertMatch(tt.cases, tt.stats)
+			if len(results) != len(tt.cases) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.cases))
+			}
+			for i, r := range results {
+				if r.stats.Target.TargetID != tt.wantID[i] || r.passed() != tt.passed[i] {
+					t.Errorf("result %d = target %d passed %v, want target %d passed %v", i, r.stats.Target.TargetID, r.passed(), tt.wantID[i], tt.passed[i])
+				}
+			}
+			if last := results[len(results)-1]; tt.wantID[len(tt.wantID)-1] == 0 && (last.errorType != "NoResults" || last.stats.Target.Comment != "gone") {
+				t.Errorf("missing target result = %+v", last)
+			}
+		})
+	}
+}
+
+func TestAssertJUnitOnPingFailure(t *testing.T) {
+	env := newTestEnv(t, outputText)
+	dir := t.TempDir()
+	path := writeFile(t, dir, "expect.yaml", "Targets:\n  - Target: 192.0.2.1 core\n  - Target: 192.0.2.2\n    Expect: unreachable\n")
+	junitPath := filepath.Join(dir, "report.xml")
+
+	env.server.Close()
+	env.run(5*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.assert(ctx, chOutPut, []string{"-f", path, "-duration", "1s", "-junit", junitPath})
+	})
+	if exitCode != 1 {
+		t.Errorf("exitCode = %d, want 1", exitCode)
+	}
+
+	data, err := os.ReadFile(junitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report tJUnitTestSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Tests != 2 || report.Errors != 2 || report.Failures != 0 || len(report.Suites) != 1 {
+		t.Fatalf("report = %s", data)
+	}
+	for _, c := range report.Suites[0].Cases {
+		if c.Error == nil || c.Error.Type != "PingFailed" || c.Error.Message == "" {
+			t.Errorf("testcase %q error = %+v", c.Name, c.Error)
+		}
+	}
+}
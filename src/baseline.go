@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// baseline compare の対象ごとの変化
+const (
+	baselineChangeUnchanged   = "unchanged"
+	baselineChangeUnreachable = "unreachable"
+	baselineChangeRecovered   = "recovered"
+	baselineChangeRTT         = "rtt"
+	baselineChangeMissing     = "missing"
+	baselineChangeNew         = "new"
+	baselineChangeUnknown     = "unknown"
+)
+
+const defaultBaselineDuration = 60 * time.Second
+
+// tBaselineFile baseline save で書き出すファイルの中身
+type tBaselineFile struct {
+	Kind        string `json:"Kind"`
+	PingerID    uint32 `json:"PingerID"`
+	Description string `json:"Description"`
+	//集計を終えた時刻
+	Time        time.Time `json:"Time"`
+	DurationSec float64   `json:"DurationSec"`
+
+	Targets []tBaselineTarget `json:"Targets"`
+}
+
+// tBaselineTarget 1つの対象の集計
+type tBaselineTarget struct {
+	TargetIP          string  `json:"TargetIP"`
+	TargetBinIP       string  `json:"TargetBinIP"`
+	Comment           string  `json:"Comment"`
+	ExpectUnreachable bool    `json:"ExpectUnreachable"`
+	Sent              int64   `json:"Sent"`
+	Received          int64   `json:"Received"`
+	Late              int64   `json:"Late"`
+	TTLExceeded       int64   `json:"TTLExceeded"`
+	LossPercent       float64 `json:"LossPercent"`
+	AvgMillisec       float64 `json:"AvgMillisec"`
+	P50Millisec       float64 `json:"P50Millisec"`
+	P90Millisec       float64 `json:"P90Millisec"`
+}
+
+func newBaselineTarget(s pingclient.TargetStats) tBaselineTarget {
+	return tBaselineTarget{
+		TargetIP:          s.Target.TargetIP,
+		TargetBinIP:       s.Target.TargetBinIP,
+		Comment:           s.Target.Comment,
+		ExpectUnreachable: s.Target.ExpectUnreachable,
+		Sent:              s.Sent,
+		Received:          s.Received,
+		Late:              s.Late,
+		TTLExceeded:       s.TTLExceeded,
+		LossPercent:       s.LossPercent,
+		AvgMillisec:       durationMillisec(s.Avg),
+		P50Millisec:       durationMillisec(s.P50),
+		P90Millisec:       durationMillisec(s.P90),
+	}
+}
+
+func (t tBaselineTarget) target() pingclient.Target {
+	return pingclient.Target{
+		TargetIP:          t.TargetIP,
+		TargetBinIP:       t.TargetBinIP,
+		Comment:           t.Comment,
+		ExpectUnreachable: t.ExpectUnreachable,
+	}
+}
+
+func (t tBaselineTarget) reachable() bool {
+	return t.Received > 0
+}
+
+// tBaselineTolerance RTT(p50)の変化の許容範囲、割合と絶対値の大きい方
+type tBaselineTolerance struct {
+	Percent  float64 `json:"Percent"`
+	Millisec float64 `json:"Millisec"`
+}
+
+func (tolerance tBaselineTolerance) exceeded(before float64, after float64) bool {
+	return math.Abs(after-before) > math.Max(before*tolerance.Percent/100, tolerance.Millisec)
+}
+
+// tBaselineTargetReport 1つの対象の比較結果
+type tBaselineTargetReport struct {
+	TargetIP          string `json:"TargetIP"`
+	Comment           string `json:"Comment"`
+	ExpectUnreachable bool   `json:"ExpectUnreachable"`
+	Change            string `json:"Change"`
+	//悪くなった変化か、応答が無いことを期待する対象では応答し始めることが悪化
+	Regression bool             `json:"Regression"`
+	Before     *tBaselineTarget `json:"Before"`
+	After      *tBaselineTarget `json:"After"`
+	//p50の差、両方応答がある時のみ
+	RTTDeltaMillisec *float64 `json:"RTTDeltaMillisec"`
+}
+
+// tBaselineReport baseline compare の出力
+type tBaselineReport struct {
+	Kind         string             `json:"Kind"`
+	PingerID     uint32             `json:"PingerID"`
+	BaselinePath string             `json:"BaselinePath"`
+	BaselineTime time.Time          `json:"BaselineTime"`
+	Time         time.Time          `json:"Time"`
+	DurationSec  float64            `json:"DurationSec"`
+	RTTTolerance tBaselineTolerance `json:"RTTTolerance"`
+	//変化ごとの対象数
+	Counts      map[string]int          `json:"Counts"`
+	Regressions int                     `json:"Regressions"`
+	Targets     []tBaselineTargetReport `json:"Targets"`
+}
+
+// baselineCompareTarget 1つの対象の変化、before か after の片方は nil でもよい
+func baselineCompareTarget(before *tBaselineTarget, after *tBaselineTarget, tolerance tBaselineTolerance) tBaselineTargetReport {
+	report := tBaselineTargetReport{
+		Change: baselineChangeUnchanged,
+		Before: before,
+		After:  after,
+	}
+	switch {
+	case after == nil:
+		report.TargetIP, report.Comment, report.ExpectUnreachable = before.TargetIP, before.Comment, before.ExpectUnreachable
+		report.Change = baselineChangeMissing
+		report.Regression = true
+		return report
+	case before == nil:
+		report.TargetIP, report.Comment, report.ExpectUnreachable = after.TargetIP, after.Comment, after.ExpectUnreachable
+		report.Change = baselineChangeNew
+		return report
+	}
+	report.TargetIP, report.Comment, report.ExpectUnreachable = after.TargetIP, after.Comment, after.ExpectUnreachable
+
+	if before.Sent == 0 || after.Sent == 0 {
+		report.Change = baselineChangeUnknown
+		report.Regression = after.Sent == 0
+		return report
+	}
+
+	switch {
+	case before.reachable() && !after.reachable():
+		report.Change = baselineChangeUnreachable
+		report.Regression = !after.ExpectUnreachable
+	case !before.reachable() && after.reachable():
+		report.Change = baselineChangeRecovered
+		report.Regression = after.ExpectUnreachable
+	case before.reachable() && after.reachable():
+		delta := after.P50Millisec - before.P50Millisec
+		report.RTTDeltaMillisec = &delta
+		if tolerance.exceeded(before.P50Millisec, after.P50Millisec) {
+			report.Change = baselineChangeRTT
+			report.Regression = delta > 0
+		}
+	}
+	return report
+}
+
+// baselineCompare 対象は TargetIP(開始時に指定したアドレス)で対応付ける、同じものが複数あれば順に対応付ける
+func baselineCompare(before []tBaselineTarget, after []tBaselineTarget, tolerance tBaselineTolerance) []tBaselineTargetReport {
+	afterIndexes := make(map[string][]int)
+	for i, t := range after {
+		afterIndexes[t.TargetIP] = append(afterIndexes[t.TargetIP], i)
+	}
+
+	reports := make([]tBaselineTargetReport, 0, len(before)+len(after))
+	matched := make([]bool, len(after))
+	for i := range before {
+		b := &before[i]
+		var a *tBaselineTarget
+		if indexes := afterIndexes[b.TargetIP]; len(indexes) > 0 {
+			a = &after[indexes[0]]
+			matched[indexes[0]] = true
+			afterIndexes[b.TargetIP] = indexes[1:]
+		}
+		reports = append(reports, baselineCompareTarget(b, a, tolerance))
+	}
+	for i := range after {
+		if !matched[i] {
+			reports = append(reports, baselineCompareTarget(nil, &after[i], tolerance))
+		}
+	}
+	return reports
+}
+
+// parseFlagsInterspersed 位置引数の後ろにあるフラグも解析して、位置引数を返す
+func parseFlagsInterspersed(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := flagSet.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flagSet.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// baseline 作業前後の到達性とRTTを比べる
+func (thisClient *tClientWrap) baseline(ctx context.Context, chOutPut chan<- tCliMsg, args []string) {
+	usage := "" +
+		"Please enter\n" +
+		"  \"baseline save {pingerID} -o {baseline file path} [-duration 60s]\"\n" +
+		"  \"baseline compare {pingerID} {baseline file path} [-duration 60s] [-rtt-tolerance 50] [-rtt-tolerance-ms 5]\""
+	if len(args) < 1 {
+		exitCode = 1
+		chOutPut <- tCliMsg{
+			text:    usage,
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return
+	}
+
+	switch args[0] {
+	case "s", "sa", "sav", "save":
+		thisClient.baselineSave(ctx, chOutPut, args[1:], usage)
+	case "c", "co", "com", "comp", "compa", "compar", "compare":
+		thisClient.baselineCompare(ctx, chOutPut, args[1:], usage)
+	default:
+		exitCode = 1
+		chOutPut <- tCliMsg{
+			text:    usage,
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+	}
+}
+
+func (thisClient *tClientWrap) baselineSave(ctx context.Context, chOutPut chan<- tCliMsg, args []string, usage string) {
+	exitCode = 1
+
+	flagSet := flag.NewFlagSet("baseline save", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	var path string
+	var duration time.Duration
+	flagSet.StringVar(&path, "o", "", "baseline file path")
+	flagSet.DurationVar(&duration, "duration", defaultBaselineDuration, "how long to watch")
+	positional, err := parseFlagsInterspersed(flagSet, args)
+	if err != nil || len(positional) != 1 || path == "" || duration <= 0 {
+		chOutPut <- tCliMsg{
+			text:    usage,
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return
+	}
+	pingerID, ok := thisClient.parsePingerID(chOutPut, positional[0])
+	if !ok {
+		return
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	chOutPut <- tCliMsg{
+		text:    fmt.Sprintf("watching pinger %d for %s", pingerID, duration),
+		color:   cliColorDefault,
+		noBreak: false,
+	}
+	info, stats, err := thisClient.watchFor(childCtx, pingerID, duration)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
+	}
+
+	baselineFile := tBaselineFile{
+		Kind:        "baseline",
+		PingerID:    info.PingerID,
+		Description: info.Description,
+		Time:        time.Now(),
+		DurationSec: duration.Seconds(),
+		Targets:     make([]tBaselineTarget, 0, len(stats)),
+	}
+	for _, s := range stats {
+		baselineFile.Targets = append(baselineFile.Targets, newBaselineTarget(s))
+	}
+
+	jsonBlob, err := json.MarshalIndent(baselineFile, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(path, append(jsonBlob, '\n'), 0644)
+	}
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "baseline "+err.Error())
+		return
+	}
+
+	exitCode = 0
+	chOutPut <- tCliMsg{
+		text:    fmt.Sprintf("baseline: %d targets saved to [%s]", len(baselineFile.Targets), path),
+		color:   cliColorDefault,
+		noBreak: false,
+	}
+}
+
+func (thisClient *tClientWrap) baselineCompare(ctx context.Context, chOutPut chan<- tCliMsg, args []string, usage string) {
+	exitCode = 1
+
+	flagSet := flag.NewFlagSet("baseline compare", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	var duration time.Duration
+	tolerance := tBaselineTolerance{}
+	flagSet.DurationVar(&duration, "duration", 0, "how long to watch")
+	flagSet.Float64Var(&tolerance.Percent, "rtt-tolerance", 50, "allowed change of p50 rtt in percent")
+	flagSet.Float64Var(&tolerance.Millisec, "rtt-tolerance-ms", 5, "allowed change of p50 rtt in milliseconds")
+	positional, err := parseFlagsInterspersed(flagSet, args)
+	if err != nil || len(positional) != 2 || duration < 0 || tolerance.Percent < 0 || tolerance.Millisec < 0 {
+		chOutPut <- tCliMsg{
+			text:    usage,
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return
+	}
+	pingerID, ok := thisClient.parsePingerID(chOutPut, positional[0])
+	if !ok {
+		return
+	}
+	path := positional[1]
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, err.Error())
+		chOutPut <- tCliMsg{
+			text:    "can not open [" + path + "]",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return
+	}
+	baselineFile := tBaselineFile{}
+	if err := yamlUnmarshal(data, &baselineFile); err != nil {
+		logger.Log(labelinglog.FlgError, "["+path+"] "+err.Error())
+		return
+	}
+	if duration == 0 {
+		duration = time.Duration(baselineFile.DurationSec * float64(time.Second))
+	}
+	if duration <= 0 {
+		duration = defaultBaselineDuration
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	chOutPut <- tCliMsg{
+		text:    fmt.Sprintf("watching pinger %d for %s, baseline at %s", pingerID, duration, baselineFile.Time.Local().Format("2006/01/02 15:04:05")),
+		color:   cliColorDefault,
+		noBreak: false,
+	}
+	_, stats, err := thisClient.watchFor(childCtx, pingerID, duration)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
+	}
+
+	after := make([]tBaselineTarget, 0, len(stats))
+	for _, s := range stats {
+		after = append(after, newBaselineTarget(s))
+	}
+
+	report := tBaselineReport{
+		Kind:         "baseline",
+		PingerID:     pingerID,
+		BaselinePath: path,
+		BaselineTime: baselineFile.Time,
+		Time:         time.Now(),
+		DurationSec:  duration.Seconds(),
+		RTTTolerance: tolerance,
+		Counts:       make(map[string]int),
+		Targets:      baselineCompare(baselineFile.Targets, after, tolerance),
+	}
+	for _, t := range report.Targets {
+		report.Counts[t.Change]++
+		if t.Regression {
+			report.Regressions++
+		}
+	}
+	if report.Regressions == 0 {
+		exitCode = 0
+	}
+
+	if thisClient.output.isMachine() {
+		chOutPut <- dataMsg(thisClient.output, report, func(w io.Writer) {
+			fmt.Fprintln(w, "Change\tRegression\tTargetIP\tLossBefore\tLossAfter\tP50Before\tP50After\tComment")
+			for _, t := range report.Targets {
+				fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					t.Change,
+					t.Regression,
+					t.TargetIP,
+					baselineLossString(t.Before),
+					baselineLossString(t.After),
+					baselineRTTString(t.Before),
+					baselineRTTString(t.After),
+					t.Comment,
+				)
+			}
+		})
+		return
+	}
+
+	for _, t := range report.Targets {
+		chOutPut <- baselineMsg(t)
+	}
+	strColor := cliColorGreen
+	if report.Regressions > 0 {
+		strColor = cliColorRed
+	}
+	chOutPut <- tCliMsg{
+		text: fmt.Sprintf("baseline: %d targets, %d unreachable, %d recovered, %d rtt changed, %d missing, %d new, %d unknown, %d unchanged, %d regressions",
+			len(report.Targets),
+			report.Counts[baselineChangeUnreachable],
+			report.Counts[baselineChangeRecovered],
+			report.Counts[baselineChangeRTT],
+			report.Counts[baselineChangeMissing],
+			report.Counts[baselineChangeNew],
+			report.Counts[baselineChangeUnknown],
+			report.Counts[baselineChangeUnchanged],
+			report.Regressions,
+		),
+		color:   strColor,
+		noBreak: false,
+	}
+}
+
+func baselineLossString(t *tBaselineTarget) string {
+	if t == nil || t.Sent == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", t.LossPercent)
+}
+
+func baselineRTTString(t *tBaselineTarget) string {
+	if t == nil || !t.reachable() {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fms", t.P50Millisec)
+}
+
+func baselineMsg(t tBaselineTargetReport) tCliMsg {
+	strColor := cliColorDefault
+	switch {
+	case t.Regression:
+		strColor = cliColorRed
+	case t.Change != baselineChangeUnchanged:
+		strColor = cliColorGreen
+	}
+
+	detail := ""
+	if t.RTTDeltaMillisec != nil {
+		detail = fmt.Sprintf(" (%+.2fms)", *t.RTTDeltaMillisec)
+	}
+
+	target := t.After
+	if target == nil {
+		target = t.Before
+	}
+
+	return tCliMsg{
+		text: fmt.Sprintf("B %-11s - %15s - loss %6s -> %6s, rtt p50 %s -> %s%s - %s",
+			strings.ToUpper(t.Change),
+			target.TargetBinIP,
+			baselineLossString(t.Before),
+			baselineLossString(t.After),
+			baselineRTTString(t.Before),
+			baselineRTTString(t.After),
+			detail,
+			targetComment(target.target()),
+		),
+		color:   strColor,
+		noBreak: false,
+		data:    true,
+	}
+}
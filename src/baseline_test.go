@@ -0,0 +1,142 @@
+package main
+
+import "testing"
+
+func TestBaselineCompareTarget(t *testing.T) {
+	baselineTarget := func(sent int64, received int64, p50 float64) *tBaselineTarget {
+		return &tBaselineTarget{TargetIP: "192.0.2.1", TargetBinIP: "192.0.2.1", Sent: sent, Received: received, P50Millisec: p50}
+	}
+	expectUnreachable := func(t *tBaselineTarget) *tBaselineTarget {
+		t.ExpectUnreachable = true
+		return t
+	}
+	ms := func(f float64) *float64 { return &f }
+	tolerance := tBaselineTolerance{Percent: 50, Millisec: 5}
+
+	tests := []struct {
+		name       string
+		before     *tBaselineTarget
+		after      *tBaselineTarget
+		change     string
+		regression bool
+		//nil なら RTTDeltaMillisec も nil
+		delta *float64
+	}{
+		{name: "missing", before: baselineTarget(5, 5, 10), change: baselineChangeMissing, regression: true},
+		{name: "new", after: baselineTarget(5, 5, 10), change: baselineChangeNew},
+		{name: "unknown before", before: baselineTarget(0, 0, 0), after: baselineTarget(5, 5, 10), change: baselineChangeUnknown},
+		{name: "unknown after", before: baselineTarget(5, 5, 10), after: baselineTarget(0, 0, 0), change: baselineChangeUnknown, regression: true},
+		{name: "unreachable", before: baselineTarget(5, 5, 10), after: baselineTarget(5, 0, 0), change: baselineChangeUnreachable, regression: true},
+		{name: "recovered", before: baselineTarget(5, 0, 0), after: baselineTarget(5, 3, 10), change: baselineChangeRecovered},
+		{
+			name:   "expected unreachable gets unreachable",
+			before: expectUnreachable(baselineTarget(5, 5, 10)), after: expectUnreachable(baselineTarget(5, 0, 0)),
+			change: baselineChangeUnreachable,
+		},
+		{
+			name:   "expected unreachable starts answering",
+			before: expectUnreachable(baselineTarget(5, 0, 0)), after: expectUnreachable(baselineTarget(5, 5, 10)),
+			change: baselineChangeRecovered, regression: true,
+		},
+		{name: "still unreachable", before: baselineTarget(5, 0, 0), after: baselineTarget(5, 0, 0), change: baselineChangeUnchanged},
+		//差は 5ms と 50% の大きい方まで許す
+		{name: "rtt within ms", before: baselineTarget(5, 5, 2), after: baselineTarget(5, 5, 7), change: baselineChangeUnchanged, delta: ms(5)},
+		{name: "rtt over ms", before: baselineTarget(5, 5, 2), after: baselineTarget(5, 5, 7.5), change: baselineChangeRTT, regression: true, delta: ms(5.5)},
+		{name: "rtt within percent", before: baselineTarget(5, 5, 100), after: baselineTarget(5, 5, 150), change: baselineChangeUnchanged, delta: ms(50)},
+		{name: "rtt over percent", before: baselineTarget(5, 5, 100), after: baselineTarget(5, 5, 151), change: baselineChangeRTT, regression: true, delta: ms(51)},
+		{name: "rtt improved", before: baselineTarget(5, 5, 100), after: baselineTarget(5, 5, 40), change: baselineChangeRTT, delta: ms(-60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := baselineCompareTarget(tt.before, tt.after, tolerance)
+			if report.Change != tt.change || report.Regression != tt.regression {
+				t.Errorf("change %s regression %v, want change %s regression %v", report.Change, report.Regression, tt.change, tt.regression)
+			}
+			switch {
+			case tt.delta == nil && report.RTTDeltaMillisec != nil:
+				t.Errorf("RTTDeltaMillisec = %v, want nil", *report.RTTDeltaMillisec)
+			case tt.delta != nil && (report.RTTDeltaMillisec == nil || *report.RTTDeltaMillisec != *tt.delta):
+				t.Errorf("RTTDeltaMillisec = %v, want %v", report.RTTDeltaMillisec, *tt.delta)
+			}
+			if report.Before != tt.before || report.After != tt.after {
+				t.Errorf("Before, After = %p, %p, want %p, %p", report.Before, report.After, tt.before, tt.after)
+			}
+			if report.TargetIP != "192.0.2.1" {
+				t.Errorf("TargetIP = %s, want 192.0.2.1", report.TargetIP)
+			}
+		})
+	}
+}
+
+func TestBaselineCompare(t *testing.T) {
+	baselineTarget := func(ip string, comment string, received int64) tBaselineTarget {
+		return tBaselineTarget{TargetIP: ip, TargetBinIP: ip, Comment: comment, Sent: 5, Received: received, P50Millisec: 10}
+	}
+	type wantReport struct {
+		targetIP string
+		comment  string
+		change   string
+	}
+
+	tests := []struct {
+		name   string
+		before []tBaselineTarget
+		after  []tBaselineTarget
+		want   []wantReport
+	}{
+		{
+			name:   "out of order",
+			before: []tBaselineTarget{baselineTarget("192.0.2.1", "", 5), baselineTarget("192.0.2.2", "", 5)},
+			after:  []tBaselineTarget{baselineTarget("192.0.2.2", "", 0), baselineTarget("192.0.2.1", "", 5)},
+			want: []wantReport{
+				{targetIP: "192.0.2.1", change: baselineChangeUnchanged},
+				{targetIP: "192.0.2.2", change: baselineChangeUnreachable},
+			},
+		},
+		{
+			name:   "duplicates in order",
+			before: []tBaselineTarget{baselineTarget("192.0.2.1", "a", 5), baselineTarget("192.0.2.1", "b", 0)},
+			after:  []tBaselineTarget{baselineTarget("192.0.2.1", "a", 0), baselineTarget("192.0.2.1", "b", 5)},
+			want: []wantReport{
+				{targetIP: "192.0.2.1", comment: "a", change: baselineChangeUnreachable},
+				{targetIP: "192.0.2.1", comment: "b", change: baselineChangeRecovered},
+			},
+		},
+		{
+			name:   "more duplicates after",
+			before: []tBaselineTarget{baselineTarget("192.0.2.1", "a", 5)},
+			after:  []tBaselineTarget{baselineTarget("192.0.2.1", "a", 5), baselineTarget("192.0.2.1", "b", 5)},
+			want: []wantReport{
+				{targetIP: "192.0.2.1", comment: "a", change: baselineChangeUnchanged},
+				{targetIP: "192.0.2.1", comment: "b", change: baselineChangeNew},
+			},
+		},
+		{
+			name:   "missing and new",
+			before: []tBaselineTarget{baselineTarget("192.0.2.1", "gone", 5), baselineTarget("192.0.2.2", "", 5)},
+			after:  []tBaselineTarget{baselineTarget("192.0.2.3", "added", 5), baselineTarget("192.0.2.2", "", 5)},
+			want: []wantReport{
+				{targetIP: "192.0.2.1", comment: "gone", change: baselineChangeMissing},
+				{targetIP: "192.0.2.2", change: baselineChangeUnchanged},
+				{targetIP: "192.0.2.3", comment: "added", change: baselineChangeNew},
+			},
+		},
+	}
+
+	tolerance := tBaselineTolerance{Percent: 50, Millisec: 5}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports := baselineCompare(tt.before, tt.after, tolerance)
+			if len(reports) != len(tt.want) {
+				t.Fatalf("got %d reports, want %d", len(reports), len(tt.want))
+			}
+			for i, r := range reports {
+				w := tt.want[i]
+				if r.TargetIP != w.targetIP || r.Comment != w.comment || r.Change != w.change {
+					t.Errorf("report %d = %s %q %s, want %s %q %s", i, r.TargetIP, r.Comment, r.Change, w.targetIP, w.comment, w.change)
+				}
+			}
+		})
+	}
+}
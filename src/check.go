@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// pingFor 一時的なpingerで duration の間pingを撃って集計し、pingerを止める
+func (thisClient *tClientWrap) pingFor(ctx context.Context, descStr string, targetList []pingclient.StartTarget, duration time.Duration) (pingclient.PingerInfo, []pingclient.TargetStats, error) {
+	// 止め損ねても残り続けないよう期限を短くする
+	config := thisClient.config
+	config.StopPingerSec = uint64((duration + time.Minute).Seconds())
+	pingerID, err := thisClient.client.Start(ctx, config.startOptions(descStr, targetList))
+	if err != nil {
+		return pingclient.PingerInfo{}, nil, fmt.Errorf("start failed: %w", err)
+	}
+	defer (func() {
+		stopCtx, stopCtxCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer stopCtxCancel()
+		thisClient.client.Stop(stopCtx, pingerID)
+	})()
+
+	return thisClient.watchFor(ctx, pingerID, duration)
+}
+
+// watchFor 動いているpingerの結果を duration の間集計する
+func (thisClient *tClientWrap) watchFor(ctx context.Context, pingerID uint32, duration time.Duration) (pingclient.PingerInfo, []pingclient.TargetStats, error) {
+	var aggregator *pingclient.Aggregator
+	info, err := thisClient.watchResultsFor(ctx, pingerID, duration, func(info pingclient.PingerInfo) {
+		aggregator = pingclient.NewAggregator(info)
+	}, func(result pingclient.Result) {
+		aggregator.Add(result)
+	})
+	if err != nil {
+		return info, nil, err
+	}
+
+	return info, aggregator.Snapshot(), nil
+}
+
+// watchResultsFor 動いているpingerの結果を duration の間 add に渡す、start は結果の前に一度だけ呼ばれる
+// 期間の途中でストリームが終わったり中断されたらエラー
+func (thisClient *tClientWrap) watchResultsFor(ctx context.Context, pingerID uint32, duration time.Duration, start func(info pingclient.PingerInfo), add func(result pingclient.Result)) (pingclient.PingerInfo, error) {
+	watchCtx, watchCtxCancel := context.WithTimeout(ctx, duration)
+	defer watchCtxCancel()
+	watch, err := thisClient.client.WatchResults(watchCtx, pingerID)
+	if err != nil {
+		return pingclient.PingerInfo{}, fmt.Errorf("watch failed: %w", err)
+	}
+
+	start(watch.Info)
+	for result := range watch.C {
+		add(result)
+	}
+	if ctx.Err() != nil {
+		return watch.Info, fmt.Errorf("interrupted")
+	}
+	if watchCtx.Err() == nil {
+		// 期間の途中でストリームが終わった
+		if err := watch.Err(); err != nil {
+			return watch.Info, fmt.Errorf("result stream ended: %w", err)
+		}
+		return watch.Info, fmt.Errorf("result stream ended")
+	}
+
+	return watch.Info, nil
+}
+
+// monitoring-plugins の終了コード
+const (
+	checkStateOK       = 0
+	checkStateWarning  = 1
+	checkStateCritical = 2
+	checkStateUnknown  = 3
+)
+
+var checkStateNames = map[int]string{
+	checkStateOK:       "OK",
+	checkStateWarning:  "WARNING",
+	checkStateCritical: "CRITICAL",
+	checkStateUnknown:  "UNKNOWN",
+}
+
+// checkStateWorse CRITICAL > WARNING > UNKNOWN > OK
+func checkStateWorse(a int, b int) int {
+	rank := func(state int) int {
+		switch state {
+		case checkStateCritical:
+			return 3
+		case checkStateWarning:
+			return 2
+		case checkStateUnknown:
+			return 1
+		default:
+			return 0
+		}
+	}
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+type tCheckThresholds struct {
+	warnLoss float64
+	critLoss float64
+	warnRTT  float64
+	critRTT  float64
+}
+
+// checkTargetState loss(%) と平均RTT(ms) を閾値と比べる、結果が無ければ UNKNOWN
+func checkTargetState(s pingclient.TargetStats, thresholds tCheckThresholds) int {
+	if s.Sent == 0 {
+		return checkStateUnknown
+	}
+	if s.Target.ExpectUnreachable {
+		// 応答が無いことを期待する対象は1つでも応答があれば CRITICAL
+		if s.Received > 0 || s.Late > 0 {
+			return checkStateCritical
+		}
+		return checkStateOK
+	}
+	rtt := durationMillisec(s.Avg)
+	hasRTT := s.Received > 0
+	switch {
+	case s.LossPercent >= thresholds.critLoss, hasRTT && rtt >= thresholds.critRTT:
+		return checkStateCritical
+	case s.LossPercent >= thresholds.warnLoss, hasRTT && rtt >= thresholds.warnRTT:
+		return checkStateWarning
+	default:
+		return checkStateOK
+	}
+}
+
+func checkPerfLabel(s pingclient.TargetStats, name string) string {
+	return "'" + strings.ReplaceAll(s.Target.TargetBinIP+" "+name, "'", "''") + "'"
+}
+
+// checkPluginOutput 1行目に状態と要約と perfdata、2行目以降に対象ごとの詳細
+func checkPluginOutput(state int, summary string, stats []pingclient.TargetStats, states []int, thresholds tCheckThresholds) string {
+	perfdata := make([]string, 0, len(stats)*2)
+	details := make([]string, 0, len(stats))
+	for i, s := range stats {
+		rta := "U"
+		if s.Received > 0 {
+			rta = fmt.Sprintf("%.3fms", durationMillisec(s.Avg))
+		}
+		perfdata = append(perfdata,
+			fmt.Sprintf("%s=%s;%g;%g;0;", checkPerfLabel(s, "rta"), rta, thresholds.warnRTT, thresholds.critRTT),
+			fmt.Sprintf("%s=%.1f%%;%g;%g;0;100", checkPerfLabel(s, "pl"), s.LossPercent, thresholds.warnLoss, thresholds.critLoss),
+		)
+		detailRTA := "-"
+		if s.Received > 0 {
+			detailRTA = fmt.Sprintf("%.2fms", durationMillisec(s.Avg))
+		}
+		details = append(details, fmt.Sprintf("[%s] %s - loss %.1f%% (%d/%d), rta %s - %s",
+			checkStateNames[states[i]],
+			s.Target.TargetBinIP,
+			s.LossPercent,
+			s.Sent-s.Received,
+			s.Sent,
+			detailRTA,
+			targetComment(s.Target),
+		))
+	}
+
+	text := "PING " + checkStateNames[state] + " - " + summary
+	if len(perfdata) > 0 {
+		text += " | " + strings.Join(perfdata, " ")
+	}
+	if len(details) > 0 {
+		text += "\n" + strings.Join(details, "\n")
+	}
+	return text
+}
+
+// check 一時的なpingerで duration の間pingを撃ち、監視プラグインの形式で結果を出して終了コードを決める
+func (thisClient *tClientWrap) check(ctx context.Context, chOutPut chan<- tCliMsg, args []string) {
+	unknown := func(reason string) {
+		exitCode = checkStateUnknown
+		chOutPut <- tCliMsg{
+			text:    checkPluginOutput(checkStateUnknown, reason, nil, nil, tCheckThresholds{}),
+			color:   cliColorDefault,
+			noBreak: false,
+			data:    true,
+		}
+	}
+
+	flagSet := flag.NewFlagSet("check", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	var path string
+	var duration time.Duration
+	var thresholds tCheckThresholds
+	flagSet.StringVar(&path, "targets", "", "target list path")
+	flagSet.DurationVar(&duration, "duration", 30*time.Second, "how long to ping")
+	flagSet.Float64Var(&thresholds.warnLoss, "warn-loss", 20, "warning threshold of packet loss (%)")
+	flagSet.Float64Var(&thresholds.critLoss, "crit-loss", 60, "critical threshold of packet loss (%)")
+	flagSet.Float64Var(&thresholds.warnRTT, "warn-rtt", 100, "warning threshold of average rtt (ms)")
+	flagSet.Float64Var(&thresholds.critRTT, "crit-rtt", 300, "critical threshold of average rtt (ms)")
+	if err := flagSet.Parse(args); err != nil || path == "" || flagSet.NArg() > 0 || duration <= 0 {
+		unknown("usage: check -targets {target list path} [-duration 30s] [-warn-loss 20] [-crit-loss 60] [-warn-rtt 100] [-crit-rtt 300]")
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		unknown(err.Error())
+		return
+	}
+	targetList, _, err := pingclient.ParseTargets(file)
+	file.Close()
+	if err != nil {
+		unknown(err.Error())
+		return
+	}
+	if len(targetList) == 0 {
+		unknown("no targets in " + path)
+		return
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	_, stats, err := thisClient.pingFor(childCtx, "check "+path, targetList, duration)
+	if err != nil {
+		unknown(err.Error())
+		return
+	}
+
+	state := checkStateOK
+	states := make([]int, len(stats))
+	counts := make(map[int]int)
+	var maxLoss float64
+	var maxRTT time.Duration
+	for i, s := range stats {
+		states[i] = checkTargetState(s, thresholds)
+		state = checkStateWorse(state, states[i])
+		counts[states[i]]++
+		if s.LossPercent > maxLoss {
+			maxLoss = s.LossPercent
+		}
+		if s.Received > 0 && s.Avg > maxRTT {
+			maxRTT = s.Avg
+		}
+	}
+
+	summary := fmt.Sprintf("%d targets", len(stats))
+	for _, st := range []int{checkStateCritical, checkStateWarning, checkStateUnknown} {
+		if counts[st] > 0 {
+			summary += fmt.Sprintf(", %d %s", counts[st], strings.ToLower(checkStateNames[st]))
+		}
+	}
+	summary += fmt.Sprintf(", max loss %.1f%%, max rta %.3fms", maxLoss, durationMillisec(maxRTT))
+
+	exitCode = state
+	chOutPut <- tCliMsg{
+		text:    checkPluginOutput(state, summary, stats, states, thresholds),
+		color:   cliColorDefault,
+		noBreak: false,
+		data:    true,
+	}
+}
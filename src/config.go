@@ -1,8 +1,18 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/influx"
+	"github.com/umenosuke/ping-grpc-client/pkg/notify"
+	"github.com/umenosuke/ping-grpc-client/pkg/otlp"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+	"github.com/umenosuke/ping-grpc-client/pkg/syslog"
 )
 
 // Config 設定ファイルの中身
@@ -27,6 +37,132 @@ type Config struct {
 
 	//pingのstart時に統計表示のログを保存するパス、空白文字列でログを保存しない
 	CountLogOutputPath string `json:"CountLogOutputPath"`
+
+	//状態変化(DOWN)とみなす連続失敗回数
+	EventDownCount uint64 `json:"EventDownCount"`
+
+	//状態変化(UP)とみなす連続成功回数
+	EventUpCount uint64 `json:"EventUpCount"`
+
+	//対象ごとの EventDownCount, EventUpCount、キーは対象のIP(FQDN)
+	EventTargetHysteresis map[string]pingclient.Hysteresis `json:"EventTargetHysteresis"`
+
+	//pingのstart時に CountLogOutputPath へ状態変化のログも保存するか
+	EventLogOutput bool `json:"EventLogOutput"`
+
+	//同じ時間帯に DOWN になった対象がこの割合(%)以上なら1つの障害(観測点やサーバー側の障害)として通知し、個別の DOWN/UP を抑止する、0で無効
+	MassFailurePercent float64 `json:"MassFailurePercent"`
+
+	//DOWN になった対象がこの数より少なければ1つの障害とみなさない
+	MassFailureMinTargets uint64 `json:"MassFailureMinTargets"`
+
+	//同じ時間帯とみなす幅(ミリ秒)、DOWN の通知はこの間遅れる、0なら IntervalMillisec の2倍
+	MassFailureWindowMillisec uint64 `json:"MassFailureWindowMillisec"`
+
+	//結果や統計のストリームが IntervalMillisec, StatisticsIntervalSec の何回分届かなければ STALE と表示するか
+	StreamStaleCount uint64 `json:"StreamStaleCount"`
+
+	//結果や統計のストリームが何回分届かなければ購読し直すか、0なら購読し直さない
+	StreamResubscribeCount uint64 `json:"StreamResubscribeCount"`
+
+	//結果や統計のストリームが切れた時に繋ぎ直すまでの最初の待ち時間(ミリ秒)、失敗するたびに倍になる
+	StreamReconnectMinMillisec uint64 `json:"StreamReconnectMinMillisec"`
+
+	//繋ぎ直すまでの待ち時間の上限(ミリ秒)
+	StreamReconnectMaxMillisec uint64 `json:"StreamReconnectMaxMillisec"`
+
+	//TTL Exceeded が続いているかを判定する直近の結果の数
+	TTLWindowCount uint64 `json:"TTLWindowCount"`
+
+	//直近 TTLWindowCount 件のうち TTL Exceeded がこの割合(%)以上なら続いているとみなす
+	TTLPersistentPercent float64 `json:"TTLPersistentPercent"`
+
+	//状態変化を通知するWebhook、Template は generic, slack, teams のいずれか
+	Webhooks []notify.Webhook `json:"Webhooks"`
+
+	//Webhookへの1回のPOSTのタイムアウト(秒)
+	WebhookTimeoutSec uint64 `json:"WebhookTimeoutSec"`
+
+	//Webhookへの通知に失敗した時に再送する回数
+	WebhookRetryNum uint64 `json:"WebhookRetryNum"`
+
+	//Webhookへの再送までの待ち時間(秒)
+	WebhookRetryIntervalSec uint64 `json:"WebhookRetryIntervalSec"`
+
+	//同じ対象への通知を抑止する時間(秒)、DOWNを通知した後のUPは抑止しない
+	WebhookCooldownSec uint64 `json:"WebhookCooldownSec"`
+
+	//influx の書き込み先(/api/v2/write?org=...&bucket=...)、空白文字列なら InfluxOutputPath へ書く
+	InfluxWriteURL string `json:"InfluxWriteURL"`
+
+	//influx の書き込みに使うトークン
+	InfluxToken string `json:"InfluxToken"`
+
+	//influx の書き込み先のファイル、InfluxWriteURL と両方空白文字列なら標準出力
+	InfluxOutputPath string `json:"InfluxOutputPath"`
+
+	//influx の1回のPOSTの最大行数
+	InfluxBatchSize uint64 `json:"InfluxBatchSize"`
+
+	//influx へ溜まった行を送る間隔(秒)
+	InfluxFlushIntervalSec uint64 `json:"InfluxFlushIntervalSec"`
+
+	//influx へ送れていない行をいくつまで保持するか、超えたら古いものから捨てる
+	InfluxBufferSize uint64 `json:"InfluxBufferSize"`
+
+	//influx への1回のPOSTのタイムアウト(秒)
+	InfluxTimeoutSec uint64 `json:"InfluxTimeoutSec"`
+
+	//influx への送信に失敗した時に再送するまでの時間(秒)
+	InfluxRetryIntervalSec uint64 `json:"InfluxRetryIntervalSec"`
+
+	//otlp の送信先、grpc なら host:port (例 127.0.0.1:4317)、http ならURL (例 http://127.0.0.1:4318/v1/metrics)
+	OtlpEndpoint string `json:"OtlpEndpoint"`
+
+	//otlp の送信方法、grpc か http
+	OtlpProtocol string `json:"OtlpProtocol"`
+
+	//otlp を grpc で送る時に TLS を使わない
+	OtlpInsecure bool `json:"OtlpInsecure"`
+
+	//otlp の送信時に付けるヘッダ
+	OtlpHeaders map[string]string `json:"OtlpHeaders"`
+
+	//otlp へメトリクスを送る間隔(秒)
+	OtlpIntervalSec uint64 `json:"OtlpIntervalSec"`
+
+	//otlp への1回の送信のタイムアウト(秒)
+	OtlpTimeoutSec uint64 `json:"OtlpTimeoutSec"`
+
+	//syslog の送信先(host:port)、空白文字列なら送らない
+	SyslogAddress string `json:"SyslogAddress"`
+
+	//syslog の送信方法、udp, tcp, tls のいずれか
+	SyslogNetwork string `json:"SyslogNetwork"`
+
+	//syslog の facility、user, daemon, local0 ～ local7 または数値
+	SyslogFacility string `json:"SyslogFacility"`
+
+	//syslog の APP-NAME
+	SyslogAppName string `json:"SyslogAppName"`
+
+	//syslog の HOSTNAME、空白文字列ならこのホストの名前
+	SyslogHostname string `json:"SyslogHostname"`
+
+	//syslog の構造化データの SD-ID
+	SyslogSDID string `json:"SyslogSDID"`
+
+	//syslog を tls で送る時のCA証明書、空白文字列ならシステムの証明書
+	SyslogCACertificatePath string `json:"SyslogCACertificatePath"`
+
+	//syslog への接続と1回の送信のタイムアウト(秒)
+	SyslogTimeoutSec uint64 `json:"SyslogTimeoutSec"`
+
+	//result の結果を syslog へ送るか
+	SyslogResult bool `json:"SyslogResult"`
+
+	//events, notify, daemon の状態変化を syslog へ送るか
+	SyslogEvent bool `json:"SyslogEvent"`
 }
 
 // DefaultConfig is return default value config
@@ -39,6 +175,52 @@ func DefaultConfig() Config {
 		StatisticsIntervalSec: 1,
 		CountRateThreshold:    80,
 		CountLogOutputPath:    "",
+		EventDownCount:        3,
+		EventUpCount:          3,
+		EventTargetHysteresis: map[string]pingclient.Hysteresis{},
+		EventLogOutput:        false,
+		MassFailurePercent:    50,
+		MassFailureMinTargets: 3,
+		TTLWindowCount:        20,
+		TTLPersistentPercent:  50,
+
+		StreamStaleCount:           3,
+		StreamResubscribeCount:     0,
+		StreamReconnectMinMillisec: 500,
+		StreamReconnectMaxMillisec: 30000,
+
+		Webhooks:                []notify.Webhook{},
+		WebhookTimeoutSec:       10,
+		WebhookRetryNum:         3,
+		WebhookRetryIntervalSec: 5,
+		WebhookCooldownSec:      300,
+
+		InfluxWriteURL:         "",
+		InfluxToken:            "",
+		InfluxOutputPath:       "",
+		InfluxBatchSize:        5000,
+		InfluxFlushIntervalSec: 1,
+		InfluxBufferSize:       100000,
+		InfluxTimeoutSec:       10,
+		InfluxRetryIntervalSec: 5,
+
+		OtlpEndpoint:    "127.0.0.1:4317",
+		OtlpProtocol:    otlp.ProtocolGRPC,
+		OtlpInsecure:    false,
+		OtlpHeaders:     map[string]string{},
+		OtlpIntervalSec: 10,
+		OtlpTimeoutSec:  10,
+
+		SyslogAddress:           "",
+		SyslogNetwork:           syslog.NetworkUDP,
+		SyslogFacility:          "local0",
+		SyslogAppName:           "ping-grpc-client",
+		SyslogHostname:          "",
+		SyslogSDID:              syslog.DefaultSDID,
+		SyslogCACertificatePath: "",
+		SyslogTimeoutSec:        10,
+		SyslogResult:            true,
+		SyslogEvent:             true,
 	}
 }
 
@@ -69,3 +251,135 @@ func configStringify(data Config) string {
 
 	return string(jsonBlob)
 }
+
+func (config Config) startOptions(descStr string, targetList []pingclient.StartTarget) pingclient.StartOptions {
+	return pingclient.StartOptions{
+		Description:           descStr,
+		Targets:               targetList,
+		StopPingerSec:         config.StopPingerSec,
+		IntervalMillisec:      config.IntervalMillisec,
+		TimeoutMillisec:       config.TimeoutMillisec,
+		StatisticsCountsNum:   config.StatisticsCountsNum,
+		StatisticsIntervalSec: config.StatisticsIntervalSec,
+	}
+}
+
+// configOverride configJSONにある項目だけbaseを上書きしたコピーを返す
+func configOverride(base Config, configJSON []byte) (Config, error) {
+	jsonBlob, err := json.Marshal(base)
+	if err != nil {
+		return base, err
+	}
+
+	var res Config
+	if err := json.Unmarshal(jsonBlob, &res); err != nil {
+		return base, err
+	}
+	if len(configJSON) > 0 {
+		if err := json.Unmarshal(configJSON, &res); err != nil {
+			return base, err
+		}
+	}
+
+	return res, nil
+}
+
+func (config Config) eventDetectorOptions() pingclient.EventDetectorOptions {
+	return pingclient.EventDetectorOptions{
+		Default: pingclient.Hysteresis{
+			DownCount: config.EventDownCount,
+			UpCount:   config.EventUpCount,
+		},
+		Targets: config.EventTargetHysteresis,
+	}
+}
+
+func (config Config) massFailureOptions() pingclient.MassFailureOptions {
+	return pingclient.MassFailureOptions{
+		Percent:    config.MassFailurePercent,
+		MinTargets: int(config.MassFailureMinTargets),
+		Window:     time.Duration(config.MassFailureWindowMillisec) * time.Millisecond,
+	}
+}
+
+// newEventDetector eventDetectorOptions の状態変化に、多くの対象が同時に DOWN になった時の集約を加える
+func (config Config) newEventDetector(info pingclient.PingerInfo) *pingclient.MassFailureDetector {
+	return pingclient.NewMassFailureDetector(info, config.eventDetectorOptions(), config.massFailureOptions())
+}
+
+func (config Config) watchdogOptions() pingclient.WatchdogOptions {
+	return pingclient.WatchdogOptions{
+		StaleCount:       int(config.StreamStaleCount),
+		ResubscribeCount: int(config.StreamResubscribeCount),
+	}
+}
+
+func (config Config) backoffOptions() pingclient.BackoffOptions {
+	return pingclient.BackoffOptions{
+		Min: time.Duration(config.StreamReconnectMinMillisec) * time.Millisecond,
+		Max: time.Duration(config.StreamReconnectMaxMillisec) * time.Millisecond,
+	}
+}
+
+func (config Config) ttlAnalyzerOptions() pingclient.TTLAnalyzerOptions {
+	return pingclient.TTLAnalyzerOptions{
+		WindowCount:       int(config.TTLWindowCount),
+		PersistentPercent: config.TTLPersistentPercent,
+	}
+}
+
+func (config Config) notifyOptions() notify.Options {
+	return notify.Options{
+		Webhooks:      config.Webhooks,
+		Timeout:       time.Duration(config.WebhookTimeoutSec) * time.Second,
+		RetryNum:      int(config.WebhookRetryNum),
+		RetryInterval: time.Duration(config.WebhookRetryIntervalSec) * time.Second,
+		Cooldown:      time.Duration(config.WebhookCooldownSec) * time.Second,
+	}
+}
+
+func (config Config) influxWriterOptions() influx.HTTPWriterOptions {
+	return influx.HTTPWriterOptions{
+		URL:           config.InfluxWriteURL,
+		Token:         config.InfluxToken,
+		BatchSize:     int(config.InfluxBatchSize),
+		FlushInterval: time.Duration(config.InfluxFlushIntervalSec) * time.Second,
+		Timeout:       time.Duration(config.InfluxTimeoutSec) * time.Second,
+		RetryInterval: time.Duration(config.InfluxRetryIntervalSec) * time.Second,
+		BufferSize:    int(config.InfluxBufferSize),
+	}
+}
+
+func (config Config) otlpOptions() otlp.Options {
+	return otlp.Options{
+		Protocol: config.OtlpProtocol,
+		Endpoint: config.OtlpEndpoint,
+		Insecure: config.OtlpInsecure,
+		Headers:  config.OtlpHeaders,
+		Timeout:  time.Duration(config.OtlpTimeoutSec) * time.Second,
+	}
+}
+
+func (config Config) syslogWriterOptions() (syslog.WriterOptions, error) {
+	options := syslog.WriterOptions{
+		Network: config.SyslogNetwork,
+		Address: config.SyslogAddress,
+		Timeout: time.Duration(config.SyslogTimeoutSec) * time.Second,
+	}
+
+	if config.SyslogNetwork == syslog.NetworkTLS && config.SyslogCACertificatePath != "" {
+		caCert, err := ioutil.ReadFile(config.SyslogCACertificatePath)
+		if err != nil {
+			return options, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return options, fmt.Errorf("no certificate in %s", config.SyslogCACertificatePath)
+		}
+		options.TLSConfig = &tls.Config{
+			RootCAs: caCertPool,
+		}
+	}
+
+	return options, nil
+}
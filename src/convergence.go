@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// tConvergenceMark mark で記録した時刻
+type tConvergenceMark struct {
+	num   int
+	label string
+	time  time.Time
+}
+
+// tConvergenceRun 1回の連続した損失
+type tConvergenceRun struct {
+	target pingclient.Target
+	//最初に失われたpingの送信時刻
+	since             time.Time
+	firstLostSequence int64
+	lastLostSequence  int64
+	lostCount         int64
+	//復旧後最初の成功を受け取った時刻、継続中はゼロ値
+	recovered time.Time
+	//最初の失敗から復旧後最初の成功の送信までの時間
+	outage time.Duration
+	//復旧した時点で最後の mark、無ければ nil
+	mark *tConvergenceMark
+}
+
+func (run tConvergenceRun) ongoing() bool {
+	return run.recovered.IsZero()
+}
+
+// converge mark から復旧までの時間
+func (run tConvergenceRun) converge() (time.Duration, bool) {
+	if run.mark == nil || run.ongoing() {
+		return 0, false
+	}
+	return run.recovered.Sub(run.mark.time), true
+}
+
+// tConvergenceRecord is a line of "convergence" in structured output
+type tConvergenceRecord struct {
+	Kind              string  `json:"Kind"`
+	PingerID          uint32  `json:"PingerID"`
+	TargetID          uint32  `json:"TargetID"`
+	TargetIP          string  `json:"TargetIP"`
+	FQDN              string  `json:"FQDN"`
+	Comment           string  `json:"Comment"`
+	ExpectUnreachable bool    `json:"ExpectUnreachable"`
+	FirstLostSequence int64   `json:"FirstLostSequence"`
+	LastLostSequence  int64   `json:"LastLostSequence"`
+	LostCount         int64   `json:"LostCount"`
+	SinceUnixNanosec  int64   `json:"SinceUnixNanosec"`
+	Ongoing           bool    `json:"Ongoing"`
+	OutageMillisec    float64 `json:"OutageMillisec"`
+	//継続中は0
+	RecoveredUnixNanosec int64 `json:"RecoveredUnixNanosec"`
+	//復旧した時点(継続中は終了時点)で最後の mark、無ければ0
+	Mark             int      `json:"Mark"`
+	MarkLabel        string   `json:"MarkLabel"`
+	MarkUnixNanosec  int64    `json:"MarkUnixNanosec"`
+	ConvergeMillisec *float64 `json:"ConvergeMillisec"`
+}
+
+// tConvergenceMarkRecord is a mark of "convergence" in structured output
+type tConvergenceMarkRecord struct {
+	Kind            string `json:"Kind"`
+	PingerID        uint32 `json:"PingerID"`
+	Mark            int    `json:"Mark"`
+	MarkLabel       string `json:"MarkLabel"`
+	MarkUnixNanosec int64  `json:"MarkUnixNanosec"`
+}
+
+func newConvergenceRecord(pingerID uint32, run tConvergenceRun) tConvergenceRecord {
+	record := tConvergenceRecord{
+		Kind:              "loss-run",
+		PingerID:          pingerID,
+		TargetID:          run.target.TargetID,
+		TargetIP:          run.target.TargetBinIP,
+		FQDN:              run.target.FQDN(),
+		Comment:           run.target.Comment,
+		ExpectUnreachable: run.target.ExpectUnreachable,
+		FirstLostSequence: run.firstLostSequence,
+		LastLostSequence:  run.lastLostSequence,
+		LostCount:         run.lostCount,
+		SinceUnixNanosec:  run.since.UnixNano(),
+		Ongoing:           run.ongoing(),
+		OutageMillisec:    durationMillisec(run.outage),
+	}
+	if !run.ongoing() {
+		record.RecoveredUnixNanosec = run.recovered.UnixNano()
+	}
+	if run.mark != nil {
+		record.Mark = run.mark.num
+		record.MarkLabel = run.mark.label
+		record.MarkUnixNanosec = run.mark.time.UnixNano()
+	}
+	if d, ok := run.converge(); ok {
+		ms := durationMillisec(d)
+		record.ConvergeMillisec = &ms
+	}
+	return record
+}
+
+func convergenceMarkMsg(mark tConvergenceMark) tCliMsg {
+	label := ""
+	if mark.label != "" {
+		label = " - " + mark.label
+	}
+	return tCliMsg{
+		text:    fmt.Sprintf("M MARK %d - %s%s", mark.num, mark.time.Format("2006/01/02 15:04:05.000"), label),
+		color:   cliColorBlue,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+func convergenceLossMsg(run tConvergenceRun) tCliMsg {
+	return tCliMsg{
+		text: fmt.Sprintf("C LOSS - %s - %15s - lost since seq %05d - %s",
+			run.since.Format("2006/01/02 15:04:05.000"),
+			run.target.TargetBinIP,
+			run.firstLostSequence,
+			targetComment(run.target),
+		),
+		color:   cliColorRed,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+func convergenceRunMsg(run tConvergenceRun) tCliMsg {
+	strColor := cliColorGreen
+	end := run.recovered.Format("2006/01/02 15:04:05.000")
+	if run.ongoing() {
+		strColor = cliColorRed
+		end = "ongoing"
+	}
+
+	converge := ""
+	if d, ok := run.converge(); ok {
+		converge = fmt.Sprintf(", converged %.1fms after mark %d", durationMillisec(d), run.mark.num)
+	}
+
+	return tCliMsg{
+		text: fmt.Sprintf("C RUN  - %s - %15s - seq %05d-%05d, %d lost, outage %.1fms%s - %s",
+			end,
+			run.target.TargetBinIP,
+			run.firstLostSequence,
+			run.lastLostSequence,
+			run.lostCount,
+			durationMillisec(run.outage),
+			converge,
+			targetComment(run.target),
+		),
+		color:   strColor,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+// convergence 対象ごとの連続した損失を検出し、mark からの収束時間を測る
+func (thisClient *tClientWrap) convergence(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string, chLine <-chan string) {
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
+		return
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	watch, err := thisClient.watchResults(childCtx, chOutPut, id)
+	if err != nil {
+		if status.Code(err) == codes.Canceled {
+			return
+		}
+		if streamErr(err) {
+			exitCode = exitCodePingerNotFound
+		}
+		return
+	}
+	thisClient.printInfo(chOutPut, watch.Info)
+	chOutPut <- tCliMsg{
+		text:    "m, mark [label] : record the failover trigger time / s, summary : show summary / q : quit",
+		color:   cliColorDefault,
+		noBreak: false,
+	}
+
+	// 1回の失敗でDOWN、1回の成功でUPにすると連続した損失の始まりと終わりになる
+	detector := pingclient.NewEventDetector(watch.Info, pingclient.EventDetectorOptions{
+		Default: pingclient.Hysteresis{DownCount: 1, UpCount: 1},
+	})
+	marks := make([]*tConvergenceMark, 0)
+	lastMark := func() *tConvergenceMark {
+		if len(marks) == 0 {
+			return nil
+		}
+		return marks[len(marks)-1]
+	}
+	runs := make([]tConvergenceRun, 0)
+	ongoing := make(map[uint32]tConvergenceRun)
+
+	printRun := func(run tConvergenceRun) {
+		if thisClient.output.isStructured() {
+			chOutPut <- recordMsg(thisClient.output, newConvergenceRecord(id, run))
+		} else {
+			chOutPut <- convergenceRunMsg(run)
+		}
+	}
+	printSummary := func() {
+		thisClient.printConvergenceSummary(chOutPut, watch.Info, runs, ongoing, lastMark())
+	}
+
+loop:
+	for {
+		select {
+		case result, ok := <-watch.C:
+			if !ok {
+				break loop
+			}
+			e, ok := detector.Add(result)
+			if !ok {
+				// 続いている損失を伸ばす、タイムアウト後の応答は損失のまま
+				run, isOngoing := ongoing[result.Target.TargetID]
+				if isOngoing && !result.AsExpected() && (result.Target.ExpectUnreachable || result.Type != pingclient.ResultTypeReceiveAfterTimeout) {
+					run.lastLostSequence = result.Sequence
+					run.lostCount++
+					ongoing[result.Target.TargetID] = run
+				}
+				continue
+			}
+			switch e.Type {
+			case pingclient.EventDown:
+				run := tConvergenceRun{
+					target:            e.Target,
+					since:             e.Since,
+					firstLostSequence: e.FirstLostSequence,
+					lastLostSequence:  e.LastLostSequence,
+					lostCount:         e.LostCount,
+				}
+				ongoing[e.Target.TargetID] = run
+				if !thisClient.output.isMachine() {
+					chOutPut <- convergenceLossMsg(run)
+				}
+			case pingclient.EventUp:
+				delete(ongoing, e.Target.TargetID)
+				run := tConvergenceRun{
+					target:            e.Target,
+					since:             e.Since,
+					firstLostSequence: e.FirstLostSequence,
+					lastLostSequence:  e.LastLostSequence,
+					lostCount:         e.LostCount,
+					recovered:         e.Time,
+					outage:            e.OutageDuration,
+					mark:              lastMark(),
+				}
+				runs = append(runs, run)
+				printRun(run)
+			}
+		case line, ok := <-chLine:
+			if !ok {
+				chLine = nil
+				continue
+			}
+			command, label := line, ""
+			if i := strings.IndexAny(line, " \t"); i >= 0 {
+				command, label = line[:i], strings.TrimSpace(line[i+1:])
+			}
+			switch strings.ToLower(command) {
+			case "m", "ma", "mar", "mark":
+				mark := &tConvergenceMark{num: len(marks) + 1, label: label, time: time.Now()}
+				marks = append(marks, mark)
+				if thisClient.output.isStructured() {
+					chOutPut <- recordMsg(thisClient.output, tConvergenceMarkRecord{
+						Kind:            "mark",
+						PingerID:        id,
+						Mark:            mark.num,
+						MarkLabel:       mark.label,
+						MarkUnixNanosec: mark.time.UnixNano(),
+					})
+				} else {
+					chOutPut <- convergenceMarkMsg(*mark)
+				}
+			case "s", "su", "sum", "summ", "summa", "summar", "summary":
+				printSummary()
+			case "q", "qu", "qui", "quit":
+				childCtxCancel()
+			case "":
+			default:
+				chOutPut <- tCliMsg{
+					text:    "unknown command \"" + line + "\" (mark [label] / summary / quit)",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+			}
+		}
+	}
+	if streamErr(watch.Err()) {
+		exitCode = exitCodePingerNotFound
+	}
+
+	// 終了時点で続いている損失
+	now := time.Now()
+	for _, t := range watch.Info.Targets {
+		if run, ok := ongoing[t.TargetID]; ok {
+			run.outage = now.Sub(run.since)
+			run.mark = lastMark()
+			printRun(run)
+			ongoing[t.TargetID] = run
+		}
+	}
+	printSummary()
+}
+
+// printConvergenceSummary 対象ごとの損失の合計と、最後の mark からの収束時間
+func (thisClient *tClientWrap) printConvergenceSummary(chOutPut chan<- tCliMsg, info pingclient.PingerInfo, runs []tConvergenceRun, ongoing map[uint32]tConvergenceRun, mark *tConvergenceMark) {
+	if thisClient.output.isMachine() {
+		return
+	}
+
+	chOutPut <- tCliMsg{
+		text:    "",
+		color:   cliColorDefault,
+		noBreak: false,
+		data:    true,
+	}
+	if mark == nil {
+		chOutPut <- tCliMsg{
+			text:    "--- convergence summary --- no mark",
+			color:   cliColorDefault,
+			noBreak: false,
+			data:    true,
+		}
+	} else {
+		chOutPut <- tCliMsg{
+			text:    fmt.Sprintf("--- convergence summary --- after mark %d (%s)", mark.num, mark.time.Format("2006/01/02 15:04:05.000")),
+			color:   cliColorDefault,
+			noBreak: false,
+			data:    true,
+		}
+	}
+
+	for _, t := range info.Targets {
+		runCount := 0
+		var lostCount int64
+		var longest time.Duration
+		var converge time.Duration
+		for _, run := range runs {
+			if run.target.TargetID != t.TargetID {
+				continue
+			}
+			runCount++
+			lostCount += run.lostCount
+			if run.outage > longest {
+				longest = run.outage
+			}
+			if d, ok := run.converge(); ok && run.mark == mark && d > converge {
+				converge = d
+			}
+		}
+		run, isOngoing := ongoing[t.TargetID]
+		if isOngoing {
+			runCount++
+			lostCount += run.lostCount
+			if outage := time.Since(run.since); outage > longest {
+				longest = outage
+			}
+		}
+
+		strColor := cliColorDefault
+		state := ""
+		switch {
+		case isOngoing:
+			strColor = cliColorRed
+			state = "not converged"
+		case mark == nil:
+		case converge > 0:
+			strColor = cliColorGreen
+			state = fmt.Sprintf("converged %.1fms after mark", durationMillisec(converge))
+		default:
+			state = "no loss after mark"
+		}
+		if state != "" {
+			state = ", " + state
+		}
+
+		chOutPut <- tCliMsg{
+			text: fmt.Sprintf("%15s - %d runs, %d lost, longest outage %.1fms%s - %s",
+				t.TargetBinIP,
+				runCount,
+				lostCount,
+				durationMillisec(longest),
+				state,
+				targetComment(t),
+			),
+			color:   strColor,
+			noBreak: false,
+			data:    true,
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/notify"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// tDaemonRecord is a lifecycle line of "daemon" in structured output
+type tDaemonRecord struct {
+	Kind            string `json:"Kind"`
+	TimeUnixNanosec int64  `json:"TimeUnixNanosec"`
+	Monitor         string `json:"Monitor"`
+	PingerID        uint32 `json:"PingerID"`
+	Message         string `json:"Message"`
+}
+
+type tDaemonMonitor struct {
+	client         tClientWrap
+	chOutPut       chan<- tCliMsg
+	name           string
+	description    string
+	targetList     []pingclient.StartTarget
+	recreateBefore time.Duration
+	retryInterval  time.Duration
+
+	notifier     *notify.Notifier
+	syslogSender *tSyslogSender
+}
+
+func (thisClient *tClientWrap) daemon(ctx context.Context, chOutPut chan<- tCliMsg, path string) {
+	monitorsConfig, specs, ok := thisClient.loadMonitors(chOutPut, path)
+	if !ok {
+		return
+	}
+
+	monitors := make([]*tDaemonMonitor, 0, len(specs))
+	defer (func() {
+		for _, monitor := range monitors {
+			monitor.syslogSender.close()
+		}
+	})()
+	for _, spec := range specs {
+		monitor := &tDaemonMonitor{
+			client:         *thisClient,
+			chOutPut:       chOutPut,
+			name:           spec.name,
+			description:    spec.description,
+			targetList:     spec.targetList,
+			recreateBefore: time.Duration(monitorsConfig.RecreateBeforeSec) * time.Second,
+			retryInterval:  time.Duration(monitorsConfig.RetryIntervalSec) * time.Second,
+		}
+		monitor.client.config = spec.config
+		if len(spec.config.Webhooks) > 0 {
+			notifier, err := notify.New(spec.config.notifyOptions())
+			if err != nil {
+				logger.Log(labelinglog.FlgError, "["+spec.name+"] "+err.Error())
+				return
+			}
+			monitor.notifier = notifier
+		}
+		syslogSender, err := monitor.client.newSyslogSender()
+		if err != nil {
+			logger.Log(labelinglog.FlgError, "["+spec.name+"] syslog "+err.Error())
+			return
+		}
+		monitor.syslogSender = syslogSender
+		monitors = append(monitors, monitor)
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	wg := sync.WaitGroup{}
+	for _, monitor := range monitors {
+		wg.Add(1)
+		go (func(monitor *tDaemonMonitor) {
+			defer wg.Done()
+			monitor.run(childCtx)
+		})(monitor)
+	}
+	wg.Wait()
+}
+
+func (thisMonitor *tDaemonMonitor) log(pingerID uint32, color tCliColor, text string) {
+	now := time.Now()
+	if thisMonitor.client.output.isStructured() {
+		thisMonitor.chOutPut <- recordMsg(thisMonitor.client.output, tDaemonRecord{
+			Kind:            "daemon",
+			TimeUnixNanosec: now.UnixNano(),
+			Monitor:         thisMonitor.name,
+			PingerID:        pingerID,
+			Message:         text,
+		})
+		return
+	}
+
+	if pingerID != 0 {
+		text = "id " + strconv.FormatUint(uint64(pingerID), 10) + " " + text
+	}
+	thisMonitor.chOutPut <- tCliMsg{
+		text:    fmt.Sprintf("D - %s - %s - %s", now.Format("2006/01/02 15:04:05.000"), thisMonitor.name, text),
+		color:   color,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+// wait ctxが終わったらfalse
+func (thisMonitor *tDaemonMonitor) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(thisMonitor.retryInterval):
+		return true
+	}
+}
+
+func (thisMonitor *tDaemonMonitor) run(ctx context.Context) {
+	var current pingclient.PingerInfo
+	var detector *pingclient.MassFailureDetector
+
+	defer (func() {
+		if current.PingerID == 0 {
+			return
+		}
+		stopCtx, stopCtxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer stopCtxCancel()
+		thisMonitor.stopPinger(stopCtx, current.PingerID)
+	})()
+
+	// 作り直しの期限で通知が止まらないよう、通知は pinger を作り直しても同じものを使う
+	var chEvent chan<- pingclient.Event
+	if thisMonitor.notifier != nil {
+		var chNotifyDone <-chan struct{}
+		chEvent, chNotifyDone = thisMonitor.client.notifyWorker(ctx, thisMonitor.chOutPut, thisMonitor.notifier)
+		defer (func() { <-chNotifyDone })()
+		defer close(chEvent)
+	}
+
+	for {
+		if current.PingerID == 0 {
+			info, err := thisMonitor.startPinger(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				thisMonitor.log(0, cliColorRed, "start failed, retry in "+thisMonitor.retryInterval.String()+" : "+err.Error())
+				if !thisMonitor.wait(ctx) {
+					return
+				}
+				continue
+			}
+			current = info
+			// 作り直した pinger でも DOWN のままの対象を続けて扱う
+			if detector == nil {
+				detector = thisMonitor.client.config.newEventDetector(info)
+			} else {
+				detector.Rebind(info)
+			}
+		}
+
+		watchCtx, watchCtxCancel := context.WithDeadline(ctx, thisMonitor.recreateAt(current))
+		err := thisMonitor.watch(watchCtx, current.PingerID, detector, chEvent)
+		recreate := watchCtx.Err() == context.DeadlineExceeded
+		watchCtxCancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if recreate {
+			thisMonitor.log(current.PingerID, cliColorDefault, "expire at "+current.ExpireTime.Format("2006/01/02 15:04:05")+", recreating")
+			info, err := thisMonitor.startPinger(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				thisMonitor.log(current.PingerID, cliColorRed, "recreate failed, retry in "+thisMonitor.retryInterval.String()+" : "+err.Error())
+				if time.Now().After(current.ExpireTime) {
+					current = pingclient.PingerInfo{}
+				}
+				if !thisMonitor.wait(ctx) {
+					return
+				}
+				continue
+			}
+			thisMonitor.stopPinger(ctx, current.PingerID)
+			current = info
+			detector.Rebind(info)
+			continue
+		}
+
+		// 切れたストリームの再接続は watchResults などが行うので、ここに来るのは
+		// pinger が無くなったか、止められたか、繋ぎ直しても直らないエラーの時
+		if status.Code(err) == codes.NotFound {
+			thisMonitor.log(current.PingerID, cliColorYellow, "pinger lost, starting a new one : "+err.Error())
+			current = pingclient.PingerInfo{}
+			continue
+		}
+		if err != nil {
+			thisMonitor.log(current.PingerID, cliColorYellow, "stream ended : "+err.Error())
+		} else {
+			thisMonitor.log(current.PingerID, cliColorYellow, "stream ended")
+		}
+
+		info, err := thisMonitor.client.client.Info(ctx, current.PingerID)
+		switch {
+		case err == nil && info.StartTime.Equal(current.StartTime) && info.Description == current.Description:
+			thisMonitor.log(current.PingerID, cliColorDefault, "pinger alive, re-attach in "+thisMonitor.retryInterval.String())
+		case err == nil || status.Code(err) == codes.NotFound:
+			// サーバーの再起動などで別のpingerになっている
+			thisMonitor.log(current.PingerID, cliColorYellow, "pinger lost, starting a new one")
+			current = pingclient.PingerInfo{}
+			continue
+		default:
+			if ctx.Err() != nil {
+				return
+			}
+			thisMonitor.log(current.PingerID, cliColorRed, "server unreachable, retry in "+thisMonitor.retryInterval.String()+" : "+err.Error())
+		}
+		if !thisMonitor.wait(ctx) {
+			return
+		}
+	}
+}
+
+// recreateAt 期限のRecreateBeforeSec前、ただし寿命の半分より前にはしない
+func (thisMonitor *tDaemonMonitor) recreateAt(info pingclient.PingerInfo) time.Time {
+	before := thisMonitor.recreateBefore
+	if lifetime := info.ExpireTime.Sub(info.StartTime); before > lifetime/2 {
+		before = lifetime / 2
+	}
+
+	return info.ExpireTime.Add(-before)
+}
+
+func (thisMonitor *tDaemonMonitor) startPinger(ctx context.Context) (pingclient.PingerInfo, error) {
+	pingerID, err := thisMonitor.client.client.Start(ctx, thisMonitor.client.config.startOptions(thisMonitor.description, thisMonitor.targetList))
+	if err != nil {
+		return pingclient.PingerInfo{}, err
+	}
+
+	info, err := thisMonitor.client.client.Info(ctx, pingerID)
+	if err != nil {
+		thisMonitor.stopPinger(ctx, pingerID)
+		return pingclient.PingerInfo{}, err
+	}
+	thisMonitor.log(pingerID, cliColorGreen, fmt.Sprintf("started, %d targets, expire at %s", len(info.Targets), info.ExpireTime.Format("2006/01/02 15:04:05")))
+
+	return info, nil
+}
+
+func (thisMonitor *tDaemonMonitor) stopPinger(ctx context.Context, pingerID uint32) {
+	if err := thisMonitor.client.client.Stop(ctx, pingerID); err != nil {
+		thisMonitor.log(pingerID, cliColorRed, "stop failed : "+err.Error())
+		return
+	}
+	thisMonitor.log(pingerID, cliColorDefault, "stopped")
+}
+
+// watch 結果と統計の購読をどちらかが終わるまで続ける、chEvent が nil でなければ状態変化を渡す
+func (thisMonitor *tDaemonMonitor) watch(ctx context.Context, pingerID uint32, detector *pingclient.MassFailureDetector, chEvent chan<- pingclient.Event) error {
+	childCtx, childCtxCancel := context.WithCancel(ctx)
+	defer childCtxCancel()
+
+	resultWatch, err := thisMonitor.client.watchResults(childCtx, thisMonitor.chOutPut, pingerID)
+	if err != nil {
+		return err
+	}
+	statisticsWatch, err := thisMonitor.client.watchStatistics(childCtx, thisMonitor.chOutPut, pingerID)
+	if err != nil {
+		return err
+	}
+	thisMonitor.log(pingerID, cliColorDefault, "attached")
+
+	var logFile *os.File
+	if thisMonitor.client.config.CountLogOutputPath != "" {
+		logPath := thisMonitor.client.config.CountLogOutputPath + "/" + thisMonitor.name + ".log"
+		logFile, err = os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			logger.Log(labelinglog.FlgError, "logfile "+err.Error())
+		} else {
+			defer logFile.Close()
+		}
+	}
+
+	printEvent := func(e pingclient.Event) {
+		if thisMonitor.client.output.isStructured() {
+			thisMonitor.chOutPut <- recordMsg(thisMonitor.client.output, newEventRecord(e))
+		} else {
+			thisMonitor.chOutPut <- eventMsg(e)
+		}
+		thisMonitor.syslogSender.event(e)
+		if chEvent != nil {
+			chEvent <- e
+		}
+	}
+	mass := thisMonitor.client.config.newStatisticsMass(statisticsWatch.Info)
+
+	chResult := resultWatch.C
+	chStatistics := statisticsWatch.C
+	for chResult != nil && chStatistics != nil {
+		select {
+		case result, ok := <-chResult:
+			if !ok {
+				chResult = nil
+				continue
+			}
+			for _, e := range detector.Add(result) {
+				printEvent(e)
+			}
+		case statistics, ok := <-chStatistics:
+			if !ok {
+				chStatistics = nil
+				continue
+			}
+			if logFile != nil {
+				fmt.Fprintln(logFile, "")
+				for _, msg := range thisMonitor.client.statisticsMsgs(statistics, mass) {
+					fmt.Fprintln(logFile, msg.text)
+				}
+			}
+		}
+	}
+	childCtxCancel()
+	for _, e := range detector.Flush() {
+		printEvent(e)
+	}
+
+	if err := resultWatch.Err(); err != nil {
+		return err
+	}
+	return statisticsWatch.Err()
+}
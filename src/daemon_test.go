@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/fakepinger"
+)
+
+func TestDaemonKeepsDownAcrossRecreate(t *testing.T) {
+	env := newTestEnv(t, outputJSONL)
+	env.server.SetBehavior("192.0.2.2", fakepinger.Behavior{LossPercent: 100})
+	// 寿命2秒、半分の1秒ごとに作り直す
+	env.client.config.StopPingerSec = 2
+	env.client.config.EventDownCount = 1
+	path := writeFile(t, t.TempDir(), "monitors.yaml", "Monitors:\n  - Name: core\n    Targets:\n      - 192.0.2.1 up\n      - 192.0.2.2 down\n")
+
+	msgs := env.run(4500*time.Millisecond, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.daemon(ctx, chOutPut, path)
+	})
+
+	records := jsonRecords(t, msgs)
+	recreated := 0
+	for _, r := range records["daemon"] {
+		if strings.HasSuffix(r["Message"].(string), "recreating") {
+			recreated++
+		}
+	}
+	if recreated < 2 {
+		t.Fatalf("recreated %d times, want at least 2 : %v", recreated, records["daemon"])
+	}
+
+	downs := 0
+	for _, r := range records["event"] {
+		if r["TargetIP"] != "192.0.2.2" || r["Event"] != "DOWN" {
+			t.Errorf("unexpected event %v", r)
+			continue
+		}
+		downs++
+	}
+	if downs != 1 {
+		t.Errorf("got %d DOWN of the target down across recreate, want 1 : %v", downs, records["event"])
+	}
+}
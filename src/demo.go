@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/fakepinger"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// demoTargets はdemoで最初に起動するpingerの対象
+var demoTargets = []struct {
+	target   pingclient.StartTarget
+	behavior fakepinger.Behavior
+}{
+	{
+		target:   pingclient.StartTarget{TargetIP: "192.0.2.1", Comment: "stable"},
+		behavior: fakepinger.Behavior{RTTMean: 5 * time.Millisecond, RTTJitter: 1 * time.Millisecond},
+	},
+	{
+		target:   pingclient.StartTarget{TargetIP: "192.0.2.2", Comment: "lossy 20%"},
+		behavior: fakepinger.Behavior{LossPercent: 20, RTTMean: 30 * time.Millisecond, RTTJitter: 10 * time.Millisecond},
+	},
+	{
+		target:   pingclient.StartTarget{TargetIP: "192.0.2.3", Comment: "slow, sometimes late"},
+		behavior: fakepinger.Behavior{LatePercent: 10, RTTMean: 400 * time.Millisecond, RTTJitter: 150 * time.Millisecond},
+	},
+	{
+		target:   pingclient.StartTarget{TargetIP: "192.0.2.4", Comment: "down"},
+		behavior: fakepinger.Behavior{LossPercent: 100},
+	},
+	{
+		target:   pingclient.StartTarget{TargetIP: "192.0.2.5", Comment: "routing loop"},
+		behavior: fakepinger.Behavior{TTLExceededPercent: 90, TTLExceededFrom: "198.51.100.1", RTTMean: 20 * time.Millisecond},
+	},
+	{
+		target:   pingclient.StartTarget{TargetIP: "demo.example.com", Comment: "fqdn"},
+		behavior: fakepinger.Behavior{LossPercent: 2, RTTMean: 15 * time.Millisecond, RTTJitter: 3 * time.Millisecond},
+	},
+}
+
+// dialDemo starts a fake server with one running pinger and connects to it.
+func dialDemo(config Config) (*fakepinger.Server, *grpc.ClientConn, error) {
+	server := fakepinger.New(fakepinger.Options{
+		Seed:            time.Now().UnixNano(),
+		DefaultBehavior: fakepinger.DefaultBehavior(),
+	})
+
+	targets := make([]pingclient.StartTarget, 0, len(demoTargets))
+	for _, t := range demoTargets {
+		server.SetBehavior(t.target.TargetIP, t.behavior)
+		targets = append(targets, t.target)
+	}
+
+	ctx := context.Background()
+	conn, err := server.Dial(ctx)
+	if err != nil {
+		server.Close()
+		return nil, nil, err
+	}
+
+	pingerID, err := pingclient.New(conn).Start(ctx, pingclient.StartOptions{
+		Description:           "demo",
+		Targets:               targets,
+		StopPingerSec:         config.StopPingerSec,
+		IntervalMillisec:      config.IntervalMillisec,
+		TimeoutMillisec:       config.TimeoutMillisec,
+		StatisticsCountsNum:   config.StatisticsCountsNum,
+		StatisticsIntervalSec: config.StatisticsIntervalSec,
+	})
+	if err != nil {
+		conn.Close()
+		server.Close()
+		return nil, nil, err
+	}
+	logger.Log(labelinglog.FlgInfo, "demo mode, fake pinger started ID: "+strconv.FormatUint(uint64(pingerID), 10))
+
+	return server, conn, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/fakepinger"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+func TestStartStop(t *testing.T) {
+	env := newTestEnv(t, outputJSONL)
+	path := writeFile(t, t.TempDir(), "targets.txt", "192.0.2.1 first\n# comment\n192.0.2.2\tsecond\n")
+
+	msgs := env.run(5*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		targetList, ok := readTargetFile(chOutPut, path)
+		if !ok {
+			t.Fatal("readTargetFile failed")
+		}
+		env.client.start(ctx, chOutPut, "e2e", targetList)
+	})
+
+	infos := jsonRecords(t, msgs)[""]
+	if len(infos) != 1 {
+		t.Fatalf("start printed %d info, want 1 : %v", len(infos), msgs)
+	}
+	if infos[0]["Description"] != "e2e" || len(infos[0]["Targets"].([]interface{})) != 2 {
+		t.Errorf("start info = %v", infos[0])
+	}
+
+	pingers := env.list()
+	if len(pingers) != 1 || pingers[0].Description != "e2e" {
+		t.Fatalf("list after start = %v", pingers)
+	}
+
+	env.run(5*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.stop(ctx, chOutPut, "1")
+	})
+	if pingers := env.list(); len(pingers) != 0 {
+		t.Errorf("list after stop = %v", pingers)
+	}
+	if exitCode != 0 {
+		t.Errorf("exitCode = %d", exitCode)
+	}
+}
+
+func TestResult(t *testing.T) {
+	env := newTestEnv(t, outputText)
+	env.server.SetBehavior("192.0.2.2", fakepinger.Behavior{LossPercent: 100})
+	env.startPinger(
+		pingclient.StartTarget{TargetIP: "192.0.2.1", Comment: "up"},
+		pingclient.StartTarget{TargetIP: "192.0.2.2", Comment: "down"},
+	)
+
+	msgs := env.run(1500*time.Millisecond, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.result(ctx, chOutPut, true, outputText, "1")
+	})
+
+	up, down := 0, 0
+	for _, text := range dataTexts(msgs, "R ") {
+		switch {
+		case strings.HasPrefix(text, "R O") && strings.Contains(text, "192.0.2.1"):
+			up++
+		case strings.HasPrefix(text, "R X") && strings.Contains(text, "192.0.2.2") && strings.Contains(text, "Timeout!!"):
+			down++
+		default:
+			t.Errorf("unexpected result line %q", text)
+		}
+	}
+	if up < 5 || down < 5 {
+		t.Errorf("got %d replies and %d timeouts, want at least 5 each", up, down)
+	}
+	if len(dataTexts(msgs, "--- 192.0.2.")) != 2 {
+		t.Errorf("summary statistics missing : %v", msgs)
+	}
+}
+
+func TestResultJSONL(t *testing.T) {
+	env := newTestEnv(t, outputJSONL)
+	env.startPinger(pingclient.StartTarget{TargetIP: "192.0.2.1", Comment: "up"})
+
+	msgs := env.run(1*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.result(ctx, chOutPut, true, outputJSONL, "1")
+	})
+
+	results := jsonRecords(t, msgs)["result"]
+	if len(results) < 5 {
+		t.Fatalf("got %d result records, want at least 5", len(results))
+	}
+	for i, r := range results {
+		if r["TargetIP"] != "192.0.2.1" || r["Type"] != "Receive" || r["Sequence"] != float64(i) {
+			t.Errorf("result record %d = %v", i, r)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	env := newTestEnv(t, outputText)
+	env.server.SetBehavior("192.0.2.2", fakepinger.Behavior{LossPercent: 100})
+	env.startPinger(
+		pingclient.StartTarget{TargetIP: "192.0.2.1", Comment: "up"},
+		pingclient.StartTarget{TargetIP: "192.0.2.2", Comment: "down"},
+	)
+
+	msgs := env.run(2500*time.Millisecond, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.count(ctx, chOutPut, "1")
+	})
+
+	up := dataTexts(msgs, "S O")
+	down := dataTexts(msgs, "S X")
+	if len(up) < 2 || len(down) < 2 {
+		t.Fatalf("got %d O and %d X statistics lines, want at least 2 each : %v", len(up), len(down), msgs)
+	}
+	for _, text := range up {
+		if !strings.Contains(text, "192.0.2.1") || !strings.Contains(text, "100% in last 5") {
+			t.Errorf("unexpected O line %q", text)
+		}
+	}
+	for _, text := range down {
+		if !strings.Contains(text, "192.0.2.2") || !strings.Contains(text, "000% in last 5") {
+			t.Errorf("unexpected X line %q", text)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	env := newTestEnv(t, outputJSONL)
+	dir := t.TempDir()
+	apply := func(content string, args ...string) map[string]string {
+		path := writeFile(t, dir, "monitors.json", content)
+		msgs := env.run(5*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+			env.client.apply(ctx, chOutPut, append([]string{"-f", path}, args...))
+		})
+		actions := make(map[string]string)
+		for _, r := range jsonRecords(t, msgs)["apply"] {
+			if r["Error"] != "" {
+				t.Errorf("apply failed %v", r)
+			}
+			actions[r["Name"].(string)] = r["Action"].(string)
+		}
+		return actions
+	}
+	assertActions := func(got map[string]string, want map[string]string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("actions = %v, want %v", got, want)
+		}
+		for name, action := range want {
+			if got[name] != action {
+				t.Errorf("action of %s = %q, want %q", name, got[name], action)
+			}
+		}
+	}
+
+	assertActions(apply(`{"Monitors": [
+		{"Name": "core", "Targets": ["192.0.2.1 router", "! 192.0.2.9 closed"]},
+		{"Name": "edge", "Targets": ["192.0.2.2 !important"]}
+	]}`), map[string]string{"core": "create", "edge": "create"})
+	if pingers := env.list(); len(pingers) != 2 {
+		t.Fatalf("list after create = %v", pingers)
+	}
+
+	assertActions(apply(`{"Monitors": [
+		{"Name": "core", "Targets": ["192.0.2.1 router", "! 192.0.2.9 closed"]},
+		{"Name": "edge", "Targets": ["192.0.2.2 !important"]}
+	]}`), map[string]string{"core": "keep", "edge": "keep"})
+
+	assertExitCode := func(want int) {
+		t.Helper()
+		if exitCode != want {
+			t.Errorf("exitCode = %d, want %d", exitCode, want)
+		}
+	}
+	assertExitCode(0)
+
+	changed := `{"Monitors": [
+		{"Name": "core", "Targets": ["192.0.2.1 router", "192.0.2.3 new"]}
+	]}`
+	assertActions(apply(changed, "--dry-run"), map[string]string{"core": "replace", "edge": "delete"})
+	assertExitCode(exitCodeApplyPending)
+
+	assertActions(apply(changed), map[string]string{"core": "replace", "edge": "delete"})
+	assertExitCode(0)
+
+	assertActions(apply(changed, "--dry-run"), map[string]string{"core": "keep"})
+	assertExitCode(0)
+
+	assertActions(apply(`{"Monitors": [{"Name": "bad name"}]}`), map[string]string{})
+	assertExitCode(1)
+
+	pingers := env.list()
+	if len(pingers) != 1 || pingers[0].Description != "[apply:core] core" {
+		t.Fatalf("list after replace = %v", pingers)
+	}
+	info, err := env.client.client.Info(context.Background(), pingers[0].PingerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Targets) != 2 || info.Targets[1].TargetIP != "192.0.2.3" {
+		t.Errorf("targets after replace = %v", info.Targets)
+	}
+}
+
+func TestApplyServerUnavailable(t *testing.T) {
+	env := newTestEnv(t, outputJSONL)
+	path := writeFile(t, t.TempDir(), "monitors.json", `{"Monitors": [{"Name": "core", "Targets": ["192.0.2.1"]}]}`)
+
+	env.server.Close()
+	env.run(5*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.apply(ctx, chOutPut, []string{"-f", path})
+	})
+	if exitCode != 1 {
+		t.Errorf("exitCode = %d, want 1", exitCode)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// tEventRecord is a line of "events" in structured output
+type tEventRecord struct {
+	Kind                   string  `json:"Kind"`
+	Event                  string  `json:"Event"`
+	PingerID               uint32  `json:"PingerID"`
+	TargetID               uint32  `json:"TargetID"`
+	TargetIP               string  `json:"TargetIP"`
+	FQDN                   string  `json:"FQDN"`
+	Comment                string  `json:"Comment"`
+	ExpectUnreachable      bool    `json:"ExpectUnreachable"`
+	TimeUnixNanosec        int64   `json:"TimeUnixNanosec"`
+	SinceUnixNanosec       int64   `json:"SinceUnixNanosec"`
+	OutageDurationMillisec float64 `json:"OutageDurationMillisec"`
+	LostCount              int64   `json:"LostCount"`
+	FirstLostSequence      int64   `json:"FirstLostSequence"`
+	LastLostSequence       int64   `json:"LastLostSequence"`
+	Affected               int     `json:"Affected"`
+	TargetCount            int     `json:"TargetCount"`
+}
+
+func newEventRecord(e pingclient.Event) tEventRecord {
+	return tEventRecord{
+		Kind:                   "event",
+		Event:                  e.Type.String(),
+		PingerID:               e.PingerID,
+		TargetID:               e.Target.TargetID,
+		TargetIP:               e.Target.TargetBinIP,
+		FQDN:                   e.Target.FQDN(),
+		Comment:                e.Target.Comment,
+		ExpectUnreachable:      e.Target.ExpectUnreachable,
+		TimeUnixNanosec:        e.Time.UnixNano(),
+		SinceUnixNanosec:       e.Since.UnixNano(),
+		OutageDurationMillisec: durationMillisec(e.OutageDuration),
+		LostCount:              e.LostCount,
+		FirstLostSequence:      e.FirstLostSequence,
+		LastLostSequence:       e.LastLostSequence,
+		Affected:               e.Affected,
+		TargetCount:            e.TargetCount,
+	}
+}
+
+func eventMsg(e pingclient.Event) tCliMsg {
+	switch {
+	case e.Type.IsMass():
+		return massEventMsg(e)
+	case e.Type == pingclient.EventDown && e.Target.ExpectUnreachable:
+		return tCliMsg{
+			text: fmt.Sprintf("E DOWN - %s - %15s - answering, %d replies since %s (seq %05d) - %s",
+				e.Time.Format("2006/01/02 15:04:05.000"),
+				e.Target.TargetBinIP,
+				e.LostCount,
+				e.Since.Format("2006/01/02 15:04:05.000"),
+				e.FirstLostSequence,
+				targetComment(e.Target),
+			),
+			color:   cliColorRed,
+			noBreak: false,
+			data:    true,
+		}
+	case e.Type == pingclient.EventDown:
+		return tCliMsg{
+			text: fmt.Sprintf("E DOWN - %s - %15s - %d lost since %s (seq %05d) - %s",
+				e.Time.Format("2006/01/02 15:04:05.000"),
+				e.Target.TargetBinIP,
+				e.LostCount,
+				e.Since.Format("2006/01/02 15:04:05.000"),
+				e.FirstLostSequence,
+				targetComment(e.Target),
+			),
+			color:   cliColorRed,
+			noBreak: false,
+			data:    true,
+		}
+	case e.Target.ExpectUnreachable:
+		return tCliMsg{
+			text: fmt.Sprintf("E UP   - %s - %15s - unreachable again after %.3fs, %d replies (seq %05d-%05d) - %s",
+				e.Time.Format("2006/01/02 15:04:05.000"),
+				e.Target.TargetBinIP,
+				e.OutageDuration.Seconds(),
+				e.LostCount,
+				e.FirstLostSequence,
+				e.LastLostSequence,
+				targetComment(e.Target),
+			),
+			color:   cliColorGreen,
+			noBreak: false,
+			data:    true,
+		}
+	default:
+		return tCliMsg{
+			text: fmt.Sprintf("E UP   - %s - %15s - outage %.3fs, %d lost (seq %05d-%05d) - %s",
+				e.Time.Format("2006/01/02 15:04:05.000"),
+				e.Target.TargetBinIP,
+				e.OutageDuration.Seconds(),
+				e.LostCount,
+				e.FirstLostSequence,
+				e.LastLostSequence,
+				targetComment(e.Target),
+			),
+			color:   cliColorGreen,
+			noBreak: false,
+			data:    true,
+		}
+	}
+}
+
+func (thisClient *tClientWrap) events(ctx context.Context, chOutPut chan<- tCliMsg, execBackground bool, output tOutputFormat, pingerID string) {
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
+		return
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, execBackground)
+	defer childCtxCancel()
+
+	watch, err := thisClient.watchResults(childCtx, chOutPut, id)
+	if err != nil {
+		if status.Code(err) == codes.Canceled {
+			return
+		}
+		if streamErr(err) && !execBackground {
+			exitCode = exitCodePingerNotFound
+		}
+		return
+	}
+	thisClient.printInfo(chOutPut, watch.Info)
+
+	syslogSender, err := thisClient.newSyslogSender()
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "syslog "+err.Error())
+		return
+	}
+	defer syslogSender.close()
+
+	printEvent := func(e pingclient.Event) {
+		if output.isStructured() {
+			chOutPut <- recordMsg(output, newEventRecord(e))
+		} else {
+			chOutPut <- eventMsg(e)
+		}
+		syslogSender.event(e)
+	}
+
+	detector := thisClient.config.newEventDetector(watch.Info)
+	for result := range watch.C {
+		for _, e := range detector.Add(result) {
+			printEvent(e)
+		}
+	}
+	for _, e := range detector.Flush() {
+		printEvent(e)
+	}
+	if streamErr(watch.Err()) && !execBackground {
+		exitCode = exitCodePingerNotFound
+	}
+}
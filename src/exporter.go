@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/metrics"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// tCollectorSink feeds a metrics.Collector from followPingers
+type tCollectorSink struct {
+	collector *metrics.Collector
+}
+
+func (thisSink tCollectorSink) attach(info pingclient.PingerInfo) {
+	thisSink.collector.AddPinger(info)
+}
+
+func (thisSink tCollectorSink) detach(pingerID uint32) {
+	thisSink.collector.RemovePinger(pingerID)
+}
+
+func (thisSink tCollectorSink) result(r pingclient.Result) {
+	thisSink.collector.AddResult(r)
+}
+
+func (thisSink tCollectorSink) statistics(s pingclient.Statistics) {
+	thisSink.collector.AddStatistics(s)
+}
+
+// exporter 一致するpingerのメトリクスを Prometheus 形式で /metrics に出す
+func (thisClient *tClientWrap) exporter(ctx context.Context, chOutPut chan<- tCliMsg, listenAddress string, selectorArgs []string) {
+	collector := metrics.NewCollector(nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metrics.PrometheusContentType)
+		if err := collector.WritePrometheus(w); err != nil {
+			logger.Log(labelinglog.FlgWarn, "metrics: "+err.Error())
+		}
+	})
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, err.Error())
+		return
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	chServeDone := make(chan struct{})
+	go (func() {
+		defer close(chServeDone)
+		defer childCtxCancel()
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Log(labelinglog.FlgError, err.Error())
+		}
+	})()
+	chOutPut <- tCliMsg{
+		text:    "serving http://" + listener.Addr().String() + "/metrics",
+		color:   cliColorDefault,
+		noBreak: false,
+	}
+
+	thisClient.followPingers(childCtx, chOutPut, parsePingerSelectors(selectorArgs), tCollectorSink{collector: collector})
+
+	shutdownCtx, shutdownCtxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCtxCancel()
+	server.Shutdown(shutdownCtx)
+	<-chServeDone
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// followPollInterval 対象のpingerが増えていないか確認する間隔
+const followPollInterval = 10 * time.Second
+
+// tPingerSink receives the streams of the pingers followed by followPingers
+type tPingerSink interface {
+	attach(info pingclient.PingerInfo)
+	detach(pingerID uint32)
+	result(r pingclient.Result)
+	statistics(s pingclient.Statistics)
+}
+
+// tPingerSelector 数字はPingerID、それ以外は Description か apply の Name に一致するpinger
+type tPingerSelector struct {
+	pingerID uint32
+	name     string
+}
+
+func parsePingerSelectors(args []string) []tPingerSelector {
+	selectors := make([]tPingerSelector, 0, len(args))
+	for _, arg := range args {
+		if id, err := strconv.ParseUint(arg, 10, 32); err == nil {
+			selectors = append(selectors, tPingerSelector{pingerID: uint32(id)})
+		} else {
+			selectors = append(selectors, tPingerSelector{name: arg})
+		}
+	}
+	return selectors
+}
+
+func matchPingerSelectors(selectors []tPingerSelector, p pingclient.PingerSummary) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, s := range selectors {
+		if s.name == "" {
+			if s.pingerID == p.PingerID {
+				return true
+			}
+			continue
+		}
+		if s.name == p.Description {
+			return true
+		}
+		if match := applyMarkerRegexp.FindStringSubmatch(p.Description); match != nil && match[1] == s.name {
+			return true
+		}
+	}
+	return false
+}
+
+// followPingers 一致するpingerの結果と統計をctxが終わるまでsinkへ流す
+// 新しく起動したpingerは followPollInterval ごとに見つけて購読し、止まったpingerは外す
+func (thisClient *tClientWrap) followPingers(ctx context.Context, chOutPut chan<- tCliMsg, selectors []tPingerSelector, sink tPingerSink) {
+	var mu sync.Mutex
+	following := make(map[uint32]bool)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	logFollow := func(pingerID uint32, text string) {
+		chOutPut <- tCliMsg{
+			text:    fmt.Sprintf("F - %s - id %d %s", time.Now().Format("2006/01/02 15:04:05.000"), pingerID, text),
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+	}
+
+	for {
+		pingers, err := thisClient.client.List(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		}
+
+		for _, p := range pingers {
+			if !matchPingerSelectors(selectors, p) {
+				continue
+			}
+			mu.Lock()
+			isFollowing := following[p.PingerID]
+			following[p.PingerID] = true
+			mu.Unlock()
+			if isFollowing {
+				continue
+			}
+
+			wg.Add(1)
+			go (func(pingerID uint32) {
+				defer wg.Done()
+				defer (func() {
+					mu.Lock()
+					delete(following, pingerID)
+					mu.Unlock()
+				})()
+
+				err := thisClient.followPinger(ctx, chOutPut, pingerID, sink, func() { logFollow(pingerID, "attached") })
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					logFollow(pingerID, "detached : "+err.Error())
+				} else {
+					logFollow(pingerID, "detached")
+				}
+			})(p.PingerID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+// followPinger 切れたストリームは watchResults などが繋ぎ直し、STALE などの知らせは chNotice へ出す
+func (thisClient *tClientWrap) followPinger(ctx context.Context, chNotice chan<- tCliMsg, pingerID uint32, sink tPingerSink, onAttach func()) error {
+	childCtx, childCtxCancel := context.WithCancel(ctx)
+	defer childCtxCancel()
+
+	resultWatch, err := thisClient.watchResults(childCtx, chNotice, pingerID)
+	if err != nil {
+		return err
+	}
+	statisticsWatch, err := thisClient.watchStatistics(childCtx, chNotice, pingerID)
+	if err != nil {
+		return err
+	}
+	sink.attach(resultWatch.Info)
+	defer sink.detach(pingerID)
+	onAttach()
+
+	chResult := resultWatch.C
+	chStatistics := statisticsWatch.C
+	for chResult != nil && chStatistics != nil {
+		select {
+		case result, ok := <-chResult:
+			if !ok {
+				chResult = nil
+				continue
+			}
+			sink.result(result)
+		case statistics, ok := <-chStatistics:
+			if !ok {
+				chStatistics = nil
+				continue
+			}
+			sink.statistics(statistics)
+		}
+	}
+	childCtxCancel()
+
+	if err := resultWatch.Err(); err != nil {
+		return err
+	}
+	return statisticsWatch.Err()
+}
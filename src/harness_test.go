@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/fakepinger"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// testEnv is the CLI client connected to a fakepinger.Server over bufconn.
+type testEnv struct {
+	t      *testing.T
+	server *fakepinger.Server
+	client *tClientWrap
+}
+
+func newTestEnv(t *testing.T, output tOutputFormat) *testEnv {
+	t.Helper()
+
+	server := fakepinger.New(fakepinger.Options{Seed: 1, DefaultBehavior: fakepinger.DefaultBehavior()})
+	conn, err := server.Dial(context.Background())
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Close()
+	})
+
+	config := DefaultConfig()
+	config.StopPingerSec = 60
+	config.IntervalMillisec = 100
+	config.TimeoutMillisec = 100
+	config.StatisticsCountsNum = 5
+	config.StatisticsIntervalSec = 1
+
+	exitCode = 0
+	t.Cleanup(func() { exitCode = 0 })
+
+	return &testEnv{
+		t:      t,
+		server: server,
+		client: &tClientWrap{
+			client:   pingclient.New(conn),
+			chCancel: make(chan struct{}),
+			wgFinish: &sync.WaitGroup{},
+			config:   config,
+			output:   output,
+		},
+	}
+}
+
+// run runs command until it returns or d passes and returns everything it printed.
+func (thisEnv *testEnv) run(d time.Duration, command func(ctx context.Context, chOutPut chan<- tCliMsg)) []tCliMsg {
+	thisEnv.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	ch := make(chan tCliMsg, 200)
+	msgs := make([]tCliMsg, 0)
+	done := make(chan struct{})
+	go (func() {
+		defer close(done)
+		for msg := range ch {
+			msgs = append(msgs, msg)
+		}
+	})()
+
+	command(ctx, ch)
+	thisEnv.client.wgFinish.Wait()
+	close(ch)
+	<-done
+
+	return msgs
+}
+
+// startPinger starts a pinger with the config of the env directly, not through the CLI.
+func (thisEnv *testEnv) startPinger(targets ...pingclient.StartTarget) uint32 {
+	thisEnv.t.Helper()
+
+	pingerID, err := thisEnv.client.client.Start(context.Background(), thisEnv.client.config.startOptions("test", targets))
+	if err != nil {
+		thisEnv.t.Fatal(err)
+	}
+	return pingerID
+}
+
+func (thisEnv *testEnv) list() []pingclient.PingerSummary {
+	thisEnv.t.Helper()
+
+	pingers, err := thisEnv.client.client.List(context.Background())
+	if err != nil {
+		thisEnv.t.Fatal(err)
+	}
+	return pingers
+}
+
+// writeFile writes content to name in a temporary directory and returns the path.
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// dataTexts returns the text of the data messages starting with prefix.
+func dataTexts(msgs []tCliMsg, prefix string) []string {
+	texts := make([]string, 0)
+	for _, msg := range msgs {
+		if msg.data && strings.HasPrefix(msg.text, prefix) {
+			texts = append(texts, msg.text)
+		}
+	}
+	return texts
+}
+
+// jsonRecords decodes every data message as a JSON object and groups them by Kind.
+func jsonRecords(t *testing.T, msgs []tCliMsg) map[string][]map[string]interface{} {
+	t.Helper()
+
+	records := make(map[string][]map[string]interface{})
+	for _, msg := range msgs {
+		if !msg.data {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(msg.text), "\n") {
+			record := make(map[string]interface{})
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("not a json line %q : %v", line, err)
+			}
+			kind, _ := record["Kind"].(string)
+			records[kind] = append(records[kind], record)
+		}
+	}
+	return records
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/influx"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// tInfluxSink writes line protocol from followPingers
+type tInfluxSink struct {
+	write func(lines ...string)
+}
+
+func (thisSink tInfluxSink) attach(info pingclient.PingerInfo) {}
+
+func (thisSink tInfluxSink) detach(pingerID uint32) {}
+
+func (thisSink tInfluxSink) result(r pingclient.Result) {
+	thisSink.write(influx.ResultLine(influx.DefaultResultMeasurement, r))
+}
+
+func (thisSink tInfluxSink) statistics(s pingclient.Statistics) {
+	thisSink.write(influx.StatisticsLines(influx.DefaultStatisticsMeasurement, s)...)
+}
+
+// influx 一致するpingerの結果と統計を InfluxDB line protocol で書き続ける
+func (thisClient *tClientWrap) influx(ctx context.Context, chOutPut chan<- tCliMsg, selectorArgs []string) {
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	var sink tInfluxSink
+	switch {
+	case thisClient.config.InfluxWriteURL != "":
+		options := thisClient.config.influxWriterOptions()
+		options.OnError = func(err error) {
+			logger.Log(labelinglog.FlgError, err.Error())
+		}
+		writer := influx.NewHTTPWriter(options)
+
+		chWriterDone := make(chan struct{})
+		go (func() {
+			defer close(chWriterDone)
+			writer.Run(childCtx)
+		})()
+		defer (func() {
+			<-chWriterDone
+			if dropped := writer.Dropped(); dropped > 0 {
+				logger.Log(labelinglog.FlgWarn, fmt.Sprintf("influx: %d lines dropped (buffer full)", dropped))
+			}
+		})()
+
+		sink.write = writer.Write
+	case thisClient.config.InfluxOutputPath != "":
+		file, err := os.OpenFile(thisClient.config.InfluxOutputPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			logger.Log(labelinglog.FlgError, "influx "+err.Error())
+			return
+		}
+		defer file.Close()
+
+		var mu sync.Mutex
+		sink.write = func(lines ...string) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, line := range lines {
+				fmt.Fprintln(file, line)
+			}
+		}
+	default:
+		sink.write = func(lines ...string) {
+			for _, line := range lines {
+				chOutPut <- tCliMsg{
+					text:    line,
+					color:   cliColorDefault,
+					noBreak: false,
+					data:    true,
+				}
+			}
+		}
+	}
+
+	thisClient.followPingers(childCtx, chOutPut, parsePingerSelectors(selectorArgs), sink)
+}
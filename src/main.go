@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
@@ -10,10 +9,8 @@ import (
 	"io/ioutil"
 	"os"
 	"os/signal"
-	"regexp"
 	"runtime"
 	"strconv"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -23,7 +20,7 @@ import (
 	"google.golang.org/grpc/keepalive"
 
 	"github.com/umenosuke/labelinglog"
-	pb "github.com/umenosuke/ping-grpc-client/proto/pingGrpc"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
 )
 
 type tCliColor int
@@ -40,6 +37,8 @@ type tCliMsg struct {
 	text    string
 	color   tCliColor
 	noBreak bool
+	//機械可読な出力の本体か、-output が text 以外の時はそれ以外を標準エラー出力へ出す
+	data bool
 }
 
 const terminateTimeOutSec = 15
@@ -63,6 +62,7 @@ var (
 	argConfig                string
 	argConfigPath            string
 	argNoColor               bool
+	argOutput                string
 	argShowConfigFlg         bool
 	argShowVersionFlag       bool
 )
@@ -79,6 +79,7 @@ func init() {
 	flag.StringVar(&argConfig, "config", "{}", "config json string")
 	flag.StringVar(&argConfigPath, "configPath", "", "config file path")
 	flag.BoolVar(&argNoColor, "noColor", false, "disable colorful output")
+	flag.StringVar(&argOutput, "output", "text", "output format (text|json|jsonl|yaml|table)")
 	flag.BoolVar(&argShowConfigFlg, "printConfig", false, "show default config")
 	flag.BoolVar(&argShowVersionFlag, "version", false, "show version")
 	flag.BoolVar(&argShowVersionFlag, "v", false, "show version (shorthand)")
@@ -98,6 +99,16 @@ func main() {
 }
 
 func subMain() {
+	// 監視プラグインとして呼ばれた時は準備の失敗も UNKNOWN として出力する
+	setupFailed := func(err error) {
+		logger.Log(labelinglog.FlgFatal, err.Error())
+		exitCode = 1
+		if isPluginSubCommand(flag.Args()) {
+			exitCode = checkStateUnknown
+			fmt.Fprintln(os.Stdout, checkPluginOutput(checkStateUnknown, err.Error(), nil, nil, tCheckThresholds{}))
+		}
+	}
+
 	if argShowVersionFlag {
 		fmt.Fprint(os.Stdout, "Version "+metaVersion+"\n"+"Revision "+metaRevision+"\n")
 		return
@@ -110,8 +121,7 @@ func subMain() {
 
 	config, err := configLoad(argConfigPath, argConfig)
 	if err != nil {
-		logger.Log(labelinglog.FlgFatal, err.Error())
-		exitCode = 1
+		setupFailed(err)
 		return
 	}
 	if argDebugFlag {
@@ -119,18 +129,37 @@ func subMain() {
 		logger.LogMultiLines(labelinglog.FlgDebug, configStringify(config))
 	}
 
-	grpcDialOptions, err := getGrpcDialOptions()
+	outputFormat, err := parseOutputFormat(argOutput)
 	if err != nil {
-		logger.Log(labelinglog.FlgFatal, err.Error())
-		exitCode = 1
+		setupFailed(err)
 		return
 	}
 
-	conn, err := grpc.Dial(argServerAddress, grpcDialOptions...)
-	if err != nil {
-		logger.Log(labelinglog.FlgFatal, err.Error())
-		exitCode = 1
-		return
+	args := flag.Args()
+
+	var conn *grpc.ClientConn
+	if len(args) >= 1 && args[0] == "demo" {
+		args = args[1:]
+
+		demoServer, demoConn, err := dialDemo(config)
+		if err != nil {
+			setupFailed(err)
+			return
+		}
+		defer demoServer.Close()
+		conn = demoConn
+	} else {
+		grpcDialOptions, err := getGrpcDialOptions()
+		if err != nil {
+			setupFailed(err)
+			return
+		}
+
+		conn, err = grpc.Dial(argServerAddress, grpcDialOptions...)
+		if err != nil {
+			setupFailed(err)
+			return
+		}
 	}
 	defer conn.Close()
 
@@ -154,7 +183,11 @@ func subMain() {
 			case sig := <-c:
 				switch sig {
 				case syscall.SIGINT:
-					fmt.Println()
+					if outputFormat.isMachine() {
+						fmt.Fprintln(os.Stderr)
+					} else {
+						fmt.Println()
+					}
 					logger.Log(labelinglog.FlgDebug, "request stop, SIGINT")
 					chCancel <- struct{}{}
 				default:
@@ -164,7 +197,7 @@ func subMain() {
 		}
 	})()
 
-	enableColor := !argNoColor && runtime.GOOS != "windows"
+	enableColor := !argNoColor && runtime.GOOS != "windows" && !outputFormat.isMachine() && !isPluginSubCommand(args)
 	chCLIStr := make(chan tCliMsg, 200)
 	wgFinishLog.Add(1)
 	go (func() {
@@ -193,15 +226,20 @@ func subMain() {
 				str += "\x1b[49m\x1b[39m"
 			}
 
+			out := os.Stdout
+			if outputFormat.isMachine() && !msg.data {
+				out = os.Stderr
+			}
+
 			if msg.noBreak {
-				fmt.Print(str)
+				fmt.Fprint(out, str)
 			} else {
-				fmt.Println(str)
+				fmt.Fprintln(out, str)
 			}
 		}
 	})()
 
-	var isInteractive = len(flag.Args()) < 1
+	var isInteractive = len(args) < 1
 
 	wgFinish.Add(1)
 	go (func() {
@@ -209,18 +247,19 @@ func subMain() {
 		defer childCtxCancel()
 
 		client := tClientWrap{
-			client:        pb.NewPingerClient(conn),
+			client:        pingclient.New(conn),
 			chCancel:      chCancel,
 			wgFinish:      &sync.WaitGroup{},
 			config:        config,
 			isInteractive: isInteractive,
+			output:        outputFormat,
 		}
 
 		if isInteractive {
 			client.interactive(childCtx, chCLIStr)
 		} else {
-			var subCommand = flag.Args()[0]
-			var subCommandArgs = flag.Args()[1:]
+			var subCommand = args[0]
+			var subCommandArgs = args[1:]
 
 			switch subCommand {
 			case "s", "st":
@@ -229,7 +268,8 @@ func subMain() {
 						"unknown command \"" + subCommand + "\"\n" +
 						"\n" +
 						"start : start pinger\n" +
-						"stop  : stop pinger",
+						"stop  : stop pinger\n" +
+						"stats : show rtt statistics",
 					color:   cliColorDefault,
 					noBreak: false,
 				}
@@ -248,54 +288,8 @@ func subMain() {
 						descStr = path
 					}
 
-					if _, err := os.Stat(path); err != nil {
-						logger.Log(labelinglog.FlgError, "target list file not found ["+path+"]")
-						chCLIStr <- tCliMsg{
-							text:    "not found [" + path + "]",
-							color:   cliColorDefault,
-							noBreak: false,
-						}
-						return
-					}
-
-					file, err := os.Open(path)
-					if err != nil {
-						logger.Log(labelinglog.FlgError, err.Error())
-						chCLIStr <- tCliMsg{
-							text:    "can not open [" + path + "]",
-							color:   cliColorDefault,
-							noBreak: false,
-						}
-						return
-					}
-					defer file.Close()
-
-					targetList := make([]*pb.StartRequest_IcmpTarget, 0)
-					reg := regexp.MustCompile(`^([^# \t]*)[# \t]*(.*)$`)
-					scanner := bufio.NewScanner(file)
-					lineNum := 0
-					for scanner.Scan() {
-						lineNum++
-						line := strings.Trim(scanner.Text(), " \t")
-						if line != "" {
-							result := reg.FindStringSubmatch(line)
-							if result != nil {
-								targetIP := result[1]
-								targetComment := result[2]
-
-								targetList = append(targetList, &pb.StartRequest_IcmpTarget{
-									TargetIP: targetIP,
-									Comment:  targetComment,
-								})
-							} else {
-								logger.Log(labelinglog.FlgInfo, fmt.Sprintf("[%s] line %3d skip, comment or format error \"%s\"", path, lineNum, line))
-							}
-						} else {
-							logger.Log(labelinglog.FlgInfo, fmt.Sprintf("[%s] line %3d skip, empty \"%s\"", path, lineNum, line))
-						}
-					}
-					if err := scanner.Err(); err != nil {
-						logger.Log(labelinglog.FlgError, err.Error())
+					targetList, ok := readTargetFile(chCLIStr, path)
+					if !ok {
 						return
 					}
 
@@ -381,7 +375,7 @@ func subMain() {
 					noBreak: false,
 				}
 				if len(subCommandArgs) >= 1 {
-					client.result(childCtx, chCLIStr, false, subCommandArgs[0])
+					client.result(childCtx, chCLIStr, false, client.output, subCommandArgs[0])
 				} else {
 					chCLIStr <- tCliMsg{
 						text:    "Please enter \"pingerID\"",
@@ -406,6 +400,188 @@ func subMain() {
 					}
 					return
 				}
+			case "stat", "stats":
+				chCLIStr <- tCliMsg{
+					text:    "[stats]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				if len(subCommandArgs) >= 2 {
+					client.stats(childCtx, chCLIStr, subCommandArgs[0], subCommandArgs[1])
+				} else if len(subCommandArgs) >= 1 {
+					client.stats(childCtx, chCLIStr, subCommandArgs[0], "")
+				} else {
+					chCLIStr <- tCliMsg{
+						text:    "Please enter \"pingerID\"",
+						color:   cliColorDefault,
+						noBreak: false,
+					}
+					return
+				}
+			case "ev", "eve", "even", "event", "events":
+				chCLIStr <- tCliMsg{
+					text:    "[events]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				if len(subCommandArgs) >= 1 {
+					client.events(childCtx, chCLIStr, false, client.output, subCommandArgs[0])
+				} else {
+					chCLIStr <- tCliMsg{
+						text:    "Please enter \"pingerID\"",
+						color:   cliColorDefault,
+						noBreak: false,
+					}
+					return
+				}
+			case "n", "no", "not", "noti", "notif", "notify":
+				chCLIStr <- tCliMsg{
+					text:    "[notify]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				if len(subCommandArgs) >= 1 {
+					client.notify(childCtx, chCLIStr, subCommandArgs[0])
+				} else {
+					chCLIStr <- tCliMsg{
+						text:    "Please enter \"pingerID\"",
+						color:   cliColorDefault,
+						noBreak: false,
+					}
+					return
+				}
+			case "t", "ta", "tab", "tabl", "table":
+				chCLIStr <- tCliMsg{
+					text:    "[table]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				if len(subCommandArgs) >= 1 {
+					stdin := newStdin(false)
+					defer stdin.stop()
+					chKey, restore := stdin.keys()
+					defer restore()
+					client.table(childCtx, chCLIStr, subCommandArgs[0], chKey)
+				} else {
+					chCLIStr <- tCliMsg{
+						text:    "Please enter \"pingerID\"",
+						color:   cliColorDefault,
+						noBreak: false,
+					}
+					return
+				}
+			case "ttl":
+				chCLIStr <- tCliMsg{
+					text:    "[ttl]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				if len(subCommandArgs) >= 2 {
+					client.ttl(childCtx, chCLIStr, subCommandArgs[0], subCommandArgs[1])
+				} else if len(subCommandArgs) >= 1 {
+					client.ttl(childCtx, chCLIStr, subCommandArgs[0], "")
+				} else {
+					chCLIStr <- tCliMsg{
+						text:    "Please enter \"pingerID\"",
+						color:   cliColorDefault,
+						noBreak: false,
+					}
+					return
+				}
+			case "conv", "conve", "conver", "converg", "converge", "convergen", "convergenc", "convergence":
+				chCLIStr <- tCliMsg{
+					text:    "[convergence]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				if len(subCommandArgs) >= 1 {
+					stdin := newStdin(false)
+					defer stdin.stop()
+					client.convergence(childCtx, chCLIStr, subCommandArgs[0], stdin.lines())
+				} else {
+					chCLIStr <- tCliMsg{
+						text:    "Please enter \"pingerID\"",
+						color:   cliColorDefault,
+						noBreak: false,
+					}
+					return
+				}
+			case "d", "da", "dae", "daem", "daemo", "daemon":
+				chCLIStr <- tCliMsg{
+					text:    "[daemon]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				if len(subCommandArgs) >= 1 {
+					client.daemon(childCtx, chCLIStr, subCommandArgs[0])
+				} else {
+					chCLIStr <- tCliMsg{
+						text:    "Please enter \"monitors file path\"",
+						color:   cliColorDefault,
+						noBreak: false,
+					}
+					return
+				}
+			case "a", "ap", "app", "appl", "apply":
+				chCLIStr <- tCliMsg{
+					text:    "[apply]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				client.apply(childCtx, chCLIStr, subCommandArgs)
+			case "exp", "expo", "expor", "export", "exporte", "exporter":
+				chCLIStr <- tCliMsg{
+					text:    "[exporter]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				if len(subCommandArgs) >= 1 {
+					client.exporter(childCtx, chCLIStr, subCommandArgs[0], subCommandArgs[1:])
+				} else {
+					chCLIStr <- tCliMsg{
+						text:    "Please enter \"listen address\"",
+						color:   cliColorDefault,
+						noBreak: false,
+					}
+					return
+				}
+			case "influx":
+				chCLIStr <- tCliMsg{
+					text:    "[influx]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				client.influx(childCtx, chCLIStr, subCommandArgs)
+			case "o", "ot", "otl", "otlp":
+				chCLIStr <- tCliMsg{
+					text:    "[otlp]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				client.otlp(childCtx, chCLIStr, subCommandArgs)
+			case "ch", "che", "chec", "check":
+				client.check(childCtx, chCLIStr, subCommandArgs)
+			case "as", "ass", "asse", "asser", "assert":
+				chCLIStr <- tCliMsg{
+					text:    "[assert]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				client.assert(childCtx, chCLIStr, subCommandArgs)
+			case "b", "ba", "bas", "base", "basel", "baseli", "baselin", "baseline":
+				chCLIStr <- tCliMsg{
+					text:    "[baseline]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				client.baseline(childCtx, chCLIStr, subCommandArgs)
+			case "adv", "advi", "advis", "advise":
+				chCLIStr <- tCliMsg{
+					text:    "[advise]",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+				client.advise(childCtx, chCLIStr, subCommandArgs)
 			case "h", "he", "hel", "help":
 				chCLIStr <- tCliMsg{
 					text: "" +
@@ -421,6 +597,34 @@ func subMain() {
 						"info \"{pingerID}\"   : show pinger info\n" +
 						"result \"{pingerID}\" : show ping result\n" +
 						"count \"{pingerID}\"  : show ping statistics\n" +
+						"stats \"{pingerID}\"                : show rtt statistics every 10s\n" +
+						"stats \"{pingerID}\" \"{interval}\"   : show rtt statistics every interval (e.g. 30s)\n" +
+						"table \"{pingerID}\"  : show live per-target table\n" +
+						"events \"{pingerID}\" : show target state changes (DOWN/UP)\n" +
+						"notify \"{pingerID}\" : post target state changes to webhooks\n" +
+						"ttl \"{pingerID}\"                  : show ttl exceeded per target and reporting router every 10s\n" +
+						"ttl \"{pingerID}\" \"{interval}\"     : show ttl exceeded per target and reporting router every interval\n" +
+						"convergence \"{pingerID}\" : measure loss runs per target, \"mark\" on stdin records the failover trigger\n" +
+						"\n" +
+						"daemon \"{monitors file path}\" : keep pingers running and watched\n" +
+						"apply -f \"{monitors file path}\" [--dry-run] : start, stop or replace pingers to match the file\n" +
+						"\n" +
+						"exporter \"{listen address}\" [\"{pingerID or name}\" ...] : serve prometheus metrics on /metrics\n" +
+						"influx [\"{pingerID or name}\" ...]                     : write influxdb line protocol\n" +
+						"otlp [\"{pingerID or name}\" ...]                       : push metrics to an opentelemetry collector\n" +
+						"\n" +
+						"check -targets \"{target list path}\" [-duration 30s] [-warn-loss 20] [-crit-loss 60] [-warn-rtt 100] [-crit-rtt 300]\n" +
+						"      : ping for a while and exit as a nagios/icinga plugin (0 ok, 1 warning, 2 critical, 3 unknown)\n" +
+						"assert -f \"{expectations file path}\" [-duration 30s] [-junit \"{report path}\"]\n" +
+						"      : ping for a while, check reachable/unreachable/max loss/max rtt per target and exit 1 on any failure\n" +
+						"baseline save \"{pingerID}\" -o \"{baseline file path}\" [-duration 60s]\n" +
+						"      : watch a pinger for a while and save reachability and rtt per target\n" +
+						"baseline compare \"{pingerID}\" \"{baseline file path}\" [-duration 60s] [-rtt-tolerance 50] [-rtt-tolerance-ms 5]\n" +
+						"      : watch a pinger again and report targets that became unreachable, recovered or moved in rtt\n" +
+						"advise \"{pingerID}\" [-duration 60s] [-percentile 99] [-margin 1.5] [-write \"{config path}\"]\n" +
+						"      : watch a pinger for a while and recommend TimeoutMillisec and IntervalMillisec from reply and late reply rtt\n" +
+						"\n" +
+						"demo [subcommand] : run against a built-in fake server\n" +
 						"\n" +
 						"help : (this) show help",
 					color:   cliColorDefault,
@@ -476,6 +680,19 @@ func subMain() {
 	}
 }
 
+// isPluginSubCommand 監視プラグインとして出力するサブコマンドか
+func isPluginSubCommand(args []string) bool {
+	if len(args) < 1 {
+		return false
+	}
+	switch args[0] {
+	case "ch", "che", "chec", "check":
+		return true
+	default:
+		return false
+	}
+}
+
 func getGrpcDialOptions() ([]grpc.DialOption, error) {
 	grpcDialOptions := make([]grpc.DialOption, 0)
 
@@ -514,3 +731,38 @@ func getGrpcDialOptions() ([]grpc.DialOption, error) {
 
 	return grpcDialOptions, nil
 }
+
+func readTargetFile(chOutPut chan<- tCliMsg, path string) ([]pingclient.StartTarget, bool) {
+	if _, err := os.Stat(path); err != nil {
+		logger.Log(labelinglog.FlgError, "target list file not found ["+path+"]")
+		chOutPut <- tCliMsg{
+			text:    "not found [" + path + "]",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return nil, false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, err.Error())
+		chOutPut <- tCliMsg{
+			text:    "can not open [" + path + "]",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return nil, false
+	}
+	defer file.Close()
+
+	targetList, skipped, err := pingclient.ParseTargets(file)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, err.Error())
+		return nil, false
+	}
+	for _, line := range skipped {
+		logger.Log(labelinglog.FlgInfo, fmt.Sprintf("[%s] line %3d skip, empty, comment or format error \"%s\"", path, line.LineNum, line.Text))
+	}
+
+	return targetList, true
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// tMassFailureRecord is the start or end of a mass failure of "count" in structured output
+type tMassFailureRecord struct {
+	Kind             string `json:"Kind"`
+	Event            string `json:"Event"`
+	PingerID         uint32 `json:"PingerID"`
+	TimeUnixNanosec  int64  `json:"TimeUnixNanosec"`
+	SinceUnixNanosec int64  `json:"SinceUnixNanosec"`
+	Failing          int    `json:"Failing"`
+	TargetCount      int    `json:"TargetCount"`
+}
+
+// tStatisticsMass count の統計で多くの対象が同時に失敗し始めたか
+// 同じ時間帯に成功から失敗に変わった対象が閾値以上で始まり、その後に失敗した対象が閾値の半分を下回ると終わる
+// pinger の開始直後のように一度も成功していない対象は数えない
+// 障害の前から失敗していた対象は障害に含めない
+type tStatisticsMass struct {
+	options       pingclient.MassFailureOptions
+	rateThreshold int64
+	window        time.Duration
+
+	//対象ごとの成功から失敗に変わった時刻、失敗中のみ
+	failedAt  map[uint32]time.Time
+	succeeded map[uint32]bool
+
+	active  bool
+	since   time.Time
+	failing int
+	//failing のうち障害中に失敗し始めた対象の数
+	affected int
+	total    int
+}
+
+func (config Config) newStatisticsMass(info pingclient.PingerInfo) *tStatisticsMass {
+	options := config.massFailureOptions()
+	window := options.Window
+	if window <= 0 {
+		window = 2 * time.Duration(info.IntervalMillisec) * time.Millisecond
+	}
+	if statisticsWindow := 2 * time.Duration(info.StatisticsIntervalSec) * time.Second; window < statisticsWindow {
+		window = statisticsWindow
+	}
+
+	return &tStatisticsMass{
+		options:       options,
+		rateThreshold: config.CountRateThreshold,
+		window:        window,
+		failedAt:      make(map[uint32]time.Time),
+		succeeded:     make(map[uint32]bool),
+	}
+}
+
+// update 統計から失敗している対象を数え、障害の始まりか終わりなら true を返す
+func (thisMass *tStatisticsMass) update(statistics pingclient.Statistics) bool {
+	thisMass.failing, thisMass.affected, thisMass.total = 0, 0, 0
+	recent := 0
+	var recentSince time.Time
+	for _, c := range statistics.Targets {
+		if c.Target.ExpectUnreachable {
+			continue
+		}
+		id := c.Target.TargetID
+		thisMass.total++
+		if countSuccess(c, thisMass.rateThreshold) {
+			thisMass.succeeded[id] = true
+			delete(thisMass.failedAt, id)
+			continue
+		}
+		if !thisMass.succeeded[id] {
+			continue
+		}
+		thisMass.failing++
+		failedAt, ok := thisMass.failedAt[id]
+		if !ok {
+			failedAt = statistics.Time
+			thisMass.failedAt[id] = failedAt
+		}
+		if statistics.Time.Sub(failedAt) <= thisMass.window {
+			recent++
+			if recentSince.IsZero() || failedAt.Before(recentSince) {
+				recentSince = failedAt
+			}
+		}
+		if thisMass.active && !failedAt.Before(thisMass.since) {
+			thisMass.affected++
+		}
+	}
+
+	threshold := thisMass.options.Threshold(thisMass.total)
+	switch {
+	case threshold == 0:
+		return false
+	case !thisMass.active && recent >= threshold:
+		thisMass.active = true
+		thisMass.since = recentSince
+		thisMass.affected = recent
+		return true
+	case thisMass.active && thisMass.affected*2 < threshold:
+		thisMass.active = false
+		return true
+	default:
+		return false
+	}
+}
+
+// hides 障害中に失敗し始めた対象か、障害の前から失敗している対象は隠さない
+func (thisMass *tStatisticsMass) hides(c pingclient.SuccessCount) bool {
+	if !thisMass.active || c.Target.ExpectUnreachable {
+		return false
+	}
+	failedAt, ok := thisMass.failedAt[c.Target.TargetID]
+	return ok && !failedAt.Before(thisMass.since)
+}
+
+func (thisMass *tStatisticsMass) record(statistics pingclient.Statistics) tMassFailureRecord {
+	event := pingclient.EventMassUp
+	if thisMass.active {
+		event = pingclient.EventMassDown
+	}
+	return tMassFailureRecord{
+		Kind:             "mass-failure",
+		Event:            event.String(),
+		PingerID:         statistics.PingerID,
+		TimeUnixNanosec:  statistics.Time.UnixNano(),
+		SinceUnixNanosec: thisMass.since.UnixNano(),
+		Failing:          thisMass.failing,
+		TargetCount:      thisMass.total,
+	}
+}
+
+// log 障害の始まりと終わりを標準エラー出力のログにも残す
+func (thisMass *tStatisticsMass) log(statistics pingclient.Statistics) {
+	id := fmt.Sprintf("id %d", statistics.PingerID)
+	if thisMass.active {
+		logger.Log(labelinglog.FlgWarn, fmt.Sprintf("%s mass failure, %d/%d targets failing, likely vantage point or server side outage", id, thisMass.affected, thisMass.total))
+	} else {
+		logger.Log(labelinglog.FlgNotice, fmt.Sprintf("%s mass failure end after %.3fs", id, statistics.Time.Sub(thisMass.since).Seconds()))
+	}
+}
+
+// msg 障害中は毎回、終わった時は1回だけ出す見出し
+func (thisMass *tStatisticsMass) msg(statistics pingclient.Statistics) tCliMsg {
+	timeStr := statistics.Time.Format("2006/01/02 15:04:05.000")
+	if thisMass.active {
+		return tCliMsg{
+			text: fmt.Sprintf("S MASS - %s - %d/%d targets failing since %s, likely vantage point or server side outage, targets failing since then hidden",
+				timeStr,
+				thisMass.affected,
+				thisMass.total,
+				thisMass.since.Format("2006/01/02 15:04:05.000"),
+			),
+			color:   cliColorRed,
+			noBreak: false,
+			data:    true,
+		}
+	}
+	return tCliMsg{
+		text: fmt.Sprintf("S MASS - %s - end after %.3fs, %d/%d targets failing",
+			timeStr,
+			statistics.Time.Sub(thisMass.since).Seconds(),
+			thisMass.failing,
+			thisMass.total,
+		),
+		color:   cliColorGreen,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+func massEventMsg(e pingclient.Event) tCliMsg {
+	if e.Type == pingclient.EventMassDown {
+		return tCliMsg{
+			text: fmt.Sprintf("E MASS-DOWN - %s - %d/%d targets down since %s, likely vantage point or server side outage, per-target events suppressed",
+				e.Time.Format("2006/01/02 15:04:05.000"),
+				e.Affected,
+				e.TargetCount,
+				e.Since.Format("2006/01/02 15:04:05.000"),
+			),
+			color:   cliColorRed,
+			noBreak: false,
+			data:    true,
+		}
+	}
+
+	return tCliMsg{
+		text: fmt.Sprintf("E MASS-UP   - %s - outage %.3fs, %d/%d targets affected",
+			e.Time.Format("2006/01/02 15:04:05.000"),
+			e.OutageDuration.Seconds(),
+			e.Affected,
+			e.TargetCount,
+		),
+		color:   cliColorGreen,
+		noBreak: false,
+		data:    true,
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+func TestStatisticsMass(t *testing.T) {
+	type step struct {
+		//開始からの秒数
+		at int
+		//対象ごとの成功率、"O" は 100 で "X" は 0
+		rates string
+
+		wantMass bool
+		//X の行が表示される対象の番号
+		wantX []int
+	}
+
+	tests := []struct {
+		name string
+		//"!" の対象は ExpectUnreachable
+		targets string
+		steps   []step
+	}{
+		{
+			name:    "failing together hides them until the end",
+			targets: ".....",
+			steps: []step{
+				{at: 0, rates: "OOOOO"},
+				{at: 1, rates: "XXOOO", wantX: []int{0, 1}},
+				{at: 2, rates: "XXXOO", wantMass: true},
+				{at: 3, rates: "XXXXO", wantMass: true},
+				{at: 4, rates: "OOOXO", wantX: []int{3}},
+				{at: 5, rates: "OOOXO", wantX: []int{3}},
+			},
+		},
+		{
+			name:    "failures before the incident stay visible",
+			targets: ".....",
+			steps: []step{
+				{at: 0, rates: "OOOOO"},
+				{at: 1, rates: "OOOOX", wantX: []int{4}},
+				{at: 5, rates: "XXXOX", wantMass: true, wantX: []int{4}},
+				{at: 6, rates: "XXXXX", wantMass: true, wantX: []int{4}},
+				{at: 7, rates: "XXOOX", wantMass: true, wantX: []int{4}},
+				{at: 8, rates: "OOOOX", wantX: []int{4}},
+				{at: 9, rates: "OOOOX", wantX: []int{4}},
+			},
+		},
+		{
+			name:    "failures spread in time",
+			targets: ".....",
+			steps: []step{
+				{at: 0, rates: "OOOOO"},
+				{at: 1, rates: "XOOOO", wantX: []int{0}},
+				{at: 4, rates: "XXOOO", wantX: []int{0, 1}},
+				{at: 7, rates: "XXXOO", wantX: []int{0, 1, 2}},
+			},
+		},
+		{
+			name:    "never succeeded is not counted",
+			targets: ".....",
+			steps: []step{
+				{at: 0, rates: "XXXXX", wantX: []int{0, 1, 2, 3, 4}},
+				{at: 1, rates: "XXXXX", wantX: []int{0, 1, 2, 3, 4}},
+			},
+		},
+		{
+			name:    "expect unreachable is neither counted nor hidden",
+			targets: "....!",
+			steps: []step{
+				{at: 0, rates: "OOOOX"},
+				{at: 1, rates: "XXXOO", wantMass: true, wantX: []int{4}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := make([]pingclient.Target, 0, len(tt.targets))
+			for i, c := range tt.targets {
+				ip := fmt.Sprintf("192.0.2.%d", i+1)
+				targets = append(targets, pingclient.Target{TargetID: uint32(i + 1), TargetIP: ip, TargetBinIP: ip, ExpectUnreachable: c == '!'})
+			}
+			info := pingclient.PingerInfo{PingerID: 1, Targets: targets, IntervalMillisec: 1000, StatisticsIntervalSec: 1, StatisticsCountsNum: 10}
+			client := &tClientWrap{config: DefaultConfig()}
+			mass := client.config.newStatisticsMass(info)
+			start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+			for _, st := range tt.steps {
+				statistics := pingclient.Statistics{PingerID: 1, Time: start.Add(time.Duration(st.at) * time.Second), CountsNum: 10}
+				for i, c := range st.rates {
+					rate := int64(100)
+					if c == 'X' {
+						rate = 0
+					}
+					statistics.Targets = append(statistics.Targets, pingclient.SuccessCount{Target: targets[i], Count: rate / 10, Rate: rate})
+				}
+
+				gotMass := false
+				gotX := make([]int, 0)
+				for _, msg := range client.statisticsMsgs(statistics, mass) {
+					switch {
+					case strings.HasPrefix(msg.text, "S MASS") && !strings.Contains(msg.text, " end after "):
+						gotMass = true
+					case strings.HasPrefix(msg.text, "S X"):
+						for i, target := range targets {
+							if strings.Contains(msg.text, " "+target.TargetBinIP+" ") {
+								gotX = append(gotX, i)
+							}
+						}
+					}
+				}
+				wantX := st.wantX
+				if wantX == nil {
+					wantX = []int{}
+				}
+				if gotMass != st.wantMass || !reflect.DeepEqual(gotX, wantX) {
+					t.Errorf("at %ds mass %v X %v, want mass %v X %v", st.at, gotMass, gotX, st.wantMass, wantX)
+				}
+			}
+		})
+	}
+}
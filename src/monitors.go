@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// tMonitorsConfig daemon, apply の監視設定ファイルの中身(JSON or YAML)
+type tMonitorsConfig struct {
+	//pingerの期限(ExpireUnixNanosec)の何秒前に作り直すか(daemon)
+	RecreateBeforeSec uint64 `json:"RecreateBeforeSec"`
+
+	//サーバーに繋がらない時などに再試行するまでの時間(秒)(daemon)
+	RetryIntervalSec uint64 `json:"RetryIntervalSec"`
+
+	Monitors []tMonitorConfig `json:"Monitors"`
+}
+
+// tMonitorConfig 1つのpingerの設定
+type tMonitorConfig struct {
+	//ログなどに表示する名前、apply ではpingerを見分けるのに使う
+	Name string `json:"Name"`
+
+	//対象リストのパス、相対パスは設定ファイルからの位置
+	TargetListPath string `json:"TargetListPath"`
+
+	//対象リストと同じ形式の行、TargetListPath と両方あれば両方使う
+	Targets []string `json:"Targets"`
+
+	//pingerのDescription、空白文字列なら Name
+	Description string `json:"Description"`
+
+	//このpingerだけ上書きするコンフィグの項目
+	Config json.RawMessage `json:"Config"`
+}
+
+func defaultMonitorsConfig() tMonitorsConfig {
+	return tMonitorsConfig{
+		RecreateBeforeSec: 600,
+		RetryIntervalSec:  10,
+		Monitors:          []tMonitorConfig{},
+	}
+}
+
+// tMonitorSpec 設定ファイルから組み立てた1つのpingerの内容
+type tMonitorSpec struct {
+	name        string
+	description string
+	config      Config
+	targetList  []pingclient.StartTarget
+}
+
+func (thisClient *tClientWrap) loadMonitors(chOutPut chan<- tCliMsg, path string) (tMonitorsConfig, []tMonitorSpec, bool) {
+	monitorsConfig := defaultMonitorsConfig()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, err.Error())
+		chOutPut <- tCliMsg{
+			text:    "can not open [" + path + "]",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return monitorsConfig, nil, false
+	}
+	if err := yamlUnmarshal(data, &monitorsConfig); err != nil {
+		logger.Log(labelinglog.FlgError, "["+path+"] "+err.Error())
+		return monitorsConfig, nil, false
+	}
+
+	specs := make([]tMonitorSpec, 0, len(monitorsConfig.Monitors))
+	names := make(map[string]bool, len(monitorsConfig.Monitors))
+	for i, m := range monitorsConfig.Monitors {
+		spec := tMonitorSpec{
+			name:        m.Name,
+			description: m.Description,
+			targetList:  make([]pingclient.StartTarget, 0),
+		}
+		if spec.name == "" {
+			spec.name = fmt.Sprintf("monitor%d", i+1)
+		}
+		if strings.ContainsAny(spec.name, " \t]") {
+			logger.Log(labelinglog.FlgError, "["+path+"] invalid Name \""+spec.name+"\"")
+			return monitorsConfig, nil, false
+		}
+		if names[spec.name] {
+			logger.Log(labelinglog.FlgError, "["+path+"] duplicate Name \""+spec.name+"\"")
+			return monitorsConfig, nil, false
+		}
+		names[spec.name] = true
+		if spec.description == "" {
+			spec.description = spec.name
+		}
+
+		spec.config, err = configOverride(thisClient.config, m.Config)
+		if err != nil {
+			logger.Log(labelinglog.FlgError, "["+spec.name+"] config "+err.Error())
+			return monitorsConfig, nil, false
+		}
+
+		if m.TargetListPath != "" {
+			targetPath := m.TargetListPath
+			if !filepath.IsAbs(targetPath) {
+				targetPath = filepath.Join(filepath.Dir(path), targetPath)
+			}
+			targetList, ok := readTargetFile(chOutPut, targetPath)
+			if !ok {
+				return monitorsConfig, nil, false
+			}
+			spec.targetList = append(spec.targetList, targetList...)
+		}
+		for _, line := range m.Targets {
+			if target, ok := pingclient.ParseTargetLine(line); ok {
+				spec.targetList = append(spec.targetList, target)
+			} else {
+				logger.Log(labelinglog.FlgInfo, fmt.Sprintf("[%s] skip, empty, comment or format error \"%s\"", spec.name, line))
+			}
+		}
+		if len(spec.targetList) == 0 {
+			logger.Log(labelinglog.FlgError, "["+spec.name+"] no targets")
+			return monitorsConfig, nil, false
+		}
+
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		chOutPut <- tCliMsg{
+			text:    "no \"Monitors\" in [" + path + "]",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return monitorsConfig, nil, false
+	}
+
+	return monitorsConfig, specs, true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/notify"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// notify 状態変化を表示しつつWebhookへ通知する
+func (thisClient *tClientWrap) notify(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string) {
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
+		return
+	}
+
+	if len(thisClient.config.Webhooks) == 0 {
+		chOutPut <- tCliMsg{
+			text:    "no \"Webhooks\" in config",
+			color:   cliColorDefault,
+			noBreak: false,
+		}
+		return
+	}
+	notifier, err := notify.New(thisClient.config.notifyOptions())
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	watch, err := thisClient.watchResults(childCtx, chOutPut, id)
+	if err != nil {
+		if status.Code(err) == codes.Canceled {
+			return
+		}
+		if streamErr(err) {
+			exitCode = exitCodePingerNotFound
+		}
+		return
+	}
+	thisClient.printInfo(chOutPut, watch.Info)
+
+	syslogSender, err := thisClient.newSyslogSender()
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "syslog "+err.Error())
+		return
+	}
+	defer syslogSender.close()
+
+	chEvent, chNotifyDone := thisClient.notifyWorker(childCtx, chOutPut, notifier)
+
+	printEvent := func(e pingclient.Event) {
+		if thisClient.output.isStructured() {
+			chOutPut <- recordMsg(thisClient.output, newEventRecord(e))
+		} else {
+			chOutPut <- eventMsg(e)
+		}
+		syslogSender.event(e)
+		chEvent <- e
+	}
+
+	detector := thisClient.config.newEventDetector(watch.Info)
+	for result := range watch.C {
+		for _, e := range detector.Add(result) {
+			printEvent(e)
+		}
+	}
+	for _, e := range detector.Flush() {
+		printEvent(e)
+	}
+	close(chEvent)
+	if streamErr(watch.Err()) {
+		exitCode = exitCodePingerNotFound
+	}
+
+	<-chNotifyDone
+}
+
+// notifyWorker 通知の再送で結果の受信が止まらないよう別のgoroutineで通知する
+// 返したchannelをcloseすると残りを通知して終わる
+func (thisClient *tClientWrap) notifyWorker(ctx context.Context, chOutPut chan<- tCliMsg, notifier *notify.Notifier) (chan<- pingclient.Event, <-chan struct{}) {
+	chEvent := make(chan pingclient.Event, 100)
+	chNotifyDone := make(chan struct{})
+	go (func() {
+		defer close(chNotifyDone)
+		for e := range chEvent {
+			name := e.Target.TargetBinIP
+			if e.Type.IsMass() {
+				name = "pinger " + strconv.FormatUint(uint64(e.PingerID), 10)
+			}
+			sent, err := notifier.Notify(ctx, e)
+			if err != nil {
+				logger.Log(labelinglog.FlgError, "webhook "+e.Type.String()+" "+name+" : \""+err.Error()+"\"")
+			} else if sent {
+				chOutPut <- tCliMsg{
+					text:    "webhook " + e.Type.String() + " " + name + " : notified",
+					color:   cliColorDefault,
+					noBreak: false,
+				}
+			} else {
+				logger.Log(labelinglog.FlgInfo, "webhook "+e.Type.String()+" "+name+" : cooldown")
+			}
+		}
+	})()
+
+	return chEvent, chNotifyDone
+}
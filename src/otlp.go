@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/metrics"
+	"github.com/umenosuke/ping-grpc-client/pkg/otlp"
+)
+
+// otlp 一致するpingerのメトリクスを OpenTelemetry Collector へ送り続ける
+func (thisClient *tClientWrap) otlp(ctx context.Context, chOutPut chan<- tCliMsg, selectorArgs []string) {
+	exporter, err := otlp.New(thisClient.config.otlpOptions())
+	if err != nil {
+		logger.Log(labelinglog.FlgError, err.Error())
+		return
+	}
+	defer exporter.Close()
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	collector := metrics.NewCollector(nil)
+	resource := []otlp.Attribute{
+		{Key: "service.name", Value: "ping-grpc-client"},
+		{Key: "ping.server.address", Value: argServerAddress},
+	}
+
+	interval := time.Duration(thisClient.config.OtlpIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	chExportDone := make(chan struct{})
+	go (func() {
+		defer close(chExportDone)
+
+		export := func(exportCtx context.Context) {
+			snapshot := collector.Snapshot()
+			if len(snapshot) == 0 {
+				return
+			}
+			request := otlp.EncodeMetrics(resource, snapshot, collector.Buckets(), time.Now())
+			if err := exporter.Export(exportCtx, request); err != nil {
+				// 累積値なので次の送信で取り戻せる
+				logger.Log(labelinglog.FlgWarn, "otlp: "+err.Error())
+			}
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-childCtx.Done():
+				// 最後の値を送っておく
+				finalCtx, finalCtxCancel := context.WithTimeout(context.Background(), thisClient.config.otlpOptions().Timeout+time.Second)
+				defer finalCtxCancel()
+				export(finalCtx)
+				return
+			case <-ticker.C:
+				export(childCtx)
+			}
+		}
+	})()
+
+	thisClient.followPingers(childCtx, chOutPut, parsePingerSelectors(selectorArgs), tCollectorSink{collector: collector})
+	childCtxCancel()
+	<-chExportDone
+}
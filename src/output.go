@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+type tOutputFormat string
+
+const (
+	outputText  = tOutputFormat("text")
+	outputJSON  = tOutputFormat("json")
+	outputJSONL = tOutputFormat("jsonl")
+	outputYAML  = tOutputFormat("yaml")
+	outputTable = tOutputFormat("table")
+)
+
+func parseOutputFormat(str string) (tOutputFormat, error) {
+	switch tOutputFormat(str) {
+	case outputText, outputJSON, outputJSONL, outputYAML, outputTable:
+		return tOutputFormat(str), nil
+	default:
+		return outputText, fmt.Errorf("unknown output format \"%s\"", str)
+	}
+}
+
+// isMachine 標準出力にはデータのみを出力するか
+func (f tOutputFormat) isMachine() bool {
+	return f != outputText
+}
+
+// isStructured 構造化データ(json/jsonl/yaml)で出力するか
+func (f tOutputFormat) isStructured() bool {
+	return f == outputJSON || f == outputJSONL || f == outputYAML
+}
+
+// tResultRecord is a line of "result -output jsonl"
+type tResultRecord struct {
+	Kind                   string  `json:"Kind"`
+	PingerID               uint32  `json:"PingerID"`
+	TargetID               uint32  `json:"TargetID"`
+	TargetIP               string  `json:"TargetIP"`
+	FQDN                   string  `json:"FQDN"`
+	Comment                string  `json:"Comment"`
+	ExpectUnreachable      bool    `json:"ExpectUnreachable"`
+	Type                   string  `json:"Type"`
+	Sequence               int64   `json:"Sequence"`
+	PeerIP                 string  `json:"PeerIP,omitempty"`
+	SendTimeUnixNanosec    int64   `json:"SendTimeUnixNanosec"`
+	ReceiveTimeUnixNanosec int64   `json:"ReceiveTimeUnixNanosec"`
+	RTTMillisec            float64 `json:"RTTMillisec"`
+}
+
+func newResultRecord(result pingclient.Result) tResultRecord {
+	record := tResultRecord{
+		Kind:                   "result",
+		PingerID:               result.PingerID,
+		TargetID:               result.Target.TargetID,
+		TargetIP:               result.Target.TargetBinIP,
+		FQDN:                   result.Target.FQDN(),
+		Comment:                result.Target.Comment,
+		ExpectUnreachable:      result.Target.ExpectUnreachable,
+		Type:                   result.Type.String(),
+		Sequence:               result.Sequence,
+		SendTimeUnixNanosec:    result.SendTimeUnixNanosec,
+		ReceiveTimeUnixNanosec: result.ReceiveTimeUnixNanosec,
+	}
+	if result.IsReply() {
+		record.RTTMillisec = float64(result.RTT()) / 1000 / 1000
+	}
+	if result.Type == pingclient.ResultTypeTTLExceeded {
+		record.PeerIP = result.PeerIP
+	}
+
+	return record
+}
+
+// tStatisticsRecord is a line of "count -output jsonl", one per target
+type tStatisticsRecord struct {
+	Kind              string `json:"Kind"`
+	PingerID          uint32 `json:"PingerID"`
+	TargetID          uint32 `json:"TargetID"`
+	TargetIP          string `json:"TargetIP"`
+	FQDN              string `json:"FQDN"`
+	Comment           string `json:"Comment"`
+	ExpectUnreachable bool   `json:"ExpectUnreachable"`
+	TimeUnixNanosec   int64  `json:"TimeUnixNanosec"`
+	Count             int64  `json:"Count"`
+	CountsNum         uint64 `json:"CountsNum"`
+	Rate              int64  `json:"Rate"`
+	//RateがCountRateThreshold以上か、ExpectUnreachable の対象はRateが0か
+	Success bool `json:"Success"`
+}
+
+// countSuccess 応答が無いことを期待する対象は1つでも応答があれば失敗
+func countSuccess(c pingclient.SuccessCount, threshold int64) bool {
+	if c.Target.ExpectUnreachable {
+		return c.Rate == 0
+	}
+	return c.Rate >= threshold
+}
+
+func newStatisticsRecords(statistics pingclient.Statistics, threshold int64) []tStatisticsRecord {
+	records := make([]tStatisticsRecord, 0, len(statistics.Targets))
+	for _, c := range statistics.Targets {
+		records = append(records, tStatisticsRecord{
+			Kind:              "statistics",
+			PingerID:          statistics.PingerID,
+			TargetID:          c.Target.TargetID,
+			TargetIP:          c.Target.TargetBinIP,
+			FQDN:              c.Target.FQDN(),
+			Comment:           c.Target.Comment,
+			ExpectUnreachable: c.Target.ExpectUnreachable,
+			TimeUnixNanosec:   statistics.Time.UnixNano(),
+			Count:             c.Count,
+			CountsNum:         statistics.CountsNum,
+			Rate:              c.Rate,
+			Success:           countSuccess(c, threshold),
+		})
+	}
+
+	return records
+}
+
+// recordMsg result/countの1レコード分の出力
+// ストリームなので json は jsonl と同じ、yaml は1レコード1ドキュメント
+func recordMsg(output tOutputFormat, v interface{}) tCliMsg {
+	if output == outputYAML {
+		str, err := yamlMarshal(v)
+		if err != nil {
+			logger.Log(labelinglog.FlgError, "yaml "+err.Error())
+		}
+
+		return tCliMsg{
+			text:    "---\n" + str,
+			color:   cliColorDefault,
+			noBreak: true,
+			data:    true,
+		}
+	}
+
+	return jsonlMsg(v)
+}
+
+// dataMsg list/info/startの出力
+func dataMsg(output tOutputFormat, v interface{}, table func(w io.Writer)) tCliMsg {
+	str := ""
+
+	switch output {
+	case outputJSON:
+		jsonBlob, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			logger.Log(labelinglog.FlgError, "json "+err.Error())
+		}
+		str = string(jsonBlob) + "\n"
+	case outputYAML:
+		yamlStr, err := yamlMarshal(v)
+		if err != nil {
+			logger.Log(labelinglog.FlgError, "yaml "+err.Error())
+		}
+		str = yamlStr
+	case outputTable:
+		b := &strings.Builder{}
+		w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+		table(w)
+		w.Flush()
+		str = b.String()
+	default:
+		return jsonlMsg(v)
+	}
+
+	return tCliMsg{
+		text:    str,
+		color:   cliColorDefault,
+		noBreak: true,
+		data:    true,
+	}
+}
+
+func jsonlMsg(v interface{}) tCliMsg {
+	jsonBlob, err := json.Marshal(v)
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "json "+err.Error())
+	}
+
+	return tCliMsg{
+		text:    string(jsonBlob),
+		color:   cliColorDefault,
+		noBreak: false,
+		data:    true,
+	}
+}
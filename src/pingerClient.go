@@ -1,15 +1,11 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"os"
-	"regexp"
-	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -17,81 +13,85 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/umenosuke/labelinglog"
-	pb "github.com/umenosuke/ping-grpc-client/proto/pingGrpc"
-	"github.com/umenosuke/pinger4"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
 )
 
 type tClientWrap struct {
-	client        pb.PingerClient
+	client        *pingclient.Client
 	chCancel      <-chan struct{}
 	wgFinish      *sync.WaitGroup
 	config        Config
 	isInteractive bool
+	output        tOutputFormat
 }
 
-func (thisClient *tClientWrap) start(ctx context.Context, chOutPut chan<- tCliMsg, descStr string, targetList []*pb.StartRequest_IcmpTarget) {
-	req := &pb.StartRequest{
-		Description:           descStr,
-		Targets:               targetList,
-		StopPingerSec:         thisClient.config.StopPingerSec,
-		IntervalMillisec:      thisClient.config.IntervalMillisec,
-		TimeoutMillisec:       thisClient.config.TimeoutMillisec,
-		StatisticsCountsNum:   thisClient.config.StatisticsCountsNum,
-		StatisticsIntervalSec: thisClient.config.StatisticsIntervalSec,
+func (thisClient *tClientWrap) start(ctx context.Context, chOutPut chan<- tCliMsg, descStr string, targetList []pingclient.StartTarget) {
+	pingerID, err := thisClient.client.Start(ctx, thisClient.config.startOptions(descStr, targetList))
+	if err != nil {
+		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
 	}
-
-	res, err := thisClient.client.Start(ctx, req)
-	if res != nil {
+	if !thisClient.output.isMachine() {
 		chOutPut <- tCliMsg{
-			text:    "start ID: " + strconv.FormatUint(uint64(res.GetPingerID()), 10),
+			text:    "start ID: " + strconv.FormatUint(uint64(pingerID), 10),
 			color:   cliColorDefault,
 			noBreak: false,
 		}
 	}
-	if err != nil {
-		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
-	}
 
-	info, err := thisClient.client.GetPingerInfo(ctx, &pb.PingerID{PingerID: res.GetPingerID()})
-	if info != nil {
-		thisClient.printInfo(chOutPut, info)
-	}
+	info, err := thisClient.client.Info(ctx, pingerID)
 	if err != nil {
 		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		if thisClient.output.isMachine() {
+			thisClient.printInfoData(chOutPut, pingclient.PingerInfo{PingerID: pingerID})
+		}
+	} else if thisClient.output.isMachine() {
+		thisClient.printInfoData(chOutPut, info)
+	} else {
+		thisClient.printInfo(chOutPut, info)
 	}
 
 	if thisClient.config.CountLogOutputPath != "" {
-		thisClient.logOutput(ctx, chOutPut, res.GetPingerID())
+		thisClient.logOutput(ctx, chOutPut, pingerID)
 	}
 }
 
 func (thisClient *tClientWrap) logOutput(ctx context.Context, chOutPut chan<- tCliMsg, pingerID uint32) {
 	strPingerID := strconv.FormatUint(uint64(pingerID), 10)
 
-	childCtx, childCtxCancel := context.WithCancel(ctx)
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, thisClient.isInteractive)
+
+	logPathPrefix := thisClient.config.CountLogOutputPath + "/" + time.Now().Format("20060102_150405") + "_id" + strPingerID
+
+	chLogOutput := make(chan tCliMsg, 200)
+	thisClient.logFile(childCtx, childCtxCancel, chOutPut, strPingerID, logPathPrefix+".log", chLogOutput)
+
+	thisClient.wgFinish.Add(1)
 	go (func() {
+		defer thisClient.wgFinish.Done()
 		defer childCtxCancel()
-		if thisClient.isInteractive {
-			select {
-			case <-ctx.Done():
-			case <-childCtx.Done():
-			}
-		} else {
-			select {
-			case <-ctx.Done():
-			case <-childCtx.Done():
-			case <-thisClient.chCancel:
-			}
-		}
+		thisClient.result(childCtx, chLogOutput, true, outputText, strPingerID)
 	})()
 
-	logPath := thisClient.config.CountLogOutputPath + "/" + time.Now().Format("20060102_150405") + "_id" + strPingerID + ".log"
+	if thisClient.config.EventLogOutput {
+		chEventLogOutput := make(chan tCliMsg, 200)
+		thisClient.logFile(childCtx, childCtxCancel, chOutPut, strPingerID, logPathPrefix+"_events.log", chEventLogOutput)
 
-	chLogOutput := make(chan tCliMsg, 200)
+		thisClient.wgFinish.Add(1)
+		go (func() {
+			defer thisClient.wgFinish.Done()
+			defer childCtxCancel()
+			thisClient.events(childCtx, chEventLogOutput, true, outputText, strPingerID)
+		})()
+	}
+}
+
+// logFile chLogOutputの内容をctxが終わるまでlogPathに書き続ける
+func (thisClient *tClientWrap) logFile(ctx context.Context, cancel context.CancelFunc, chOutPut chan<- tCliMsg, strPingerID string, logPath string, chLogOutput <-chan tCliMsg) {
 	thisClient.wgFinish.Add(1)
 	go (func() {
 		defer thisClient.wgFinish.Done()
-		defer childCtxCancel()
+		defer cancel()
 		if thisClient.config.CountLogOutputPath != "" {
 			file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 			if err != nil {
@@ -124,7 +124,7 @@ func (thisClient *tClientWrap) logOutput(ctx context.Context, chOutPut chan<- tC
 					continue
 				}
 				select {
-				case <-childCtx.Done():
+				case <-ctx.Done():
 					return
 				default:
 				}
@@ -132,13 +132,6 @@ func (thisClient *tClientWrap) logOutput(ctx context.Context, chOutPut chan<- tC
 		}
 	})()
 
-	thisClient.wgFinish.Add(1)
-	go (func() {
-		defer thisClient.wgFinish.Done()
-		defer childCtxCancel()
-		thisClient.result(childCtx, chLogOutput, true, strPingerID)
-	})()
-
 	logger.Log(labelinglog.FlgNotice, "id "+strPingerID+" llogging start : "+logPath)
 	chOutPut <- tCliMsg{
 		text:    "id " + strPingerID + " llogging start : " + logPath,
@@ -147,8 +140,8 @@ func (thisClient *tClientWrap) logOutput(ctx context.Context, chOutPut chan<- tC
 	}
 }
 
-func (thisClient *tClientWrap) stop(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string) {
-	id, err := strconv.Atoi(pingerID)
+func (thisClient *tClientWrap) parsePingerID(chOutPut chan<- tCliMsg, pingerID string) (uint32, bool) {
+	id, err := strconv.ParseUint(pingerID, 10, 32)
 	if err != nil {
 		logger.Log(labelinglog.FlgError, "parse error : \""+pingerID+"\"")
 		chOutPut <- tCliMsg{
@@ -156,295 +149,296 @@ func (thisClient *tClientWrap) stop(ctx context.Context, chOutPut chan<- tCliMsg
 			color:   cliColorDefault,
 			noBreak: false,
 		}
+		return 0, false
+	}
+
+	return uint32(id), true
+}
+
+// foregroundCtx is canceled by ctx or chCancel(SIGINT)
+func (thisClient *tClientWrap) foregroundCtx(ctx context.Context, execBackground bool) (context.Context, context.CancelFunc) {
+	childCtx, childCtxCancel := context.WithCancel(ctx)
+	go (func() {
+		defer childCtxCancel()
+		if execBackground {
+			select {
+			case <-ctx.Done():
+			case <-childCtx.Done():
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+			case <-childCtx.Done():
+			case <-thisClient.chCancel:
+			}
+		}
+	})()
+
+	return childCtx, childCtxCancel
+}
+
+func (thisClient *tClientWrap) stop(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string) {
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
 		return
 	}
 
-	_, err = thisClient.client.Stop(ctx, &pb.PingerID{PingerID: uint32(id)})
+	err := thisClient.client.Stop(ctx, id)
 	if err != nil {
 		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
 	}
 }
 
 func (thisClient *tClientWrap) info(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string) {
-	id, err := strconv.Atoi(pingerID)
-	if err != nil {
-		logger.Log(labelinglog.FlgError, "parse error : \""+pingerID+"\"")
-		chOutPut <- tCliMsg{
-			text:    "\"pingerID\" is please enter a number",
-			color:   cliColorDefault,
-			noBreak: false,
-		}
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
 		return
 	}
 
-	info, err := thisClient.client.GetPingerInfo(ctx, &pb.PingerID{PingerID: uint32(id)})
-	if info != nil {
-		thisClient.printInfo(chOutPut, info)
-	}
+	info, err := thisClient.client.Info(ctx, id)
 	if err != nil {
 		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
+	}
+	if thisClient.output.isMachine() {
+		thisClient.printInfoData(chOutPut, info)
+	} else {
+		thisClient.printInfo(chOutPut, info)
 	}
 }
 
-func (thisClient *tClientWrap) result(ctx context.Context, chOutPut chan<- tCliMsg, execBackground bool, pingerID string) {
-	id, err := strconv.Atoi(pingerID)
-	if err != nil {
-		logger.Log(labelinglog.FlgError, "parse error : \""+pingerID+"\"")
-		chOutPut <- tCliMsg{
-			text:    "\"pingerID\" is please enter a number",
-			color:   cliColorDefault,
-			noBreak: false,
-		}
+func (thisClient *tClientWrap) result(ctx context.Context, chOutPut chan<- tCliMsg, execBackground bool, output tOutputFormat, pingerID string) {
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
 		return
 	}
 
-	info, err := thisClient.client.GetPingerInfo(ctx, &pb.PingerID{PingerID: uint32(id)})
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, execBackground)
+	defer childCtxCancel()
+
+	watch, err := thisClient.watchResults(childCtx, chOutPut, id)
 	if err != nil {
 		if status.Code(err) == codes.Canceled {
 			return
 		}
-		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
-		return
-	}
-	thisClient.printInfo(chOutPut, info)
-
-	targets := make(map[uint32]struct {
-		IPAddress string
-		Comment   string
-	})
-	for _, t := range info.GetTargets() {
-		comment := t.GetComment()
-		if t.GetTargetIP() != t.GetTargetBinIP() {
-			comment += " (FQDN: " + t.GetTargetIP() + ")"
-		}
-
-		targets[t.GetTargetID()] = struct {
-			IPAddress string
-			Comment   string
-		}{
-			IPAddress: t.GetTargetBinIP(),
-			Comment:   comment,
+		if streamErr(err) && !execBackground {
+			exitCode = exitCodePingerNotFound
 		}
+		return
 	}
+	thisClient.printInfo(chOutPut, watch.Info)
 
-	childCtx, childCtxCancel := context.WithCancel(ctx)
-	defer childCtxCancel()
-	go (func() {
-		defer childCtxCancel()
-		if execBackground {
-			select {
-			case <-ctx.Done():
-			case <-childCtx.Done():
-			}
-		} else {
-			select {
-			case <-ctx.Done():
-			case <-childCtx.Done():
-			case <-thisClient.chCancel:
-			}
-		}
-	})()
-
-	stream, err := thisClient.client.GetsIcmpResult(childCtx, &pb.PingerID{PingerID: uint32(id)})
+	syslogSender, err := thisClient.newSyslogSender()
 	if err != nil {
-		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		logger.Log(labelinglog.FlgError, "syslog "+err.Error())
 		return
 	}
-	for {
-		result, err := stream.Recv()
-		if err != nil {
-			if err == io.EOF {
-				return
-			}
-			if status.Code(err) == codes.Canceled {
-				return
-			}
-			logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
-			return
+	defer syslogSender.close()
+
+	aggregator := pingclient.NewAggregator(watch.Info)
+	sequenceChecker := pingclient.NewSequenceChecker(watch.Info)
+	ttlAnalyzer := pingclient.NewTTLAnalyzer(watch.Info, thisClient.config.ttlAnalyzerOptions())
+	for result := range watch.C {
+		aggregator.Add(result)
+		syslogSender.result(result)
+		if output.isStructured() {
+			chOutPut <- recordMsg(output, newResultRecord(result))
+		} else if msg, ok := resultMsg(result); ok {
+			chOutPut <- msg
 		}
-
-		if result != nil {
-			switch result.GetType() {
-			case pb.IcmpResult_IcmpResultTypeReceive:
-				chOutPut <- tCliMsg{
-					text: fmt.Sprintf("R O - %s - %15s - %05d - %7.2fms - %s",
-						time.Unix(0, result.GetReceiveTimeUnixNanosec()).Format("2006/01/02 15:04:05.000"),
-						targets[result.GetTargetID()].IPAddress,
-						result.GetSequence(),
-						float64(result.GetReceiveTimeUnixNanosec()-result.GetSendTimeUnixNanosec())/1000/1000,
-						targets[result.GetTargetID()].Comment,
-					),
-					color:   cliColorGreen,
-					noBreak: false,
-				}
-			case pb.IcmpResult_IcmpResultTypeReceiveAfterTimeout:
-				chOutPut <- tCliMsg{
-					text: fmt.Sprintf("R ? - %s - %15s - %05d - %7.2fms after Timeout - %s",
-						time.Unix(0, result.GetReceiveTimeUnixNanosec()).Format("2006/01/02 15:04:05.000"),
-						targets[result.GetTargetID()].IPAddress,
-						result.GetSequence(),
-						float64(result.GetReceiveTimeUnixNanosec()-result.GetSendTimeUnixNanosec())/1000/1000,
-						targets[result.GetTargetID()].Comment,
-					),
-					color:   cliColorYellow,
-					noBreak: false,
-				}
-			case pb.IcmpResult_IcmpResultTypeTTLExceeded:
-				chOutPut <- tCliMsg{
-					text: fmt.Sprintf("R X - %s - %15s - %05d - TTL Exceeded from %s - %s",
-						time.Unix(0, result.GetReceiveTimeUnixNanosec()).Format("2006/01/02 15:04:05.000"),
-						targets[result.GetTargetID()].IPAddress,
-						result.GetSequence(),
-						pinger4.BinIPv4Address2String(pinger4.BinIPv4Address(result.GetBinPeerIP())),
-						targets[result.GetTargetID()].Comment,
-					),
-					color:   cliColorRed,
-					noBreak: false,
-				}
-			case pb.IcmpResult_IcmpResultTypeTimeout:
-				chOutPut <- tCliMsg{
-					text: fmt.Sprintf("R X - %s - %15s - %05d - Timeout!! - %s",
-						time.Unix(0, result.GetReceiveTimeUnixNanosec()).Format("2006/01/02 15:04:05.000"),
-						targets[result.GetTargetID()].IPAddress,
-						result.GetSequence(),
-						targets[result.GetTargetID()].Comment,
-					),
-					color:   cliColorRed,
-					noBreak: false,
-				}
+		if c, ok := ttlAnalyzer.Add(result); ok {
+			thisClient.printTTLChange(chOutPut, output, c)
+		}
+		for _, a := range sequenceChecker.Add(result) {
+			if output.isStructured() {
+				chOutPut <- recordMsg(output, newSequenceRecord(a))
+			} else {
+				chOutPut <- sequenceMsg(a)
 			}
 		}
 	}
+	if streamErr(watch.Err()) && !execBackground {
+		exitCode = exitCodePingerNotFound
+	}
+
+	thisClient.printStats(chOutPut, output, id, aggregator.Snapshot(), true)
+	thisClient.printSequenceSummary(chOutPut, output, id, sequenceChecker.Snapshot())
+	thisClient.printTTLReport(chOutPut, output, "ttl-summary", id, ttlAnalyzer.Snapshot(), true)
 }
 
-func (thisClient *tClientWrap) count(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string) {
-	id, err := strconv.Atoi(pingerID)
-	if err != nil {
-		logger.Log(labelinglog.FlgError, "parse error : \""+pingerID+"\"")
-		chOutPut <- tCliMsg{
-			text:    "\"pingerID\" is please enter a number",
-			color:   cliColorDefault,
-			noBreak: false,
-		}
-		return
+func targetComment(t pingclient.Target) string {
+	comment := t.Comment
+	if fqdn := t.FQDN(); fqdn != "" {
+		comment += " (FQDN: " + fqdn + ")"
 	}
-
-	info, err := thisClient.client.GetPingerInfo(ctx, &pb.PingerID{PingerID: uint32(id)})
-	if err != nil {
-		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
-		return
+	if t.ExpectUnreachable {
+		comment = pingclient.ExpectUnreachablePrefix + " " + comment
 	}
-	thisClient.printInfo(chOutPut, info)
+	return comment
+}
 
-	targets := make(map[uint32]struct {
-		IPAddress string
-		Comment   string
-	})
-	for _, t := range info.GetTargets() {
-		comment := t.GetComment()
-		if t.GetTargetIP() != t.GetTargetBinIP() {
-			comment += " (FQDN: " + t.GetTargetIP() + ")"
+func resultMsg(result pingclient.Result) (tCliMsg, bool) {
+	timeStr := result.ReceiveTime().Format("2006/01/02 15:04:05.000")
+	rttMillisec := float64(result.RTT()) / 1000 / 1000
+
+	var ox string
+	var strColor tCliColor
+	var detail string
+	switch result.Type {
+	case pingclient.ResultTypeReceive:
+		ox, strColor = "O", cliColorGreen
+		detail = fmt.Sprintf("%7.2fms", rttMillisec)
+	case pingclient.ResultTypeReceiveAfterTimeout:
+		ox, strColor = "?", cliColorYellow
+		detail = fmt.Sprintf("%7.2fms after Timeout", rttMillisec)
+	case pingclient.ResultTypeTTLExceeded:
+		ox, strColor = "X", cliColorRed
+		detail = "TTL Exceeded from " + result.PeerIP
+	case pingclient.ResultTypeTimeout:
+		ox, strColor = "X", cliColorRed
+		detail = "Timeout!!"
+	default:
+		return tCliMsg{}, false
+	}
+
+	// 応答が無いことを期待する対象は逆に評価する
+	if result.Target.ExpectUnreachable {
+		if result.AsExpected() {
+			ox, strColor = "O", cliColorGreen
+		} else {
+			ox, strColor = "X", cliColorRed
 		}
+	}
 
-		targets[t.GetTargetID()] = struct {
-			IPAddress string
-			Comment   string
-		}{
-			IPAddress: t.GetTargetBinIP(),
-			Comment:   comment,
-		}
+	return tCliMsg{
+		text: fmt.Sprintf("R %s - %s - %15s - %05d - %s - %s",
+			ox,
+			timeStr,
+			result.Target.TargetBinIP,
+			result.Sequence,
+			detail,
+			targetComment(result.Target),
+		),
+		color:   strColor,
+		noBreak: false,
+		data:    true,
+	}, true
+}
+
+func (thisClient *tClientWrap) count(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string) {
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
+		return
 	}
-	resultListNum := int64(info.GetStatisticsCountsNum())
 
-	childCtx, childCtxCancel := context.WithCancel(ctx)
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
 	defer childCtxCancel()
-	go (func() {
-		defer childCtxCancel()
-		select {
-		case <-ctx.Done():
-		case <-childCtx.Done():
-		case <-thisClient.chCancel:
-		}
-	})()
 
-	stream, err := thisClient.client.GetsStatistics(childCtx, &pb.PingerID{PingerID: uint32(id)})
+	watch, err := thisClient.watchStatistics(childCtx, chOutPut, id)
 	if err != nil {
-		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		if status.Code(err) == codes.Canceled {
+			return
+		}
+		if streamErr(err) {
+			exitCode = exitCodePingerNotFound
+		}
 		return
 	}
-	for {
-		res, err := stream.Recv()
-		if err != nil {
-			if err == io.EOF {
-				return
+	thisClient.printInfo(chOutPut, watch.Info)
+
+	mass := thisClient.config.newStatisticsMass(watch.Info)
+	for statistics := range watch.C {
+		if thisClient.output.isStructured() {
+			if mass.update(statistics) {
+				mass.log(statistics)
+				chOutPut <- recordMsg(thisClient.output, mass.record(statistics))
 			}
-			if status.Code(err) == codes.Canceled {
-				return
+			for _, record := range newStatisticsRecords(statistics, thisClient.config.CountRateThreshold) {
+				chOutPut <- recordMsg(thisClient.output, record)
 			}
-			logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
-			return
+			continue
 		}
 
-		if res != nil {
-			chOutPut <- tCliMsg{
-				text:    "",
-				color:   cliColorDefault,
-				noBreak: false,
-			}
+		chOutPut <- tCliMsg{
+			text:    "",
+			color:   cliColorDefault,
+			noBreak: false,
+			data:    true,
+		}
 
-			counts := res.GetTargets()
-			timeNowStr := time.Now().Format("2006/01/02 15:04:05.000")
-			for _, c := range counts {
-				str := ""
-				strColor := cliColorDefault
-
-				rate := c.GetCount() * 100 / resultListNum
-				var ox string
-				if rate < thisClient.config.CountRateThreshold {
-					ox = "X"
-					strColor = cliColorRed
-				} else {
-					ox = "O"
-					strColor = cliColorGreen
-				}
-				targetID := c.GetTargetID()
-				str += fmt.Sprintf("S %s - %s - %15s - %03d%% in last %d - %s",
-					ox,
-					timeNowStr,
-					targets[targetID].IPAddress,
-					rate,
-					resultListNum,
-					targets[targetID].Comment,
-				)
+		for _, msg := range thisClient.statisticsMsgs(statistics, mass) {
+			chOutPut <- msg
+		}
+	}
+	if streamErr(watch.Err()) {
+		exitCode = exitCodePingerNotFound
+	}
+}
 
-				chOutPut <- tCliMsg{
-					text:    str,
-					color:   strColor,
-					noBreak: false,
-				}
-			}
+// statisticsMsgs mass が多くの対象の同時の失敗を検出している間は見出しを出し、障害中に失敗し始めた対象を省く
+func (thisClient *tClientWrap) statisticsMsgs(statistics pingclient.Statistics, mass *tStatisticsMass) []tCliMsg {
+	msgs := make([]tCliMsg, 0, len(statistics.Targets)+1)
+
+	if mass.update(statistics) {
+		mass.log(statistics)
+		msgs = append(msgs, mass.msg(statistics))
+	} else if mass.active {
+		msgs = append(msgs, mass.msg(statistics))
+	}
+
+	timeNowStr := statistics.Time.Format("2006/01/02 15:04:05.000")
+	for _, c := range statistics.Targets {
+		var ox string
+		var strColor tCliColor
+		if countSuccess(c, thisClient.config.CountRateThreshold) {
+			ox = "O"
+			strColor = cliColorGreen
+		} else if mass.hides(c) {
+			continue
+		} else {
+			ox = "X"
+			strColor = cliColorRed
 		}
+
+		msgs = append(msgs, tCliMsg{
+			text: fmt.Sprintf("S %s - %s - %15s - %03d%% in last %d - %s",
+				ox,
+				timeNowStr,
+				c.Target.TargetBinIP,
+				c.Rate,
+				statistics.CountsNum,
+				targetComment(c.Target),
+			),
+			color:   strColor,
+			noBreak: false,
+			data:    true,
+		})
 	}
+
+	return msgs
 }
 
-func (thisClient *tClientWrap) printInfo(chOutPut chan<- tCliMsg, info *pb.PingerInfo) {
+func (thisClient *tClientWrap) printInfo(chOutPut chan<- tCliMsg, info pingclient.PingerInfo) {
 	str := ""
 
 	str += "================================================================\n"
-	str += "Description           : " + info.GetDescription() + "\n"
+	str += "Description           : " + info.Description + "\n"
 	str += "Targets               : \n"
-	for _, t := range info.GetTargets() {
-		str += "                        " + "IP     : " + t.GetTargetIP() + "\n"
-		str += "                        " + "BinIP  : " + t.GetTargetBinIP() + "\n"
-		str += "                        " + "Comment: " + t.GetComment() + "\n"
+	for _, t := range info.Targets {
+		str += "                        " + "IP     : " + t.TargetIP + "\n"
+		str += "                        " + "BinIP  : " + t.TargetBinIP + "\n"
+		str += "                        " + "Comment: " + t.Comment + "\n"
+		if t.ExpectUnreachable {
+			str += "                        " + "Expect : unreachable\n"
+		}
 		str += "                        ----------------------------------------\n"
 	}
-	str += "IntervalMillisec      : " + strconv.FormatUint(info.GetIntervalMillisec(), 10) + "\n"
-	str += "TimeoutMillisec       : " + strconv.FormatUint(info.GetTimeoutMillisec(), 10) + "\n"
-	str += "StatisticsCountsNum   : " + strconv.FormatUint(info.GetStatisticsCountsNum(), 10) + "\n"
-	str += "StatisticsIntervalSec : " + strconv.FormatUint(info.GetStatisticsIntervalSec(), 10) + "\n"
-	str += "StartUnixNanosec      : " + time.Unix(0, int64(info.GetStartUnixNanosec())).Format("2006/01/02 15:04:05.000") + "\n"
-	str += "ExpireUnixNanosec     : " + time.Unix(0, int64(info.GetExpireUnixNanosec())).Format("2006/01/02 15:04:05.000") + "\n"
+	str += "IntervalMillisec      : " + strconv.FormatUint(info.IntervalMillisec, 10) + "\n"
+	str += "TimeoutMillisec       : " + strconv.FormatUint(info.TimeoutMillisec, 10) + "\n"
+	str += "StatisticsCountsNum   : " + strconv.FormatUint(info.StatisticsCountsNum, 10) + "\n"
+	str += "StatisticsIntervalSec : " + strconv.FormatUint(info.StatisticsIntervalSec, 10) + "\n"
+	str += "StartUnixNanosec      : " + info.StartTime.Format("2006/01/02 15:04:05.000") + "\n"
+	str += "ExpireUnixNanosec     : " + info.ExpireTime.Format("2006/01/02 15:04:05.000") + "\n"
 	str += "================================================================"
 
 	chOutPut <- tCliMsg{
@@ -454,85 +448,126 @@ func (thisClient *tClientWrap) printInfo(chOutPut chan<- tCliMsg, info *pb.Pinge
 	}
 }
 
+// printInfoData -output が text 以外の時の info と start の出力
+func (thisClient *tClientWrap) printInfoData(chOutPut chan<- tCliMsg, info pingclient.PingerInfo) {
+	chOutPut <- dataMsg(thisClient.output, info, func(w io.Writer) {
+		fmt.Fprintf(w, "PingerID\t%d\n", info.PingerID)
+		fmt.Fprintf(w, "Description\t%s\n", info.Description)
+		fmt.Fprintf(w, "IntervalMillisec\t%d\n", info.IntervalMillisec)
+		fmt.Fprintf(w, "TimeoutMillisec\t%d\n", info.TimeoutMillisec)
+		fmt.Fprintf(w, "StatisticsCountsNum\t%d\n", info.StatisticsCountsNum)
+		fmt.Fprintf(w, "StatisticsIntervalSec\t%d\n", info.StatisticsIntervalSec)
+		fmt.Fprintf(w, "StartTime\t%s\n", info.StartTime.Format("2006/01/02 15:04:05.000"))
+		fmt.Fprintf(w, "ExpireTime\t%s\n", info.ExpireTime.Format("2006/01/02 15:04:05.000"))
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "TargetID\tTargetIP\tTargetBinIP\tExpectUnreachable\tComment")
+		for _, t := range info.Targets {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%t\t%s\n", t.TargetID, t.TargetIP, t.TargetBinIP, t.ExpectUnreachable, t.Comment)
+		}
+	})
+}
+
+// printListData -output が text 以外の時の list の出力、jsonl は1pinger1行
+func (thisClient *tClientWrap) printListData(chOutPut chan<- tCliMsg, pingers []pingclient.PingerSummary) {
+	if thisClient.output == outputJSONL {
+		for _, p := range pingers {
+			chOutPut <- jsonlMsg(p)
+		}
+		return
+	}
+
+	chOutPut <- dataMsg(thisClient.output, pingers, func(w io.Writer) {
+		fmt.Fprintln(w, "PingerID\tDescription\tStartTime\tExpireTime")
+		for _, p := range pingers {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n",
+				p.PingerID,
+				p.Description,
+				p.StartTime.Format("2006/01/02 15:04:05.000"),
+				p.ExpireTime.Format("2006/01/02 15:04:05.000"),
+			)
+		}
+	})
+}
+
 func (thisClient *tClientWrap) printList(ctx context.Context, chOutPut chan<- tCliMsg) {
-	list, err := thisClient.client.GetPingerList(ctx, &pb.Null{})
+	pingers, err := thisClient.client.List(ctx)
 	if err != nil {
 		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
+	}
+	if thisClient.output.isMachine() {
+		thisClient.printListData(chOutPut, pingers)
+		return
 	}
 
-	if list != nil {
-		pingers := list.GetPingers()
-		sort.Slice(pingers, func(i, j int) bool { return pingers[i].GetStartUnixNanosec() < pingers[j].GetStartUnixNanosec() })
-
-		str := ""
+	str := ""
 
+	str += "================================================================\n"
+	for _, p := range pingers {
+		str += "PingerID          : " + strconv.FormatUint(uint64(p.PingerID), 10) + "\n"
+		str += "Description       : " + p.Description + "\n"
+		str += "StartUnixNanosec  : " + p.StartTime.Format("2006/01/02 15:04:05.000") + "\n"
+		str += "ExpireUnixNanosec : " + p.ExpireTime.Format("2006/01/02 15:04:05.000") + "\n"
 		str += "================================================================\n"
-		for _, p := range pingers {
-			str += "PingerID          : " + strconv.FormatUint(uint64(p.GetPingerID()), 10) + "\n"
-			str += "Description       : " + p.GetDescription() + "\n"
-			str += "StartUnixNanosec  : " + time.Unix(0, int64(p.GetStartUnixNanosec())).Format("2006/01/02 15:04:05.000") + "\n"
-			str += "ExpireUnixNanosec : " + time.Unix(0, int64(p.GetExpireUnixNanosec())).Format("2006/01/02 15:04:05.000") + "\n"
-			str += "================================================================\n"
-		}
+	}
 
-		chOutPut <- tCliMsg{
-			text:    str,
-			color:   cliColorDefault,
-			noBreak: true,
-		}
+	chOutPut <- tCliMsg{
+		text:    str,
+		color:   cliColorDefault,
+		noBreak: true,
 	}
 }
 
 func (thisClient *tClientWrap) printListSummary(ctx context.Context, chOutPut chan<- tCliMsg) {
-	list, err := thisClient.client.GetPingerList(ctx, &pb.Null{})
+	pingers, err := thisClient.client.List(ctx)
 	if err != nil {
 		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
+	}
+	if thisClient.output.isMachine() {
+		thisClient.printListData(chOutPut, pingers)
+		return
 	}
 
-	if list != nil {
-		pingers := list.GetPingers()
-		sort.Slice(pingers, func(i, j int) bool { return pingers[i].GetStartUnixNanosec() < pingers[j].GetStartUnixNanosec() })
-
-		str := ""
+	str := ""
 
-		str += "================================================================\n"
-		str += "running Pingers (start order)\n"
-		str += "----------------------------------------------------------------\n"
-		str += "PingerID : Description\n"
-		for _, p := range pingers {
-			str += strconv.FormatUint(uint64(p.GetPingerID()), 10) + " : " + p.GetDescription() + "\n"
-		}
-		str += "================================================================\n"
+	str += "================================================================\n"
+	str += "running Pingers (start order)\n"
+	str += "----------------------------------------------------------------\n"
+	str += "PingerID : Description\n"
+	for _, p := range pingers {
+		str += strconv.FormatUint(uint64(p.PingerID), 10) + " : " + p.Description + "\n"
+	}
+	str += "================================================================\n"
 
-		chOutPut <- tCliMsg{
-			text:    str,
-			color:   cliColorDefault,
-			noBreak: true,
-		}
+	chOutPut <- tCliMsg{
+		text:    str,
+		color:   cliColorDefault,
+		noBreak: true,
 	}
 }
 
 func (thisClient *tClientWrap) printListVeryShort(ctx context.Context, chOutPut chan<- tCliMsg) {
-	list, err := thisClient.client.GetPingerList(ctx, &pb.Null{})
+	pingers, err := thisClient.client.List(ctx)
 	if err != nil {
 		logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+		return
+	}
+	if thisClient.output.isMachine() {
+		thisClient.printListData(chOutPut, pingers)
+		return
 	}
 
-	if list != nil {
-		pingers := list.GetPingers()
-		sort.Slice(pingers, func(i, j int) bool { return pingers[i].GetStartUnixNanosec() < pingers[j].GetStartUnixNanosec() })
-
-		str := ""
+	str := ""
 
-		for _, p := range pingers {
-			str += strconv.FormatUint(uint64(p.GetPingerID()), 10) + "\n"
-		}
+	for _, p := range pingers {
+		str += strconv.FormatUint(uint64(p.PingerID), 10) + "\n"
+	}
 
-		chOutPut <- tCliMsg{
-			text:    str,
-			color:   cliColorDefault,
-			noBreak: true,
-		}
+	chOutPut <- tCliMsg{
+		text:    str,
+		color:   cliColorDefault,
+		noBreak: true,
 	}
 }
 
@@ -540,36 +575,10 @@ func (thisClient *tClientWrap) interactive(ctx context.Context, chOutPut chan<-
 	childCtx, childCtxCancel := context.WithCancel(ctx)
 	defer childCtxCancel()
 
-	chStdinText := make(chan string, 5)
-
-	go (func() {
-		defer childCtxCancel()
-
-		scanner := bufio.NewScanner(os.Stdin)
-		logger.Log(labelinglog.FlgDebug, "start scanner")
-		defer logger.Log(labelinglog.FlgDebug, "finish scanner")
-		for {
-			select {
-			case <-childCtx.Done():
-				logger.Log(labelinglog.FlgDebug, "stop scanner")
-				return
-			default:
-			}
-
-			if scanner.Scan() {
-				text := scanner.Text()
-				chStdinText <- strings.Trim(text, " \t")
-			} else {
-				if err := scanner.Err(); err != nil {
-					logger.Log(labelinglog.FlgError, "scanner: "+err.Error())
-					return
-				}
-
-				logger.Log(labelinglog.FlgDebug, "scanner: stdin closed, scanner reNew")
-				scanner = bufio.NewScanner(os.Stdin)
-			}
-		}
-	})()
+	//table のキー入力と行の入力は同じ読み手から受け取る
+	stdin := newStdin(true)
+	defer stdin.stop()
+	chStdinText := stdin.lines()
 
 	logger.Log(labelinglog.FlgDebug, "start interactive")
 	defer logger.Log(labelinglog.FlgDebug, "finish interactive")
@@ -592,7 +601,12 @@ func (thisClient *tClientWrap) interactive(ctx context.Context, chOutPut chan<-
 		case <-thisClient.chCancel:
 			logger.Log(labelinglog.FlgDebug, "stop interactive, chCancel")
 			return
-		case command = <-chStdinText:
+		case line, ok := <-chStdinText:
+			if !ok {
+				logger.Log(labelinglog.FlgDebug, "stop interactive, stdin closed")
+				return
+			}
+			command = line
 		}
 
 		switch command {
@@ -600,7 +614,8 @@ func (thisClient *tClientWrap) interactive(ctx context.Context, chOutPut chan<-
 			chOutPut <- tCliMsg{
 				text: "" +
 					"start : start pinger\n" +
-					"stop  : stop pinger",
+					"stop  : stop pinger\n" +
+					"stats : show rtt statistics",
 				color:   cliColorDefault,
 				noBreak: false,
 			}
@@ -625,8 +640,7 @@ func (thisClient *tClientWrap) interactive(ctx context.Context, chOutPut chan<-
 			case descStr = <-chStdinText:
 			}
 
-			targetList := make([]*pb.StartRequest_IcmpTarget, 0)
-			reg := regexp.MustCompile(`^([^# \t]*)[# \t]*(.*)$`)
+			targetList := make([]pingclient.StartTarget, 0)
 			for {
 				chOutPut <- tCliMsg{
 					text:    "target [IP Comment]? ",
@@ -645,15 +659,8 @@ func (thisClient *tClientWrap) interactive(ctx context.Context, chOutPut chan<-
 					break
 				}
 
-				result := reg.FindStringSubmatch(targetStr)
-				if result != nil {
-					targetIP := result[1]
-					targetComment := result[2]
-
-					targetList = append(targetList, &pb.StartRequest_IcmpTarget{
-						TargetIP: targetIP,
-						Comment:  targetComment,
-					})
+				if target, ok := pingclient.ParseTargetLine(targetStr); ok {
+					targetList = append(targetList, target)
 				}
 			}
 
@@ -733,7 +740,7 @@ func (thisClient *tClientWrap) interactive(ctx context.Context, chOutPut chan<-
 			case pingerID = <-chStdinText:
 			}
 
-			thisClient.result(childCtx, chOutPut, false, pingerID)
+			thisClient.result(childCtx, chOutPut, false, thisClient.output, pingerID)
 		case "c", "co", "cou", "coun", "count":
 			chOutPut <- tCliMsg{
 				text:    "[count]",
@@ -757,6 +764,146 @@ func (thisClient *tClientWrap) interactive(ctx context.Context, chOutPut chan<-
 			}
 
 			thisClient.count(childCtx, chOutPut, pingerID)
+		case "stat", "stats":
+			chOutPut <- tCliMsg{
+				text:    "[stats]",
+				color:   cliColorDefault,
+				noBreak: false,
+			}
+
+			thisClient.printListSummary(childCtx, chOutPut)
+			chOutPut <- tCliMsg{
+				text:    "PingerID? ",
+				color:   cliColorDefault,
+				noBreak: true,
+			}
+			var pingerID string
+			select {
+			case <-childCtx.Done():
+				continue
+			case <-thisClient.chCancel:
+				continue
+			case pingerID = <-chStdinText:
+			}
+
+			thisClient.stats(childCtx, chOutPut, pingerID, "")
+		case "ev", "eve", "even", "event", "events":
+			chOutPut <- tCliMsg{
+				text:    "[events]",
+				color:   cliColorDefault,
+				noBreak: false,
+			}
+
+			thisClient.printListSummary(childCtx, chOutPut)
+			chOutPut <- tCliMsg{
+				text:    "PingerID? ",
+				color:   cliColorDefault,
+				noBreak: true,
+			}
+			var pingerID string
+			select {
+			case <-childCtx.Done():
+				continue
+			case <-thisClient.chCancel:
+				continue
+			case pingerID = <-chStdinText:
+			}
+
+			thisClient.events(childCtx, chOutPut, false, thisClient.output, pingerID)
+		case "n", "no", "not", "noti", "notif", "notify":
+			chOutPut <- tCliMsg{
+				text:    "[notify]",
+				color:   cliColorDefault,
+				noBreak: false,
+			}
+
+			thisClient.printListSummary(childCtx, chOutPut)
+			chOutPut <- tCliMsg{
+				text:    "PingerID? ",
+				color:   cliColorDefault,
+				noBreak: true,
+			}
+			var pingerID string
+			select {
+			case <-childCtx.Done():
+				continue
+			case <-thisClient.chCancel:
+				continue
+			case pingerID = <-chStdinText:
+			}
+
+			thisClient.notify(childCtx, chOutPut, pingerID)
+		case "t", "ta", "tab", "tabl", "table":
+			chOutPut <- tCliMsg{
+				text:    "[table]",
+				color:   cliColorDefault,
+				noBreak: false,
+			}
+
+			thisClient.printListSummary(childCtx, chOutPut)
+			chOutPut <- tCliMsg{
+				text:    "PingerID? ",
+				color:   cliColorDefault,
+				noBreak: true,
+			}
+			var pingerID string
+			select {
+			case <-childCtx.Done():
+				continue
+			case <-thisClient.chCancel:
+				continue
+			case pingerID = <-chStdinText:
+			}
+
+			chKey, restore := stdin.keys()
+			thisClient.table(childCtx, chOutPut, pingerID, chKey)
+			restore()
+		case "ttl":
+			chOutPut <- tCliMsg{
+				text:    "[ttl]",
+				color:   cliColorDefault,
+				noBreak: false,
+			}
+
+			thisClient.printListSummary(childCtx, chOutPut)
+			chOutPut <- tCliMsg{
+				text:    "PingerID? ",
+				color:   cliColorDefault,
+				noBreak: true,
+			}
+			var pingerID string
+			select {
+			case <-childCtx.Done():
+				continue
+			case <-thisClient.chCancel:
+				continue
+			case pingerID = <-chStdinText:
+			}
+
+			thisClient.ttl(childCtx, chOutPut, pingerID, "")
+		case "conv", "conve", "conver", "converg", "converge", "convergen", "convergenc", "convergence":
+			chOutPut <- tCliMsg{
+				text:    "[convergence]",
+				color:   cliColorDefault,
+				noBreak: false,
+			}
+
+			thisClient.printListSummary(childCtx, chOutPut)
+			chOutPut <- tCliMsg{
+				text:    "PingerID? ",
+				color:   cliColorDefault,
+				noBreak: true,
+			}
+			var pingerID string
+			select {
+			case <-childCtx.Done():
+				continue
+			case <-thisClient.chCancel:
+				continue
+			case pingerID = <-chStdinText:
+			}
+
+			thisClient.convergence(childCtx, chOutPut, pingerID, chStdinText)
 		case "q", "qu", "qui", "quit":
 			chOutPut <- tCliMsg{
 				text:    "[quit]",
@@ -781,6 +928,12 @@ func (thisClient *tClientWrap) interactive(ctx context.Context, chOutPut chan<-
 					"info   : show pinger info\n" +
 					"result : show ping result\n" +
 					"count  : show ping statistics\n" +
+					"stats  : show rtt statistics\n" +
+					"table  : show live per-target table\n" +
+					"events : show target state changes\n" +
+					"notify : post target state changes to webhooks\n" +
+					"ttl    : show ttl exceeded per reporting router\n" +
+					"convergence : measure loss runs, \"mark\" records the failover trigger\n" +
 					"\n" +
 					"quit   : exit client\n" +
 					"exit   : exit client\n" +
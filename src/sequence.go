@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// tSequenceRecord is a sequence anomaly of "result" in structured output
+type tSequenceRecord struct {
+	Kind              string `json:"Kind"`
+	Anomaly           string `json:"Anomaly"`
+	PingerID          uint32 `json:"PingerID"`
+	TargetID          uint32 `json:"TargetID"`
+	TargetIP          string `json:"TargetIP"`
+	FQDN              string `json:"FQDN"`
+	Comment           string `json:"Comment"`
+	TimeUnixNanosec   int64  `json:"TimeUnixNanosec"`
+	FirstSequence     int64  `json:"FirstSequence"`
+	LastSequence      int64  `json:"LastSequence"`
+	Count             int64  `json:"Count"`
+	MaxSequence       int64  `json:"MaxSequence"`
+	WasMissing        bool   `json:"WasMissing"`
+	ExpectUnreachable bool   `json:"ExpectUnreachable"`
+}
+
+// tSequenceSummaryRecord is the sequence counts of a target at the end of "result" in structured output
+type tSequenceSummaryRecord struct {
+	Kind      string `json:"Kind"`
+	PingerID  uint32 `json:"PingerID"`
+	TargetID  uint32 `json:"TargetID"`
+	TargetIP  string `json:"TargetIP"`
+	FQDN      string `json:"FQDN"`
+	Comment   string `json:"Comment"`
+	Delivered int64  `json:"Delivered"`
+	Missing   int64  `json:"Missing"`
+	Duplicate int64  `json:"Duplicate"`
+	Reordered int64  `json:"Reordered"`
+}
+
+func newSequenceRecord(a pingclient.SequenceAnomaly) tSequenceRecord {
+	return tSequenceRecord{
+		Kind:              "sequence",
+		Anomaly:           a.Type.String(),
+		PingerID:          a.PingerID,
+		TargetID:          a.Target.TargetID,
+		TargetIP:          a.Target.TargetBinIP,
+		FQDN:              a.Target.FQDN(),
+		Comment:           a.Target.Comment,
+		TimeUnixNanosec:   a.Time.UnixNano(),
+		FirstSequence:     a.FirstSequence,
+		LastSequence:      a.LastSequence,
+		Count:             a.Count(),
+		MaxSequence:       a.MaxSequence,
+		WasMissing:        a.WasMissing,
+		ExpectUnreachable: a.Target.ExpectUnreachable,
+	}
+}
+
+// sequenceMsg 結果の欠落・重複・入れ替わり、pingの損失(Timeout)とは別
+func sequenceMsg(a pingclient.SequenceAnomaly) tCliMsg {
+	detail := ""
+	switch a.Type {
+	case pingclient.SequenceMissing:
+		if a.Count() == 1 {
+			detail = fmt.Sprintf("seq %05d never delivered", a.FirstSequence)
+		} else {
+			detail = fmt.Sprintf("seq %05d-%05d never delivered (%d results)", a.FirstSequence, a.LastSequence, a.Count())
+		}
+	case pingclient.SequenceDuplicate:
+		detail = fmt.Sprintf("seq %05d delivered again", a.FirstSequence)
+	case pingclient.SequenceReordered:
+		detail = fmt.Sprintf("seq %05d delivered after %05d", a.FirstSequence, a.MaxSequence)
+		if a.WasMissing {
+			detail += " (counted as missing before)"
+		}
+	}
+
+	return tCliMsg{
+		text: fmt.Sprintf("S %-9s - %s - %15s - %s - %s",
+			a.Type,
+			a.Time.Format("2006/01/02 15:04:05.000"),
+			a.Target.TargetBinIP,
+			detail,
+			targetComment(a.Target),
+		),
+		color:   cliColorBlue,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+// printSequenceSummary 対象ごとの欠落・重複・入れ替わりの数
+func (thisClient *tClientWrap) printSequenceSummary(chOutPut chan<- tCliMsg, output tOutputFormat, pingerID uint32, snapshot []pingclient.SequenceCounts) {
+	if output.isStructured() {
+		for _, c := range snapshot {
+			chOutPut <- recordMsg(output, tSequenceSummaryRecord{
+				Kind:      "sequence-summary",
+				PingerID:  pingerID,
+				TargetID:  c.Target.TargetID,
+				TargetIP:  c.Target.TargetBinIP,
+				FQDN:      c.Target.FQDN(),
+				Comment:   c.Target.Comment,
+				Delivered: c.Delivered,
+				Missing:   c.Missing,
+				Duplicate: c.Duplicate,
+				Reordered: c.Reordered,
+			})
+		}
+		return
+	}
+
+	chOutPut <- tCliMsg{
+		text:    "--- sequence check ---",
+		color:   cliColorDefault,
+		noBreak: false,
+		data:    true,
+	}
+	for _, c := range snapshot {
+		strColor := cliColorDefault
+		if c.Missing > 0 || c.Duplicate > 0 || c.Reordered > 0 {
+			strColor = cliColorBlue
+		}
+		chOutPut <- tCliMsg{
+			text: fmt.Sprintf("%15s - %d delivered, %d missing, %d duplicate, %d reordered - %s",
+				c.Target.TargetBinIP,
+				c.Delivered,
+				c.Missing,
+				c.Duplicate,
+				c.Reordered,
+				targetComment(c.Target),
+			),
+			color:   strColor,
+			noBreak: false,
+			data:    true,
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+const defaultStatsPrintInterval = 10 * time.Second
+
+// tStatsRecord is a line of "stats" and the summary of "result" in structured output
+type tStatsRecord struct {
+	Kind         string  `json:"Kind"`
+	PingerID     uint32  `json:"PingerID"`
+	TargetID     uint32  `json:"TargetID"`
+	TargetIP     string  `json:"TargetIP"`
+	FQDN         string  `json:"FQDN"`
+	Comment      string  `json:"Comment"`
+	Sent         int64   `json:"Sent"`
+	Received     int64   `json:"Received"`
+	Late         int64   `json:"Late"`
+	TTLExceeded  int64   `json:"TTLExceeded"`
+	LossPercent  float64 `json:"LossPercent"`
+	MinMillisec  float64 `json:"MinMillisec"`
+	AvgMillisec  float64 `json:"AvgMillisec"`
+	MaxMillisec  float64 `json:"MaxMillisec"`
+	MDevMillisec float64 `json:"MDevMillisec"`
+	P50Millisec  float64 `json:"P50Millisec"`
+	P90Millisec  float64 `json:"P90Millisec"`
+	P99Millisec  float64 `json:"P99Millisec"`
+}
+
+func durationMillisec(d time.Duration) float64 {
+	return float64(d) / 1000 / 1000
+}
+
+func newStatsRecord(kind string, pingerID uint32, s pingclient.TargetStats) tStatsRecord {
+	return tStatsRecord{
+		Kind:         kind,
+		PingerID:     pingerID,
+		TargetID:     s.Target.TargetID,
+		TargetIP:     s.Target.TargetBinIP,
+		FQDN:         s.Target.FQDN(),
+		Comment:      s.Target.Comment,
+		Sent:         s.Sent,
+		Received:     s.Received,
+		Late:         s.Late,
+		TTLExceeded:  s.TTLExceeded,
+		LossPercent:  s.LossPercent,
+		MinMillisec:  durationMillisec(s.Min),
+		AvgMillisec:  durationMillisec(s.Avg),
+		MaxMillisec:  durationMillisec(s.Max),
+		MDevMillisec: durationMillisec(s.MDev),
+		P50Millisec:  durationMillisec(s.P50),
+		P90Millisec:  durationMillisec(s.P90),
+		P99Millisec:  durationMillisec(s.P99),
+	}
+}
+
+// statsLineMsg 1対象1行の途中経過
+func statsLineMsg(s pingclient.TargetStats) tCliMsg {
+	strColor := cliColorGreen
+	if s.Sent == 0 {
+		strColor = cliColorDefault
+	} else if s.Target.ExpectUnreachable {
+		// 応答が無いことを期待する対象は1つでも応答があれば赤
+		if s.Received > 0 || s.Late > 0 {
+			strColor = cliColorRed
+		}
+	} else if s.Received == 0 {
+		strColor = cliColorRed
+	} else if s.Received < s.Sent || s.Late > 0 {
+		strColor = cliColorYellow
+	}
+
+	return tCliMsg{
+		text: fmt.Sprintf("T - %s - %15s - sent %5d recv %5d loss %5.1f%% - min/avg/max/mdev %.2f/%.2f/%.2f/%.2fms - p50/p90/p99 %.2f/%.2f/%.2fms - %s",
+			time.Now().Format("2006/01/02 15:04:05.000"),
+			s.Target.TargetBinIP,
+			s.Sent,
+			s.Received,
+			s.LossPercent,
+			durationMillisec(s.Min),
+			durationMillisec(s.Avg),
+			durationMillisec(s.Max),
+			durationMillisec(s.MDev),
+			durationMillisec(s.P50),
+			durationMillisec(s.P90),
+			durationMillisec(s.P99),
+			targetComment(s.Target),
+		),
+		color:   strColor,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+// statsSummaryMsg ping(8)のような集計結果
+func statsSummaryMsg(s pingclient.TargetStats) tCliMsg {
+	str := ""
+
+	str += fmt.Sprintf("--- %s ping statistics --- %s\n", s.Target.TargetBinIP, targetComment(s.Target))
+	str += fmt.Sprintf("%d packets transmitted, %d received, %.1f%% packet loss, %d late, %d ttl exceeded\n",
+		s.Sent,
+		s.Received,
+		s.LossPercent,
+		s.Late,
+		s.TTLExceeded,
+	)
+	if s.Received > 0 {
+		str += fmt.Sprintf("rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n",
+			durationMillisec(s.Min),
+			durationMillisec(s.Avg),
+			durationMillisec(s.Max),
+			durationMillisec(s.MDev),
+		)
+		str += fmt.Sprintf("rtt p50/p90/p99 = %.3f/%.3f/%.3f ms\n",
+			durationMillisec(s.P50),
+			durationMillisec(s.P90),
+			durationMillisec(s.P99),
+		)
+	}
+
+	return tCliMsg{
+		text:    str,
+		color:   cliColorDefault,
+		noBreak: true,
+		data:    true,
+	}
+}
+
+func (thisClient *tClientWrap) printStats(chOutPut chan<- tCliMsg, output tOutputFormat, pingerID uint32, snapshot []pingclient.TargetStats, isSummary bool) {
+	if output.isStructured() {
+		kind := "stats"
+		if isSummary {
+			kind = "summary"
+		}
+		for _, s := range snapshot {
+			chOutPut <- recordMsg(output, newStatsRecord(kind, pingerID, s))
+		}
+		return
+	}
+
+	chOutPut <- tCliMsg{
+		text:    "",
+		color:   cliColorDefault,
+		noBreak: false,
+		data:    true,
+	}
+	for _, s := range snapshot {
+		if isSummary {
+			chOutPut <- statsSummaryMsg(s)
+		} else {
+			chOutPut <- statsLineMsg(s)
+		}
+	}
+}
+
+func (thisClient *tClientWrap) stats(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string, intervalStr string) {
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
+		return
+	}
+
+	interval := defaultStatsPrintInterval
+	if intervalStr != "" {
+		d, err := time.ParseDuration(intervalStr)
+		if err != nil || d <= 0 {
+			logger.Log(labelinglog.FlgError, "parse error : \""+intervalStr+"\"")
+			chOutPut <- tCliMsg{
+				text:    "\"interval\" is please enter a duration (e.g. 30s)",
+				color:   cliColorDefault,
+				noBreak: false,
+			}
+			return
+		}
+		interval = d
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	watch, err := thisClient.watchResults(childCtx, chOutPut, id)
+	if err != nil {
+		if status.Code(err) == codes.Canceled {
+			return
+		}
+		if streamErr(err) {
+			exitCode = exitCodePingerNotFound
+		}
+		return
+	}
+	thisClient.printInfo(chOutPut, watch.Info)
+
+	aggregator := pingclient.NewAggregator(watch.Info)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case result, ok := <-watch.C:
+			if !ok {
+				break loop
+			}
+			aggregator.Add(result)
+		case <-ticker.C:
+			thisClient.printStats(chOutPut, thisClient.output, id, aggregator.Snapshot(), false)
+		}
+	}
+	if streamErr(watch.Err()) {
+		exitCode = exitCodePingerNotFound
+	}
+
+	thisClient.printStats(chOutPut, thisClient.output, id, aggregator.Snapshot(), true)
+}
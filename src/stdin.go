@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/umenosuke/labelinglog"
+)
+
+// tStdin 標準入力を1つのgoroutineで読み、行単位かキー単位で渡す
+// 読む側を切り替えても、前の読み手が入力を横取りしない
+type tStdin struct {
+	//interactive では Ctrl+D の後も読み続ける
+	keepOnEOF bool
+
+	mu      sync.Mutex
+	keyMode bool
+
+	chLine   chan string
+	chKey    chan string
+	chStop   chan struct{}
+	stopOnce sync.Once
+}
+
+// newStdin 標準入力を読み始める、終わったら stop する
+func newStdin(keepOnEOF bool) *tStdin {
+	thisStdin := &tStdin{
+		keepOnEOF: keepOnEOF,
+		chLine:    make(chan string, 5),
+		chKey:     make(chan string, 16),
+		chStop:    make(chan struct{}),
+	}
+	go thisStdin.read()
+
+	return thisStdin
+}
+
+// stop 読むのを止める、読み込み中の Read は止められないので次の入力で終わる
+func (thisStdin *tStdin) stop() {
+	thisStdin.stopOnce.Do(func() { close(thisStdin.chStop) })
+}
+
+// lines 1行ずつ、前後の空白は除く、標準入力が終わると close される
+func (thisStdin *tStdin) lines() <-chan string {
+	return thisStdin.chLine
+}
+
+// keys Enter無しでキーを1文字ずつ渡す、返す関数で行単位に戻す
+// Enter無しで読めない環境では、行の入力が1文字ずつ届く
+func (thisStdin *tStdin) keys() (<-chan string, func()) {
+	restore, err := enableKeyInput()
+	if err != nil {
+		logger.Log(labelinglog.FlgDebug, "key input: "+err.Error())
+	}
+
+	thisStdin.mu.Lock()
+	thisStdin.keyMode = true
+	thisStdin.mu.Unlock()
+	//前に読んだ時の残りは捨てる
+	for len(thisStdin.chKey) > 0 {
+		<-thisStdin.chKey
+	}
+
+	return thisStdin.chKey, func() {
+		restore()
+		thisStdin.mu.Lock()
+		thisStdin.keyMode = false
+		thisStdin.mu.Unlock()
+	}
+}
+
+func (thisStdin *tStdin) isKeyMode() bool {
+	thisStdin.mu.Lock()
+	defer thisStdin.mu.Unlock()
+	return thisStdin.keyMode
+}
+
+func (thisStdin *tStdin) read() {
+	defer close(thisStdin.chLine)
+	defer close(thisStdin.chKey)
+	logger.Log(labelinglog.FlgDebug, "start stdin reader")
+	defer logger.Log(labelinglog.FlgDebug, "finish stdin reader")
+
+	buf := make([]byte, 256)
+	line := make([]byte, 0, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		select {
+		case <-thisStdin.chStop:
+			return
+		default:
+		}
+
+		for _, b := range buf[:n] {
+			if thisStdin.isKeyMode() {
+				//キーは取りこぼしても困らないので、詰まったら捨てる
+				select {
+				case thisStdin.chKey <- string([]byte{b}):
+				default:
+				}
+				continue
+			}
+			if b != '\n' {
+				line = append(line, b)
+				continue
+			}
+			if !thisStdin.sendLine(string(line)) {
+				return
+			}
+			line = line[:0]
+		}
+
+		if err == io.EOF && thisStdin.keepOnEOF {
+			logger.Log(labelinglog.FlgDebug, "stdin closed, keep reading")
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				logger.Log(labelinglog.FlgError, "stdin: "+err.Error())
+			}
+			if len(line) > 0 {
+				thisStdin.sendLine(string(line))
+			}
+			return
+		}
+	}
+}
+
+func (thisStdin *tStdin) sendLine(line string) bool {
+	select {
+	case thisStdin.chLine <- strings.Trim(line, " \t\r"):
+		return true
+	case <-thisStdin.chStop:
+		return false
+	}
+}
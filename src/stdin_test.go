@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// useStdinPipe replaces os.Stdin with a pipe and returns its writer.
+func useStdinPipe(t *testing.T) *os.File {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		w.Close()
+		r.Close()
+	})
+	return w
+}
+
+func receive(t *testing.T, ch <-chan string) (string, bool) {
+	t.Helper()
+
+	select {
+	case text, ok := <-ch:
+		return text, ok
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing received")
+		return "", false
+	}
+}
+
+func TestStdinSwitchesLinesAndKeys(t *testing.T) {
+	w := useStdinPipe(t)
+	stdin := newStdin(false)
+	defer stdin.stop()
+
+	w.Write([]byte(" start 1 \r\n"))
+	if line, _ := receive(t, stdin.lines()); line != "start 1" {
+		t.Errorf("line = %q", line)
+	}
+
+	chKey, restore := stdin.keys()
+	w.Write([]byte("lq"))
+	for _, want := range []string{"l", "q"} {
+		if key, _ := receive(t, chKey); key != want {
+			t.Errorf("key = %q, want %q", key, want)
+		}
+	}
+	restore()
+
+	w.Write([]byte("list\nlast"))
+	if line, _ := receive(t, stdin.lines()); line != "list" {
+		t.Errorf("line after keys = %q", line)
+	}
+	w.Close()
+	if line, _ := receive(t, stdin.lines()); line != "last" {
+		t.Errorf("line without newline = %q", line)
+	}
+	if _, ok := receive(t, stdin.lines()); ok {
+		t.Error("lines not closed at EOF")
+	}
+	if _, ok := receive(t, chKey); ok {
+		t.Error("keys not closed at EOF")
+	}
+}
+
+func TestStdinStop(t *testing.T) {
+	w := useStdinPipe(t)
+	stdin := newStdin(false)
+
+	//誰も読まない行で詰まっていても止まる
+	for i := 0; i < 10; i++ {
+		w.Write([]byte("line\n"))
+	}
+	time.Sleep(100 * time.Millisecond)
+	stdin.stop()
+
+	for {
+		if _, ok := receive(t, stdin.lines()); !ok {
+			break
+		}
+	}
+}
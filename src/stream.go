@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+const streamBufferSize = 200
+
+// exitCodePingerNotFound 購読していたpingerが無くなって終わった時の終了コード
+const exitCodePingerNotFound = 4
+
+// tStream is a pingclient watch watched by a watchdog and subscribed again when configured
+type tStream[T any] struct {
+	watchdog *pingclient.Watchdog
+	backoff  *pingclient.Backoff
+	done     chan struct{}
+	err      error
+
+	//購読開始時のpingerの情報
+	Info pingclient.PingerInfo
+	//購読終了時にcloseされる
+	C <-chan T
+}
+
+// tResultStream is pingclient.ResultWatch watched by a watchdog and subscribed again when configured
+type tResultStream = tStream[pingclient.Result]
+
+// tStatisticsStream is pingclient.StatisticsWatch watched by a watchdog and subscribed again when configured
+type tStatisticsStream = tStream[pingclient.Statistics]
+
+// tSubscription 1回の購読、pingclient.ResultWatch と pingclient.StatisticsWatch の共通部分
+type tSubscription[T any] struct {
+	info pingclient.PingerInfo
+	c    <-chan T
+	err  func() error
+}
+
+// tStreamSource 購読するものごとの違い
+type tStreamSource[T any] struct {
+	kind string
+	//見逃したものの数え方
+	unit      string
+	interval  func(info pingclient.PingerInfo) time.Duration
+	expected  func(info pingclient.PingerInfo, d time.Duration) int
+	subscribe func(ctx context.Context) (tSubscription[T], error)
+}
+
+// Err waits for the stream to end and returns the reason, like pingclient.ResultWatch.Err.
+func (thisStream *tStream[T]) Err() error {
+	<-thisStream.done
+	return thisStream.err
+}
+
+// silent 届かずに STALE になっていればその時間、そうでなければ0
+func (thisStream *tStream[T]) silent() time.Duration {
+	return thisStream.watchdog.Silent(time.Now())
+}
+
+// tickC watchdog を確認する間隔のticker、間隔が無ければ確認しない
+func (thisStream *tStream[T]) tickC() (<-chan time.Time, func()) {
+	if thisStream.watchdog.Interval() <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(thisStream.watchdog.Interval())
+	return ticker.C, ticker.Stop
+}
+
+// streamErr ストリームの終わった理由をログに出し、pingerが無くなっていれば true
+func streamErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	logger.Log(labelinglog.FlgError, "\""+err.Error()+"\"")
+	return status.Code(err) == codes.NotFound
+}
+
+// streamRetryable 繋ぎ直せば直るかもしれない理由か、権限や未実装などは何度繋いでも同じなので諦める
+func streamRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unknown, codes.Canceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// samePinger サーバーの再起動などで同じIDの別のpingerになっていれば NotFound を返す
+func samePinger(info pingclient.PingerInfo, newInfo pingclient.PingerInfo) error {
+	if newInfo.StartTime.Equal(info.StartTime) && newInfo.Description == info.Description {
+		return nil
+	}
+	return status.Errorf(codes.NotFound, "pinger %d was replaced by another one", info.PingerID)
+}
+
+// giveUp 繋ぎ直さずに終わる、期限を過ぎて無くなったpingerは正常な終わりとして扱う
+func (thisStream *tStream[T]) giveUp(notice tStreamNotice, err error) {
+	if status.Code(err) != codes.NotFound {
+		thisStream.err = err
+		notice.failed(err)
+		return
+	}
+	if expire := thisStream.Info.ExpireTime; !expire.IsZero() && !time.Now().Before(expire) {
+		notice.ended("pinger expired")
+		return
+	}
+	thisStream.err = err
+	notice.gone()
+}
+
+// reconnect 購読が切れた時に ctx が終わるか諦めるまで間隔を空けながら subscribe を繰り返す
+// 待っている間も watchdog は確認する、繋ぎ直せなければ Err() の理由を残して false
+func (thisStream *tStream[T]) reconnect(ctx context.Context, notice tStreamNotice, cause error, lastSeen time.Time, chTick <-chan time.Time, subscribe func() error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if !streamRetryable(cause) {
+		thisStream.giveUp(notice, cause)
+		return false
+	}
+	disconnected := time.Now()
+	notice.disconnected(cause)
+
+	for {
+		timer := time.NewTimer(thisStream.backoff.Next())
+		for waiting := true; waiting; {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return false
+			case <-timer.C:
+				waiting = false
+			case now := <-chTick:
+				if becameStale, _ := thisStream.watchdog.Check(now); becameStale {
+					notice.stale(thisStream.watchdog.Silent(now))
+				}
+			}
+		}
+
+		err := subscribe()
+		if err == nil {
+			now := time.Now()
+			thisStream.backoff.Reset()
+			thisStream.watchdog.Resubscribed(now)
+			notice.reconnected(now.Sub(disconnected), notice.expected(thisStream.Info, now.Sub(lastSeen)))
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if !streamRetryable(err) {
+			thisStream.giveUp(notice, err)
+			return false
+		}
+		logger.Log(labelinglog.FlgWarn, fmt.Sprintf("id %d %s stream reconnect failed : \"%s\"", notice.pingerID, notice.kind, err.Error()))
+	}
+}
+
+// tStreamNotice ストリームの STALE などをログと chNotice へ出す、chNotice が nil ならログのみ
+type tStreamNotice struct {
+	chNotice chan<- tCliMsg
+	kind     string
+	//見逃したものの数え方
+	unit     string
+	pingerID uint32
+	interval time.Duration
+	//見逃したものの数の見積もり方
+	expected func(info pingclient.PingerInfo, d time.Duration) int
+}
+
+func (thisNotice tStreamNotice) send(flg labelinglog.LogLevel, color tCliColor, mark string, text string) {
+	text = fmt.Sprintf("id %d %s stream %s", thisNotice.pingerID, thisNotice.kind, text)
+	logger.Log(flg, text)
+	if thisNotice.chNotice == nil {
+		return
+	}
+	thisNotice.chNotice <- tCliMsg{
+		text:    fmt.Sprintf("!! %-5s - %s - %s", mark, time.Now().Format("2006/01/02 15:04:05.000"), text),
+		color:   color,
+		noBreak: false,
+	}
+}
+
+func (thisNotice tStreamNotice) stale(silent time.Duration) {
+	thisNotice.send(labelinglog.FlgWarn, cliColorRed, "STALE", fmt.Sprintf("delivered nothing for %.3fs (expected every %s), shown values may be outdated", silent.Seconds(), thisNotice.interval))
+}
+
+func (thisNotice tStreamNotice) recovered(silent time.Duration) {
+	thisNotice.send(labelinglog.FlgNotice, cliColorGreen, "LIVE", fmt.Sprintf("delivering again after %.3fs", silent.Seconds()))
+}
+
+func (thisNotice tStreamNotice) resubscribed() {
+	thisNotice.send(labelinglog.FlgWarn, cliColorYellow, "RESUB", "subscribed again")
+}
+
+func (thisNotice tStreamNotice) disconnected(cause error) {
+	text := "disconnected, reconnecting"
+	if cause != nil {
+		text = "disconnected : \"" + cause.Error() + "\", reconnecting"
+	}
+	thisNotice.send(labelinglog.FlgWarn, cliColorRed, "DISC", text)
+}
+
+func (thisNotice tStreamNotice) reconnected(after time.Duration, missed int) {
+	thisNotice.send(labelinglog.FlgWarn, cliColorYellow, "RECON", fmt.Sprintf("reconnected after %.3fs, %d %s possibly missed", after.Seconds(), missed, thisNotice.unit))
+}
+
+func (thisNotice tStreamNotice) failed(err error) {
+	thisNotice.send(labelinglog.FlgError, cliColorRed, "FAIL", "ended, not reconnecting : \""+err.Error()+"\"")
+}
+
+// ended 正常な終わりはログのみ
+func (thisNotice tStreamNotice) ended(reason string) {
+	logger.Log(labelinglog.FlgNotice, fmt.Sprintf("id %d %s stream ended, %s", thisNotice.pingerID, thisNotice.kind, reason))
+}
+
+func (thisNotice tStreamNotice) gone() {
+	thisNotice.send(labelinglog.FlgError, cliColorRed, "GONE", "ended, pinger no longer exists")
+}
+
+// watchResults WatchResults を watchdog 付きで購読する
+// StreamStaleCount 回分の間隔の間何も届かなければ STALE を、届き始めたら LIVE を出し、
+// StreamResubscribeCount 回分届かなければ購読し直す
+// 切れた時や購読し直せなかった時は間隔を空けながら繋ぎ直し、pingerが無くなっていれば NotFound で終わる
+// pingerの停止や期限切れでサーバーが閉じたストリームはそのまま正常に終わる
+func (thisClient *tClientWrap) watchResults(ctx context.Context, chNotice chan<- tCliMsg, pingerID uint32) (*tResultStream, error) {
+	return watchStream(ctx, thisClient.config, chNotice, pingerID, tStreamSource[pingclient.Result]{
+		kind:     "result",
+		unit:     "results",
+		interval: pingclient.ResultInterval,
+		expected: pingclient.ExpectedResults,
+		subscribe: func(ctx context.Context) (tSubscription[pingclient.Result], error) {
+			watch, err := thisClient.client.WatchResults(ctx, pingerID)
+			if err != nil {
+				return tSubscription[pingclient.Result]{}, err
+			}
+			return tSubscription[pingclient.Result]{info: watch.Info, c: watch.C, err: watch.Err}, nil
+		},
+	})
+}
+
+// watchStatistics WatchStatistics を watchResults と同じように watchdog 付きで購読する
+func (thisClient *tClientWrap) watchStatistics(ctx context.Context, chNotice chan<- tCliMsg, pingerID uint32) (*tStatisticsStream, error) {
+	return watchStream(ctx, thisClient.config, chNotice, pingerID, tStreamSource[pingclient.Statistics]{
+		kind:     "statistics",
+		unit:     "statistics",
+		interval: pingclient.StatisticsInterval,
+		expected: pingclient.ExpectedStatistics,
+		subscribe: func(ctx context.Context) (tSubscription[pingclient.Statistics], error) {
+			watch, err := thisClient.client.WatchStatistics(ctx, pingerID)
+			if err != nil {
+				return tSubscription[pingclient.Statistics]{}, err
+			}
+			return tSubscription[pingclient.Statistics]{info: watch.Info, c: watch.C, err: watch.Err}, nil
+		},
+	})
+}
+
+// watchStream watchResults と watchStatistics の中身
+func watchStream[T any](ctx context.Context, config Config, chNotice chan<- tCliMsg, pingerID uint32, source tStreamSource[T]) (*tStream[T], error) {
+	watchCtx, watchCtxCancel := context.WithCancel(ctx)
+	watch, err := source.subscribe(watchCtx)
+	if err != nil {
+		watchCtxCancel()
+		return nil, err
+	}
+
+	ch := make(chan T, streamBufferSize)
+	stream := &tStream[T]{
+		watchdog: pingclient.NewWatchdog(source.interval(watch.info), config.watchdogOptions(), time.Now()),
+		backoff:  pingclient.NewBackoff(config.backoffOptions()),
+		done:     make(chan struct{}),
+		Info:     watch.info,
+		C:        ch,
+	}
+	notice := tStreamNotice{chNotice: chNotice, kind: source.kind, unit: source.unit, pingerID: pingerID, interval: stream.watchdog.Interval(), expected: source.expected}
+
+	go (func() {
+		defer close(stream.done)
+		defer close(ch)
+		defer (func() { watchCtxCancel() })()
+
+		chTick, stopTick := stream.tickC()
+		defer stopTick()
+
+		subscribe := func() error {
+			watchCtxCancel()
+			watchCtx, watchCtxCancel = context.WithCancel(ctx)
+			newWatch, err := source.subscribe(watchCtx)
+			if err != nil {
+				return err
+			}
+			if err := samePinger(stream.Info, newWatch.info); err != nil {
+				return err
+			}
+			watch = newWatch
+			return nil
+		}
+
+		lastSeen := time.Now()
+		chData := watch.c
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case data, ok := <-chData:
+				if !ok {
+					cause := watch.err()
+					if cause == nil {
+						notice.ended("closed by the server")
+						return
+					}
+					if !stream.reconnect(ctx, notice, cause, lastSeen, chTick, subscribe) {
+						return
+					}
+					chData = watch.c
+					continue
+				}
+				lastSeen = time.Now()
+				if silent := stream.watchdog.Seen(time.Now()); silent > 0 {
+					notice.recovered(silent)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- data:
+				}
+			case now := <-chTick:
+				becameStale, resubscribe := stream.watchdog.Check(now)
+				if becameStale {
+					notice.stale(stream.watchdog.Silent(now))
+				}
+				if !resubscribe {
+					continue
+				}
+
+				stream.watchdog.Resubscribed(now)
+				if err := subscribe(); err != nil {
+					if !stream.reconnect(ctx, notice, err, lastSeen, chTick, subscribe) {
+						return
+					}
+				} else {
+					notice.resubscribed()
+				}
+				chData = watch.c
+			}
+		}
+	})()
+
+	return stream, nil
+}
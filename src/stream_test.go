@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+	pb "github.com/umenosuke/ping-grpc-client/proto/pingGrpc"
+)
+
+// breakingClient breaks the result stream of the first subscription after some results.
+type breakingClient struct {
+	pb.PingerClient
+
+	breakAfter int
+	breakErr   error
+	//切れた時に呼ばれる
+	onBreak func()
+
+	mu         sync.Mutex
+	subscribes int
+}
+
+type breakingStream struct {
+	pb.Pinger_GetsIcmpResultClient
+
+	breakAfter int
+	breakErr   error
+	onBreak    func()
+	received   int
+}
+
+func (thisStream *breakingStream) Recv() (*pb.IcmpResult, error) {
+	if thisStream.received >= thisStream.breakAfter {
+		if thisStream.onBreak != nil {
+			thisStream.onBreak()
+			thisStream.onBreak = nil
+		}
+		return nil, thisStream.breakErr
+	}
+	thisStream.received++
+	return thisStream.Pinger_GetsIcmpResultClient.Recv()
+}
+
+func (thisClient *breakingClient) GetsIcmpResult(ctx context.Context, in *pb.PingerID, opts ...grpc.CallOption) (pb.Pinger_GetsIcmpResultClient, error) {
+	thisClient.mu.Lock()
+	thisClient.subscribes++
+	first := thisClient.subscribes == 1
+	thisClient.mu.Unlock()
+
+	stream, err := thisClient.PingerClient.GetsIcmpResult(ctx, in, opts...)
+	if err != nil || !first {
+		return stream, err
+	}
+	return &breakingStream{Pinger_GetsIcmpResultClient: stream, breakAfter: thisClient.breakAfter, breakErr: thisClient.breakErr, onBreak: thisClient.onBreak}, nil
+}
+
+func (thisClient *breakingClient) subscribed() int {
+	thisClient.mu.Lock()
+	defer thisClient.mu.Unlock()
+	return thisClient.subscribes
+}
+
+// useBreakingClient replaces the client of env with one whose first result stream breaks with err.
+func useBreakingClient(t *testing.T, env *testEnv, err error) *breakingClient {
+	t.Helper()
+
+	conn, dialErr := env.server.Dial(context.Background())
+	if dialErr != nil {
+		t.Fatal(dialErr)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client := &breakingClient{PingerClient: pb.NewPingerClient(conn), breakAfter: 3, breakErr: err}
+	env.client.client = pingclient.NewFromPingerClient(client)
+	env.client.config.StreamReconnectMinMillisec = 50
+	env.client.config.StreamReconnectMaxMillisec = 100
+	return client
+}
+
+// noticeTexts returns the "!! {mark}" lines of the stream notices.
+func noticeTexts(msgs []tCliMsg, mark string) []string {
+	texts := make([]string, 0)
+	for _, msg := range msgs {
+		if strings.HasPrefix(msg.text, "!! "+mark) {
+			texts = append(texts, msg.text)
+		}
+	}
+	return texts
+}
+
+func TestStreamEndsOnStop(t *testing.T) {
+	env := newTestEnv(t, outputText)
+	pingerID := env.startPinger(pingclient.StartTarget{TargetIP: "192.0.2.1"})
+	time.AfterFunc(500*time.Millisecond, func() { env.client.client.Stop(context.Background(), pingerID) })
+
+	start := time.Now()
+	msgs := env.run(5*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.result(ctx, chOutPut, true, outputText, "1")
+	})
+
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("result did not end with the pinger")
+	}
+	for _, mark := range []string{"DISC", "GONE", "FAIL"} {
+		if texts := noticeTexts(msgs, mark); len(texts) != 0 {
+			t.Errorf("unexpected notice %v", texts)
+		}
+	}
+	if len(dataTexts(msgs, "R O")) == 0 || len(dataTexts(msgs, "--- 192.0.2.1")) != 1 {
+		t.Errorf("results or summary missing : %v", msgs)
+	}
+	if exitCode != 0 {
+		t.Errorf("exitCode = %d, want 0", exitCode)
+	}
+}
+
+func TestStreamReconnect(t *testing.T) {
+	env := newTestEnv(t, outputText)
+	client := useBreakingClient(t, env, status.Error(codes.Unavailable, "connection reset"))
+	env.startPinger(pingclient.StartTarget{TargetIP: "192.0.2.1"})
+
+	msgs := env.run(1500*time.Millisecond, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.result(ctx, chOutPut, true, outputText, "1")
+	})
+
+	if len(noticeTexts(msgs, "DISC")) != 1 || len(noticeTexts(msgs, "RECON")) != 1 {
+		t.Fatalf("want one DISC and one RECON : %v", msgs)
+	}
+	if client.subscribed() != 2 {
+		t.Errorf("subscribed %d times, want 2", client.subscribed())
+	}
+	if n := len(dataTexts(msgs, "R O")); n < 6 {
+		t.Errorf("got %d results, want results after reconnecting", n)
+	}
+	if exitCode != 0 {
+		t.Errorf("exitCode = %d, want 0", exitCode)
+	}
+}
+
+func TestStreamGone(t *testing.T) {
+	env := newTestEnv(t, outputText)
+	client := useBreakingClient(t, env, status.Error(codes.Unavailable, "connection reset"))
+	pingerID := env.startPinger(pingclient.StartTarget{TargetIP: "192.0.2.1"})
+
+	//切れている間に止まる
+	client.onBreak = func() {
+		if err := env.client.client.Stop(context.Background(), pingerID); err != nil {
+			t.Error(err)
+		}
+	}
+	msgs := env.run(5*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.result(ctx, chOutPut, false, outputText, "1")
+	})
+
+	if len(noticeTexts(msgs, "GONE")) != 1 {
+		t.Errorf("want GONE : %v", msgs)
+	}
+	if exitCode != exitCodePingerNotFound {
+		t.Errorf("exitCode = %d, want %d", exitCode, exitCodePingerNotFound)
+	}
+}
+
+func TestStreamGivesUp(t *testing.T) {
+	tests := []struct {
+		code      codes.Code
+		reconnect bool
+	}{
+		{code: codes.Unavailable, reconnect: true},
+		{code: codes.DeadlineExceeded, reconnect: true},
+		{code: codes.Internal, reconnect: true},
+		{code: codes.PermissionDenied},
+		{code: codes.Unauthenticated},
+		{code: codes.Unimplemented},
+		{code: codes.InvalidArgument},
+		{code: codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			env := newTestEnv(t, outputText)
+			client := useBreakingClient(t, env, status.Error(tt.code, "broken"))
+			env.startPinger(pingclient.StartTarget{TargetIP: "192.0.2.1"})
+
+			msgs := env.run(1*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+				env.client.result(ctx, chOutPut, true, outputText, "1")
+			})
+
+			if tt.reconnect {
+				if client.subscribed() != 2 || len(noticeTexts(msgs, "RECON")) != 1 {
+					t.Errorf("did not reconnect : %v", msgs)
+				}
+				return
+			}
+			if client.subscribed() != 1 || len(noticeTexts(msgs, "DISC")) != 0 {
+				t.Errorf("reconnected on %s : %v", tt.code, msgs)
+			}
+			if len(noticeTexts(msgs, "FAIL")) != 1 {
+				t.Errorf("want FAIL : %v", msgs)
+			}
+			if exitCode != 0 {
+				t.Errorf("exitCode = %d, want 0", exitCode)
+			}
+		})
+	}
+}
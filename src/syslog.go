@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+	"github.com/umenosuke/ping-grpc-client/pkg/syslog"
+)
+
+// tSyslogSender 結果と状態変化を syslog へ送る
+// 送信で結果の受信が止まらないよう別のgoroutineで送り、溜まりすぎたら捨てる
+// nil の時は何もしない
+type tSyslogSender struct {
+	writer   *syslog.Writer
+	facility syslog.Facility
+	hostname string
+	appName  string
+	procID   string
+	sdID     string
+	timeout  time.Duration
+
+	sendResult bool
+	sendEvent  bool
+
+	chMessage chan syslog.Message
+	chDone    chan struct{}
+	dropped   uint64
+}
+
+// newSyslogSender SyslogAddress が無ければ nil を返す
+func (thisClient *tClientWrap) newSyslogSender() (*tSyslogSender, error) {
+	config := thisClient.config
+	if config.SyslogAddress == "" {
+		return nil, nil
+	}
+
+	facility, err := syslog.ParseFacility(config.SyslogFacility)
+	if err != nil {
+		return nil, err
+	}
+	writerOptions, err := config.syslogWriterOptions()
+	if err != nil {
+		return nil, err
+	}
+	writer, err := syslog.NewWriter(writerOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname := config.SyslogHostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	sender := &tSyslogSender{
+		writer:     writer,
+		facility:   facility,
+		hostname:   hostname,
+		appName:    config.SyslogAppName,
+		procID:     strconv.Itoa(os.Getpid()),
+		sdID:       config.SyslogSDID,
+		timeout:    time.Duration(config.SyslogTimeoutSec) * time.Second,
+		sendResult: config.SyslogResult,
+		sendEvent:  config.SyslogEvent,
+		chMessage:  make(chan syslog.Message, 1000),
+		chDone:     make(chan struct{}),
+	}
+	go sender.run()
+
+	return sender, nil
+}
+
+func (thisSender *tSyslogSender) run() {
+	defer close(thisSender.chDone)
+
+	failing := false
+	for m := range thisSender.chMessage {
+		if err := thisSender.writer.Write(m); err != nil {
+			if !failing {
+				logger.Log(labelinglog.FlgError, "syslog "+err.Error())
+				failing = true
+			}
+			continue
+		}
+		if failing {
+			logger.Log(labelinglog.FlgWarn, "syslog recovered")
+			failing = false
+		}
+	}
+}
+
+func (thisSender *tSyslogSender) send(m syslog.Message) {
+	m.Facility = thisSender.facility
+	m.Hostname = thisSender.hostname
+	m.AppName = thisSender.appName
+	m.ProcID = thisSender.procID
+
+	select {
+	case thisSender.chMessage <- m:
+	default:
+		atomic.AddUint64(&thisSender.dropped, 1)
+	}
+}
+
+func (thisSender *tSyslogSender) result(r pingclient.Result) {
+	if thisSender == nil || !thisSender.sendResult {
+		return
+	}
+	thisSender.send(syslog.ResultMessage(thisSender.sdID, r))
+}
+
+func (thisSender *tSyslogSender) event(e pingclient.Event) {
+	if thisSender == nil || !thisSender.sendEvent {
+		return
+	}
+	thisSender.send(syslog.EventMessage(thisSender.sdID, e))
+}
+
+// close 残りを送って終わる、送れない場合も長くは待たない
+func (thisSender *tSyslogSender) close() {
+	if thisSender == nil {
+		return
+	}
+
+	close(thisSender.chMessage)
+	select {
+	case <-thisSender.chDone:
+	case <-time.After(thisSender.timeout + time.Second):
+	}
+	thisSender.writer.Close()
+
+	if dropped := atomic.LoadUint64(&thisSender.dropped); dropped > 0 {
+		logger.Log(labelinglog.FlgWarn, fmt.Sprintf("syslog: %d messages dropped (queue full)", dropped))
+	}
+}
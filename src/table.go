@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/width"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+const tableRedrawInterval = time.Second
+
+const tableDefaultWidth = 120
+
+type tTableSortKey struct {
+	key  string
+	name string
+	less func(a, b pingclient.TargetStats) bool
+}
+
+var tableSortKeys = []tTableSortKey{
+	{key: "n", name: "order", less: func(a, b pingclient.TargetStats) bool { return false }},
+	{key: "i", name: "ip", less: func(a, b pingclient.TargetStats) bool {
+		return bytes.Compare(net.ParseIP(a.Target.TargetBinIP).To16(), net.ParseIP(b.Target.TargetBinIP).To16()) < 0
+	}},
+	{key: "l", name: "loss", less: func(a, b pingclient.TargetStats) bool { return a.LossPercent > b.LossPercent }},
+	{key: "r", name: "last", less: func(a, b pingclient.TargetStats) bool { return tableLastSortValue(a) > tableLastSortValue(b) }},
+	{key: "a", name: "avg", less: func(a, b pingclient.TargetStats) bool { return a.Avg > b.Avg }},
+	{key: "b", name: "best", less: func(a, b pingclient.TargetStats) bool { return a.Min > b.Min }},
+	{key: "w", name: "worst", less: func(a, b pingclient.TargetStats) bool { return a.Max > b.Max }},
+	{key: "s", name: "stdev", less: func(a, b pingclient.TargetStats) bool { return a.MDev > b.MDev }},
+}
+
+// tableLastSortValue 応答が無かったものを最も遅い扱いにする
+func tableLastSortValue(s pingclient.TargetStats) time.Duration {
+	switch s.LastType {
+	case pingclient.ResultTypeReceive, pingclient.ResultTypeReceiveAfterTimeout:
+		return s.LastRTT
+	case pingclient.ResultTypeUnknown:
+		return -1
+	default:
+		return time.Duration(1<<63 - 1)
+	}
+}
+
+// table 対象ごとに1行の表を同じ位置に再描画し続ける
+func (thisClient *tClientWrap) table(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string, chKey <-chan string) {
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
+		return
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	watch, err := thisClient.watchResults(childCtx, nil, id)
+	if err != nil {
+		if status.Code(err) == codes.Canceled {
+			return
+		}
+		if streamErr(err) {
+			exitCode = exitCodePingerNotFound
+		}
+		return
+	}
+
+	aggregator := pingclient.NewAggregator(watch.Info)
+	sortKey := tableSortKeys[0]
+	ticker := time.NewTicker(tableRedrawInterval)
+	defer ticker.Stop()
+
+	chOutPut <- tCliMsg{
+		text:    "\x1b[2J",
+		color:   cliColorDefault,
+		noBreak: true,
+		data:    true,
+	}
+	redraw := func() {
+		//端末の大きさは描く度に確かめる
+		screenWidth, screenHeight := tableSize()
+		chOutPut <- tCliMsg{
+			text:    renderTable(watch.Info, aggregator.Snapshot(), sortKey, time.Now(), watch.silent(), screenWidth, screenHeight),
+			color:   cliColorDefault,
+			noBreak: true,
+			data:    true,
+		}
+	}
+	redraw()
+
+loop:
+	for {
+		select {
+		case result, ok := <-watch.C:
+			if !ok {
+				break loop
+			}
+			aggregator.Add(result)
+		case <-ticker.C:
+			redraw()
+		case key, ok := <-chKey:
+			if !ok {
+				chKey = nil
+				continue
+			}
+			key = strings.ToLower(strings.Trim(key, " \t\r\n"))
+			if key == "q" {
+				childCtxCancel()
+				continue
+			}
+			for _, k := range tableSortKeys {
+				if k.key == key {
+					sortKey = k
+					redraw()
+				}
+			}
+		}
+	}
+	if streamErr(watch.Err()) {
+		exitCode = exitCodePingerNotFound
+	}
+
+	redraw()
+	chOutPut <- tCliMsg{
+		text:    "",
+		color:   cliColorDefault,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+// tableSize 端末の大きさ、取れなければ COLUMNS と LINES、高さが分からなければ0
+func tableSize() (int, int) {
+	screenWidth, screenHeight := terminalSize()
+	if screenWidth <= 0 {
+		if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+			screenWidth = w
+		} else {
+			screenWidth = tableDefaultWidth
+		}
+	}
+	if screenHeight <= 0 {
+		if h, err := strconv.Atoi(os.Getenv("LINES")); err == nil && h > 0 {
+			screenHeight = h
+		}
+	}
+	return screenWidth, screenHeight
+}
+
+// renderTable silent が0でなければ結果が届いていないことを見出しに出す
+// 幅と高さに収まるよう切り詰める、screenHeight が0なら全ての対象を出す
+func renderTable(info pingclient.PingerInfo, snapshot []pingclient.TargetStats, sortKey tTableSortKey, now time.Time, silent time.Duration, screenWidth int, screenHeight int) string {
+	sort.SliceStable(snapshot, func(i, j int) bool { return sortKey.less(snapshot[i], snapshot[j]) })
+
+	keys := make([]string, 0, len(tableSortKeys))
+	for _, k := range tableSortKeys {
+		keys = append(keys, k.key+":"+k.name)
+	}
+
+	lines := make([]string, 0, len(snapshot)+4)
+	title := fmt.Sprintf("PingerID %d - %s - %s", info.PingerID, info.Description, now.Format("2006/01/02 15:04:05"))
+	if silent > 0 {
+		title = fmt.Sprintf("!! STALE: no results for %.0fs, values below may be outdated !! ", silent.Seconds()) + title
+	}
+	lines = append(lines, title)
+	lines = append(lines, "sort: "+sortKey.name+" ("+strings.Join(keys, " ")+" q:quit)")
+	lines = append(lines, "")
+
+	//IPv6 のアドレスでも列が揃うよう、最も長いものに合わせる
+	targetWidth := 15
+	for _, s := range snapshot {
+		if w := displayWidth(s.Target.TargetBinIP); w > targetWidth {
+			targetWidth = w
+		}
+	}
+	rowFormat := "%s %8s %8s %8s %8s %8s %6s %6s %5s %5s"
+	header := fmt.Sprintf(rowFormat, padCells("Target", targetWidth), "Last", "Avg", "Best", "Worst", "StDev", "Loss%", "Sent", "Late", "TTL")
+	commentWidth := screenWidth - displayWidth(header) - 2
+	if commentWidth >= 8 {
+		header += "  Comment"
+	}
+	lines = append(lines, header)
+
+	//最後の行の改行で画面がスクロールしないよう、高さより1行少なく出す
+	rows := len(snapshot)
+	if screenHeight > 0 && len(lines)+rows > screenHeight-1 {
+		rows = screenHeight - 1 - len(lines) - 1
+		if rows < 0 {
+			rows = 0
+		}
+	}
+	for _, s := range snapshot[:rows] {
+		row := fmt.Sprintf(rowFormat,
+			padCells(s.Target.TargetBinIP, targetWidth),
+			tableLast(s),
+			tableMillisec(s.Avg, s.Received),
+			tableMillisec(s.Min, s.Received),
+			tableMillisec(s.Max, s.Received),
+			tableMillisec(s.MDev, s.Received),
+			fmt.Sprintf("%.1f", s.LossPercent),
+			strconv.FormatInt(s.Sent, 10),
+			strconv.FormatInt(s.Late, 10),
+			strconv.FormatInt(s.TTLExceeded, 10),
+		)
+		if commentWidth >= 8 {
+			row += "  " + truncateCells(targetComment(s.Target), commentWidth)
+		}
+		lines = append(lines, row)
+	}
+	if rows < len(snapshot) {
+		lines = append(lines, fmt.Sprintf("+%d more", len(snapshot)-rows))
+	}
+
+	str := "\x1b[H"
+	for _, line := range lines {
+		str += truncateCells(line, screenWidth) + "\x1b[K\n"
+	}
+	str += "\x1b[J"
+
+	return str
+}
+
+func tableMillisec(d time.Duration, received int64) string {
+	if received == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", durationMillisec(d))
+}
+
+func tableLast(s pingclient.TargetStats) string {
+	switch s.LastType {
+	case pingclient.ResultTypeReceive:
+		return fmt.Sprintf("%.1f", durationMillisec(s.LastRTT))
+	case pingclient.ResultTypeReceiveAfterTimeout:
+		return fmt.Sprintf("%.0f?", durationMillisec(s.LastRTT))
+	case pingclient.ResultTypeTTLExceeded:
+		return "ttl"
+	case pingclient.ResultTypeTimeout:
+		return "timeout"
+	default:
+		return "-"
+	}
+}
+
+// runeWidth 端末での表示幅、全角は2
+func runeWidth(r rune) int {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func displayWidth(str string) int {
+	w := 0
+	for _, r := range str {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// truncateCells 表示幅が cells に収まるよう切り詰める
+func truncateCells(str string, cells int) string {
+	w := 0
+	for i, r := range str {
+		w += runeWidth(r)
+		if w > cells {
+			return str[:i]
+		}
+	}
+	return str
+}
+
+// padCells 表示幅が cells になるよう右を空白で埋める
+func padCells(str string, cells int) string {
+	if w := displayWidth(str); w < cells {
+		return str + strings.Repeat(" ", cells-w)
+	}
+	return str
+}
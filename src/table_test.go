@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+func TestTruncateCells(t *testing.T) {
+	tests := []struct {
+		str   string
+		cells int
+		want  string
+	}{
+		{str: "router", cells: 10, want: "router"},
+		{str: "router", cells: 3, want: "rou"},
+		{str: "本社ルーター", cells: 12, want: "本社ルーター"},
+		{str: "本社ルーター", cells: 5, want: "本社"},
+		{str: "本社 router", cells: 6, want: "本社 r"},
+		{str: "ｱｲｳ", cells: 2, want: "ｱｲ"},
+		{str: "router", cells: 0, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := truncateCells(tt.str, tt.cells); got != tt.want {
+			t.Errorf("truncateCells(%q, %d) = %q, want %q", tt.str, tt.cells, got, tt.want)
+		}
+	}
+}
+
+func TestRenderTable(t *testing.T) {
+	snapshot := make([]pingclient.TargetStats, 0, 200)
+	for i := 0; i < 200; i++ {
+		target := pingclient.Target{TargetID: uint32(i + 1), TargetIP: fmt.Sprintf("192.0.2.%d", i), TargetBinIP: fmt.Sprintf("192.0.2.%d", i), Comment: "本社ルーター"}
+		snapshot = append(snapshot, pingclient.TargetStats{Target: target, Sent: 10, Received: 10})
+	}
+	snapshot[1].Target.TargetBinIP = "2001:db8::1234:5678"
+	info := pingclient.PingerInfo{PingerID: 1, Description: "core"}
+
+	render := func(width int, height int) []string {
+		str := renderTable(info, append([]pingclient.TargetStats(nil), snapshot...), tableSortKeys[0], time.Now(), 0, width, height)
+		str = strings.TrimPrefix(str, "\x1b[H")
+		str = strings.TrimSuffix(str, "\x1b[J")
+		return strings.Split(strings.TrimSuffix(str, "\x1b[K\n"), "\x1b[K\n")
+	}
+
+	lines := render(120, 24)
+	if len(lines) != 23 {
+		t.Fatalf("got %d lines on 24 rows, want 23", len(lines))
+	}
+	if last := lines[len(lines)-1]; last != "+182 more" {
+		t.Errorf("last line = %q", last)
+	}
+	for _, line := range lines {
+		if w := displayWidth(line); w > 120 {
+			t.Errorf("line is %d cells wide : %q", w, line)
+		}
+	}
+	// IPv6 のアドレスがあっても次の列の位置は同じ
+	if i, j := strings.Index(lines[4], " -"), strings.Index(lines[5], " -"); i != j || i < len("2001:db8::1234:5678") {
+		t.Errorf("columns not aligned\n%s\n%s", lines[4], lines[5])
+	}
+	if !strings.HasSuffix(lines[4], "  本社ルーター") {
+		t.Errorf("comment = %q", lines[4])
+	}
+
+	if lines := render(100, 0); len(lines) != 4+200 {
+		t.Errorf("got %d lines without height, want every target", len(lines))
+	}
+}
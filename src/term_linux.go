@@ -0,0 +1,40 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalSize 標準出力の端末の幅と高さ、端末でなければ0
+func terminalSize() (int, int) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0
+	}
+	return int(ws.Col), int(ws.Row)
+}
+
+// enableKeyInput 標準入力をEnter無しで1文字ずつ読めるようにする
+// Ctrl+C はシグナルのまま残す
+func enableKeyInput() (func(), error) {
+	fd := int(os.Stdin.Fd())
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return func() {}, err
+	}
+
+	raw := *termios
+	raw.Lflag &^= unix.ICANON | unix.ECHO
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return func() {}, err
+	}
+
+	return func() {
+		unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	}, nil
+}
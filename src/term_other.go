@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// terminalSize 標準出力の端末の幅と高さ、取得できなければ0
+func terminalSize() (int, int) {
+	return 0, 0
+}
+
+// enableKeyInput この環境では未対応、キーはEnterと一緒に入力する
+func enableKeyInput() (func(), error) {
+	return func() {}, errors.New("key input is not supported on this platform")
+}
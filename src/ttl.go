@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/umenosuke/labelinglog"
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+const defaultTTLPrintInterval = 10 * time.Second
+
+// tTTLRecord is a line of "ttl" and the ttl summary of "result" in structured output
+type tTTLRecord struct {
+	Kind                       string           `json:"Kind"`
+	PingerID                   uint32           `json:"PingerID"`
+	TargetID                   uint32           `json:"TargetID"`
+	TargetIP                   string           `json:"TargetIP"`
+	FQDN                       string           `json:"FQDN"`
+	Comment                    string           `json:"Comment"`
+	Decided                    int64            `json:"Decided"`
+	TTLExceeded                int64            `json:"TTLExceeded"`
+	TTLExceededPercent         float64          `json:"TTLExceededPercent"`
+	RecentCount                int              `json:"RecentCount"`
+	RecentTTLExceeded          int              `json:"RecentTTLExceeded"`
+	Consecutive                int64            `json:"Consecutive"`
+	Persistent                 bool             `json:"Persistent"`
+	PersistentSinceUnixNanosec int64            `json:"PersistentSinceUnixNanosec"`
+	Peers                      []tTTLPeerRecord `json:"Peers"`
+}
+
+type tTTLPeerRecord struct {
+	PeerIP           string `json:"PeerIP"`
+	Count            int64  `json:"Count"`
+	FirstUnixNanosec int64  `json:"FirstUnixNanosec"`
+	LastUnixNanosec  int64  `json:"LastUnixNanosec"`
+}
+
+func ttlExceededPercent(s pingclient.TargetTTLStats) float64 {
+	if s.Decided == 0 {
+		return 0
+	}
+	return float64(s.TTLExceeded) * 100 / float64(s.Decided)
+}
+
+func newTTLRecord(kind string, pingerID uint32, s pingclient.TargetTTLStats) tTTLRecord {
+	record := tTTLRecord{
+		Kind:               kind,
+		PingerID:           pingerID,
+		TargetID:           s.Target.TargetID,
+		TargetIP:           s.Target.TargetBinIP,
+		FQDN:               s.Target.FQDN(),
+		Comment:            s.Target.Comment,
+		Decided:            s.Decided,
+		TTLExceeded:        s.TTLExceeded,
+		TTLExceededPercent: ttlExceededPercent(s),
+		RecentCount:        s.RecentCount,
+		RecentTTLExceeded:  s.RecentTTLExceeded,
+		Consecutive:        s.Consecutive,
+		Persistent:         s.Persistent,
+		Peers:              make([]tTTLPeerRecord, 0, len(s.Peers)),
+	}
+	if s.Persistent {
+		record.PersistentSinceUnixNanosec = s.PersistentSince.UnixNano()
+	}
+	for _, p := range s.Peers {
+		record.Peers = append(record.Peers, tTTLPeerRecord{
+			PeerIP:           p.PeerIP,
+			Count:            p.Count,
+			FirstUnixNanosec: p.First.UnixNano(),
+			LastUnixNanosec:  p.Last.UnixNano(),
+		})
+	}
+	return record
+}
+
+func ttlPeersString(s pingclient.TargetTTLStats) string {
+	str := ""
+	for i, p := range s.Peers {
+		if i > 0 {
+			str += ", "
+		}
+		str += p.PeerIP
+	}
+	return str
+}
+
+// ttlChangeMsg TTL Exceeded が続き始めた/止んだ
+func ttlChangeMsg(c pingclient.TTLChange) tCliMsg {
+	s := c.Stats
+	if s.Persistent {
+		return tCliMsg{
+			text: fmt.Sprintf("L LOOP  - %s - %15s - %d/%d recent ttl exceeded from %s, likely routing loop - %s",
+				c.Time.Format("2006/01/02 15:04:05.000"),
+				s.Target.TargetBinIP,
+				s.RecentTTLExceeded,
+				s.RecentCount,
+				ttlPeersString(s),
+				targetComment(s.Target),
+			),
+			color:   cliColorRed,
+			noBreak: false,
+			data:    true,
+		}
+	}
+
+	return tCliMsg{
+		text: fmt.Sprintf("L CLEAR - %s - %15s - %d/%d recent ttl exceeded - %s",
+			c.Time.Format("2006/01/02 15:04:05.000"),
+			s.Target.TargetBinIP,
+			s.RecentTTLExceeded,
+			s.RecentCount,
+			targetComment(s.Target),
+		),
+		color:   cliColorGreen,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+// ttlTargetMsg 1対象の TTL Exceeded の集計と回答したルーター
+func ttlTargetMsg(s pingclient.TargetTTLStats) tCliMsg {
+	strColor := cliColorDefault
+	state := ""
+	if s.Persistent {
+		strColor = cliColorRed
+		state = fmt.Sprintf(", PERSISTENT since %s", s.PersistentSince.Format("2006/01/02 15:04:05.000"))
+	} else if s.TTLExceeded > 0 {
+		strColor = cliColorYellow
+	}
+
+	str := fmt.Sprintf("%15s - %d/%d ttl exceeded (%.1f%%), recent %d/%d, consecutive %d%s - %s",
+		s.Target.TargetBinIP,
+		s.TTLExceeded,
+		s.Decided,
+		ttlExceededPercent(s),
+		s.RecentTTLExceeded,
+		s.RecentCount,
+		s.Consecutive,
+		state,
+		targetComment(s.Target),
+	)
+	for _, p := range s.Peers {
+		str += fmt.Sprintf("\n%15s   from %-15s : %d (first %s, last %s)",
+			"",
+			p.PeerIP,
+			p.Count,
+			p.First.Format("15:04:05.000"),
+			p.Last.Format("15:04:05.000"),
+		)
+	}
+
+	return tCliMsg{
+		text:    str,
+		color:   strColor,
+		noBreak: false,
+		data:    true,
+	}
+}
+
+// printTTLReport onlyExceeded なら TTL Exceeded があった対象のみ
+func (thisClient *tClientWrap) printTTLReport(chOutPut chan<- tCliMsg, output tOutputFormat, kind string, pingerID uint32, snapshot []pingclient.TargetTTLStats, onlyExceeded bool) {
+	targets := make([]pingclient.TargetTTLStats, 0, len(snapshot))
+	for _, s := range snapshot {
+		if !onlyExceeded || s.TTLExceeded > 0 {
+			targets = append(targets, s)
+		}
+	}
+
+	if output.isStructured() {
+		for _, s := range targets {
+			chOutPut <- recordMsg(output, newTTLRecord(kind, pingerID, s))
+		}
+		return
+	}
+
+	if onlyExceeded && len(targets) == 0 {
+		return
+	}
+	chOutPut <- tCliMsg{
+		text:    "--- ttl exceeded report --- " + time.Now().Format("2006/01/02 15:04:05.000"),
+		color:   cliColorDefault,
+		noBreak: false,
+		data:    true,
+	}
+	for _, s := range targets {
+		chOutPut <- ttlTargetMsg(s)
+	}
+}
+
+func (thisClient *tClientWrap) ttl(ctx context.Context, chOutPut chan<- tCliMsg, pingerID string, intervalStr string) {
+	id, ok := thisClient.parsePingerID(chOutPut, pingerID)
+	if !ok {
+		return
+	}
+
+	interval := defaultTTLPrintInterval
+	if intervalStr != "" {
+		d, err := time.ParseDuration(intervalStr)
+		if err != nil || d <= 0 {
+			logger.Log(labelinglog.FlgError, "parse error : \""+intervalStr+"\"")
+			chOutPut <- tCliMsg{
+				text:    "\"interval\" is please enter a duration (e.g. 30s)",
+				color:   cliColorDefault,
+				noBreak: false,
+			}
+			return
+		}
+		interval = d
+	}
+
+	childCtx, childCtxCancel := thisClient.foregroundCtx(ctx, false)
+	defer childCtxCancel()
+
+	watch, err := thisClient.watchResults(childCtx, chOutPut, id)
+	if err != nil {
+		if status.Code(err) == codes.Canceled {
+			return
+		}
+		if streamErr(err) {
+			exitCode = exitCodePingerNotFound
+		}
+		return
+	}
+	thisClient.printInfo(chOutPut, watch.Info)
+
+	analyzer := pingclient.NewTTLAnalyzer(watch.Info, thisClient.config.ttlAnalyzerOptions())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case result, ok := <-watch.C:
+			if !ok {
+				break loop
+			}
+			if c, ok := analyzer.Add(result); ok {
+				thisClient.printTTLChange(chOutPut, thisClient.output, c)
+			}
+		case <-ticker.C:
+			thisClient.printTTLReport(chOutPut, thisClient.output, "ttl", id, analyzer.Snapshot(), false)
+		}
+	}
+	if streamErr(watch.Err()) {
+		exitCode = exitCodePingerNotFound
+	}
+
+	thisClient.printTTLReport(chOutPut, thisClient.output, "ttl-summary", id, analyzer.Snapshot(), false)
+}
+
+func (thisClient *tClientWrap) printTTLChange(chOutPut chan<- tCliMsg, output tOutputFormat, c pingclient.TTLChange) {
+	if output.isStructured() {
+		chOutPut <- recordMsg(output, newTTLRecord("ttl-change", c.PingerID, c.Stats))
+	} else {
+		chOutPut <- ttlChangeMsg(c)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlMarshal encodes v as YAML, following the encoding/json rules (tags, MarshalJSON).
+// Keys keep the order of the JSON and strings stay double quoted, only collections are in block style.
+func yamlMarshal(v interface{}) (string, error) {
+	jsonBlob, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	// JSONはそのままYAMLとして読める
+	node := &yaml.Node{}
+	if err := yaml.Unmarshal(jsonBlob, node); err != nil {
+		return "", err
+	}
+	yamlBlockStyle(node)
+
+	b := &bytes.Buffer{}
+	enc := yaml.NewEncoder(b)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+func yamlBlockStyle(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		node.Style = 0
+	}
+	for i, child := range node.Content {
+		// キーは必要な時だけクォートされる
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			child.Style = 0
+		}
+		yamlBlockStyle(child)
+	}
+}
+
+// yamlUnmarshal decodes a YAML (or JSON) document into v, following the encoding/json rules
+// (json tags, json.RawMessage, UnmarshalJSON).
+// A scalar is decoded as a string wherever v has a string, so "Description: 2024" is "2024".
+func yamlUnmarshal(data []byte, v interface{}) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return json.Unmarshal(trimmed, v)
+	}
+
+	node := &yaml.Node{}
+	if err := yaml.Unmarshal(data, node); err != nil {
+		return err
+	}
+
+	var value interface{}
+	if len(node.Content) > 0 {
+		var err error
+		value, err = yamlNodeValue(node.Content[0], reflect.TypeOf(v))
+		if err != nil {
+			return err
+		}
+	}
+
+	jsonBlob, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonBlob, v)
+}
+
+var jsonRawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// yamlNodeValue node を json.Marshal できる値にする、t は入れる先の型(分からなければ nil)
+func yamlNodeValue(node *yaml.Node, t reflect.Type) (interface{}, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == jsonRawMessageType || (t != nil && t.Kind() == reflect.Interface) {
+		t = nil
+	}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return yamlNodeValue(node.Alias, t)
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlNodeValue(node.Content[0], t)
+	case yaml.SequenceNode:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		values := make([]interface{}, 0, len(node.Content))
+		for _, child := range node.Content {
+			value, err := yamlNodeValue(child, elem)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case yaml.MappingNode:
+		values := make(map[string]interface{}, len(node.Content)/2)
+		if err := yamlMappingValues(node, t, values); err != nil {
+			return nil, err
+		}
+		return values, nil
+	default:
+		if node.ShortTag() == "!!null" {
+			return nil, nil
+		}
+		if t != nil && t.Kind() == reflect.String {
+			return node.Value, nil
+		}
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		if _, ok := value.(time.Time); ok {
+			return node.Value, nil
+		}
+		return value, nil
+	}
+}
+
+// yamlMappingValues node のキーと値を values に入れる、"<<" で結合されたものは先に書かれたものを優先する
+func yamlMappingValues(node *yaml.Node, t reflect.Type, values map[string]interface{}) error {
+	merges := make([]*yaml.Node, 0)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, child := node.Content[i], node.Content[i+1]
+		if key.ShortTag() == "!!merge" {
+			merges = append(merges, child)
+			continue
+		}
+		if key.Kind != yaml.ScalarNode {
+			return fmt.Errorf("yaml: line %d: unsupported key", key.Line)
+		}
+
+		value, err := yamlNodeValue(child, yamlFieldType(t, key.Value))
+		if err != nil {
+			return err
+		}
+		values[key.Value] = value
+	}
+
+	for _, merge := range merges {
+		if merge.Kind == yaml.AliasNode {
+			merge = merge.Alias
+		}
+		sources := []*yaml.Node{merge}
+		if merge.Kind == yaml.SequenceNode {
+			sources = merge.Content
+		}
+		for _, source := range sources {
+			if source.Kind == yaml.AliasNode {
+				source = source.Alias
+			}
+			if source.Kind != yaml.MappingNode {
+				return fmt.Errorf("yaml: line %d: map merge requires map or sequence of maps", merge.Line)
+			}
+			merged := make(map[string]interface{})
+			if err := yamlMappingValues(source, t, merged); err != nil {
+				return err
+			}
+			for key, value := range merged {
+				if _, ok := values[key]; !ok {
+					values[key] = value
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// yamlFieldType encoding/json と同じように key に当たる t のフィールドの型を探す
+func yamlFieldType(t reflect.Type, key string) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem()
+	case reflect.Struct:
+	default:
+		return nil
+	}
+
+	var folded reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				name = tagName
+			}
+		}
+		if name == key {
+			return field.Type
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = field.Type
+		}
+	}
+	return folded
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/umenosuke/ping-grpc-client/pkg/pingclient"
+)
+
+// yamlGoldenInfo is "info" and "start" in "-output yaml", the field names are part of the interface.
+const yamlGoldenInfo = `PingerID: 3
+Description: "core \"dc1\""
+Targets:
+  - TargetID: 1
+    TargetIP: "192.0.2.1"
+    TargetBinIP: "192.0.2.1"
+    Comment: "router: main"
+    ExpectUnreachable: false
+  - TargetID: 2
+    TargetIP: "www.example.com"
+    TargetBinIP: "198.51.100.7"
+    Comment: ""
+    ExpectUnreachable: true
+IntervalMillisec: 1000
+TimeoutMillisec: 500
+StatisticsCountsNum: 10
+StatisticsIntervalSec: 1
+StartTime: "2026-01-02T03:04:05Z"
+ExpireTime: "2026-01-02T07:04:05Z"
+`
+
+// yamlGoldenList is "list {pingerID}" in "-output yaml"
+const yamlGoldenList = `- PingerID: 3
+  Description: "core \"dc1\""
+  StartTime: "2026-01-02T03:04:05Z"
+  ExpireTime: "2026-01-02T07:04:05Z"
+- PingerID: 4
+  Description: "123"
+  StartTime: "2026-01-02T03:04:05Z"
+  ExpireTime: "2026-01-02T07:04:05Z"
+`
+
+func yamlTestInfo() pingclient.PingerInfo {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return pingclient.PingerInfo{
+		PingerID:    3,
+		Description: `core "dc1"`,
+		Targets: []pingclient.Target{
+			{TargetID: 1, TargetIP: "192.0.2.1", TargetBinIP: "192.0.2.1", Comment: "router: main"},
+			{TargetID: 2, TargetIP: "www.example.com", TargetBinIP: "198.51.100.7", ExpectUnreachable: true},
+		},
+		IntervalMillisec:      1000,
+		TimeoutMillisec:       500,
+		StatisticsCountsNum:   10,
+		StatisticsIntervalSec: 1,
+		StartTime:             start,
+		ExpireTime:            start.Add(4 * time.Hour),
+	}
+}
+
+func yamlCapture(print func(chOutPut chan<- tCliMsg)) string {
+	ch := make(chan tCliMsg, 10)
+	print(ch)
+	close(ch)
+
+	str := ""
+	for msg := range ch {
+		str += msg.text
+	}
+	return str
+}
+
+func TestYAMLMarshalInfo(t *testing.T) {
+	client := &tClientWrap{output: outputYAML}
+	got := yamlCapture(func(chOutPut chan<- tCliMsg) { client.printInfoData(chOutPut, yamlTestInfo()) })
+	if got != yamlGoldenInfo {
+		t.Errorf("info yaml =\n%s\nwant\n%s", got, yamlGoldenInfo)
+	}
+}
+
+func TestYAMLMarshalList(t *testing.T) {
+	info := yamlTestInfo()
+	pingers := []pingclient.PingerSummary{
+		{PingerID: 3, Description: info.Description, StartTime: info.StartTime, ExpireTime: info.ExpireTime},
+		{PingerID: 4, Description: "123", StartTime: info.StartTime, ExpireTime: info.ExpireTime},
+	}
+
+	client := &tClientWrap{output: outputYAML}
+	got := yamlCapture(func(chOutPut chan<- tCliMsg) { client.printListData(chOutPut, pingers) })
+	if got != yamlGoldenList {
+		t.Errorf("list yaml =\n%s\nwant\n%s", got, yamlGoldenList)
+	}
+
+	got = yamlCapture(func(chOutPut chan<- tCliMsg) { client.printListData(chOutPut, []pingclient.PingerSummary{}) })
+	if got != "[]\n" {
+		t.Errorf("empty list yaml = %q", got)
+	}
+}
+
+func TestYAMLMarshalStart(t *testing.T) {
+	env := newTestEnv(t, outputYAML)
+	msgs := env.run(5*time.Second, func(ctx context.Context, chOutPut chan<- tCliMsg) {
+		env.client.start(ctx, chOutPut, `core "dc1"`, []pingclient.StartTarget{
+			{TargetIP: "192.0.2.1", Comment: "router: main"},
+			{TargetIP: "www.example.com", ExpectUnreachable: true},
+		})
+	})
+
+	got := ""
+	for _, msg := range msgs {
+		if msg.data {
+			got += msg.text
+		}
+	}
+
+	// 時刻と設定値以外は info と同じ
+	normalize := regexp.MustCompile(`(?m)^(PingerID|IntervalMillisec|TimeoutMillisec|StatisticsCountsNum|StatisticsIntervalSec|StartTime|ExpireTime|    TargetBinIP): .*$`)
+	if normalize.ReplaceAllString(got, "$1: -") != normalize.ReplaceAllString(yamlGoldenInfo, "$1: -") {
+		t.Errorf("start yaml =\n%s\nwant the form of\n%s", got, yamlGoldenInfo)
+	}
+}
+
+func TestYAMLUnmarshal(t *testing.T) {
+	type tNested struct {
+		Name  string   `json:"Name"`
+		Lines []string `json:"Lines"`
+	}
+	type tDoc struct {
+		Description string            `json:"Description"`
+		Count       uint64            `json:"Count"`
+		Ratio       *float64          `json:"Ratio"`
+		Enabled     bool              `json:"Enabled"`
+		Items       []tNested         `json:"Items"`
+		Labels      map[string]string `json:"Labels"`
+		Raw         json.RawMessage   `json:"Raw"`
+		Any         interface{}       `json:"Any"`
+		Ignored     string            `json:"-"`
+		lower       string
+	}
+	ratio := 0.5
+
+	tests := []struct {
+		name    string
+		yaml    string
+		want    tDoc
+		wantErr bool
+	}{
+		{
+			name: "block mapping and sequence with comments",
+			yaml: "# head\nDescription: core # tail\nCount: 3\nItems:\n  - Name: a\n    Lines:\n      - 192.0.2.1 router\n      - \"! 192.0.2.9 # closed\"\n  - Name: b\n",
+			want: tDoc{Description: "core", Count: 3, Items: []tNested{{Name: "a", Lines: []string{"192.0.2.1 router", "! 192.0.2.9 # closed"}}, {Name: "b"}}},
+		},
+		{
+			name: "scalars into string fields stay strings",
+			yaml: "Description: 2024\nLabels: {year: 2024, on: true, date: 2026-01-02, none: ~}\nItems: [{Name: 0x10}]\n",
+			want: tDoc{Description: "2024", Labels: map[string]string{"year": "2024", "on": "true", "date": "2026-01-02", "none": ""}, Items: []tNested{{Name: "0x10"}}},
+		},
+		{
+			name: "timestamp and float",
+			yaml: "Description: 2026-01-02T03:04:05Z\nRatio: 0.5\nEnabled: true\n",
+			want: tDoc{Description: "2026-01-02T03:04:05Z", Ratio: &ratio, Enabled: true},
+		},
+		{
+			name: "block scalars",
+			yaml: "Description: |\n  line1\n  line2\nItems:\n  - Name: >-\n      folded\n      text\n",
+			want: tDoc{Description: "line1\nline2\n", Items: []tNested{{Name: "folded text"}}},
+		},
+		{
+			name: "nested flow collections",
+			yaml: "Items: [{Name: a, Lines: [x, \"y, z\"]}, {Name: b, Lines: []}]\n",
+			want: tDoc{Items: []tNested{{Name: "a", Lines: []string{"x", "y, z"}}, {Name: "b", Lines: []string{}}}},
+		},
+		{
+			name: "raw message and interface keep yaml types",
+			yaml: "Raw:\n  IntervalMillisec: 500\n  Webhooks: [{URL: \"http://127.0.0.1/\", Template: generic}]\nAny: [1, two, {three: 3.5}]\n",
+			want: tDoc{
+				Raw: json.RawMessage(`{"IntervalMillisec":500,"Webhooks":[{"Template":"generic","URL":"http://127.0.0.1/"}]}`),
+				Any: []interface{}{float64(1), "two", map[string]interface{}{"three": 3.5}},
+			},
+		},
+		{
+			name: "anchors, aliases and merge keys",
+			yaml: "base: &base\n  Name: shared\n  Lines: [x]\nItems:\n  - *base\n  - <<: *base\n    Name: own\n",
+			want: tDoc{Items: []tNested{{Name: "shared", Lines: []string{"x"}}, {Name: "own", Lines: []string{"x"}}}},
+		},
+		{
+			name: "keys match case insensitively like encoding/json, json:\"-\" is skipped",
+			yaml: "description: lower\ncount: 1\nIgnored: x\n",
+			want: tDoc{Description: "lower", Count: 1},
+		},
+		{
+			name: "json document",
+			yaml: "  {\"Description\": \"json\", \"Count\": 2}\n",
+			want: tDoc{Description: "json", Count: 2},
+		},
+		{
+			name: "empty document",
+			yaml: "# nothing\n",
+			want: tDoc{},
+		},
+		{
+			name:    "string into number",
+			yaml:    "Count: many\n",
+			wantErr: true,
+		},
+		{
+			name:    "tab indent",
+			yaml:    "Items:\n\t- Name: a\n",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed flow",
+			yaml:    "Items: [a, b\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got tDoc
+			err := yamlUnmarshal([]byte(tt.yaml), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("no error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLUnmarshalMonitors(t *testing.T) {
+	monitorsConfig := defaultMonitorsConfig()
+	err := yamlUnmarshal([]byte(`
+RetryIntervalSec: 5
+Monitors:
+  - Name: core
+    Description: 2024
+    Targets:
+      - 192.0.2.1 router
+    Config:
+      IntervalMillisec: 500
+`), &monitorsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if monitorsConfig.RecreateBeforeSec != 600 || monitorsConfig.RetryIntervalSec != 5 || len(monitorsConfig.Monitors) != 1 {
+		t.Fatalf("monitors = %+v", monitorsConfig)
+	}
+	m := monitorsConfig.Monitors[0]
+	if m.Name != "core" || m.Description != "2024" || len(m.Targets) != 1 {
+		t.Errorf("monitor = %+v", m)
+	}
+	config, err := configOverride(DefaultConfig(), m.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.IntervalMillisec != 500 || config.TimeoutMillisec != DefaultConfig().TimeoutMillisec {
+		t.Errorf("config override = %d/%d", config.IntervalMillisec, config.TimeoutMillisec)
+	}
+}
+
+func TestTableInfo(t *testing.T) {
+	client := &tClientWrap{output: outputTable}
+	got := yamlCapture(func(chOutPut chan<- tCliMsg) { client.printInfoData(chOutPut, yamlTestInfo()) })
+
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^TargetID +TargetIP +TargetBinIP +ExpectUnreachable +Comment$`),
+		regexp.MustCompile(`(?m)^1 +192\.0\.2\.1 +192\.0\.2\.1 +false +router: main$`),
+		regexp.MustCompile(`(?m)^2 +www\.example\.com +198\.51\.100\.7 +true *$`),
+	}
+	for _, re := range want {
+		if !re.MatchString(got) {
+			t.Errorf("table info does not match %s :\n%s", re, got)
+		}
+	}
+}